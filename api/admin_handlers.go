@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/InVisionApp/rye"
+	"github.com/gorilla/mux"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+)
+
+type RestoreRequest struct {
+	Version int64 `json:"version"`
+}
+
+// @Summary Lists the changes made to a foo
+// @Description Newest first by default. Filter with `filter[action]`, `filter[actor]`, `filter[version][op]` and `filter[timestamp][op]`; sort on version or timestamp.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Foo ID"
+// @Param limit query int false "Page size" default(50)
+// @Param cursor query string false "Opaque cursor taken from links.next or links.prev"
+// @Success 200 {object} api.ListResponseJSON "A page of audit entries"
+// @Failure 400 {object} api.QueryErrorJSON "Invalid query parameters"
+// @Router /admin/v1/foos/{id}/history [get]
+func (a *API) fooHistoryHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	q, resp := a.parseListQuery(rw, r, dalutil.AuditListSpec)
+	if resp != nil {
+		return resp
+	}
+
+	entries, info, err := a.Deps.FooDAL.FooHistory(r.Context(), mux.Vars(r)["id"], q, a.Deps.Cursors)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return writeList(rw, r, entries, info)
+}
+
+// @Summary Restores a prior version of a foo
+// @Description The restored content is saved as a new version; deleted foos are undeleted.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Foo ID"
+// @Param restore body api.RestoreRequest true "The version to restore"
+// @Success 200 {object} types.Foo "The restored foo"
+// @Failure 400 {object} rye.JSONStatus "Invalid request body"
+// @Failure 404 {object} rye.JSONStatus "No such foo or version"
+// @Failure 409 {object} rye.JSONStatus "The foo changed while being restored or the restored foo_field is taken"
+// @Router /admin/v1/foos/{id}/restore [post]
+func (a *API) restoreFooHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	req := &RestoreRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return &rye.Response{Err: fmt.Errorf("Invalid request body: %v", err), StatusCode: http.StatusBadRequest}
+	}
+
+	if req.Version < 1 {
+		return &rye.Response{Err: fmt.Errorf("Invalid request body: version must be positive"), StatusCode: http.StatusBadRequest}
+	}
+
+	foo, err := a.Deps.FooDAL.RestoreFoo(r.Context(), mux.Vars(r)["id"], req.Version)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return writeFoo(rw, foo, http.StatusOK)
+}
+
+// @Summary Lists dead lettered events
+// @Description Events the relay gave up publishing, newest first.
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Number of events" default(50)
+// @Success 200 {object} api.ListResponseJSON "Dead events"
+// @Failure 400 {object} rye.JSONStatus "Invalid limit"
+// @Router /admin/v1/events/dead [get]
+func (a *API) deadEventsHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	limit, resp := parseLimit(r)
+	if resp != nil {
+		return resp
+	}
+
+	records, err := a.Deps.Outbox.Dead(r.Context(), limit)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return writeList(rw, r, records, &dalutil.PageInfo{Limit: limit})
+}
+
+// @Summary Retries a dead lettered event
+// @Description The event is published again with a fresh set of attempts; later events of its aggregate may have been published already.
+// @Tags admin
+// @Param id path string true "Event ID"
+// @Success 204 "The event is pending again"
+// @Failure 404 {object} rye.JSONStatus "No such dead event"
+// @Router /admin/v1/events/{id}/retry [post]
+func (a *API) retryEventHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	if err := a.Deps.Outbox.Retry(r.Context(), mux.Vars(r)["id"]); err != nil {
+		return errorResponse(err)
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// parseLimit reads the limit query param of lists that are not paginated
+func parseLimit(r *http.Request) (int, *rye.Response) {
+	l := r.URL.Query().Get("limit")
+	if l == "" {
+		return dalutil.DEFAULT_PER_PAGE, nil
+	}
+
+	n, err := strconv.Atoi(l)
+	if err != nil || n < 1 || n > dalutil.MAX_PER_PAGE {
+		return 0, &rye.Response{Err: fmt.Errorf("Invalid limit: must be between 1 and %d", dalutil.MAX_PER_PAGE), StatusCode: http.StatusBadRequest}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/InVisionApp/rye"
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/dal/foo/types"
+	"github.com/dfraglabs/go-microservice-1/deps"
+	"github.com/dfraglabs/go-microservice-1/events"
+	"github.com/dfraglabs/go-microservice-1/fakes/eventoutbox"
+	"github.com/dfraglabs/go-microservice-1/fakes/foodal"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+var _ = Describe("Admin handlers", func() {
+	var (
+		api      *API
+		fakeDAL  *foodal.FakeIDAL
+		outbox   *eventoutbox.FakeIOutbox
+		router   *mux.Router
+		response *httptest.ResponseRecorder
+
+		id = "5bc9d3d2e138230001a4b1c2"
+	)
+
+	handle := func(h rye.Handler) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if resp := h(rw, r); resp != nil && !resp.StopExecution {
+				rye.WriteJSONStatus(rw, "error", resp.Error(), resp.StatusCode)
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		fakeDAL = &foodal.FakeIDAL{}
+		outbox = &eventoutbox.FakeIOutbox{}
+		api = New(config.New(), &deps.Dependencies{FooDAL: fakeDAL, Outbox: outbox, Cursors: dalutil.NewCursorCodec([]byte("secret"))}, "test")
+
+		router = mux.NewRouter()
+		router.HandleFunc("/admin/v1/foos/{id}/history", handle(api.fooHistoryHandler)).Methods("GET")
+		router.HandleFunc("/admin/v1/foos/{id}/restore", handle(api.restoreFooHandler)).Methods("POST")
+		router.HandleFunc("/admin/v1/events/dead", handle(api.deadEventsHandler)).Methods("GET")
+		router.HandleFunc("/admin/v1/events/{id}/retry", handle(api.retryEventHandler)).Methods("POST")
+
+		response = httptest.NewRecorder()
+	})
+
+	Describe("fooHistoryHandler", func() {
+		It("should return the audit entries of the foo", func() {
+			fakeDAL.FooHistoryReturns([]*dalutil.AuditEntry{{Action: dalutil.AUDIT_UPDATE, Actor: "jane", Version: 2}}, &dalutil.PageInfo{}, nil)
+
+			req := httptest.NewRequest("GET", "/admin/v1/foos/"+id+"/history?filter[actor]=jane", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+
+			_, gotID, q, _ := fakeDAL.FooHistoryArgsForCall(0)
+			Expect(gotID).To(Equal(id))
+			Expect(q.Filter).To(Equal(bson.M{"actor": bson.M{"$eq": "jane"}}))
+
+			body := &ListResponseJSON{}
+			Expect(json.Unmarshal(response.Body.Bytes(), body)).To(Succeed())
+			Expect(body.Data).To(HaveLen(1))
+		})
+
+		It("should reject fields that are not filterable", func() {
+			req := httptest.NewRequest("GET", "/admin/v1/foos/"+id+"/history?filter[after]=x", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+			Expect(fakeDAL.FooHistoryCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("restoreFooHandler", func() {
+		It("should restore the requested version", func() {
+			fakeDAL.RestoreFooStub = func(_ context.Context, _ string, v int64) (*types.Foo, error) {
+				return &types.Foo{Document: dalutil.Document{Version: 5}, Field: "old"}, nil
+			}
+
+			req := httptest.NewRequest("POST", "/admin/v1/foos/"+id+"/restore", strings.NewReader(`{"version":2}`))
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Header().Get(ETAG_HEADER)).To(Equal(`"5"`))
+
+			_, _, v := fakeDAL.RestoreFooArgsForCall(0)
+			Expect(v).To(Equal(int64(2)))
+		})
+
+		It("should 404 on unknown versions", func() {
+			fakeDAL.RestoreFooReturns(nil, errtype.KeyNotFoundErr{E: errors.New("no such version")})
+
+			req := httptest.NewRequest("POST", "/admin/v1/foos/"+id+"/restore", strings.NewReader(`{"version":9}`))
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should reject missing versions", func() {
+			req := httptest.NewRequest("POST", "/admin/v1/foos/"+id+"/restore", strings.NewReader(`{}`))
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+			Expect(fakeDAL.RestoreFooCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("requestActor", func() {
+		It("should record the actor header along with the token", func() {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(ACCESS_TOKEN_HEADER, "0123456789abcdef")
+			token := requestActor(req)
+
+			req.Header.Set(ACTOR_HEADER, "jane")
+			Expect(requestActor(req)).To(Equal("jane@" + token))
+		})
+
+		It("should fall back to a fingerprint of the token", func() {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(ACCESS_TOKEN_HEADER, "0123456789abcdef")
+
+			actor := requestActor(req)
+			Expect(actor).To(HavePrefix("token:"))
+			Expect(actor).To(HaveLen(len("token:") + TOKEN_FINGERPRINT_LEN))
+			Expect(actor).ToNot(ContainSubstring("0123456789abcdef"))
+		})
+	})
+
+	Describe("deadEventsHandler", func() {
+		It("should list dead events", func() {
+			outbox.DeadReturns([]*events.Record{{Event: *events.New(&events.FooDeleted{ID: id}, ""), Status: events.STATUS_DEAD}}, nil)
+
+			req := httptest.NewRequest("GET", "/admin/v1/events/dead?limit=10", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+
+			_, limit := outbox.DeadArgsForCall(0)
+			Expect(limit).To(Equal(10))
+
+			body := &ListResponseJSON{}
+			Expect(json.Unmarshal(response.Body.Bytes(), body)).To(Succeed())
+			Expect(body.Data).To(HaveLen(1))
+		})
+
+		It("should reject an invalid limit", func() {
+			req := httptest.NewRequest("GET", "/admin/v1/events/dead?limit=0", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+			Expect(outbox.DeadCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("retryEventHandler", func() {
+		It("should make the event pending again", func() {
+			req := httptest.NewRequest("POST", "/admin/v1/events/"+id+"/retry", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusNoContent))
+
+			_, gotID := outbox.RetryArgsForCall(0)
+			Expect(gotID).To(Equal(id))
+		})
+
+		It("should return 404 for an unknown event", func() {
+			outbox.RetryReturns(errtype.KeyNotFoundErr{E: errors.New("no dead event")})
+
+			req := httptest.NewRequest("POST", "/admin/v1/events/"+id+"/retry", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -1,20 +1,40 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"time"
 
 	hh "github.com/InVisionApp/go-health/handlers"
 	"github.com/InVisionApp/rye"
+	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
-	"github.com/newrelic/go-agent"
 	"github.com/sirupsen/logrus"
-	"github.com/gorilla/handlers"
 	"github.com/swaggo/http-swagger"
 
+	"github.com/dfraglabs/go-microservice-1/apm"
 	"github.com/dfraglabs/go-microservice-1/config"
 	"github.com/dfraglabs/go-microservice-1/deps"
 	_ "github.com/dfraglabs/go-microservice-1/docs"
+	"github.com/dfraglabs/go-microservice-1/loadshed"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	// Sent along with 503s caused by an unavailable backend
+	RETRY_AFTER_SEC = "5"
+
+	// Header carrying one of GO_MICROSERVICE_1_TOKENS
+	ACCESS_TOKEN_HEADER = "X-Access-Token"
+
+	// Optional; the end user a request is made on behalf of, recorded in the
+	// audit trail along with the token used. It is only as trustworthy as
+	// the caller sending it.
+	ACTOR_HEADER = "X-Actor"
+
+	// Hex chars of the token hash recorded as (part of) the actor
+	TOKEN_FINGERPRINT_LEN = 12
 )
 
 var log *logrus.Entry
@@ -27,6 +47,18 @@ type API struct {
 	Config  *config.Config
 	Version string
 	Deps    *deps.Dependencies
+
+	metrics     metrics.IMetrics
+	httpMetrics *metrics.HTTPMiddleware
+	tracer      apm.ITracer
+
+	// Caps the requests in flight; nil unless GO_MICROSERVICE_1_CONCURRENCY_LIMIT
+	shedder *loadshed.Limiter
+
+	// Open streams (bounded by GO_MICROSERVICE_1_STREAM_MAX_CONNECTIONS);
+	// stopping is closed on shutdown to end them
+	streams  chan struct{}
+	stopping chan struct{}
 }
 
 type APIResponseJSON struct {
@@ -37,14 +69,32 @@ type APIResponseJSON struct {
 }
 
 func New(cfg *config.Config, d *deps.Dependencies, version string) *API {
+	var m metrics.IMetrics = metrics.NewNoop()
+	if d.Metrics != nil {
+		m = d.Metrics
+	}
+
+	var t apm.ITracer = apm.NewNoop()
+	if d.Tracer != nil {
+		t = d.Tracer
+	}
+
 	return &API{
-		Config:  cfg,
-		Version: version,
-		Deps:    d,
+		Config:      cfg,
+		Version:     version,
+		Deps:        d,
+		metrics:     m,
+		httpMetrics: metrics.NewHTTPMiddleware(m),
+		tracer:      t,
+		shedder:     newLoadShedder(cfg, m),
+		streams:     make(chan struct{}, cfg.StreamMaxConnections),
+		stopping:    make(chan struct{}),
 	}
 }
 
-func (a *API) Run() error {
+// Run serves the API until ctx is done, then gives in-flight requests up to
+// GO_MICROSERVICE_1_SHUTDOWN_TIMEOUT_SEC to complete
+func (a *API) Run(ctx context.Context) error {
 	llog := log.WithField("method", "Run")
 	llog.Infof("Starting API server...")
 
@@ -55,21 +105,26 @@ func (a *API) Run() error {
 	 **************/
 
 	routes.Handle(
-		"/", http.HandlerFunc(a.homeHandler),
+		"/", a.httpMetrics.Wrap(http.HandlerFunc(a.homeHandler)),
 	).Methods("GET")
 
 	routes.Handle(
-		"/version", http.HandlerFunc(a.versionHandler),
+		"/version", a.httpMetrics.Wrap(http.HandlerFunc(a.versionHandler)),
 	).Methods("GET")
 
 	healthHandler := hh.NewJSONHandlerFunc(a.Deps.Health, map[string]interface{}{
 		"version": a.Version,
 	})
 
-	routes.Handle(newrelic.WrapHandle(a.Deps.NRApp,
-		"/healthcheck", healthHandler,
+	routes.Handle(a.tracer.WrapHandle(
+		"/healthcheck", a.httpMetrics.Wrap(healthHandler),
 	)).Methods("GET")
 
+	// Prometheus scrape endpoint (only when the prometheus metrics backend is enabled)
+	if a.Deps.Prometheus != nil {
+		routes.Handle("/metrics", a.Deps.Prometheus).Methods("GET")
+	}
+
 	// Expose API spec via /docs/index.html (requires initial `make docs` run)
 	routes.PathPrefix("/docs").HandlerFunc(
 		httpSwagger.WrapHandler,
@@ -79,12 +134,191 @@ func (a *API) Run() error {
 	 *  v1 endpoints
 	 **************/
 
+	routes.Handle(a.setupHandler("/v1/foos", []rye.Handler{
+		a.requireMongo,
+		a.authMiddleware(),
+		a.rateLimit(RATE_LIMIT_GROUP_V1),
+		a.identifyActor,
+		a.idempotent(a.createFooHandler),
+	})).Methods("POST")
+
+	routes.Handle(a.setupHandler("/v1/foos", []rye.Handler{
+		a.requireMongo,
+		a.authMiddleware(),
+		a.rateLimit(RATE_LIMIT_GROUP_V1),
+		a.listFoosHandler,
+	})).Methods("GET")
+
+	routes.Handle(a.setupHandler("/v1/foos/{id}", []rye.Handler{
+		a.requireMongo,
+		a.authMiddleware(),
+		a.rateLimit(RATE_LIMIT_GROUP_V1),
+		a.getFooHandler,
+	})).Methods("GET")
+
+	routes.Handle(a.setupHandler("/v1/foos/{id}", []rye.Handler{
+		a.requireMongo,
+		a.authMiddleware(),
+		a.rateLimit(RATE_LIMIT_GROUP_V1),
+		a.identifyActor,
+		a.idempotent(a.updateFooHandler),
+	})).Methods("PUT")
+
+	routes.Handle(a.setupHandler("/v1/foos/{id}", []rye.Handler{
+		a.requireMongo,
+		a.authMiddleware(),
+		a.rateLimit(RATE_LIMIT_GROUP_V1),
+		a.identifyActor,
+		a.idempotent(a.deleteFooHandler),
+	})).Methods("DELETE")
+
+	// Only with GO_MICROSERVICE_1_STREAM_ENABLED
+	if a.Deps.Broker != nil {
+		routes.Handle(a.setupHandler("/v1/stream", []rye.Handler{
+			a.authMiddleware(),
+			a.rateLimit(RATE_LIMIT_GROUP_V1),
+			a.streamHandler,
+		})).Methods("GET")
+	}
+
+	routes.Handle(a.setupHandler("/v1/jobs", []rye.Handler{
+		a.requireMongo,
+		a.authMiddleware(),
+		a.rateLimit(RATE_LIMIT_GROUP_V1),
+		a.idempotent(a.createJobHandler),
+	})).Methods("POST")
+
+	routes.Handle(a.setupHandler("/v1/jobs/{id}", []rye.Handler{
+		a.requireMongo,
+		a.authMiddleware(),
+		a.rateLimit(RATE_LIMIT_GROUP_V1),
+		a.getJobHandler,
+	})).Methods("GET")
+
+	routes.Handle(a.setupHandler("/v1/jobs/{id}", []rye.Handler{
+		a.requireMongo,
+		a.authMiddleware(),
+		a.rateLimit(RATE_LIMIT_GROUP_V1),
+		a.idempotent(a.cancelJobHandler),
+	})).Methods("DELETE")
+
+	/**************
+	 *  Admin endpoints
+	 **************/
+
+	if len(a.Config.AdminTokens) > 0 {
+		routes.Handle(a.setupHandler("/admin/v1/foos/{id}/history", []rye.Handler{
+			a.requireMongo,
+			a.adminMiddleware(),
+			a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+			a.fooHistoryHandler,
+		})).Methods("GET")
+
+		routes.Handle(a.setupHandler("/admin/v1/foos/{id}/restore", []rye.Handler{
+			a.requireMongo,
+			a.adminMiddleware(),
+			a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+			a.identifyActor,
+			a.idempotent(a.restoreFooHandler),
+		})).Methods("POST")
+
+		// Only with an events sink configured
+		if a.Deps.Outbox != nil {
+			routes.Handle(a.setupHandler("/admin/v1/events/dead", []rye.Handler{
+				a.requireMongo,
+				a.adminMiddleware(),
+				a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+				a.deadEventsHandler,
+			})).Methods("GET")
+
+			routes.Handle(a.setupHandler("/admin/v1/events/{id}/retry", []rye.Handler{
+				a.requireMongo,
+				a.adminMiddleware(),
+				a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+				a.idempotent(a.retryEventHandler),
+			})).Methods("POST")
+		}
+
+		// Only with GO_MICROSERVICE_1_WEBHOOKS_ENABLED
+		if a.Deps.Webhooks != nil {
+			routes.Handle(a.setupHandler("/admin/v1/webhooks", []rye.Handler{
+				a.requireMongo,
+				a.adminMiddleware(),
+				a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+				a.listWebhooksHandler,
+			})).Methods("GET")
+
+			routes.Handle(a.setupHandler("/admin/v1/webhooks", []rye.Handler{
+				a.requireMongo,
+				a.adminMiddleware(),
+				a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+				a.idempotent(a.createWebhookHandler),
+			})).Methods("POST")
+
+			routes.Handle(a.setupHandler("/admin/v1/webhooks/{id}", []rye.Handler{
+				a.requireMongo,
+				a.adminMiddleware(),
+				a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+				a.getWebhookHandler,
+			})).Methods("GET")
+
+			routes.Handle(a.setupHandler("/admin/v1/webhooks/{id}", []rye.Handler{
+				a.requireMongo,
+				a.adminMiddleware(),
+				a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+				a.idempotent(a.deleteWebhookHandler),
+			})).Methods("DELETE")
+
+			routes.Handle(a.setupHandler("/admin/v1/webhooks/{id}/enable", []rye.Handler{
+				a.requireMongo,
+				a.adminMiddleware(),
+				a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+				a.idempotent(a.enableWebhookHandler),
+			})).Methods("POST")
+
+			routes.Handle(a.setupHandler("/admin/v1/webhooks/{id}/deliveries", []rye.Handler{
+				a.requireMongo,
+				a.adminMiddleware(),
+				a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+				a.webhookDeliveriesHandler,
+			})).Methods("GET")
+
+			routes.Handle(a.setupHandler("/admin/v1/webhooks/deliveries/{id}/redeliver", []rye.Handler{
+				a.requireMongo,
+				a.adminMiddleware(),
+				a.rateLimit(RATE_LIMIT_GROUP_ADMIN),
+				a.idempotent(a.redeliverWebhookHandler),
+			})).Methods("POST")
+		}
+	}
+
 	llog.Infof("API server running on %v", a.Config.ListenAddress)
 
-	return http.ListenAndServe(a.Config.ListenAddress, routes)
+	srv := &http.Server{Addr: a.Config.ListenAddress, Handler: a.shedLoad(routes)}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	llog.Info("Shutting down API server; waiting for in-flight requests")
+
+	// Streams would otherwise hold the shutdown up until they time out
+	close(a.stopping)
+
+	sctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.Config.ShutdownTimeoutSec)*time.Second)
+	defer cancel()
+
+	return srv.Shutdown(sctx)
 }
 
 func (a *API) setupHandler(path string, ryeStack []rye.Handler) (string, http.Handler) {
-	p, h := newrelic.WrapHandle(a.Deps.NRApp, path, a.Deps.MWHandler.Handle(ryeStack))
+	p, h := a.tracer.WrapHandle(path, a.httpMetrics.Wrap(a.Deps.MWHandler.Handle(ryeStack)))
 	return p, handlers.LoggingHandler(os.Stdout, h)
 }
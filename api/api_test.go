@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"github.com/cactus/go-statsd-client/statsd"
 
@@ -10,6 +11,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
 	"github.com/dfraglabs/go-microservice-1/deps"
 	"github.com/dfraglabs/go-microservice-1/deps/backends"
 )
@@ -65,6 +67,21 @@ var _ = Describe("API", func() {
 		})
 	})
 
+	Describe("requireMongo", func() {
+		Context("when Mongo is not connected", func() {
+			It("should return a 503", func() {
+				d.Backends.Mongo = dalutil.NewSessionPool(nil, "test", 1, time.Second, nil)
+
+				resp := api.requireMongo(response, request)
+
+				Expect(resp).ToNot(BeNil())
+				Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+				Expect(resp.Err).To(Equal(dalutil.ErrNotConnected))
+				Expect(response.Header().Get("Retry-After")).To(Equal(RETRY_AFTER_SEC))
+			})
+		})
+	})
+
 	Describe("VersionHandler", func() {
 		Context("when the request is successful", func() {
 			It("should return the API version", func() {
@@ -3,8 +3,8 @@ package api
 import (
 	"net/http"
 
-	"github.com/InVisionApp/rye"
 	"github.com/InVisionApp/go-health"
+	"github.com/InVisionApp/rye"
 )
 
 type HealthcheckStatus struct {
@@ -42,10 +42,18 @@ func (a *API) versionHandler(rw http.ResponseWriter, r *http.Request) {
 // @Router /health [get]
 func dummyHealth() {}
 
+// @Summary Exposes service metrics in the Prometheus text format
+// @Description Only available when 'prometheus' is listed in GO_MICROSERVICE_1_METRICS_BACKENDS
+// @Tags basic
+// @Produce plain
+// @Success 200 {string} string "Prometheus text exposition format (v0.0.4)"
+// @Router /metrics [get]
+func dummyMetrics() {}
+
 // @Summary View API docs via Swagger-UI
 // @Description This endpoint serves the API spec via Swagger-UI (using github.com/swaggo/swag)
 // @Tags basic
 // @Produce html
 // @Success 200 {string} string "Swagger-UI"
 // @Router /docs/index.html [get]
-func dummyDocs() {}
\ No newline at end of file
+func dummyDocs() {}
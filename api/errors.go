@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/InVisionApp/rye"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+// errorResponse maps DAL errors to the matching HTTP status
+func errorResponse(err error) *rye.Response {
+	status := http.StatusInternalServerError
+
+	switch err.(type) {
+	case errtype.KeyNotFoundErr, errtype.APINotFoundErr:
+		status = http.StatusNotFound
+	case errtype.DuplicateKeyErr, errtype.VersionConflictErr:
+		status = http.StatusConflict
+	}
+
+	if err == dalutil.ErrNotConnected {
+		status = http.StatusServiceUnavailable
+	}
+
+	if status == http.StatusInternalServerError {
+		log.WithError(err).Error("Request failed")
+	}
+
+	return &rye.Response{
+		Err:        err,
+		StatusCode: status,
+	}
+}
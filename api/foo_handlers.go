@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/InVisionApp/rye"
+	"github.com/gorilla/mux"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/dal/foo"
+	"github.com/dfraglabs/go-microservice-1/dal/foo/types"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+const (
+	ETAG_HEADER     = "ETag"
+	IF_MATCH_HEADER = "If-Match"
+)
+
+type FooRequest struct {
+	Field string `json:"foo_field"`
+	Value int    `json:"value"`
+
+	// Expected version; the If-Match header takes precedence
+	Version int64 `json:"version,omitempty"`
+}
+
+// @Summary Creates a foo
+// @Tags foo
+// @Accept json
+// @Produce json
+// @Param foo body api.FooRequest true "The foo to create"
+// @Success 201 {object} types.Foo "The created foo; its version is also returned as the ETag"
+// @Failure 400 {object} rye.JSONStatus "Invalid request body"
+// @Failure 409 {object} rye.JSONStatus "A foo with the same foo_field already exists"
+// @Router /v1/foos [post]
+func (a *API) createFooHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	req := &FooRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return &rye.Response{Err: fmt.Errorf("Invalid request body: %v", err), StatusCode: http.StatusBadRequest}
+	}
+
+	foo := &types.Foo{
+		Field: req.Field,
+		Value: req.Value,
+	}
+
+	if err := a.Deps.FooDAL.CreateFoo(r.Context(), foo); err != nil {
+		return errorResponse(err)
+	}
+
+	return writeFoo(rw, foo, http.StatusCreated)
+}
+
+// @Summary Fetches a foo
+// @Tags foo
+// @Produce json
+// @Param id path string true "Foo ID"
+// @Success 200 {object} types.Foo "The foo; its version is also returned as the ETag"
+// @Failure 404 {object} rye.JSONStatus "No such foo"
+// @Router /v1/foos/{id} [get]
+func (a *API) getFooHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	foo, err := a.Deps.FooDAL.GetFoo(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return writeFoo(rw, foo, http.StatusOK)
+}
+
+// @Summary Lists foos
+// @Description Filter with `filter[field][op]=value` (`filter[field]=value` means `eq`), sort with `sort=-created_at,value`. Filterable and sortable fields: foo_field (eq, ne, in, nin, prefix), value (eq, ne, gt, gte, lt, lte, in, nin), created_at and updated_at (gt, gte, lt, lte). Follow `links.next`/`links.prev` to page.
+// @Tags foo
+// @Produce json
+// @Param sort query string false "Comma separated fields, prefixed with - for descending order" default(-created_at)
+// @Param limit query int false "Page size" default(50)
+// @Param cursor query string false "Opaque cursor taken from links.next or links.prev"
+// @Success 200 {object} api.ListResponseJSON "A page of foos"
+// @Failure 400 {object} api.QueryErrorJSON "Unknown field or operator, invalid value or cursor"
+// @Router /v1/foos [get]
+func (a *API) listFoosHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	q, resp := a.parseListQuery(rw, r, foo.ListSpec)
+	if resp != nil {
+		return resp
+	}
+
+	foos, info, err := a.Deps.FooDAL.ListFoos(r.Context(), q, a.Deps.Cursors)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return writeList(rw, r, foos, info)
+}
+
+// @Summary Updates a foo
+// @Description Pass the version to update via `If-Match` (412 on mismatch) or the `version` field (409 on mismatch). Without either, the update is applied to the latest version.
+// @Tags foo
+// @Accept json
+// @Produce json
+// @Param id path string true "Foo ID"
+// @Param If-Match header string false "ETag of the version being updated"
+// @Param foo body api.FooRequest true "The new foo"
+// @Success 200 {object} types.Foo "The updated foo; its new version is also returned as the ETag"
+// @Failure 400 {object} rye.JSONStatus "Invalid request body or If-Match header"
+// @Failure 404 {object} rye.JSONStatus "No such foo"
+// @Failure 409 {object} rye.JSONStatus "The foo was modified since the version in the body"
+// @Failure 412 {object} rye.JSONStatus "The foo was modified since the version in If-Match"
+// @Router /v1/foos/{id} [put]
+func (a *API) updateFooHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	req := &FooRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return &rye.Response{Err: fmt.Errorf("Invalid request body: %v", err), StatusCode: http.StatusBadRequest}
+	}
+
+	version, ifMatch, err := expectedVersion(r, req.Version)
+	if err != nil {
+		return &rye.Response{Err: err, StatusCode: http.StatusBadRequest}
+	}
+
+	var foo *types.Foo
+
+	update := func() error {
+		var err error
+
+		foo, err = a.Deps.FooDAL.GetFoo(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			return err
+		}
+
+		if version > 0 {
+			foo.Version = version
+		}
+
+		foo.Field = req.Field
+		foo.Value = req.Value
+
+		return a.Deps.FooDAL.UpdateFoo(r.Context(), foo)
+	}
+
+	if version > 0 {
+		err = update()
+	} else {
+		// Last write wins, but without losing updates made concurrently
+		err = dalutil.RetryOnConflict(r.Context(), dalutil.DEFAULT_CONFLICT_ATTEMPTS, update)
+	}
+
+	if err != nil {
+		if _, ok := err.(errtype.VersionConflictErr); ok && ifMatch {
+			return &rye.Response{Err: err, StatusCode: http.StatusPreconditionFailed}
+		}
+
+		return errorResponse(err)
+	}
+
+	return writeFoo(rw, foo, http.StatusOK)
+}
+
+// @Summary Deletes a foo
+// @Description The foo is only marked as deleted; admins can restore it.
+// @Tags foo
+// @Param id path string true "Foo ID"
+// @Success 204 "Deleted"
+// @Failure 404 {object} rye.JSONStatus "No such foo"
+// @Router /v1/foos/{id} [delete]
+func (a *API) deleteFooHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	if err := a.Deps.FooDAL.DeleteFoo(r.Context(), mux.Vars(r)["id"]); err != nil {
+		return errorResponse(err)
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func writeFoo(rw http.ResponseWriter, foo *types.Foo, status int) *rye.Response {
+	body, err := json.Marshal(foo)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	rw.Header().Set(ETAG_HEADER, ETag(foo.Version))
+	rye.WriteJSONResponse(rw, status, body)
+
+	return nil
+}
+
+// ETag renders a document version as a (strong) entity tag
+func ETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ParseETag is the inverse of ETag; weak tags (W/"...") are accepted as well
+func ParseETag(tag string) (int64, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid ETag %s", tag)
+	}
+
+	v, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("Invalid ETag %s", tag)
+	}
+
+	return v, nil
+}
+
+// expectedVersion returns the version a write is conditional on (0 if none)
+// and whether it came from If-Match
+func expectedVersion(r *http.Request, bodyVersion int64) (int64, bool, error) {
+	ifMatch := r.Header.Get(IF_MATCH_HEADER)
+
+	switch {
+	case ifMatch == "":
+		return bodyVersion, false, nil
+	case ifMatch == "*":
+		return 0, false, nil
+	case strings.Contains(ifMatch, ","):
+		return 0, false, errors.New("Only a single ETag is supported in If-Match")
+	}
+
+	v, err := ParseETag(ifMatch)
+
+	return v, true, err
+}
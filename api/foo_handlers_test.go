@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/InVisionApp/rye"
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/dal/foo/types"
+	"github.com/dfraglabs/go-microservice-1/deps"
+	"github.com/dfraglabs/go-microservice-1/fakes/foodal"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+var _ = Describe("Foo handlers", func() {
+	var (
+		api      *API
+		fakeDAL  *foodal.FakeIDAL
+		router   *mux.Router
+		response *httptest.ResponseRecorder
+
+		id = bson.ObjectIdHex("5bc9d3d2e138230001a4b1c2")
+	)
+
+	// Runs a rye handler the same way rye would (minus the middlewares)
+	handle := func(h rye.Handler) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if resp := h(rw, r); resp != nil && !resp.StopExecution {
+				rye.WriteJSONStatus(rw, "error", resp.Error(), resp.StatusCode)
+			}
+		}
+	}
+
+	newFoo := func(version int64) *types.Foo {
+		return &types.Foo{
+			Document: dalutil.Document{ID: id, Version: version},
+			Field:    "f",
+			Value:    1,
+		}
+	}
+
+	BeforeEach(func() {
+		fakeDAL = &foodal.FakeIDAL{}
+		api = New(config.New(), &deps.Dependencies{FooDAL: fakeDAL, Cursors: dalutil.NewCursorCodec([]byte("secret"))}, "test")
+
+		router = mux.NewRouter()
+		router.HandleFunc("/v1/foos", handle(api.createFooHandler)).Methods("POST")
+		router.HandleFunc("/v1/foos", handle(api.listFoosHandler)).Methods("GET")
+		router.HandleFunc("/v1/foos/{id}", handle(api.getFooHandler)).Methods("GET")
+		router.HandleFunc("/v1/foos/{id}", handle(api.updateFooHandler)).Methods("PUT")
+		router.HandleFunc("/v1/foos/{id}", handle(api.deleteFooHandler)).Methods("DELETE")
+
+		response = httptest.NewRecorder()
+	})
+
+	Describe("createFooHandler", func() {
+		It("should create the foo and return its version as the ETag", func() {
+			fakeDAL.CreateFooStub = func(_ context.Context, f *types.Foo) error {
+				f.ID, f.Version = id, 1
+				return nil
+			}
+
+			req := httptest.NewRequest("POST", "/v1/foos", strings.NewReader(`{"foo_field":"f","value":1}`))
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusCreated))
+			Expect(response.Header().Get(ETAG_HEADER)).To(Equal(`"1"`))
+
+			_, f := fakeDAL.CreateFooArgsForCall(0)
+			Expect(f.Field).To(Equal("f"))
+		})
+
+		It("should map duplicates to a 409", func() {
+			fakeDAL.CreateFooReturns(errtype.DuplicateKeyErr{E: errors.New("dup")})
+
+			req := httptest.NewRequest("POST", "/v1/foos", strings.NewReader(`{"foo_field":"f"}`))
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusConflict))
+		})
+	})
+
+	Describe("getFooHandler", func() {
+		It("should return the foo along with its ETag", func() {
+			fakeDAL.GetFooReturns(newFoo(3), nil)
+
+			router.ServeHTTP(response, httptest.NewRequest("GET", "/v1/foos/"+id.Hex(), nil))
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Header().Get(ETAG_HEADER)).To(Equal(`"3"`))
+			Expect(response.Body.String()).To(ContainSubstring(`"version":3`))
+		})
+
+		It("should return a 404 for unknown foos", func() {
+			fakeDAL.GetFooReturns(nil, errtype.KeyNotFoundErr{E: errors.New("not found")})
+
+			router.ServeHTTP(response, httptest.NewRequest("GET", "/v1/foos/"+id.Hex(), nil))
+
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("updateFooHandler", func() {
+		var conflict = errtype.VersionConflictErr{E: errors.New("conflict")}
+
+		BeforeEach(func() {
+			fakeDAL.GetFooStub = func(context.Context, string) (*types.Foo, error) {
+				return newFoo(5), nil
+			}
+		})
+
+		put := func(body string, headers map[string]string) {
+			req := httptest.NewRequest("PUT", "/v1/foos/"+id.Hex(), strings.NewReader(body))
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+
+			router.ServeHTTP(response, req)
+		}
+
+		It("should update the version given in If-Match", func() {
+			fakeDAL.UpdateFooStub = func(_ context.Context, f *types.Foo) error {
+				Expect(f.Version).To(Equal(int64(2)))
+				f.Version++
+				return nil
+			}
+
+			put(`{"foo_field":"g","value":2}`, map[string]string{IF_MATCH_HEADER: `"2"`})
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Header().Get(ETAG_HEADER)).To(Equal(`"3"`))
+		})
+
+		It("should return a 412 when If-Match is stale", func() {
+			fakeDAL.UpdateFooReturns(conflict)
+
+			put(`{"foo_field":"g"}`, map[string]string{IF_MATCH_HEADER: `"2"`})
+
+			Expect(response.Code).To(Equal(http.StatusPreconditionFailed))
+			Expect(fakeDAL.UpdateFooCallCount()).To(Equal(1))
+		})
+
+		It("should return a 409 when the body version is stale", func() {
+			fakeDAL.UpdateFooReturns(conflict)
+
+			put(`{"foo_field":"g","version":2}`, nil)
+
+			Expect(response.Code).To(Equal(http.StatusConflict))
+		})
+
+		It("should retry unconditional updates on conflict", func() {
+			fakeDAL.UpdateFooReturnsOnCall(0, conflict)
+			fakeDAL.UpdateFooReturnsOnCall(1, nil)
+
+			put(`{"foo_field":"g"}`, nil)
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(fakeDAL.GetFooCallCount()).To(Equal(2))
+		})
+
+		It("should reject malformed If-Match headers", func() {
+			put(`{"foo_field":"g"}`, map[string]string{IF_MATCH_HEADER: "2"})
+
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("deleteFooHandler", func() {
+		It("should return a 204", func() {
+			router.ServeHTTP(response, httptest.NewRequest("DELETE", "/v1/foos/"+id.Hex(), nil))
+
+			Expect(response.Code).To(Equal(http.StatusNoContent))
+
+			_, gotID := fakeDAL.DeleteFooArgsForCall(0)
+			Expect(gotID).To(Equal(id.Hex()))
+		})
+
+		It("should 404 on unknown foos", func() {
+			fakeDAL.DeleteFooReturns(errtype.KeyNotFoundErr{E: errors.New("nope")})
+
+			router.ServeHTTP(response, httptest.NewRequest("DELETE", "/v1/foos/"+id.Hex(), nil))
+
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("listFoosHandler", func() {
+		It("should pass the parsed query to the DAL and link to the adjacent pages", func() {
+			fakeDAL.ListFoosReturns([]*types.Foo{newFoo(1)}, &dalutil.PageInfo{Next: "n", Limit: 5}, nil)
+
+			req := httptest.NewRequest("GET", "/v1/foos?filter[value][gt]=1&limit=5", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+
+			_, q, _ := fakeDAL.ListFoosArgsForCall(0)
+			Expect(q.Filter).To(Equal(bson.M{"value": bson.M{"$gt": int64(1)}}))
+			Expect(q.Limit).To(Equal(5))
+
+			body := &ListResponseJSON{}
+			Expect(json.Unmarshal(response.Body.Bytes(), body)).To(Succeed())
+			Expect(body.Data).To(HaveLen(1))
+			Expect(body.Links.Prev).To(BeEmpty())
+
+			next, err := url.Parse(body.Links.Next)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(next.Path).To(Equal("/v1/foos"))
+			Expect(next.Query().Get("cursor")).To(Equal("n"))
+			Expect(next.Query().Get("limit")).To(Equal("5"))
+		})
+
+		It("should list every invalid param in the 400", func() {
+			req := httptest.NewRequest("GET", "/v1/foos?filter[nope]=1&sort=nope", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+			Expect(fakeDAL.ListFoosCallCount()).To(Equal(0))
+
+			body := &QueryErrorJSON{}
+			Expect(json.Unmarshal(response.Body.Bytes(), body)).To(Succeed())
+			Expect(body.Details).To(ConsistOf(
+				"filtering on 'nope' is not supported",
+				"sorting on 'nope' is not supported",
+			))
+		})
+	})
+
+	Describe("ETags", func() {
+		It("should round-trip versions", func() {
+			v, err := ParseETag(ETag(42))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v).To(Equal(int64(42)))
+		})
+
+		It("should accept weak ETags", func() {
+			v, err := ParseETag(`W/"7"`)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v).To(Equal(int64(7)))
+		})
+	})
+})
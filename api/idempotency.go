@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/InVisionApp/rye"
+
+	"github.com/dfraglabs/go-microservice-1/dal/idempotency"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	// Optional on write routes; retries of a request carrying it get the
+	// response of the first attempt instead of running it again
+	IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+
+	// Set (to "true") on replayed responses
+	IDEMPOTENT_REPLAYED_HEADER = "Idempotent-Replayed"
+
+	MAX_IDEMPOTENCY_KEY_LEN = 255
+
+	// How often a retry checks whether the request it duplicates completed
+	idempotencyPollInterval = 100 * time.Millisecond
+
+	// Storing the response is not bound to the request's ctx
+	idempotencyStoreTimeout = 5 * time.Second
+)
+
+// idempotent honors IDEMPOTENCY_KEY_HEADER on a write route; wrap the last
+// handler of its stack with it (after the auth middleware, as keys are
+// scoped to the access token).
+//
+// The final response is stored (for deps.IDEMPOTENCY_EXPIRE_AFTER_SEC) and
+// replayed to requests with the same key and payload; a different payload
+// gets a 422. A duplicate of a request in flight waits for it for up
+// to GO_MICROSERVICE_1_IDEMPOTENCY_WAIT_MS, then gets a 409. 5xx responses
+// are not stored, so that the request can be retried.
+func (a *API) idempotent(h rye.Handler) rye.Handler {
+	return func(rw http.ResponseWriter, r *http.Request) *rye.Response {
+		key := r.Header.Get(IDEMPOTENCY_KEY_HEADER)
+		if key == "" || a.Deps.Idempotency == nil {
+			return h(rw, r)
+		}
+
+		if len(key) > MAX_IDEMPOTENCY_KEY_LEN {
+			return &rye.Response{
+				Err:        fmt.Errorf("%s must be at most %d characters", IDEMPOTENCY_KEY_HEADER, MAX_IDEMPOTENCY_KEY_LEN),
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return &rye.Response{Err: fmt.Errorf("Unable to read body: %v", err), StatusCode: http.StatusBadRequest}
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		rec, err := a.beginIdempotent(r.Context(), tokenFingerprint(r)+":"+key,
+			idempotency.Fingerprint(r.Method, r.URL.RequestURI(), body))
+
+		switch err {
+		case nil:
+		case idempotency.ErrMismatch:
+			a.metrics.Inc(idempotency.REQUESTS_METRIC, 1, metrics.Tags{"result": "mismatch"})
+			return &rye.Response{Err: err, StatusCode: http.StatusUnprocessableEntity}
+		case idempotency.ErrInFlight:
+			a.metrics.Inc(idempotency.REQUESTS_METRIC, 1, metrics.Tags{"result": "in_flight"})
+			rw.Header().Set("Retry-After", "1")
+			return &rye.Response{Err: err, StatusCode: http.StatusConflict}
+		default:
+			return errorResponse(err)
+		}
+
+		if rec.Status == idempotency.STATUS_COMPLETED {
+			a.metrics.Inc(idempotency.REQUESTS_METRIC, 1, metrics.Tags{"result": "replayed"})
+
+			rw.Header().Set(IDEMPOTENT_REPLAYED_HEADER, "true")
+			writeStoredResponse(rw, rec.Response)
+
+			return &rye.Response{StopExecution: true}
+		}
+
+		a.metrics.Inc(idempotency.REQUESTS_METRIC, 1, metrics.Tags{"result": "new"})
+
+		recorder := newResponseRecorder()
+
+		// As rye would write it
+		if resp := h(recorder, r); resp != nil && resp.Err != nil && !resp.StopExecution {
+			rye.WriteJSONStatus(recorder, "error", resp.Error(), resp.StatusCode)
+		}
+
+		stored := idempotency.NewResponse(recorder.statusCode(), recorder.header, recorder.body.Bytes())
+
+		ctx, cancel := context.WithTimeout(context.Background(), idempotencyStoreTimeout)
+		defer cancel()
+
+		if stored.StatusCode >= http.StatusInternalServerError {
+			err = a.Deps.Idempotency.Release(ctx, rec)
+		} else {
+			err = a.Deps.Idempotency.Complete(ctx, rec, stored)
+		}
+
+		if err != nil {
+			log.WithError(err).WithField("key", key).Warn("Unable to record idempotent response")
+		}
+
+		writeStoredResponse(rw, stored)
+
+		return &rye.Response{StopExecution: true}
+	}
+}
+
+// beginIdempotent claims key, waiting for a duplicate request in flight to
+// complete
+func (a *API) beginIdempotent(ctx context.Context, key, fingerprint string) (*idempotency.Record, error) {
+	deadline := time.Now().Add(time.Duration(a.Config.IdempotencyWaitMs) * time.Millisecond)
+
+	for {
+		rec, err := a.Deps.Idempotency.Begin(ctx, key, fingerprint)
+		if err != idempotency.ErrInFlight || !time.Now().Add(idempotencyPollInterval).Before(deadline) {
+			return rec, err
+		}
+
+		select {
+		case <-time.After(idempotencyPollInterval):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+func writeStoredResponse(rw http.ResponseWriter, resp *idempotency.Response) {
+	for name, values := range resp.Header() {
+		rw.Header()[name] = values
+	}
+
+	rw.WriteHeader(resp.StatusCode)
+	rw.Write(resp.Body)
+}
+
+// responseRecorder captures a response so that it can be stored before
+// being written out
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	return r.body.Write(b)
+}
+
+// statusCode is 200 if nothing was written, as with a http.ResponseWriter
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+
+	return r.status
+}
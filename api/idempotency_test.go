@@ -0,0 +1,209 @@
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/InVisionApp/rye"
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/idempotency"
+	"github.com/dfraglabs/go-microservice-1/deps"
+	"github.com/dfraglabs/go-microservice-1/fakes/idempotencystore"
+)
+
+var _ = Describe("idempotent", func() {
+	var (
+		api       *API
+		fakeStore *idempotencystore.FakeIStore
+		router    *mux.Router
+		response  *httptest.ResponseRecorder
+
+		calls  int
+		bodies []string
+		result *rye.Response
+	)
+
+	handle := func(h rye.Handler) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if resp := h(rw, r); resp != nil && !resp.StopExecution {
+				rye.WriteJSONStatus(rw, "error", resp.Error(), resp.StatusCode)
+			}
+		}
+	}
+
+	newRequest := func(key, body string) *http.Request {
+		req := httptest.NewRequest("POST", "/v1/things", strings.NewReader(body))
+		req.Header.Set(ACCESS_TOKEN_HEADER, "token")
+		if key != "" {
+			req.Header.Set(IDEMPOTENCY_KEY_HEADER, key)
+		}
+
+		return req
+	}
+
+	BeforeEach(func() {
+		calls = 0
+		bodies = nil
+		result = nil
+
+		fakeStore = &idempotencystore.FakeIStore{}
+		fakeStore.BeginReturns(&idempotency.Record{Key: "k", Status: idempotency.STATUS_IN_FLIGHT}, nil)
+
+		api = New(config.New(), &deps.Dependencies{Idempotency: fakeStore}, "test")
+
+		created := func(rw http.ResponseWriter, r *http.Request) *rye.Response {
+			calls++
+
+			b, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+
+			if result != nil {
+				return result
+			}
+
+			rw.Header().Set(LOCATION_HEADER, "/v1/things/1")
+			rw.WriteHeader(http.StatusCreated)
+			rw.Write([]byte(`{"id":"1"}`))
+
+			return nil
+		}
+
+		router = mux.NewRouter()
+		router.HandleFunc("/v1/things", handle(api.idempotent(created))).Methods("POST")
+
+		response = httptest.NewRecorder()
+	})
+
+	It("should pass requests without a key through", func() {
+		router.ServeHTTP(response, newRequest("", `{}`))
+
+		Expect(response.Code).To(Equal(http.StatusCreated))
+		Expect(calls).To(Equal(1))
+		Expect(fakeStore.BeginCallCount()).To(Equal(0))
+	})
+
+	It("should run a new request and store its response", func() {
+		router.ServeHTTP(response, newRequest("abc", `{"a":1}`))
+
+		Expect(response.Code).To(Equal(http.StatusCreated))
+		Expect(response.Header().Get(LOCATION_HEADER)).To(Equal("/v1/things/1"))
+		Expect(response.Header().Get(IDEMPOTENT_REPLAYED_HEADER)).To(BeEmpty())
+		Expect(response.Body.String()).To(Equal(`{"id":"1"}`))
+
+		// The handler still gets the body
+		Expect(bodies).To(Equal([]string{`{"a":1}`}))
+
+		_, key, fingerprint := fakeStore.BeginArgsForCall(0)
+		Expect(key).To(HaveSuffix(":abc"))
+		Expect(key).ToNot(ContainSubstring("token"))
+		Expect(fingerprint).To(Equal(idempotency.Fingerprint("POST", "/v1/things", []byte(`{"a":1}`))))
+
+		Expect(fakeStore.CompleteCallCount()).To(Equal(1))
+		_, rec, stored := fakeStore.CompleteArgsForCall(0)
+		Expect(rec.Key).To(Equal("k"))
+		Expect(stored.StatusCode).To(Equal(http.StatusCreated))
+		Expect(stored.Header().Get(LOCATION_HEADER)).To(Equal("/v1/things/1"))
+		Expect(string(stored.Body)).To(Equal(`{"id":"1"}`))
+	})
+
+	It("should scope keys to the access token", func() {
+		router.ServeHTTP(response, newRequest("abc", `{}`))
+
+		other := newRequest("abc", `{}`)
+		other.Header.Set(ACCESS_TOKEN_HEADER, "other-token")
+		router.ServeHTTP(httptest.NewRecorder(), other)
+
+		_, first, _ := fakeStore.BeginArgsForCall(0)
+		_, second, _ := fakeStore.BeginArgsForCall(1)
+		Expect(first).ToNot(Equal(second))
+	})
+
+	It("should replay a completed response", func() {
+		fakeStore.BeginReturns(&idempotency.Record{
+			Status: idempotency.STATUS_COMPLETED,
+			Response: idempotency.NewResponse(http.StatusCreated,
+				http.Header{LOCATION_HEADER: []string{"/v1/things/1"}}, []byte(`{"id":"1"}`)),
+		}, nil)
+
+		router.ServeHTTP(response, newRequest("abc", `{"a":1}`))
+
+		Expect(calls).To(Equal(0))
+		Expect(response.Code).To(Equal(http.StatusCreated))
+		Expect(response.Header().Get(LOCATION_HEADER)).To(Equal("/v1/things/1"))
+		Expect(response.Header().Get(IDEMPOTENT_REPLAYED_HEADER)).To(Equal("true"))
+		Expect(response.Body.String()).To(Equal(`{"id":"1"}`))
+		Expect(fakeStore.CompleteCallCount()).To(Equal(0))
+	})
+
+	It("should reject a key reused with a different payload", func() {
+		fakeStore.BeginReturns(nil, idempotency.ErrMismatch)
+
+		router.ServeHTTP(response, newRequest("abc", `{"a":2}`))
+
+		Expect(calls).To(Equal(0))
+		Expect(response.Code).To(Equal(http.StatusUnprocessableEntity))
+	})
+
+	It("should wait for a duplicate in flight, then give up with a 409", func() {
+		api.Config.IdempotencyWaitMs = 250
+		fakeStore.BeginReturns(nil, idempotency.ErrInFlight)
+
+		router.ServeHTTP(response, newRequest("abc", `{}`))
+
+		Expect(calls).To(Equal(0))
+		Expect(response.Code).To(Equal(http.StatusConflict))
+		Expect(fakeStore.BeginCallCount()).To(BeNumerically(">", 1))
+	})
+
+	It("should replay the response once the duplicate in flight completes", func() {
+		api.Config.IdempotencyWaitMs = 1000
+		fakeStore.BeginReturnsOnCall(0, nil, idempotency.ErrInFlight)
+		fakeStore.BeginReturnsOnCall(1, &idempotency.Record{
+			Status:   idempotency.STATUS_COMPLETED,
+			Response: idempotency.NewResponse(http.StatusNoContent, nil, nil),
+		}, nil)
+
+		router.ServeHTTP(response, newRequest("abc", `{}`))
+
+		Expect(calls).To(Equal(0))
+		Expect(response.Code).To(Equal(http.StatusNoContent))
+	})
+
+	It("should store client errors as written by rye", func() {
+		result = &rye.Response{Err: errors.New("bad foo"), StatusCode: http.StatusBadRequest}
+
+		router.ServeHTTP(response, newRequest("abc", `{}`))
+
+		Expect(response.Code).To(Equal(http.StatusBadRequest))
+		Expect(response.Body.String()).To(ContainSubstring("bad foo"))
+
+		_, _, stored := fakeStore.CompleteArgsForCall(0)
+		Expect(stored.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(string(stored.Body)).To(Equal(response.Body.String()))
+	})
+
+	It("should release the key on server errors so that retries run again", func() {
+		result = &rye.Response{Err: errors.New("boom"), StatusCode: http.StatusServiceUnavailable}
+
+		router.ServeHTTP(response, newRequest("abc", `{}`))
+
+		Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(fakeStore.CompleteCallCount()).To(Equal(0))
+		Expect(fakeStore.ReleaseCallCount()).To(Equal(1))
+	})
+
+	It("should reject overlong keys", func() {
+		router.ServeHTTP(response, newRequest(strings.Repeat("k", MAX_IDEMPOTENCY_KEY_LEN+1), `{}`))
+
+		Expect(response.Code).To(Equal(http.StatusBadRequest))
+		Expect(calls).To(Equal(0))
+	})
+})
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/InVisionApp/rye"
+	"github.com/gorilla/mux"
+
+	"github.com/dfraglabs/go-microservice-1/dal/jobs"
+)
+
+const (
+	LOCATION_HEADER = "Location"
+)
+
+type JobRequest struct {
+	Type     string      `json:"type"`
+	Payload  interface{} `json:"payload,omitempty"`
+	Priority int         `json:"priority,omitempty"`  // higher runs first
+	DelaySec int         `json:"delay_sec,omitempty"` // before the first attempt
+}
+
+// @Summary Submits a job
+// @Description The job runs in the background; poll the URL in the `Location` header for its status, progress and result.
+// @Tags jobs
+// @Accept json
+// @Produce json
+// @Param job body api.JobRequest true "The job to run"
+// @Success 202 {object} jobs.Job "The queued job"
+// @Failure 400 {object} rye.JSONStatus "Invalid request body or unknown (or internal) job type"
+// @Router /v1/jobs [post]
+func (a *API) createJobHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	req := &JobRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return &rye.Response{Err: fmt.Errorf("Invalid request body: %v", err), StatusCode: http.StatusBadRequest}
+	}
+
+	// Internal job types (ie. webhook deliveries) are not for clients to submit
+	if !a.Deps.JobRegistry.Public(req.Type) {
+		return &rye.Response{Err: fmt.Errorf("Invalid request body: unknown job type '%s'", req.Type), StatusCode: http.StatusBadRequest}
+	}
+
+	if req.DelaySec < 0 {
+		return &rye.Response{Err: fmt.Errorf("Invalid request body: delay_sec must not be negative"), StatusCode: http.StatusBadRequest}
+	}
+
+	job, err := a.Deps.Jobs.Enqueue(r.Context(), req.Type, req.Payload, &jobs.EnqueueOpts{
+		Priority: req.Priority,
+		Delay:    time.Duration(req.DelaySec) * time.Second,
+	})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	rw.Header().Set(LOCATION_HEADER, "/v1/jobs/"+job.ID.Hex())
+
+	return writeJob(rw, job, http.StatusAccepted)
+}
+
+// @Summary Fetches a job
+// @Description `progress` is reported by the job while it runs; `result` is set once it succeeded and `last_error` after a failed attempt. Finished jobs expire after a week.
+// @Tags jobs
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} jobs.Job "The job"
+// @Failure 404 {object} rye.JSONStatus "No such job"
+// @Router /v1/jobs/{id} [get]
+func (a *API) getJobHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	job, err := a.Deps.Jobs.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return writeJob(rw, job, http.StatusOK)
+}
+
+// @Summary Cancels a job
+// @Description Queued jobs are canceled right away. Running jobs are asked to stop; they are canceled once they do (or succeed if they finish first), so poll the job for its final status.
+// @Tags jobs
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 202 {object} jobs.Job "The job, canceled or with cancel_requested set"
+// @Failure 404 {object} rye.JSONStatus "No such job"
+// @Failure 409 {object} rye.JSONStatus "The job already finished"
+// @Router /v1/jobs/{id} [delete]
+func (a *API) cancelJobHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	job, err := a.Deps.Jobs.Cancel(r.Context(), mux.Vars(r)["id"])
+
+	switch {
+	case err == jobs.ErrJobFinished:
+		return &rye.Response{Err: fmt.Errorf("Job already %s", job.Status), StatusCode: http.StatusConflict}
+	case err != nil:
+		return errorResponse(err)
+	}
+
+	return writeJob(rw, job, http.StatusAccepted)
+}
+
+func writeJob(rw http.ResponseWriter, job *jobs.Job, status int) *rye.Response {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	rye.WriteJSONResponse(rw, status, body)
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/InVisionApp/rye"
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/jobs"
+	"github.com/dfraglabs/go-microservice-1/dal/webhooks"
+	"github.com/dfraglabs/go-microservice-1/deps"
+	"github.com/dfraglabs/go-microservice-1/fakes/jobqueue"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+var _ = Describe("Job handlers", func() {
+	var (
+		api       *API
+		fakeQueue *jobqueue.FakeIQueue
+		router    *mux.Router
+		response  *httptest.ResponseRecorder
+
+		id = bson.ObjectIdHex("5bc9d3d2e138230001a4b1c3")
+	)
+
+	handle := func(h rye.Handler) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if resp := h(rw, r); resp != nil && !resp.StopExecution {
+				rye.WriteJSONStatus(rw, "error", resp.Error(), resp.StatusCode)
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		fakeQueue = &jobqueue.FakeIQueue{}
+
+		registry := jobs.NewRegistry()
+		noop := func(context.Context, *jobs.Job) (interface{}, error) { return nil, nil }
+		registry.RegisterPublic("t", noop)
+		registry.Register(webhooks.DELIVERY_JOB, noop)
+
+		api = New(config.New(), &deps.Dependencies{Jobs: fakeQueue, JobRegistry: registry}, "test")
+
+		router = mux.NewRouter()
+		router.HandleFunc("/v1/jobs", handle(api.createJobHandler)).Methods("POST")
+		router.HandleFunc("/v1/jobs/{id}", handle(api.getJobHandler)).Methods("GET")
+		router.HandleFunc("/v1/jobs/{id}", handle(api.cancelJobHandler)).Methods("DELETE")
+
+		response = httptest.NewRecorder()
+	})
+
+	Describe("createJobHandler", func() {
+		post := func(body string) {
+			router.ServeHTTP(response, httptest.NewRequest("POST", "/v1/jobs", strings.NewReader(body)))
+		}
+
+		It("should queue the job and point at it", func() {
+			fakeQueue.EnqueueStub = func(_ context.Context, t string, p interface{}, _ *jobs.EnqueueOpts) (*jobs.Job, error) {
+				return &jobs.Job{ID: id, Type: t, Payload: p, Status: jobs.STATUS_QUEUED}, nil
+			}
+
+			post(`{"type":"t","payload":{"n":1},"delay_sec":5}`)
+
+			Expect(response.Code).To(Equal(http.StatusAccepted))
+			Expect(response.Header().Get(LOCATION_HEADER)).To(Equal("/v1/jobs/" + id.Hex()))
+			Expect(response.Body.String()).To(ContainSubstring(`"status":"queued"`))
+
+			_, jobType, payload, opts := fakeQueue.EnqueueArgsForCall(0)
+			Expect(jobType).To(Equal("t"))
+			Expect(payload).To(Equal(map[string]interface{}{"n": 1.0}))
+			Expect(opts.Delay).To(Equal(5 * time.Second))
+		})
+
+		It("should reject unknown job types", func() {
+			post(`{"type":"nope"}`)
+
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+			Expect(fakeQueue.EnqueueCallCount()).To(Equal(0))
+		})
+
+		It("should reject internal job types", func() {
+			post(`{"type":"` + webhooks.DELIVERY_JOB + `"}`)
+
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+			Expect(fakeQueue.EnqueueCallCount()).To(Equal(0))
+		})
+
+		It("should reject negative delays", func() {
+			post(`{"type":"t","delay_sec":-1}`)
+
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("getJobHandler", func() {
+		It("should return the job's status, progress and result", func() {
+			fakeQueue.GetReturns(&jobs.Job{
+				ID:       id,
+				Status:   jobs.STATUS_RUNNING,
+				Progress: &jobs.Progress{Percent: 40, Message: "halfway there"},
+			}, nil)
+
+			router.ServeHTTP(response, httptest.NewRequest("GET", "/v1/jobs/"+id.Hex(), nil))
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Body.String()).To(ContainSubstring(`"progress":{"percent":40,"message":"halfway there"}`))
+
+			_, jobID := fakeQueue.GetArgsForCall(0)
+			Expect(jobID).To(Equal(id.Hex()))
+		})
+
+		It("should return a 404 for unknown jobs", func() {
+			fakeQueue.GetReturns(nil, errtype.KeyNotFoundErr{E: errors.New("not found")})
+
+			router.ServeHTTP(response, httptest.NewRequest("GET", "/v1/jobs/"+id.Hex(), nil))
+
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("cancelJobHandler", func() {
+		It("should request the cancellation", func() {
+			fakeQueue.CancelReturns(&jobs.Job{ID: id, Status: jobs.STATUS_RUNNING, CancelRequested: true}, nil)
+
+			router.ServeHTTP(response, httptest.NewRequest("DELETE", "/v1/jobs/"+id.Hex(), nil))
+
+			Expect(response.Code).To(Equal(http.StatusAccepted))
+			Expect(response.Body.String()).To(ContainSubstring(`"cancel_requested":true`))
+		})
+
+		It("should return a 409 for finished jobs", func() {
+			fakeQueue.CancelReturns(&jobs.Job{ID: id, Status: jobs.STATUS_SUCCEEDED}, jobs.ErrJobFinished)
+
+			router.ServeHTTP(response, httptest.NewRequest("DELETE", "/v1/jobs/"+id.Hex(), nil))
+
+			Expect(response.Code).To(Equal(http.StatusConflict))
+		})
+	})
+})
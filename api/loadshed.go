@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/InVisionApp/rye"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/loadshed"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	// Optional; "low" marks background traffic, served after the rest and
+	// shed first under load
+	REQUEST_PRIORITY_HEADER = "X-Request-Priority"
+
+	// Sent along with 503s of shed requests
+	SHED_RETRY_AFTER_SEC = "1"
+)
+
+// newLoadShedder returns the limiter configured by
+// GO_MICROSERVICE_1_CONCURRENCY_*; nil if there is no limit
+func newLoadShedder(cfg *config.Config, m metrics.IMetrics) *loadshed.Limiter {
+	bounds := loadshed.Bounds{
+		Initial: cfg.ConcurrencyLimitInitial,
+		Min:     cfg.ConcurrencyLimitMin,
+		Max:     cfg.ConcurrencyLimitMax,
+	}
+
+	var limit loadshed.ILimit
+
+	switch cfg.ConcurrencyLimit {
+	case loadshed.LIMIT_STATIC:
+		limit = loadshed.NewStaticLimit(cfg.ConcurrencyLimitInitial)
+	case loadshed.LIMIT_AIMD:
+		limit = loadshed.NewAIMDLimit(bounds, time.Duration(cfg.ConcurrencyLatencyTargetMs)*time.Millisecond)
+	case loadshed.LIMIT_GRADIENT:
+		limit = loadshed.NewGradientLimit(bounds)
+	default:
+		return nil
+	}
+
+	return loadshed.NewLimiter(limit, loadshed.Opts{
+		QueueSize:    cfg.ConcurrencyQueueSize,
+		QueueTimeout: time.Duration(cfg.ConcurrencyQueueTimeoutMs) * time.Millisecond,
+	}, m)
+}
+
+// shedLoad caps the requests h serves at once (see newLoadShedder),
+// answering those it sheds with a 503
+func (a *API) shedLoad(h http.Handler) http.Handler {
+	if a.shedder == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		token, err := a.shedder.Acquire(r.Context(), requestPriority(r))
+		if err != nil {
+			rw.Header().Set("Retry-After", SHED_RETRY_AFTER_SEC)
+			rye.WriteJSONStatus(rw, "error", err.Error(), http.StatusServiceUnavailable)
+
+			return
+		}
+
+		defer token.Release()
+
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// requestPriority never sheds health checks, metrics scrapes and admin
+// calls. Streams are not limited either: they are bounded by
+// GO_MICROSERVICE_1_STREAM_MAX_CONNECTIONS, and their duration says nothing
+// about load.
+func requestPriority(r *http.Request) loadshed.Priority {
+	switch path := r.URL.Path; {
+	case path == "/", path == "/version", path == "/healthcheck", path == "/metrics", path == "/v1/stream":
+		return loadshed.PRIORITY_CRITICAL
+	case strings.HasPrefix(path, "/admin/"):
+		return loadshed.PRIORITY_CRITICAL
+	}
+
+	if strings.EqualFold(r.Header.Get(REQUEST_PRIORITY_HEADER), string(loadshed.PRIORITY_LOW)) {
+		return loadshed.PRIORITY_LOW
+	}
+
+	return loadshed.PRIORITY_NORMAL
+}
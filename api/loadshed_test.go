@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/deps"
+	"github.com/dfraglabs/go-microservice-1/loadshed"
+)
+
+var _ = Describe("shedLoad", func() {
+	var (
+		cfg *config.Config
+	)
+
+	BeforeEach(func() {
+		cfg = config.New()
+		cfg.ConcurrencyLimitInitial = 1
+		cfg.ConcurrencyLimitMin = 1
+		cfg.ConcurrencyLimitMax = 10
+	})
+
+	It("should not limit anything by default", func() {
+		Expect(New(cfg, &deps.Dependencies{}, "test").shedder).To(BeNil())
+
+		cfg.ConcurrencyLimit = loadshed.LIMIT_NONE
+		Expect(New(cfg, &deps.Dependencies{}, "test").shedder).To(BeNil())
+	})
+
+	It("should build the configured limit", func() {
+		for _, l := range []string{loadshed.LIMIT_STATIC, loadshed.LIMIT_AIMD, loadshed.LIMIT_GRADIENT} {
+			cfg.ConcurrencyLimit = l
+
+			a := New(cfg, &deps.Dependencies{}, "test")
+			Expect(a.shedder).ToNot(BeNil(), l)
+			Expect(a.shedder.Limit()).To(Equal(1), l)
+		}
+	})
+
+	It("should shed requests over the limit with a 503, but not critical ones", func() {
+		cfg.ConcurrencyLimit = loadshed.LIMIT_STATIC
+		a := New(cfg, &deps.Dependencies{}, "test")
+
+		var inner *httptest.ResponseRecorder
+
+		h := a.shedLoad(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			// Served while the only slot is taken
+			if r.URL.Path == "/v1/foos" {
+				inner = httptest.NewRecorder()
+				a.shedLoad(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})).
+					ServeHTTP(inner, httptest.NewRequest("GET", "/v1/foos/1", nil))
+
+				health := httptest.NewRecorder()
+				a.shedLoad(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})).
+					ServeHTTP(health, httptest.NewRequest("GET", "/healthcheck", nil))
+				Expect(health.Code).To(Equal(http.StatusOK))
+			}
+		}))
+
+		response := httptest.NewRecorder()
+		h.ServeHTTP(response, httptest.NewRequest("GET", "/v1/foos", nil))
+
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(inner.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(inner.Header().Get("Retry-After")).To(Equal(SHED_RETRY_AFTER_SEC))
+
+		Expect(a.shedder.InFlight()).To(Equal(0))
+	})
+
+	Describe("requestPriority", func() {
+		It("should never shed health checks, admin calls and streams", func() {
+			for _, path := range []string{"/healthcheck", "/version", "/metrics", "/admin/v1/webhooks", "/v1/stream"} {
+				Expect(requestPriority(httptest.NewRequest("GET", path, nil))).To(Equal(loadshed.PRIORITY_CRITICAL), path)
+			}
+		})
+
+		It("should honor the priority header", func() {
+			req := httptest.NewRequest("GET", "/v1/foos", nil)
+			Expect(requestPriority(req)).To(Equal(loadshed.PRIORITY_NORMAL))
+
+			req.Header.Set(REQUEST_PRIORITY_HEADER, "Low")
+			Expect(requestPriority(req)).To(Equal(loadshed.PRIORITY_LOW))
+
+			req.Header.Set(REQUEST_PRIORITY_HEADER, "critical")
+			Expect(requestPriority(req)).To(Equal(loadshed.PRIORITY_NORMAL))
+		})
+	})
+})
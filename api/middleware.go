@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/InVisionApp/rye"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+)
+
+// requireMongo short-circuits with a 503 while Mongo is not connected (ie.
+// when started with GO_MICROSERVICE_1_MONGO_DB_DEGRADED_START). Add it to the
+// rye stack of every route that depends on Mongo.
+func (a *API) requireMongo(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	if a.Deps.Backends == nil || a.Deps.Backends.Mongo == nil || !a.Deps.Backends.Mongo.Connected() {
+		rw.Header().Set("Retry-After", RETRY_AFTER_SEC)
+
+		return &rye.Response{
+			Err:        dalutil.ErrNotConnected,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	return nil
+}
+
+// authMiddleware only lets through requests carrying one of the configured tokens
+func (a *API) authMiddleware() rye.Handler {
+	return rye.NewMiddlewareAccessToken(ACCESS_TOKEN_HEADER, a.Config.Tokens)
+}
+
+// adminMiddleware only lets through requests carrying one of the admin tokens
+func (a *API) adminMiddleware() rye.Handler {
+	return rye.NewMiddlewareAccessToken(ACCESS_TOKEN_HEADER, a.Config.AdminTokens)
+}
+
+// identifyActor attributes the writes made while handling the request (see
+// the audit trail) to the access token used and, if any, the end user named
+// in ACTOR_HEADER. Add it after the auth middleware.
+func (a *API) identifyActor(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	return &rye.Response{Context: dalutil.WithActor(r.Context(), requestActor(r))}
+}
+
+// requestActor returns "token:<fingerprint>", or "<actor>@token:<fingerprint>"
+// when ACTOR_HEADER is set. The header is only asserted by the caller (any
+// token holder may send any name), so the token is always recorded; the
+// token itself never is, only a fingerprint of it.
+func requestActor(r *http.Request) string {
+	token := "token:" + tokenFingerprint(r)
+
+	if actor := r.Header.Get(ACTOR_HEADER); actor != "" {
+		return actor + "@" + token
+	}
+
+	return token
+}
+
+// tokenFingerprint identifies the access token of the request without
+// revealing it
+func tokenFingerprint(r *http.Request) string {
+	sum := sha256.Sum256([]byte(r.Header.Get(ACCESS_TOKEN_HEADER)))
+
+	return hex.EncodeToString(sum[:])[:TOKEN_FINGERPRINT_LEN]
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/InVisionApp/rye"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+)
+
+// ListResponseJSON is the envelope of every list endpoint; links are absent
+// when there is no page in that direction
+type ListResponseJSON struct {
+	Data  interface{}   `json:"data"`
+	Links ListLinksJSON `json:"links"`
+}
+
+type ListLinksJSON struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// QueryErrorJSON is returned (with a 400) for invalid filter/sort/limit/cursor params
+type QueryErrorJSON struct {
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Details []string `json:"details"`
+}
+
+// parseListQuery validates the list params of r against spec; on failure the
+// 400 has already been written and the returned response stops the rye stack
+func (a *API) parseListQuery(rw http.ResponseWriter, r *http.Request, spec *dalutil.QuerySpec) (*dalutil.Query, *rye.Response) {
+	q, err := dalutil.ParseQuery(spec, r.URL.Query(), a.Deps.Cursors)
+	if err == nil {
+		return q, nil
+	}
+
+	qerr, ok := err.(*dalutil.QueryError)
+	if !ok {
+		return nil, &rye.Response{Err: err, StatusCode: http.StatusBadRequest}
+	}
+
+	body, _ := json.Marshal(&QueryErrorJSON{
+		Status:  "error",
+		Message: "Invalid query parameters",
+		Details: qerr.Problems,
+	})
+
+	rye.WriteJSONResponse(rw, http.StatusBadRequest, body)
+
+	return nil, &rye.Response{StopExecution: true}
+}
+
+// writeList writes data in a ListResponseJSON with links to the adjacent pages
+func writeList(rw http.ResponseWriter, r *http.Request, data interface{}, info *dalutil.PageInfo) *rye.Response {
+	body, err := json.Marshal(&ListResponseJSON{
+		Data: data,
+		Links: ListLinksJSON{
+			Next: pageLink(r.URL, info.Next),
+			Prev: pageLink(r.URL, info.Prev),
+		},
+	})
+
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	rye.WriteJSONResponse(rw, http.StatusOK, body)
+
+	return nil
+}
+
+// pageLink is the request URL (path and query only) with its cursor replaced
+func pageLink(u *url.URL, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+
+	q := u.Query()
+	q.Set(dalutil.CURSOR_PARAM, cursor)
+
+	link := url.URL{Path: u.Path, RawQuery: q.Encode()}
+
+	return link.String()
+}
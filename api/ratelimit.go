@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/InVisionApp/rye"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+	"github.com/dfraglabs/go-microservice-1/ratelimit"
+)
+
+const (
+	// Route groups GO_MICROSERVICE_1_RATE_LIMITS rules apply to
+	RATE_LIMIT_GROUP_V1    = "v1"
+	RATE_LIMIT_GROUP_ADMIN = "admin"
+
+	// Sent along with every rate limited response; Reset is in seconds
+	RATE_LIMIT_LIMIT_HEADER     = "RateLimit-Limit"
+	RATE_LIMIT_REMAINING_HEADER = "RateLimit-Remaining"
+	RATE_LIMIT_RESET_HEADER     = "RateLimit-Reset"
+
+	// Only used with GO_MICROSERVICE_1_RATE_LIMIT_TRUST_FORWARDED_FOR
+	FORWARDED_FOR_HEADER = "X-Forwarded-For"
+)
+
+var (
+	ErrRateLimited = errors.New("Rate limit exceeded")
+)
+
+// rateLimit applies the GO_MICROSERVICE_1_RATE_LIMITS rules of group,
+// answering with a 429 once they are exceeded. Add it after the auth
+// middleware, so that only authenticated requests are counted.
+func (a *API) rateLimit(group string) rye.Handler {
+	return func(rw http.ResponseWriter, r *http.Request) *rye.Response {
+		if a.Deps.RateLimiter == nil {
+			return nil
+		}
+
+		keys := map[string]string{
+			ratelimit.KEY_IP:    clientIP(r, a.trustedProxies()),
+			ratelimit.KEY_ROUTE: r.Method + " " + metrics.RouteTemplate(r),
+		}
+
+		if r.Header.Get(ACCESS_TOKEN_HEADER) != "" {
+			keys[ratelimit.KEY_TOKEN] = tokenFingerprint(r)
+		}
+
+		res, err := a.Deps.RateLimiter.Allow(r.Context(), group, keys)
+		if err != nil {
+			log.WithError(err).Warn("Unable to apply rate limits")
+
+			if !a.Config.RateLimitFailOpen {
+				rw.Header().Set("Retry-After", RETRY_AFTER_SEC)
+				return &rye.Response{Err: err, StatusCode: http.StatusServiceUnavailable}
+			}
+		}
+
+		if res == nil {
+			return nil
+		}
+
+		rw.Header().Set(RATE_LIMIT_LIMIT_HEADER, strconv.Itoa(res.Limit))
+		rw.Header().Set(RATE_LIMIT_REMAINING_HEADER, strconv.Itoa(res.Remaining))
+		rw.Header().Set(RATE_LIMIT_RESET_HEADER, strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			rw.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			return &rye.Response{Err: ErrRateLimited, StatusCode: http.StatusTooManyRequests}
+		}
+
+		return nil
+	}
+}
+
+// clientIP is the address the request came from or, behind trustedProxies
+// (0 if X-Forwarded-For is not trusted), the client the farthest of them
+// says it forwarded it for. Every proxy appends the address it got the
+// request from, so only the last trustedProxies entries can be relied on:
+// the ones before are up to the client.
+func clientIP(r *http.Request, trustedProxies int) string {
+	if trustedProxies > 0 {
+		fwd := strings.Split(r.Header.Get(FORWARDED_FOR_HEADER), ",")
+
+		if i := len(fwd) - trustedProxies; i >= 0 {
+			if ip := strings.TrimSpace(fwd[i]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// trustedProxies returns how many proxies X-Forwarded-For entries can be
+// taken from (see clientIP)
+func (a *API) trustedProxies() int {
+	if !a.Config.RateLimitTrustForwardedFor {
+		return 0
+	}
+
+	if a.Config.RateLimitTrustedProxies < 1 {
+		return 1
+	}
+
+	return a.Config.RateLimitTrustedProxies
+}
+
+// ceilSeconds rounds d up to whole seconds, as headers carry them
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/InVisionApp/rye"
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/deps"
+	"github.com/dfraglabs/go-microservice-1/fakes/ratelimitstore"
+	"github.com/dfraglabs/go-microservice-1/ratelimit"
+)
+
+var _ = Describe("rateLimit", func() {
+	var (
+		api    *API
+		d      *deps.Dependencies
+		router *mux.Router
+	)
+
+	ok := func(rw http.ResponseWriter, r *http.Request) *rye.Response {
+		rw.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	serve := func(h rye.Handler) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if resp := h(rw, r); resp != nil && !resp.StopExecution {
+				rye.WriteJSONStatus(rw, "error", resp.Error(), resp.StatusCode)
+				return
+			}
+
+			ok(rw, r)
+		}
+	}
+
+	newLimiter := func(store ratelimit.IStore, specs ...string) *ratelimit.Limiter {
+		l, err := ratelimit.NewLimiter(specs, store, nil)
+		Expect(err).ToNot(HaveOccurred())
+		return l
+	}
+
+	request := func(token, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/foos/1", nil)
+		req.RemoteAddr = ip + ":1234"
+		if token != "" {
+			req.Header.Set(ACCESS_TOKEN_HEADER, token)
+		}
+
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+
+		return response
+	}
+
+	BeforeEach(func() {
+		d = &deps.Dependencies{}
+		api = New(config.New(), d, "test")
+		api.Config.RateLimitFailOpen = true
+
+		router = mux.NewRouter()
+		router.HandleFunc("/v1/foos/{id}", serve(api.rateLimit(RATE_LIMIT_GROUP_V1))).Methods("GET")
+	})
+
+	It("should let everything through without a limiter", func() {
+		response := request("token", "10.0.0.1")
+
+		Expect(response.Code).To(Equal(http.StatusNoContent))
+		Expect(response.Header().Get(RATE_LIMIT_LIMIT_HEADER)).To(BeEmpty())
+	})
+
+	It("should set the RateLimit headers and reject with a 429 once exceeded", func() {
+		d.RateLimiter = newLimiter(ratelimit.NewMemoryStore(), "v1:token:token_bucket:2/m")
+
+		response := request("token", "10.0.0.1")
+		Expect(response.Code).To(Equal(http.StatusNoContent))
+		Expect(response.Header().Get(RATE_LIMIT_LIMIT_HEADER)).To(Equal("2"))
+		Expect(response.Header().Get(RATE_LIMIT_REMAINING_HEADER)).To(Equal("1"))
+		Expect(response.Header().Get(RATE_LIMIT_RESET_HEADER)).To(Equal("30"))
+
+		request("token", "10.0.0.1")
+
+		response = request("token", "10.0.0.1")
+		Expect(response.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(response.Header().Get(RATE_LIMIT_REMAINING_HEADER)).To(Equal("0"))
+		Expect(response.Header().Get("Retry-After")).To(Equal("30"))
+
+		// Another token has its own budget
+		Expect(request("other-token", "10.0.0.1").Code).To(Equal(http.StatusNoContent))
+	})
+
+	It("should count by client IP", func() {
+		d.RateLimiter = newLimiter(ratelimit.NewMemoryStore(), "v1:ip:sliding_window:1/m")
+
+		Expect(request("token", "10.0.0.1").Code).To(Equal(http.StatusNoContent))
+		Expect(request("other-token", "10.0.0.1").Code).To(Equal(http.StatusTooManyRequests))
+		Expect(request("token", "10.0.0.2").Code).To(Equal(http.StatusNoContent))
+	})
+
+	It("should count by route template", func() {
+		d.RateLimiter = newLimiter(ratelimit.NewMemoryStore(), "*:route:sliding_window:1/m")
+
+		Expect(request("token", "10.0.0.1").Code).To(Equal(http.StatusNoContent))
+
+		req := httptest.NewRequest("GET", "/v1/foos/2", nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+
+		Expect(response.Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("should only apply the rules of the group", func() {
+		d.RateLimiter = newLimiter(ratelimit.NewMemoryStore(), "admin:ip:sliding_window:1/m")
+
+		Expect(request("token", "10.0.0.1").Code).To(Equal(http.StatusNoContent))
+		Expect(request("token", "10.0.0.1").Code).To(Equal(http.StatusNoContent))
+	})
+
+	Context("when the store fails", func() {
+		BeforeEach(func() {
+			store := &ratelimitstore.FakeIStore{}
+			store.TakeReturns(nil, errors.New("boom"))
+
+			d.RateLimiter = newLimiter(store, "v1:token:token_bucket:1/m")
+		})
+
+		It("should fail open", func() {
+			Expect(request("token", "10.0.0.1").Code).To(Equal(http.StatusNoContent))
+		})
+
+		It("should fail closed if told to", func() {
+			api.Config.RateLimitFailOpen = false
+
+			response := request("token", "10.0.0.1")
+			Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(response.Header().Get("Retry-After")).To(Equal(RETRY_AFTER_SEC))
+		})
+	})
+
+	Describe("clientIP", func() {
+		It("should only trust X-Forwarded-For if told to", func() {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set(FORWARDED_FOR_HEADER, "192.168.1.1")
+
+			Expect(clientIP(req, 0)).To(Equal("10.0.0.1"))
+			Expect(clientIP(req, 1)).To(Equal("192.168.1.1"))
+		})
+
+		It("should ignore the entries the client sent", func() {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "10.0.0.2:1234"
+
+			// Spoofed by the client, then appended by two proxies
+			req.Header.Set(FORWARDED_FOR_HEADER, "1.1.1.1, 192.168.1.1, 10.0.0.1")
+
+			Expect(clientIP(req, 1)).To(Equal("10.0.0.1"))
+			Expect(clientIP(req, 2)).To(Equal("192.168.1.1"))
+
+			// Fewer entries than proxies: not forwarded by all of them
+			Expect(clientIP(req, 4)).To(Equal("10.0.0.2"))
+		})
+	})
+})
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/InVisionApp/rye"
+
+	"github.com/dfraglabs/go-microservice-1/events"
+)
+
+const (
+	// Set by EventSource when reconnecting; the query param of the same name
+	// is the fallback for clients that cannot set headers
+	LAST_EVENT_ID_HEADER = "Last-Event-ID"
+	LAST_EVENT_ID_PARAM  = "last_event_id"
+
+	// Comma separated "<type>:<id>" (ie. "foo:5bc9d3d2e138230001a4b1c2"),
+	// may be repeated
+	RESOURCES_PARAM = "resources"
+
+	// Sent when some events could not be replayed on resume; clients should
+	// refetch the resources they stream
+	STREAM_RESET_EVENT = "reset"
+
+	// Tells EventSource how long to wait before reconnecting
+	STREAM_RETRY_MS = 3000
+
+	DEFAULT_STREAM_HEARTBEAT = 15 * time.Second
+)
+
+// Aggregate types that can be streamed
+var streamableTypes = map[string]bool{
+	events.FOO_AGGREGATE: true,
+	events.BAR_AGGREGATE: true,
+}
+
+// @Summary Streams changes of resources
+// @Description Server-Sent Events stream of the domain events about the given resources (made through the replica serving the stream); every event's `data` is the event envelope. Reconnect with `Last-Event-ID` to resume; a `reset` event means some events could not be replayed and the resources should be refetched. Connections are closed after GO_MICROSERVICE_1_STREAM_MAX_DURATION_SEC and when falling too far behind.
+// @Tags stream
+// @Produce text/event-stream
+// @Param resources query string true "Comma separated resources, ie. foo:5bc9d3d2e138230001a4b1c2,bar:1"
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Success 200 {string} string "The event stream"
+// @Failure 400 {object} rye.JSONStatus "Missing, unknown or too many resources"
+// @Failure 503 {object} rye.JSONStatus "Too many open streams"
+// @Router /v1/stream [get]
+func (a *API) streamHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	topics, err := a.streamTopics(r)
+	if err != nil {
+		return &rye.Response{Err: err, StatusCode: http.StatusBadRequest}
+	}
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		return &rye.Response{Err: errors.New("Streaming is not supported"), StatusCode: http.StatusInternalServerError}
+	}
+
+	select {
+	case a.streams <- struct{}{}:
+		defer func() { <-a.streams }()
+	default:
+		rw.Header().Set("Retry-After", RETRY_AFTER_SEC)
+		return &rye.Response{Err: errors.New("Too many open streams"), StatusCode: http.StatusServiceUnavailable}
+	}
+
+	lastID := r.Header.Get(LAST_EVENT_ID_HEADER)
+	if lastID == "" {
+		lastID = r.URL.Query().Get(LAST_EVENT_ID_PARAM)
+	}
+
+	sub, missed, complete := a.Deps.Broker.Subscribe(topics, lastID)
+	defer sub.Close()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.Header().Set("X-Accel-Buffering", "no") // nginx
+	rw.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(rw, "retry: %d\n\n", STREAM_RETRY_MS)
+
+	if !complete {
+		fmt.Fprintf(rw, "event: %s\ndata: {}\n\n", STREAM_RESET_EVENT)
+	}
+
+	for _, m := range missed {
+		if err := writeStreamMessage(rw, m); err != nil {
+			return &rye.Response{StopExecution: true}
+		}
+	}
+
+	flusher.Flush()
+
+	interval := time.Duration(a.Config.StreamHeartbeatSec) * time.Second
+	if interval <= 0 {
+		interval = DEFAULT_STREAM_HEARTBEAT
+	}
+
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	// Clients resume with Last-Event-ID; this spreads long lived
+	// connections across replicas over time
+	var deadline <-chan time.Time
+
+	if a.Config.StreamMaxDurationSec > 0 {
+		t := time.NewTimer(time.Duration(a.Config.StreamMaxDurationSec) * time.Second)
+		defer t.Stop()
+
+		deadline = t.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return &rye.Response{StopExecution: true}
+		case <-a.stopping:
+			return &rye.Response{StopExecution: true}
+		case <-deadline:
+			return &rye.Response{StopExecution: true}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(rw, ": heartbeat\n\n"); err != nil {
+				return &rye.Response{StopExecution: true}
+			}
+		case m, ok := <-sub.C:
+			if !ok {
+				// Dropped for lagging behind; the client resumes from where
+				// it got to
+				return &rye.Response{StopExecution: true}
+			}
+
+			if err := writeStreamMessage(rw, m); err != nil {
+				return &rye.Response{StopExecution: true}
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+// streamTopics returns the broker topics of the resources requested
+func (a *API) streamTopics(r *http.Request) ([]string, error) {
+	topics := []string{}
+	seen := map[string]bool{}
+
+	for _, param := range r.URL.Query()[RESOURCES_PARAM] {
+		for _, res := range strings.Split(param, ",") {
+			res = strings.TrimSpace(res)
+			if res == "" || seen[res] {
+				continue
+			}
+
+			parts := strings.SplitN(res, ":", 2)
+			if len(parts) != 2 || parts[1] == "" || !streamableTypes[parts[0]] {
+				return nil, fmt.Errorf("Invalid resource '%s'", res)
+			}
+
+			seen[res] = true
+			topics = append(topics, events.Topic(parts[0], parts[1]))
+		}
+	}
+
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("Missing '%s' query param", RESOURCES_PARAM)
+	}
+
+	if len(topics) > a.Config.StreamMaxResources {
+		return nil, fmt.Errorf("At most %d resources can be streamed at once", a.Config.StreamMaxResources)
+	}
+
+	return topics, nil
+}
+
+func writeStreamMessage(w io.Writer, m *events.Message) error {
+	data, err := json.Marshal(m.Event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", m.ID, m.Event.Type, data)
+
+	return err
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/InVisionApp/rye"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/deps"
+	"github.com/dfraglabs/go-microservice-1/events"
+)
+
+var _ = Describe("Stream handler", func() {
+	var (
+		api    *API
+		broker *events.Broker
+		server *httptest.Server
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		id = "5bc9d3d2e138230001a4b1c2"
+	)
+
+	handle := func(h rye.Handler) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if resp := h(rw, r); resp != nil && !resp.StopExecution {
+				rye.WriteJSONStatus(rw, "error", resp.Error(), resp.StatusCode)
+			}
+		}
+	}
+
+	// stream opens a stream and returns its lines as they come in
+	stream := func(query string, lastID string) (*http.Response, <-chan string) {
+		req, err := http.NewRequest("GET", server.URL+"/v1/stream?"+query, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		if lastID != "" {
+			req.Header.Set(LAST_EVENT_ID_HEADER, lastID)
+		}
+
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		Expect(err).ToNot(HaveOccurred())
+
+		lines := make(chan string, 100)
+
+		go func() {
+			defer close(lines)
+
+			s := bufio.NewScanner(resp.Body)
+			for s.Scan() {
+				lines <- s.Text()
+			}
+		}()
+
+		return resp, lines
+	}
+
+	// next returns the next "field: value" line with the given field
+	next := func(lines <-chan string, field string) string {
+		for {
+			var line string
+			Eventually(lines).Should(Receive(&line))
+
+			if strings.HasPrefix(line, field+": ") {
+				return strings.TrimPrefix(line, field+": ")
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		cfg := config.New()
+		cfg.StreamMaxConnections = 2
+		cfg.StreamMaxResources = 2
+
+		broker = events.NewBroker(events.BrokerOpts{})
+		api = New(cfg, &deps.Dependencies{Broker: broker}, "test")
+
+		server = httptest.NewServer(handle(api.streamHandler))
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.Close()
+	})
+
+	It("should stream the events of the subscribed resources", func() {
+		resp, lines := stream("resources=foo:"+id, "")
+		defer resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		Eventually(broker.Subscribers).Should(Equal(1))
+
+		broker.Publish(ctx, events.New(&events.FooUpdated{ID: "other"}, ""))
+		broker.Publish(ctx, events.New(&events.FooUpdated{ID: id, Value: 7}, ""))
+
+		Expect(next(lines, "event")).To(Equal(events.FOO_UPDATED))
+		Expect(next(lines, "data")).To(ContainSubstring(`"aggregate_id":"` + id + `"`))
+	})
+
+	It("should resume after the Last-Event-ID", func() {
+		resp, lines := stream("resources=foo:"+id, "")
+
+		Eventually(broker.Subscribers).Should(Equal(1))
+		broker.Publish(ctx, events.New(&events.FooUpdated{ID: id, Value: 1}, ""))
+
+		lastID := next(lines, "id")
+		resp.Body.Close()
+
+		Eventually(broker.Subscribers).Should(BeZero())
+		broker.Publish(ctx, events.New(&events.FooDeleted{ID: id}, ""))
+
+		resp, lines = stream("resources=foo:"+id, lastID)
+		defer resp.Body.Close()
+
+		Expect(next(lines, "event")).To(Equal(events.FOO_DELETED))
+	})
+
+	It("should tell clients resuming from an unknown event to refetch", func() {
+		resp, lines := stream("resources=foo:"+id, "unknown-1")
+		defer resp.Body.Close()
+
+		Expect(next(lines, "event")).To(Equal(STREAM_RESET_EVENT))
+	})
+
+	It("should reject unknown resources", func() {
+		resp, _ := stream("resources=baz:1", "")
+		defer resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should limit the resources per stream", func() {
+		resp, _ := stream("resources=foo:a,foo:b&resources=bar:1", "")
+		defer resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should limit the open streams", func() {
+		for i := 0; i < 2; i++ {
+			resp, _ := stream("resources=bar:1", "")
+			defer resp.Body.Close()
+		}
+
+		resp, _ := stream("resources=bar:1", "")
+		defer resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should end streams on shutdown", func() {
+		resp, lines := stream("resources=bar:1", "")
+		defer resp.Body.Close()
+
+		close(api.stopping)
+
+		Eventually(lines).Should(BeClosed())
+	})
+})
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/InVisionApp/rye"
+	"github.com/gorilla/mux"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/dal/webhooks"
+)
+
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"` // event types, "prefix.*" or "*"
+	Description string   `json:"description,omitempty"`
+	Secret      string   `json:"secret,omitempty"` // generated if empty
+}
+
+// WebhookCreatedJSON is the only response carrying the secret
+type WebhookCreatedJSON struct {
+	*webhooks.Subscription
+	Secret string `json:"secret"`
+}
+
+// @Summary Subscribes a URL to domain events
+// @Description Matching events are POSTed as JSON, signed in `X-Webhook-Signature` (`v1=` followed by the hex HMAC-SHA256 of `<X-Webhook-Timestamp>.<body>` keyed with the secret). Failed deliveries are retried with exponential backoff; subscriptions failing repeatedly are disabled.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param webhook body api.WebhookRequest true "The subscription"
+// @Success 201 {object} api.WebhookCreatedJSON "The subscription, with its secret"
+// @Failure 400 {object} rye.JSONStatus "Invalid request body"
+// @Router /admin/v1/webhooks [post]
+func (a *API) createWebhookHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	req := &WebhookRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return &rye.Response{Err: fmt.Errorf("Invalid request body: %v", err), StatusCode: http.StatusBadRequest}
+	}
+
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &rye.Response{Err: fmt.Errorf("Invalid request body: url must be an absolute http(s) URL"), StatusCode: http.StatusBadRequest}
+	}
+
+	if err := webhooks.ValidateFilter(req.Events); err != nil {
+		return &rye.Response{Err: fmt.Errorf("Invalid request body: %v", err), StatusCode: http.StatusBadRequest}
+	}
+
+	sub := &webhooks.Subscription{
+		URL:         req.URL,
+		Events:      req.Events,
+		Description: req.Description,
+		Secret:      req.Secret,
+	}
+
+	if err := a.Deps.Webhooks.CreateSubscription(r.Context(), sub); err != nil {
+		return errorResponse(err)
+	}
+
+	rw.Header().Set(LOCATION_HEADER, "/admin/v1/webhooks/"+sub.ID.Hex())
+
+	return writeJSON(rw, &WebhookCreatedJSON{Subscription: sub, Secret: sub.Secret}, http.StatusCreated)
+}
+
+// @Summary Lists webhook subscriptions
+// @Tags admin
+// @Produce json
+// @Success 200 {object} api.ListResponseJSON "Every subscription"
+// @Router /admin/v1/webhooks [get]
+func (a *API) listWebhooksHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	subs, err := a.Deps.Webhooks.ListSubscriptions(r.Context())
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return writeList(rw, r, subs, &dalutil.PageInfo{Limit: len(subs)})
+}
+
+// @Summary Fetches a webhook subscription
+// @Description `status` is `disabled` (with a `disabled_reason`) once deliveries failed too many times in a row.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} webhooks.Subscription "The subscription"
+// @Failure 404 {object} rye.JSONStatus "No such subscription"
+// @Router /admin/v1/webhooks/{id} [get]
+func (a *API) getWebhookHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	sub, err := a.Deps.Webhooks.GetSubscription(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return writeJSON(rw, sub, http.StatusOK)
+}
+
+// @Summary Deletes a webhook subscription
+// @Description Its pending deliveries are canceled.
+// @Tags admin
+// @Param id path string true "Subscription ID"
+// @Success 204 "The subscription was deleted"
+// @Failure 404 {object} rye.JSONStatus "No such subscription"
+// @Router /admin/v1/webhooks/{id} [delete]
+func (a *API) deleteWebhookHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	if err := a.Deps.Webhooks.DeleteSubscription(r.Context(), mux.Vars(r)["id"]); err != nil {
+		return errorResponse(err)
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// @Summary Re-enables a webhook subscription
+// @Description Resets its failure count; deliveries canceled while it was disabled can be redelivered.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} webhooks.Subscription "The subscription"
+// @Failure 404 {object} rye.JSONStatus "No such subscription"
+// @Router /admin/v1/webhooks/{id}/enable [post]
+func (a *API) enableWebhookHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	sub, err := a.Deps.Webhooks.EnableSubscription(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return writeJSON(rw, sub, http.StatusOK)
+}
+
+// @Summary Lists the recent deliveries of a webhook subscription
+// @Description Newest first, with their latest attempts. Finished deliveries expire after a week.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param limit query int false "Number of deliveries" default(50)
+// @Success 200 {object} api.ListResponseJSON "Deliveries"
+// @Failure 400 {object} rye.JSONStatus "Invalid limit"
+// @Router /admin/v1/webhooks/{id}/deliveries [get]
+func (a *API) webhookDeliveriesHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	limit, resp := parseLimit(r)
+	if resp != nil {
+		return resp
+	}
+
+	deliveries, err := a.Deps.Webhooks.Deliveries(r.Context(), mux.Vars(r)["id"], limit)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return writeList(rw, r, deliveries, &dalutil.PageInfo{Limit: limit})
+}
+
+// @Summary Redelivers a webhook delivery
+// @Description The event is sent again with a fresh set of attempts, whatever the status of the delivery.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Delivery ID"
+// @Success 202 {object} webhooks.Delivery "The pending delivery"
+// @Failure 404 {object} rye.JSONStatus "No such delivery"
+// @Failure 409 {object} rye.JSONStatus "The subscription is disabled"
+// @Router /admin/v1/webhooks/deliveries/{id}/redeliver [post]
+func (a *API) redeliverWebhookHandler(rw http.ResponseWriter, r *http.Request) *rye.Response {
+	d, err := a.Deps.Webhooks.Redeliver(r.Context(), mux.Vars(r)["id"])
+
+	switch {
+	case err == webhooks.ErrSubscriptionDisabled:
+		return &rye.Response{Err: err, StatusCode: http.StatusConflict}
+	case err != nil:
+		return errorResponse(err)
+	}
+
+	return writeJSON(rw, d, http.StatusAccepted)
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}, status int) *rye.Response {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	rye.WriteJSONResponse(rw, status, body)
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/InVisionApp/rye"
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/webhooks"
+	"github.com/dfraglabs/go-microservice-1/deps"
+	"github.com/dfraglabs/go-microservice-1/fakes/webhooksvc"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+var _ = Describe("Webhook handlers", func() {
+	var (
+		api      *API
+		fakeHook *webhooksvc.FakeIWebhooks
+		router   *mux.Router
+		response *httptest.ResponseRecorder
+
+		id = "5bc9d3d2e138230001a4b1c2"
+	)
+
+	handle := func(h rye.Handler) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if resp := h(rw, r); resp != nil && !resp.StopExecution {
+				rye.WriteJSONStatus(rw, "error", resp.Error(), resp.StatusCode)
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		fakeHook = &webhooksvc.FakeIWebhooks{}
+		api = New(config.New(), &deps.Dependencies{Webhooks: fakeHook}, "test")
+
+		router = mux.NewRouter()
+		router.HandleFunc("/admin/v1/webhooks", handle(api.createWebhookHandler)).Methods("POST")
+		router.HandleFunc("/admin/v1/webhooks/{id}", handle(api.getWebhookHandler)).Methods("GET")
+		router.HandleFunc("/admin/v1/webhooks/{id}/deliveries", handle(api.webhookDeliveriesHandler)).Methods("GET")
+		router.HandleFunc("/admin/v1/webhooks/deliveries/{id}/redeliver", handle(api.redeliverWebhookHandler)).Methods("POST")
+
+		response = httptest.NewRecorder()
+	})
+
+	Describe("createWebhookHandler", func() {
+		It("should create the subscription and hand out its secret", func() {
+			fakeHook.CreateSubscriptionStub = func(_ context.Context, sub *webhooks.Subscription) error {
+				sub.ID = bson.ObjectIdHex(id)
+				sub.Secret = "generated"
+				return nil
+			}
+
+			req := httptest.NewRequest("POST", "/admin/v1/webhooks", strings.NewReader(`{"url": "https://example.com/hook", "events": ["foo.*"]}`))
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusCreated))
+			Expect(response.Header().Get(LOCATION_HEADER)).To(Equal("/admin/v1/webhooks/" + id))
+
+			_, sub := fakeHook.CreateSubscriptionArgsForCall(0)
+			Expect(sub.URL).To(Equal("https://example.com/hook"))
+			Expect(sub.Events).To(Equal([]string{"foo.*"}))
+
+			body := map[string]interface{}{}
+			Expect(json.Unmarshal(response.Body.Bytes(), &body)).To(Succeed())
+			Expect(body["secret"]).To(Equal("generated"))
+		})
+
+		It("should reject a relative URL", func() {
+			req := httptest.NewRequest("POST", "/admin/v1/webhooks", strings.NewReader(`{"url": "/hook", "events": ["*"]}`))
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+			Expect(fakeHook.CreateSubscriptionCallCount()).To(Equal(0))
+		})
+
+		It("should reject a malformed event filter", func() {
+			req := httptest.NewRequest("POST", "/admin/v1/webhooks", strings.NewReader(`{"url": "https://example.com/hook", "events": ["foo*"]}`))
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("getWebhookHandler", func() {
+		It("should not disclose the secret", func() {
+			fakeHook.GetSubscriptionReturns(&webhooks.Subscription{URL: "https://example.com/hook", Secret: "s3cr3t"}, nil)
+
+			req := httptest.NewRequest("GET", "/admin/v1/webhooks/"+id, nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Body.String()).ToNot(ContainSubstring("s3cr3t"))
+		})
+
+		It("should return 404 for an unknown subscription", func() {
+			fakeHook.GetSubscriptionReturns(nil, errtype.KeyNotFoundErr{E: errors.New("no such subscription")})
+
+			req := httptest.NewRequest("GET", "/admin/v1/webhooks/"+id, nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("webhookDeliveriesHandler", func() {
+		It("should list the latest deliveries", func() {
+			fakeHook.DeliveriesReturns([]*webhooks.Delivery{{Status: webhooks.DELIVERY_RETRYING}}, nil)
+
+			req := httptest.NewRequest("GET", "/admin/v1/webhooks/"+id+"/deliveries?limit=5", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+
+			_, gotID, limit := fakeHook.DeliveriesArgsForCall(0)
+			Expect(gotID).To(Equal(id))
+			Expect(limit).To(Equal(5))
+		})
+	})
+
+	Describe("redeliverWebhookHandler", func() {
+		It("should schedule the delivery again", func() {
+			fakeHook.RedeliverReturns(&webhooks.Delivery{Status: webhooks.DELIVERY_PENDING}, nil)
+
+			req := httptest.NewRequest("POST", "/admin/v1/webhooks/deliveries/"+id+"/redeliver", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusAccepted))
+		})
+
+		It("should return 409 if the subscription is disabled", func() {
+			fakeHook.RedeliverReturns(nil, webhooks.ErrSubscriptionDisabled)
+
+			req := httptest.NewRequest("POST", "/admin/v1/webhooks/deliveries/"+id+"/redeliver", nil)
+			router.ServeHTTP(response, req)
+
+			Expect(response.Code).To(Equal(http.StatusConflict))
+		})
+	})
+})
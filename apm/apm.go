@@ -0,0 +1,179 @@
+package apm
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DATASTORE_MONGODB = "MongoDB"
+)
+
+var log = logrus.WithField("pkg", "apm")
+
+// ITracer is implemented by every APM integration (ie. New Relic). Inbound
+// handlers, outbound API calls and datastore operations are all reported
+// through it so that swapping (or disabling) the APM does not touch callers.
+type ITracer interface {
+	// WrapHandle instruments an inbound HTTP handler; mirrors newrelic.WrapHandle
+	WrapHandle(pattern string, handler http.Handler) (string, http.Handler)
+
+	// StartExternalSegment times an outbound HTTP call made on behalf of the
+	// request (transaction) carried in ctx
+	StartExternalSegment(ctx context.Context, req *http.Request) IExternalSegment
+
+	// StartDatastoreSegment times a single datastore operation made on behalf
+	// of the request (transaction) carried in ctx
+	StartDatastoreSegment(ctx context.Context, ds Datastore) ISegment
+
+	// Shutdown flushes any pending data
+	Shutdown(timeout time.Duration)
+
+	// Enabled is false when nothing is reported, so that callers can skip
+	// preparing what they would report (ie. query statements)
+	Enabled() bool
+}
+
+type ISegment interface {
+	// SetError flags the operation as failed; must be called before End()
+	SetError(err error)
+	End()
+}
+
+type IExternalSegment interface {
+	End(resp *http.Response)
+}
+
+// Datastore describes a single datastore operation
+type Datastore struct {
+	Product    string
+	Database   string
+	Collection string
+	Operation  string
+
+	// Statement is a parameterized (redacted) representation of the query
+	Statement string
+	Query     map[string]interface{}
+}
+
+/*****************
+ Noop
+*****************/
+
+// Noop is the default tracer; used whenever no APM is configured
+type Noop struct{}
+
+func NewNoop() *Noop {
+	return &Noop{}
+}
+
+func (n *Noop) WrapHandle(pattern string, handler http.Handler) (string, http.Handler) {
+	return pattern, handler
+}
+
+func (n *Noop) StartExternalSegment(ctx context.Context, req *http.Request) IExternalSegment {
+	return noopExternalSegment{}
+}
+
+func (n *Noop) StartDatastoreSegment(ctx context.Context, ds Datastore) ISegment {
+	return noopSegment{}
+}
+
+func (n *Noop) Shutdown(timeout time.Duration) {}
+
+func (n *Noop) Enabled() bool {
+	return false
+}
+
+type noopSegment struct{}
+
+func (noopSegment) SetError(err error) {}
+func (noopSegment) End()               {}
+
+type noopExternalSegment struct{}
+
+func (noopExternalSegment) End(resp *http.Response) {}
+
+/*****************
+ Multi
+*****************/
+
+// Multi reports to all of the wrapped tracers (ie. New Relic + W3C tracing)
+type Multi struct {
+	tracers []ITracer
+}
+
+func NewMulti(tracers ...ITracer) *Multi {
+	return &Multi{
+		tracers: tracers,
+	}
+}
+
+// WrapHandle wraps handler with every tracer; the first tracer ends up outermost
+func (m *Multi) WrapHandle(pattern string, handler http.Handler) (string, http.Handler) {
+	for i := len(m.tracers) - 1; i >= 0; i-- {
+		pattern, handler = m.tracers[i].WrapHandle(pattern, handler)
+	}
+
+	return pattern, handler
+}
+
+func (m *Multi) StartExternalSegment(ctx context.Context, req *http.Request) IExternalSegment {
+	segs := make(multiExternalSegment, 0, len(m.tracers))
+	for _, t := range m.tracers {
+		segs = append(segs, t.StartExternalSegment(ctx, req))
+	}
+
+	return segs
+}
+
+func (m *Multi) StartDatastoreSegment(ctx context.Context, ds Datastore) ISegment {
+	segs := make(multiSegment, 0, len(m.tracers))
+	for _, t := range m.tracers {
+		segs = append(segs, t.StartDatastoreSegment(ctx, ds))
+	}
+
+	return segs
+}
+
+func (m *Multi) Shutdown(timeout time.Duration) {
+	for _, t := range m.tracers {
+		t.Shutdown(timeout)
+	}
+}
+
+// Enabled is true if any of the wrapped tracers is
+func (m *Multi) Enabled() bool {
+	for _, t := range m.tracers {
+		if t.Enabled() {
+			return true
+		}
+	}
+
+	return false
+}
+
+type multiSegment []ISegment
+
+func (m multiSegment) SetError(err error) {
+	for _, s := range m {
+		s.SetError(err)
+	}
+}
+
+func (m multiSegment) End() {
+	for i := len(m) - 1; i >= 0; i-- {
+		m[i].End()
+	}
+}
+
+type multiExternalSegment []IExternalSegment
+
+func (m multiExternalSegment) End(resp *http.Response) {
+	for i := len(m) - 1; i >= 0; i-- {
+		m[i].End(resp)
+	}
+}
@@ -0,0 +1,17 @@
+package apm
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAPMSuite(t *testing.T) {
+	// reduce the noise when testing
+	logrus.SetLevel(logrus.FatalLevel)
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "APM Suite")
+}
@@ -0,0 +1,95 @@
+package apm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	newrelic "github.com/newrelic/go-agent"
+)
+
+// fakeTxn records the errors noticed
+type fakeTxn struct {
+	newrelic.Transaction
+	errs []error
+}
+
+func (f *fakeTxn) NoticeError(err error) error {
+	f.errs = append(f.errs, err)
+	return nil
+}
+
+var _ = Describe("apm", func() {
+	Describe("Noop", func() {
+		var (
+			n *Noop
+		)
+
+		BeforeEach(func() {
+			n = NewNoop()
+		})
+
+		It("should pass the handler through untouched", func() {
+			called := false
+			p, h := n.WrapHandle("/foo", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo", nil))
+
+			Expect(p).To(Equal("/foo"))
+			Expect(called).To(BeTrue())
+		})
+
+		It("should return segments that can be ended", func() {
+			Expect(func() {
+				n.StartDatastoreSegment(context.Background(), Datastore{Operation: "find"}).End()
+				n.StartExternalSegment(context.Background(), httptest.NewRequest("GET", "/", nil)).End(nil)
+			}).ToNot(Panic())
+		})
+	})
+
+	Describe("Multi", func() {
+		It("should only be enabled if a wrapped tracer is", func() {
+			Expect(NewMulti(NewNoop()).Enabled()).To(BeFalse())
+			Expect(NewMulti(NewNoop(), &NewRelic{}).Enabled()).To(BeTrue())
+		})
+	})
+
+	Describe("NewRelic", func() {
+		Context("when the license key is invalid", func() {
+			It("should return an error", func() {
+				_, err := NewNewRelic("go-microservice-1", "too-short")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when there is no transaction in the context", func() {
+			It("should hand out noop segments", func() {
+				n := &NewRelic{}
+
+				Expect(n.StartDatastoreSegment(context.Background(), Datastore{})).To(Equal(noopSegment{}))
+				Expect(n.StartExternalSegment(context.Background(), nil)).To(Equal(noopExternalSegment{}))
+			})
+		})
+
+		Context("when a datastore operation fails", func() {
+			It("should notice the error on the transaction", func() {
+				txn := &fakeTxn{}
+				(&nrDatastoreSegment{txn: txn}).SetError(errors.New("boom"))
+
+				Expect(txn.errs).To(ConsistOf(MatchError("boom")))
+			})
+		})
+	})
+
+	Describe("TransactionFromContext", func() {
+		It("should return nil when no transaction is set", func() {
+			Expect(TransactionFromContext(context.Background())).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,123 @@
+package apm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+)
+
+type txnKey struct{}
+
+// NewRelic reports transactions and segments to New Relic
+type NewRelic struct {
+	app newrelic.Application
+}
+
+func NewNewRelic(appName, license string) (*NewRelic, error) {
+	cfg := newrelic.NewConfig(appName, license)
+
+	app, err := newrelic.NewApplication(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to instantiate New Relic application: %v", err)
+	}
+
+	return &NewRelic{
+		app: app,
+	}, nil
+}
+
+// WrapHandle starts a transaction per request. The transaction is passed
+// down both as the http.ResponseWriter (same as newrelic.WrapHandle) and via
+// the request context so that segments can be attached to it further down.
+func (n *NewRelic) WrapHandle(pattern string, handler http.Handler) (string, http.Handler) {
+	return pattern, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		txn := n.app.StartTransaction(pattern, rw, r)
+		defer txn.End()
+
+		handler.ServeHTTP(txn, r.WithContext(NewTransactionContext(r.Context(), txn)))
+	})
+}
+
+func (n *NewRelic) StartExternalSegment(ctx context.Context, req *http.Request) IExternalSegment {
+	txn := TransactionFromContext(ctx)
+	if txn == nil {
+		return noopExternalSegment{}
+	}
+
+	return &nrExternalSegment{newrelic.StartExternalSegment(txn, req)}
+}
+
+func (n *NewRelic) StartDatastoreSegment(ctx context.Context, ds Datastore) ISegment {
+	txn := TransactionFromContext(ctx)
+	if txn == nil {
+		return noopSegment{}
+	}
+
+	return &nrDatastoreSegment{txn: txn, s: newrelic.DatastoreSegment{
+		StartTime:          newrelic.StartSegmentNow(txn),
+		Product:            newrelic.DatastoreProduct(ds.Product),
+		DatabaseName:       ds.Database,
+		Collection:         ds.Collection,
+		Operation:          ds.Operation,
+		ParameterizedQuery: ds.Statement,
+		QueryParameters:    ds.Query,
+	}}
+}
+
+func (n *NewRelic) Shutdown(timeout time.Duration) {
+	n.app.Shutdown(timeout)
+}
+
+func (n *NewRelic) Enabled() bool {
+	return true
+}
+
+// NewTransactionContext returns a copy of ctx carrying the New Relic transaction
+func NewTransactionContext(ctx context.Context, txn newrelic.Transaction) context.Context {
+	return context.WithValue(ctx, txnKey{}, txn)
+}
+
+// TransactionFromContext returns the New Relic transaction carried by ctx (if any)
+func TransactionFromContext(ctx context.Context) newrelic.Transaction {
+	if ctx == nil {
+		return nil
+	}
+
+	txn, _ := ctx.Value(txnKey{}).(newrelic.Transaction)
+
+	return txn
+}
+
+type nrDatastoreSegment struct {
+	txn newrelic.Transaction
+	s   newrelic.DatastoreSegment
+}
+
+// SetError reports err on the transaction, as New Relic datastore segments
+// do not carry errors
+func (n *nrDatastoreSegment) SetError(err error) {
+	if err := n.txn.NoticeError(err); err != nil {
+		log.Debugf("Unable to notice datastore error: %v", err)
+	}
+}
+
+func (n *nrDatastoreSegment) End() {
+	if err := n.s.End(); err != nil {
+		log.Debugf("Unable to end datastore segment: %v", err)
+	}
+}
+
+type nrExternalSegment struct {
+	s newrelic.ExternalSegment
+}
+
+func (n *nrExternalSegment) End(resp *http.Response) {
+	n.s.Response = resp
+
+	if err := n.s.End(); err != nil {
+		log.Debugf("Unable to end external segment: %v", err)
+	}
+}
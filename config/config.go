@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"gopkg.in/caarlos0/env.v2"
@@ -11,6 +13,10 @@ const (
 	MIN_TOKEN_LENGTH = 16
 )
 
+var (
+	MONGO_MODES = []string{"primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest", "eventual"}
+)
+
 type Config struct {
 	ListenAddress string   `env:"GO_MICROSERVICE_1_LISTEN_ADDRESS" envDefault:":80"`
 	HealthFreqSec int      `env:"GO_MICROSERVICE_1_HEALTH_FREQ_SEC" envDefault:"60"`
@@ -18,6 +24,20 @@ type Config struct {
 	Tokens        []string `env:"GO_MICROSERVICE_1_TOKENS"`
 	ServiceName   string   `env:"GO_MICROSERVICE_1_SERVICE_NAME" envDefault:"go-microservice-1"`
 
+	// Signs pagination cursors; must be the same on every replica. Derived
+	// from GO_MICROSERVICE_1_TOKENS when empty (rotating tokens then
+	// invalidates outstanding cursors).
+	CursorSecret string `env:"GO_MICROSERVICE_1_CURSOR_SECRET"`
+
+	// Grant access to the /admin endpoints (audit history, restores); they
+	// are not served when empty
+	AdminTokens []string `env:"GO_MICROSERVICE_1_ADMIN_TOKENS"`
+
+	// mongodb:// or mongodb+srv:// connection string; any of the individual
+	// GO_MICROSERVICE_1_MONGO_DB_* vars that are explicitly set override it.
+	// The default of GO_MICROSERVICE_1_MONGO_DB_USE_SSL does not apply to it.
+	MongoURI string `env:"GO_MICROSERVICE_1_MONGO_URI"`
+
 	MongoDBName           string   `env:"GO_MICROSERVICE_1_MONGO_DB_NAME"`
 	MongoDBHosts          []string `env:"GO_MICROSERVICE_1_MONGO_DB_HOSTS"` // ports included here
 	MongoDBUser           string   `env:"GO_MICROSERVICE_1_MONGO_DB_USER"`
@@ -26,12 +46,115 @@ type Config struct {
 	MongoDBSource         string   `env:"GO_MICROSERVICE_1_MONGO_DB_AUTH_SOURCE"`
 	MongoDBConnUseSSL     bool     `env:"GO_MICROSERVICE_1_MONGO_DB_USE_SSL" envDefault:"true"`
 	MongoDBConnTimeoutSec int      `env:"GO_MICROSERVICE_1_MONGO_DB_TIMEOUT_SEC" envDefault:"30"`
+	MongoDBSlowQueryMs    int      `env:"GO_MICROSERVICE_1_MONGO_DB_SLOW_QUERY_MS" envDefault:"100"` // 0 disables slow query logging
+	MongoDBMaxSessions    int      `env:"GO_MICROSERVICE_1_MONGO_DB_MAX_SESSIONS" envDefault:"100"`
+	MongoDBOpTimeoutSec   int      `env:"GO_MICROSERVICE_1_MONGO_DB_OP_TIMEOUT_SEC" envDefault:"60"` // used when the request has no deadline
+	MongoDBAuthMechanism  string   `env:"GO_MICROSERVICE_1_MONGO_DB_AUTH_MECHANISM"`                 // ie. MONGODB-X509 for client certificate auth
+
+	MongoDBMode           string `env:"GO_MICROSERVICE_1_MONGO_DB_MODE" envDefault:"primary"`    // primary, primaryPreferred, secondary, secondaryPreferred, nearest, eventual
+	MongoDBWriteConcern   string `env:"GO_MICROSERVICE_1_MONGO_DB_WRITE_CONCERN" envDefault:"1"` // number of nodes or a tag set name such as "majority"
+	MongoDBWriteJournal   bool   `env:"GO_MICROSERVICE_1_MONGO_DB_WRITE_JOURNAL" envDefault:"false"`
+	MongoDBWriteTimeoutMs int    `env:"GO_MICROSERVICE_1_MONGO_DB_WRITE_TIMEOUT_MS" envDefault:"0"` // 0 waits forever
+	MongoDBTLSCAFile      string `env:"GO_MICROSERVICE_1_MONGO_DB_TLS_CA_FILE"`
+	MongoDBTLSCertFile    string `env:"GO_MICROSERVICE_1_MONGO_DB_TLS_CERT_FILE"`
+	MongoDBTLSKeyFile     string `env:"GO_MICROSERVICE_1_MONGO_DB_TLS_KEY_FILE"`
+	MongoDBTLSServerName  string `env:"GO_MICROSERVICE_1_MONGO_DB_TLS_SERVER_NAME"`
+
+	MongoDBConnectRetrySec       int  `env:"GO_MICROSERVICE_1_MONGO_DB_CONNECT_RETRY_SEC" envDefault:"60"`          // how long to keep retrying at startup; 0 tries once
+	MongoDBDegradedStart         bool `env:"GO_MICROSERVICE_1_MONGO_DB_DEGRADED_START" envDefault:"false"`          // start without Mongo and keep connecting in the background
+	MongoDBIndexAllowDestructive bool `env:"GO_MICROSERVICE_1_MONGO_DB_INDEX_ALLOW_DESTRUCTIVE" envDefault:"false"` // let startup rebuild indexes whose options changed; otherwise only warn
+
+	MigrationsOnStartup  bool `env:"GO_MICROSERVICE_1_MIGRATIONS_ON_STARTUP" envDefault:"false"` // apply pending migrations before serving
+	MigrationsTimeoutSec int  `env:"GO_MICROSERVICE_1_MIGRATIONS_TIMEOUT_SEC" envDefault:"600"`  // for the whole run, waiting for other replicas included
+
+	ShutdownTimeoutSec int `env:"GO_MICROSERVICE_1_SHUTDOWN_TIMEOUT_SEC" envDefault:"30"` // in-flight requests/jobs get this long to finish on SIGTERM
+
+	WorkerConcurrency       int  `env:"GO_MICROSERVICE_1_WORKER_CONCURRENCY" envDefault:"4"`
+	WorkerPollIntervalMs    int  `env:"GO_MICROSERVICE_1_WORKER_POLL_INTERVAL_MS" envDefault:"1000"`
+	WorkerInProcess         bool `env:"GO_MICROSERVICE_1_WORKER_IN_PROCESS" envDefault:"false"`        // also run jobs in the API server (instead of a separate `worker`)
+	JobVisibilityTimeoutSec int  `env:"GO_MICROSERVICE_1_JOB_VISIBILITY_TIMEOUT_SEC" envDefault:"300"` // a job whose worker died is retried after this long
+
+	// Scheduled tasks run on a single replica (API server or worker)
+	SchedulerEnabled  bool   `env:"GO_MICROSERVICE_1_SCHEDULER_ENABLED" envDefault:"false"`
+	SchedulerCatchUp  string `env:"GO_MICROSERVICE_1_SCHEDULER_CATCH_UP" envDefault:"skip"` // skip, once, all; what to do about runs missed while no replica ran the tasks
+	SchedulerLeaseSec int    `env:"GO_MICROSERVICE_1_SCHEDULER_LEASE_SEC" envDefault:"30"`  // another replica takes over this long after the running one died
+
+	// Domain events are recorded in an outbox and relayed (by a single
+	// replica) to the sink and webhooks; none disables both unless webhooks
+	// are enabled
+	EventsSink           string `env:"GO_MICROSERVICE_1_EVENTS_SINK" envDefault:"none"` // none, http, sns, file
+	EventsSinkURL        string `env:"GO_MICROSERVICE_1_EVENTS_SINK_URL"`               // endpoint of the http and sns sinks
+	EventsSNSTopicARN    string `env:"GO_MICROSERVICE_1_EVENTS_SNS_TOPIC_ARN"`
+	EventsFile           string `env:"GO_MICROSERVICE_1_EVENTS_FILE" envDefault:"events.jsonl"`
+	EventsMaxAttempts    int    `env:"GO_MICROSERVICE_1_EVENTS_MAX_ATTEMPTS" envDefault:"10"` // an event is dead lettered after this many failed publishes
+	EventsPollIntervalMs int    `env:"GO_MICROSERVICE_1_EVENTS_POLL_INTERVAL_MS" envDefault:"1000"`
 
-	FooAPIHost         string `env:"GO_MICROSERVICE_1_FOO_API_HOST"`
+	// Webhook deliveries of domain events; made by the job workers
+	WebhooksEnabled      bool `env:"GO_MICROSERVICE_1_WEBHOOKS_ENABLED" envDefault:"false"`
+	WebhooksMaxAttempts  int  `env:"GO_MICROSERVICE_1_WEBHOOKS_MAX_ATTEMPTS" envDefault:"8"`
+	WebhooksDisableAfter int  `env:"GO_MICROSERVICE_1_WEBHOOKS_DISABLE_AFTER" envDefault:"20"` // consecutive failed attempts before a subscription is disabled
+	WebhooksTimeoutSec   int  `env:"GO_MICROSERVICE_1_WEBHOOKS_TIMEOUT_SEC" envDefault:"10"`
 
-	StatsDAddress string  `env:"GO_MICROSERVICE_1_STATSD_ADDRESS" envDefault:"localhost:8125"`
-	StatsDPrefix  string  `env:"GO_MICROSERVICE_1_STATSD_PREFIX" envDefault:"statsd.go-microservice-1.dev"`
-	StatsDRate    float32 `env:"GO_MICROSERVICE_1_STATSD_RATE" envDefault:"1.0"`
+	// Server-Sent Events stream (/v1/stream) of the changes made through
+	// this replica
+	StreamEnabled        bool `env:"GO_MICROSERVICE_1_STREAM_ENABLED" envDefault:"false"`
+	StreamHeartbeatSec   int  `env:"GO_MICROSERVICE_1_STREAM_HEARTBEAT_SEC" envDefault:"15"`
+	StreamReplaySize     int  `env:"GO_MICROSERVICE_1_STREAM_REPLAY_SIZE" envDefault:"1000"`      // latest events kept for Last-Event-ID resumes
+	StreamMaxConnections int  `env:"GO_MICROSERVICE_1_STREAM_MAX_CONNECTIONS" envDefault:"1000"`  // per replica
+	StreamMaxResources   int  `env:"GO_MICROSERVICE_1_STREAM_MAX_RESOURCES" envDefault:"100"`     // per connection
+	StreamMaxDurationSec int  `env:"GO_MICROSERVICE_1_STREAM_MAX_DURATION_SEC" envDefault:"1800"` // connections are closed (and resumed by clients) after this long
+	StreamBufferSize     int  `env:"GO_MICROSERVICE_1_STREAM_BUFFER_SIZE" envDefault:"64"`        // events a connection may lag behind before it is closed
+
+	// In-process cache of foos; writes invalidate the caches of every
+	// replica through a capped collection
+	CacheEnabled    bool `env:"GO_MICROSERVICE_1_CACHE_ENABLED" envDefault:"false"`
+	CacheTTLSec     int  `env:"GO_MICROSERVICE_1_CACHE_TTL_SEC" envDefault:"60"` // bounds staleness should an invalidation get lost
+	CacheMaxEntries int  `env:"GO_MICROSERVICE_1_CACHE_MAX_ENTRIES" envDefault:"10000"`
+	PubSubSizeMB    int  `env:"GO_MICROSERVICE_1_PUBSUB_SIZE_MB" envDefault:"16"` // of the capped collection; only applies when creating it
+
+	// Idempotency-Key support on write routes
+	IdempotencyEnabled  bool `env:"GO_MICROSERVICE_1_IDEMPOTENCY_ENABLED" envDefault:"false"`
+	IdempotencyWaitMs   int  `env:"GO_MICROSERVICE_1_IDEMPOTENCY_WAIT_MS" envDefault:"2000"` // a duplicate of a request in flight waits this long before getting a 409
+	IdempotencyLeaseSec int  `env:"GO_MICROSERVICE_1_IDEMPOTENCY_LEASE_SEC" envDefault:"60"` // a request in flight is presumed dead (and retries run it again) after this long
+
+	// Rate limits of the API routes as "<group>:<key>:<algorithm>:<limit>/<period>[:<burst>]"
+	// (see ratelimit.ParseRule), ie. "v1:token:token_bucket:100/s:200";
+	// groups are v1 and admin (* for both), keys token, ip and route
+	RateLimits                 []string `env:"GO_MICROSERVICE_1_RATE_LIMITS"`
+	RateLimitStore             string   `env:"GO_MICROSERVICE_1_RATE_LIMIT_STORE" envDefault:"memory"`              // memory (a budget per replica), mongo (shared by every replica)
+	RateLimitTrustForwardedFor bool     `env:"GO_MICROSERVICE_1_RATE_LIMIT_TRUST_FORWARDED_FOR" envDefault:"false"` // take client IPs from X-Forwarded-For; only behind proxies appending to it
+	RateLimitTrustedProxies    int      `env:"GO_MICROSERVICE_1_RATE_LIMIT_TRUSTED_PROXIES" envDefault:"1"`         // how many of those proxies; the client IP is the entry this many from the right
+	RateLimitFailOpen          bool     `env:"GO_MICROSERVICE_1_RATE_LIMIT_FAIL_OPEN" envDefault:"true"`            // let requests through when the store fails
+
+	// Caps the requests served at once (health checks, admin calls and
+	// streams aside); requests over it wait in a short queue, then get a 503
+	ConcurrencyLimit           string `env:"GO_MICROSERVICE_1_CONCURRENCY_LIMIT" envDefault:"none"`        // none, static, aimd, gradient
+	ConcurrencyLimitInitial    int    `env:"GO_MICROSERVICE_1_CONCURRENCY_LIMIT_INITIAL" envDefault:"100"` // the static limit, or where adaptive ones start
+	ConcurrencyLimitMin        int    `env:"GO_MICROSERVICE_1_CONCURRENCY_LIMIT_MIN" envDefault:"10"`
+	ConcurrencyLimitMax        int    `env:"GO_MICROSERVICE_1_CONCURRENCY_LIMIT_MAX" envDefault:"1000"`
+	ConcurrencyLatencyTargetMs int    `env:"GO_MICROSERVICE_1_CONCURRENCY_LATENCY_TARGET_MS" envDefault:"250"` // aimd backs off when requests take longer
+	ConcurrencyQueueSize       int    `env:"GO_MICROSERVICE_1_CONCURRENCY_QUEUE_SIZE" envDefault:"50"`
+	ConcurrencyQueueTimeoutMs  int    `env:"GO_MICROSERVICE_1_CONCURRENCY_QUEUE_TIMEOUT_MS" envDefault:"100"`
+
+	FooAPIHost string `env:"GO_MICROSERVICE_1_FOO_API_HOST"`
+
+	NewRelicEnabled    bool   `env:"GO_MICROSERVICE_1_NEW_RELIC_ENABLED" envDefault:"false"`
+	NewRelicLicenseKey string `env:"GO_MICROSERVICE_1_NEW_RELIC_LICENSE_KEY"`
+	NewRelicAppName    string `env:"GO_MICROSERVICE_1_NEW_RELIC_APP_NAME" envDefault:"go-microservice-1"`
+
+	TracingExporter      string  `env:"GO_MICROSERVICE_1_TRACING_EXPORTER" envDefault:"none"` // none, stdout, file, otlp
+	TracingFile          string  `env:"GO_MICROSERVICE_1_TRACING_FILE" envDefault:"traces.jsonl"`
+	TracingOTLPEndpoint  string  `env:"GO_MICROSERVICE_1_TRACING_OTLP_ENDPOINT" envDefault:"http://localhost:4318"`
+	TracingSampleRate    float64 `env:"GO_MICROSERVICE_1_TRACING_SAMPLE_RATE" envDefault:"1.0"`
+	TracingIgnoreParent  bool    `env:"GO_MICROSERVICE_1_TRACING_IGNORE_PARENT_SAMPLING" envDefault:"false"`
+	TracingFlushInterval int     `env:"GO_MICROSERVICE_1_TRACING_FLUSH_INTERVAL_SEC" envDefault:"5"`
+
+	MetricsBackends []string `env:"GO_MICROSERVICE_1_METRICS_BACKENDS" envDefault:"statsd"` // statsd, prometheus
+
+	StatsDAddress   string  `env:"GO_MICROSERVICE_1_STATSD_ADDRESS" envDefault:"localhost:8125"`
+	StatsDPrefix    string  `env:"GO_MICROSERVICE_1_STATSD_PREFIX" envDefault:"statsd.go-microservice-1.dev"`
+	StatsDRate      float32 `env:"GO_MICROSERVICE_1_STATSD_RATE" envDefault:"1.0"`
+	StatsDTagFormat string  `env:"GO_MICROSERVICE_1_STATSD_TAG_FORMAT" envDefault:"name"` // name, dogstatsd
 }
 
 func New() *Config {
@@ -46,11 +169,52 @@ func (c *Config) LoadEnvVars() error {
 	var errorList []string
 
 	validations := []validation{
-		nonEmptyString{c.MongoDBName, "GO_MICROSERVICE_1_MONGO_DB_NAME"},
-		nonEmptyStringSlice{c.MongoDBHosts, "GO_MICROSERVICE_1_MONGO_DB_HOSTS"},
 		nonEmptyString{s: c.FooAPIHost, name: "GO_MICROSERVICE_1_FOO_API_HOST"},
 		nonEmptyStringSlice{s: c.Tokens, name: "GO_MICROSERVICE_1_TOKENS"},
 		tokenLength{s: c.Tokens, name: "GO_MICROSERVICE_1_TOKENS"},
+		tokenLength{s: c.AdminTokens, name: "GO_MICROSERVICE_1_ADMIN_TOKENS"},
+		oneOf{s: c.MetricsBackends, allowed: []string{"statsd", "prometheus"}, name: "GO_MICROSERVICE_1_METRICS_BACKENDS"},
+		oneOf{s: []string{c.TracingExporter}, allowed: []string{"none", "stdout", "file", "otlp"}, name: "GO_MICROSERVICE_1_TRACING_EXPORTER"},
+		oneOf{s: []string{c.StatsDTagFormat}, allowed: []string{"name", "dogstatsd"}, name: "GO_MICROSERVICE_1_STATSD_TAG_FORMAT"},
+		oneOf{s: []string{c.MongoDBMode}, allowed: MONGO_MODES, name: "GO_MICROSERVICE_1_MONGO_DB_MODE"},
+		oneOf{s: []string{c.SchedulerCatchUp}, allowed: []string{"skip", "once", "all"}, name: "GO_MICROSERVICE_1_SCHEDULER_CATCH_UP"},
+		oneOf{s: []string{c.EventsSink}, allowed: []string{"none", "http", "sns", "file"}, name: "GO_MICROSERVICE_1_EVENTS_SINK"},
+		oneOf{s: []string{c.ConcurrencyLimit}, allowed: []string{"none", "static", "aimd", "gradient"}, name: "GO_MICROSERVICE_1_CONCURRENCY_LIMIT"},
+		oneOf{s: []string{c.RateLimitStore}, allowed: []string{"memory", "mongo"}, name: "GO_MICROSERVICE_1_RATE_LIMIT_STORE"},
+		nonEmptyString{s: c.MongoDBWriteConcern, name: "GO_MICROSERVICE_1_MONGO_DB_WRITE_CONCERN"},
+	}
+
+	// The URI provides hosts and DB name (validated when it is parsed)
+	if c.MongoURI == "" {
+		validations = append(validations,
+			nonEmptyString{c.MongoDBName, "GO_MICROSERVICE_1_MONGO_DB_NAME"},
+			nonEmptyStringSlice{c.MongoDBHosts, "GO_MICROSERVICE_1_MONGO_DB_HOSTS"},
+		)
+	}
+
+	// Client certificate needs both halves
+	if c.MongoDBTLSCertFile != "" || c.MongoDBTLSKeyFile != "" {
+		validations = append(validations,
+			nonEmptyString{s: c.MongoDBTLSCertFile, name: "GO_MICROSERVICE_1_MONGO_DB_TLS_CERT_FILE"},
+			nonEmptyString{s: c.MongoDBTLSKeyFile, name: "GO_MICROSERVICE_1_MONGO_DB_TLS_KEY_FILE"},
+		)
+	}
+
+	switch c.EventsSink {
+	case "http":
+		validations = append(validations, nonEmptyString{s: c.EventsSinkURL, name: "GO_MICROSERVICE_1_EVENTS_SINK_URL"})
+	case "sns":
+		validations = append(validations,
+			nonEmptyString{s: c.EventsSinkURL, name: "GO_MICROSERVICE_1_EVENTS_SINK_URL"},
+			nonEmptyString{s: c.EventsSNSTopicARN, name: "GO_MICROSERVICE_1_EVENTS_SNS_TOPIC_ARN"},
+		)
+	}
+
+	if c.NewRelicEnabled {
+		validations = append(validations,
+			nonEmptyString{s: c.NewRelicLicenseKey, name: "GO_MICROSERVICE_1_NEW_RELIC_LICENSE_KEY"},
+			nonEmptyString{s: c.NewRelicAppName, name: "GO_MICROSERVICE_1_NEW_RELIC_APP_NAME"},
+		)
 	}
 
 	for _, v := range validations {
@@ -60,12 +224,19 @@ func (c *Config) LoadEnvVars() error {
 	}
 
 	if len(errorList) != 0 {
-		return fmt.Errorf(strings.Join(errorList, "; "))
+		return errors.New(strings.Join(errorList, "; "))
 	}
 
 	return nil
 }
 
+// IsSet reports whether envVar was explicitly set (as opposed to falling
+// back to its default)
+func (c *Config) IsSet(envVar string) bool {
+	_, ok := os.LookupEnv(envVar)
+	return ok
+}
+
 type validation interface {
 	validate() (bool, []string)
 }
@@ -115,3 +286,34 @@ func (t tokenLength) validate() (bool, []string) {
 
 	return true, nil
 }
+
+type oneOf struct {
+	s       []string
+	allowed []string
+	name    string
+}
+
+func (o oneOf) validate() (bool, []string) {
+	var errorList []string
+
+	for _, v := range o.s {
+		found := false
+
+		for _, a := range o.allowed {
+			if v == a {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			errorList = append(errorList, fmt.Sprintf("'%s' env var must be one of [%s] (got '%s')", o.name, strings.Join(o.allowed, ", "), v))
+		}
+	}
+
+	if len(errorList) > 0 {
+		return false, errorList
+	}
+
+	return true, nil
+}
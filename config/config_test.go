@@ -64,6 +64,48 @@ var _ = Describe("Config", func() {
 
 				Expect(err).To(BeNil())
 			})
+
+			It("should reject an unknown Mongo mode", func() {
+				os.Setenv("GO_MICROSERVICE_1_MONGO_DB_MODE", "tertiary")
+				defer os.Unsetenv("GO_MICROSERVICE_1_MONGO_DB_MODE")
+
+				err := cfg.LoadEnvVars()
+
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("GO_MICROSERVICE_1_MONGO_DB_MODE"))
+			})
+
+			It("should require both halves of the Mongo client certificate", func() {
+				os.Setenv("GO_MICROSERVICE_1_MONGO_DB_TLS_CERT_FILE", "client.pem")
+				defer os.Unsetenv("GO_MICROSERVICE_1_MONGO_DB_TLS_CERT_FILE")
+
+				err := cfg.LoadEnvVars()
+
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("missing 'GO_MICROSERVICE_1_MONGO_DB_TLS_KEY_FILE' env var"))
+			})
+
+			It("should reject short admin tokens", func() {
+				os.Setenv("GO_MICROSERVICE_1_ADMIN_TOKENS", "short")
+				defer os.Unsetenv("GO_MICROSERVICE_1_ADMIN_TOKENS")
+
+				err := cfg.LoadEnvVars()
+
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("short token must be at least"))
+			})
+
+			It("should require a topic for the sns events sink", func() {
+				os.Setenv("GO_MICROSERVICE_1_EVENTS_SINK", "sns")
+				os.Setenv("GO_MICROSERVICE_1_EVENTS_SINK_URL", "http://localhost:4566")
+				defer os.Unsetenv("GO_MICROSERVICE_1_EVENTS_SINK")
+				defer os.Unsetenv("GO_MICROSERVICE_1_EVENTS_SINK_URL")
+
+				err := cfg.LoadEnvVars()
+
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("missing 'GO_MICROSERVICE_1_EVENTS_SNS_TOPIC_ARN' env var"))
+			})
 		})
 	})
 
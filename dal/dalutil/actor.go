@@ -0,0 +1,32 @@
+package dalutil
+
+import (
+	"context"
+)
+
+const (
+	// Recorded as the actor of writes made outside of a request (ie. by
+	// migrations or background jobs)
+	SYSTEM_ACTOR = "system"
+)
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx attributing the writes made with it to
+// actor in the audit trail
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set via WithActor or SYSTEM_ACTOR
+func ActorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return SYSTEM_ACTOR
+	}
+
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+
+	return SYSTEM_ACTOR
+}
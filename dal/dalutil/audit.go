@@ -0,0 +1,222 @@
+package dalutil
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+const (
+	AUDIT_COLLECTION_NAME = "audit"
+
+	AUDIT_CREATE      = "create"
+	AUDIT_UPDATE      = "update"
+	AUDIT_DELETE      = "delete"
+	AUDIT_SOFT_DELETE = "soft_delete"
+	AUDIT_RESTORE     = "restore"
+
+	// Audit entries are written after the change itself and are not bound
+	// to the (possibly canceled) request ctx
+	auditTimeout = 10 * time.Second
+)
+
+var (
+	// Not part of diffs; they change on every write
+	unaudited = map[string]bool{"updated_at": true, "version": true}
+
+	// AuditListSpec is what a document history can be filtered and sorted on
+	AuditListSpec = &QuerySpec{
+		Fields: map[string]*FieldSpec{
+			"action":    {Type: FIELD_STRING, Ops: EQUALITY_OPS},
+			"actor":     {Type: FIELD_STRING, Ops: EQUALITY_OPS},
+			"version":   {Type: FIELD_INT, Ops: COMPARISON_OPS, Sortable: true},
+			"timestamp": {Type: FIELD_TIME, Ops: []string{OP_GT, OP_GTE, OP_LT, OP_LTE}, Sortable: true},
+		},
+		DefaultSort:  []string{"-timestamp"},
+		DefaultLimit: DEFAULT_PER_PAGE,
+		MaxLimit:     MAX_PER_PAGE,
+	}
+)
+
+// AuditEntry records a single write to a document
+type AuditEntry struct {
+	ID         bson.ObjectId  `bson:"_id" json:"id"`
+	Collection string         `bson:"collection" json:"collection"`
+	DocumentID bson.ObjectId  `bson:"document_id" json:"document_id"`
+	Action     string         `bson:"action" json:"action"`
+	Actor      string         `bson:"actor" json:"actor"`
+	Version    int64          `bson:"version" json:"version"` // of the document after the change; 0 once deleted
+	Changes    []*FieldChange `bson:"changes,omitempty" json:"changes,omitempty"`
+	After      bson.M         `bson:"after,omitempty" json:"after,omitempty"` // snapshot used to restore this version
+	Timestamp  time.Time      `bson:"timestamp" json:"timestamp"`
+}
+
+// FieldChange is a top level field that differs between two versions; a nil
+// Before/After means the field was absent
+type FieldChange struct {
+	Field  string      `bson:"field" json:"field"`
+	Before interface{} `bson:"before" json:"before"`
+	After  interface{} `bson:"after" json:"after"`
+}
+
+// Auditor stores and queries the audit trail; see Repository.WithAudit
+type Auditor struct {
+	coll *SmartCollection
+	repo *Repository
+}
+
+func NewAuditor(pool *SessionPool, inst *Instrumentation) *Auditor {
+	coll := NewSmartCollection(pool, AUDIT_COLLECTION_NAME, inst)
+
+	return &Auditor{
+		coll: coll,
+		repo: NewRepository(coll),
+	}
+}
+
+// AuditIndexes returns the indexes the audit collection should have
+func AuditIndexes() []*mgo.Index {
+	return []*mgo.Index{
+		{
+			Name: "document-version",
+			Key:  []string{"collection", "document_id", "-version"},
+		},
+		{
+			Name: "document-timestamp",
+			Key:  []string{"collection", "document_id", "-timestamp", "-_id"},
+		},
+	}
+}
+
+func (a *Auditor) EnsureIndexes(allowDestructive bool) error {
+	return a.coll.EnsureIndexes(AuditIndexes(), allowDestructive)
+}
+
+// Record stores entry
+func (a *Auditor) Record(ctx context.Context, entry *AuditEntry) error {
+	if entry.ID == "" {
+		entry.ID = bson.NewObjectId()
+	}
+
+	return a.coll.Insert(ctx, entry)
+}
+
+// History returns a page of the audit entries of a document
+func (a *Auditor) History(ctx context.Context, collection string, id bson.ObjectId, q *Query, codec *CursorCodec) ([]*AuditEntry, *PageInfo, error) {
+	entries := []*AuditEntry{}
+
+	info, err := a.repo.Page(ctx, bson.M{"collection": collection, "document_id": id}, q, codec, &entries)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entries, info, nil
+}
+
+// Snapshot returns the entry holding the given version of a document;
+// errtype.KeyNotFoundErr if there is none
+func (a *Auditor) Snapshot(ctx context.Context, collection string, id bson.ObjectId, version int64) (*AuditEntry, error) {
+	entry := &AuditEntry{}
+
+	err := a.coll.FindOne(ctx, bson.M{
+		"collection":  collection,
+		"document_id": id,
+		"version":     version,
+		"after":       bson.M{"$exists": true},
+	}, nil, entry)
+
+	if err == mgo.ErrNotFound {
+		return nil, errtype.KeyNotFoundErr{E: fmt.Errorf("%s: no recorded version %d of %s", collection, version, id.Hex())}
+	}
+
+	return entry, err
+}
+
+// LatestVersion returns the highest version recorded for a document (0 if none)
+func (a *Auditor) LatestVersion(ctx context.Context, collection string, id bson.ObjectId) (int64, error) {
+	entry := &AuditEntry{}
+
+	err := a.coll.FindOne(ctx, bson.M{"collection": collection, "document_id": id}, &FindOpts{
+		Select: bson.M{"version": 1},
+		Sort:   []string{"-version"},
+	}, entry)
+
+	switch {
+	case err == mgo.ErrNotFound:
+		return 0, nil
+	case err != nil:
+		return 0, err
+	}
+
+	return entry.Version, nil
+}
+
+// Diff lists the top level fields that differ between before and after
+// (either may be nil), sorted by name
+func Diff(before, after bson.M) []*FieldChange {
+	fields := map[string]bool{}
+
+	for k := range before {
+		fields[k] = true
+	}
+
+	for k := range after {
+		fields[k] = true
+	}
+
+	changes := []*FieldChange{}
+
+	for field := range fields {
+		if unaudited[field] {
+			continue
+		}
+
+		b, a := before[field], after[field]
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+
+		changes = append(changes, &FieldChange{Field: field, Before: b, After: a})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes
+}
+
+// snapshot returns doc as stored by Mongo
+func snapshot(doc interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	m := bson.M{}
+	if err := bson.Unmarshal(raw, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func versionOf(doc bson.M) int64 {
+	switch v := doc["version"].(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+
+	return 0
+}
@@ -0,0 +1,55 @@
+package dalutil
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Audit", func() {
+	Describe("Diff", func() {
+		It("should list changed, added and removed fields in order", func() {
+			before := bson.M{"a": 1, "b": "x", "c": true, "version": int64(1), "updated_at": time.Now()}
+			after := bson.M{"a": 2, "b": "x", "d": "new", "version": int64(2), "updated_at": time.Now()}
+
+			Expect(Diff(before, after)).To(Equal([]*FieldChange{
+				{Field: "a", Before: 1, After: 2},
+				{Field: "c", Before: true, After: nil},
+				{Field: "d", Before: nil, After: "new"},
+			}))
+		})
+
+		It("should handle creates and deletes", func() {
+			Expect(Diff(nil, bson.M{"a": 1})).To(Equal([]*FieldChange{{Field: "a", After: 1}}))
+			Expect(Diff(bson.M{"a": 1}, nil)).To(Equal([]*FieldChange{{Field: "a", Before: 1}}))
+		})
+	})
+
+	Describe("snapshot", func() {
+		It("should return the document as stored", func() {
+			doc := &Document{ID: bson.ObjectIdHex("5bc9d3d2e138230001a4b1c2"), Version: 3}
+
+			snap, err := snapshot(doc)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snap["_id"]).To(Equal(doc.ID))
+			Expect(versionOf(snap)).To(Equal(int64(3)))
+			Expect(snap).ToNot(HaveKey(DELETED_AT_FIELD))
+		})
+	})
+
+	Describe("ActorFromContext", func() {
+		It("should default to the system actor", func() {
+			Expect(ActorFromContext(context.Background())).To(Equal(SYSTEM_ACTOR))
+			Expect(ActorFromContext(WithActor(context.Background(), ""))).To(Equal(SYSTEM_ACTOR))
+		})
+
+		It("should return the actor set on the context", func() {
+			Expect(ActorFromContext(WithActor(context.Background(), "jane"))).To(Equal("jane"))
+		})
+	})
+})
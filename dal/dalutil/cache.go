@@ -0,0 +1,262 @@
+package dalutil
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	// Every replica's caches listen to it (see Cache.WithPubSub)
+	CACHE_INVALIDATION_CHANNEL = "cache.invalidate"
+
+	CACHE_LOOKUPS_METRIC = "cache.lookups"
+
+	DEFAULT_CACHE_TTL         = time.Minute
+	DEFAULT_CACHE_MAX_ENTRIES = 10000
+
+	// Invalidations are not bound to the caller's ctx
+	cacheInvalidationTimeout = 5 * time.Second
+)
+
+// cacheInvalidation is the payload of CACHE_INVALIDATION_CHANNEL messages;
+// an empty Key invalidates the whole cache
+type cacheInvalidation struct {
+	Cache string `bson:"cache"`
+	Key   string `bson:"key"`
+}
+
+type cacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// cacheTombstone records when (as of Cache.clock) key was last invalidated
+type cacheTombstone struct {
+	key   string
+	clock uint64
+}
+
+// Cache is an in-process cache of (BSON encoded) documents by key, bounded
+// in size and age; see Repository.WithCache.
+//
+// Entries changed on another replica are only dropped once its invalidation
+// arrives (see WithPubSub) or, at the latest, when they expire.
+type Cache struct {
+	name       string
+	ttl        time.Duration
+	maxEntries int
+	stats      *CacheStats
+	metrics    metrics.IMetrics
+	pubsub     *PubSub
+
+	// Entries are kept in insertion order; as they all live for ttl, the
+	// oldest one is also the first to expire
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+
+	// Bumped by every invalidation; see Generation. Values loaded before
+	// their key was invalidated (its tombstone) or before floor are stale.
+	// Up to maxEntries tombstones are kept; floor moves past older ones.
+	clock      uint64
+	floor      uint64
+	tombstones map[string]uint64
+	tombOrder  *list.List
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+// NewCache creates a cache; name tells apart the caches of different
+// collections in invalidation messages and metrics
+func NewCache(name string, ttl time.Duration, maxEntries int, m metrics.IMetrics) *Cache {
+	if ttl <= 0 {
+		ttl = DEFAULT_CACHE_TTL
+	}
+
+	if maxEntries <= 0 {
+		maxEntries = DEFAULT_CACHE_MAX_ENTRIES
+	}
+
+	if m == nil {
+		m = metrics.NewNoop()
+	}
+
+	return &Cache{
+		name:       name,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		stats:      NewCacheStats(),
+		metrics:    m,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+		tombstones: map[string]uint64{},
+		tombOrder:  list.New(),
+		now:        time.Now,
+	}
+}
+
+// WithPubSub makes Invalidate reach the cache of the same name on every
+// replica
+func (c *Cache) WithPubSub(p *PubSub) *Cache {
+	c.pubsub = p
+
+	p.Subscribe(CACHE_INVALIDATION_CHANNEL, func(m *PubSubMessage) {
+		inv := &cacheInvalidation{}
+		if err := m.Decode(inv); err != nil {
+			log.WithError(err).Warn("Ignoring malformed cache invalidation")
+			return
+		}
+
+		if inv.Cache == c.name {
+			c.Forget(inv.Key)
+		}
+	})
+
+	return c
+}
+
+func (c *Cache) Name() string {
+	return c.name
+}
+
+// Get returns the value cached for key, if any
+func (c *Cache) Get(key string) ([]byte, bool) {
+	var e *cacheEntry
+
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if ok {
+		e = elem.Value.(*cacheEntry)
+
+		if !c.now().Before(e.expiresAt) {
+			c.remove(elem)
+			ok = false
+		}
+	}
+	c.mu.Unlock()
+
+	result := "hit"
+	if ok {
+		c.stats.RecordHit()
+	} else {
+		c.stats.RecordMiss()
+		result = "miss"
+	}
+
+	c.metrics.Inc(CACHE_LOOKUPS_METRIC, 1, metrics.Tags{"cache": c.name, "result": result})
+
+	if !ok {
+		return nil, false
+	}
+
+	return e.value, true
+}
+
+// Generation is to be read before loading a value to Set; the value is only
+// cached if its key was not invalidated in between (it may be stale
+// otherwise)
+func (c *Cache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.clock
+}
+
+// Set caches value for key unless key was invalidated since gen (see
+// Generation). Once full, the oldest entry is evicted.
+func (c *Cache) Set(key string, value []byte, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen < c.floor || gen < c.tombstones[key] {
+		return
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	for len(c.entries) >= c.maxEntries {
+		c.remove(c.order.Front())
+	}
+
+	c.entries[key] = c.order.PushBack(&cacheEntry{key: key, value: value, expiresAt: c.now().Add(c.ttl)})
+}
+
+// Forget drops key (every key if empty) from this replica's cache only
+func (c *Cache) Forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clock++
+
+	if key == "" {
+		c.entries = map[string]*list.Element{}
+		c.order.Init()
+		c.tombstones = map[string]uint64{}
+		c.tombOrder.Init()
+		c.floor = c.clock
+
+		return
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	c.tombstones[key] = c.clock
+	c.tombOrder.PushBack(&cacheTombstone{key: key, clock: c.clock})
+
+	for c.tombOrder.Len() > c.maxEntries {
+		t := c.tombOrder.Remove(c.tombOrder.Front()).(*cacheTombstone)
+
+		// Unless the key was invalidated again since
+		if c.tombstones[t.key] == t.clock {
+			delete(c.tombstones, t.key)
+		}
+
+		c.floor = t.clock
+	}
+}
+
+// Invalidate drops key (every key if empty) from this cache and, with
+// WithPubSub, from the one of every other replica. Failing to tell the
+// others is only logged; their entries expire eventually.
+func (c *Cache) Invalidate(key string) {
+	c.Forget(key)
+
+	if c.pubsub == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cacheInvalidationTimeout)
+	defer cancel()
+
+	if err := c.pubsub.Publish(ctx, CACHE_INVALIDATION_CHANNEL, &cacheInvalidation{Cache: c.name, Key: key}); err != nil {
+		log.WithError(err).WithField("cache", c.name).Warn("Unable to publish cache invalidation")
+	}
+}
+
+// Len returns how many entries are cached
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// Stats returns the hit and miss counts
+func (c *Cache) Stats() map[string]int {
+	return c.stats.GetStats()
+}
+
+// remove drops an entry; c.mu must be held
+func (c *Cache) remove(elem *list.Element) {
+	delete(c.entries, c.order.Remove(elem).(*cacheEntry).key)
+}
@@ -0,0 +1,165 @@
+package dalutil
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	var (
+		cache *Cache
+		now   = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		cache = NewCache("widgets", time.Minute, 2, nil)
+		cache.now = func() time.Time { return now }
+	})
+
+	It("should return what was set until it expires", func() {
+		cache.Set("a", []byte("1"), cache.Generation())
+
+		v, ok := cache.Get("a")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal([]byte("1")))
+
+		cache.now = func() time.Time { return now.Add(time.Minute) }
+
+		_, ok = cache.Get("a")
+		Expect(ok).To(BeFalse())
+		Expect(cache.Stats()).To(Equal(map[string]int{"hit": 1, "miss": 1}))
+	})
+
+	It("should not cache values loaded before their key was invalidated", func() {
+		gen := cache.Generation()
+		cache.Forget("a")
+		cache.Forget("b")
+
+		cache.Set("a", []byte("stale"), gen)
+		cache.Set("c", []byte("3"), gen)
+
+		_, ok := cache.Get("a")
+		Expect(ok).To(BeFalse())
+
+		_, ok = cache.Get("c")
+		Expect(ok).To(BeTrue())
+
+		cache.Set("a", []byte("1"), cache.Generation())
+
+		_, ok = cache.Get("a")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should not cache values loaded before the whole cache was invalidated", func() {
+		gen := cache.Generation()
+		cache.Forget("")
+
+		cache.Set("a", []byte("stale"), gen)
+		Expect(cache.Len()).To(BeZero())
+	})
+
+	It("should not cache values older than the invalidations it remembers", func() {
+		gen := cache.Generation()
+		cache.Forget("a")
+		cache.Forget("b")
+		cache.Forget("c")
+
+		// a's tombstone was dropped to stay within size
+		cache.Set("a", []byte("stale"), gen)
+		Expect(cache.Len()).To(BeZero())
+	})
+
+	It("should forget one key or all of them", func() {
+		cache.Set("a", []byte("1"), cache.Generation())
+		cache.Set("b", []byte("2"), cache.Generation())
+
+		cache.Forget("a")
+		Expect(cache.Len()).To(Equal(1))
+
+		cache.Forget("")
+		Expect(cache.Len()).To(BeZero())
+	})
+
+	It("should stay within its size, evicting expired entries first", func() {
+		cache.Set("a", []byte("1"), cache.Generation())
+
+		cache.now = func() time.Time { return now.Add(30 * time.Second) }
+		cache.Set("b", []byte("2"), cache.Generation())
+
+		cache.now = func() time.Time { return now.Add(time.Minute) }
+		cache.Set("c", []byte("3"), cache.Generation())
+
+		Expect(cache.Len()).To(Equal(2))
+
+		_, ok := cache.Get("b")
+		Expect(ok).To(BeTrue())
+	})
+
+	Context("with a pubsub", func() {
+		var ps *PubSub
+
+		message := func(payload interface{}) *PubSubMessage {
+			raw, err := bson.Marshal(bson.M{"p": payload})
+			Expect(err).ToNot(HaveOccurred())
+
+			holder := struct {
+				P bson.Raw `bson:"p"`
+			}{}
+			Expect(bson.Unmarshal(raw, &holder)).To(Succeed())
+
+			return &PubSubMessage{ID: bson.NewObjectId(), Channel: CACHE_INVALIDATION_CHANNEL, Payload: holder.P, PublishedAt: now}
+		}
+
+		BeforeEach(func() {
+			// Not connected; publishing fails (and is only logged)
+			ps = NewPubSub(NewSessionPool(nil, "db", 1, time.Second, nil), nil, 0, nil)
+			cache.WithPubSub(ps)
+
+			cache.Set("a", []byte("1"), cache.Generation())
+		})
+
+		It("should forget keys invalidated on other replicas", func() {
+			ps.dispatch(message(&cacheInvalidation{Cache: "widgets", Key: "a"}))
+
+			Expect(cache.Len()).To(BeZero())
+		})
+
+		It("should ignore the invalidations of other caches", func() {
+			ps.dispatch(message(&cacheInvalidation{Cache: "gadgets", Key: "a"}))
+
+			Expect(cache.Len()).To(Equal(1))
+		})
+
+		It("should forget keys locally even if it cannot tell other replicas", func() {
+			cache.Invalidate("a")
+
+			Expect(cache.Len()).To(BeZero())
+		})
+	})
+})
+
+var _ = Describe("Repository with a cache", func() {
+	It("should read cached documents without going to Mongo", func() {
+		cache := NewCache("widgets", time.Minute, 10, nil)
+
+		// Not connected; every Mongo operation fails with ErrNotConnected
+		repo := NewRepository(NewSmartCollection(NewSessionPool(nil, "db", 1, time.Second, nil), "widgets", nil)).WithCache(cache)
+
+		id := bson.NewObjectId()
+		raw, err := bson.Marshal(bson.M{"_id": id, "name": "cached"})
+		Expect(err).ToNot(HaveOccurred())
+
+		cache.Set(id.Hex(), raw, cache.Generation())
+
+		doc := bson.M{}
+		Expect(repo.Get(context.Background(), id, &doc)).To(Succeed())
+		Expect(doc["name"]).To(Equal("cached"))
+
+		Expect(repo.Get(context.Background(), bson.NewObjectId(), &doc)).To(MatchError(ErrNotConnected))
+	})
+})
@@ -0,0 +1,230 @@
+package dalutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Cursor marks a position in a sorted result set: the sort values and _id of
+// the document the next (or previous) page starts after
+type Cursor struct {
+	Sort   string    `json:"s"`
+	Values []*string `json:"v"` // nil where the document lacks the field
+	ID     string    `json:"i"`
+	Prev   bool      `json:"p,omitempty"` // page backwards
+}
+
+// CursorCodec turns cursors into opaque strings that clients cannot alter;
+// every replica must share the same secret
+type CursorCodec struct {
+	secret []byte
+}
+
+func NewCursorCodec(secret []byte) *CursorCodec {
+	return &CursorCodec{secret: secret}
+}
+
+// Encode returns base64url(payload) + "." + base64url(hmac(payload))
+func (c *CursorCodec) Encode(cursor *Cursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(c.sign(payload)), nil
+}
+
+// Decode verifies and decodes a cursor produced by Encode
+func (c *CursorCodec) Decode(s string) (*Cursor, error) {
+	enc := base64.RawURLEncoding
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	sig, err := enc.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, c.sign(payload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := &Cursor{}
+	if err := json.Unmarshal(payload, cursor); err != nil || !bson.IsObjectIdHex(cursor.ID) {
+		return nil, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+func (c *CursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(payload)
+
+	return mac.Sum(nil)
+}
+
+// sortSignature identifies a sort order so that a cursor cannot be used with
+// a different one
+func sortSignature(keys []*SortKey) string {
+	parts := make([]string, 0, len(keys))
+
+	for _, k := range keys {
+		if k.Desc {
+			parts = append(parts, "-"+k.Param)
+		} else {
+			parts = append(parts, k.Param)
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// newCursor captures the position of doc (as returned by bson.Marshal) in a
+// result set sorted by keys
+func newCursor(keys []*SortKey, doc bson.M, prev bool) (*Cursor, error) {
+	id, ok := doc["_id"].(bson.ObjectId)
+	if !ok {
+		return nil, errors.New("cursor pagination requires ObjectId _id fields")
+	}
+
+	cursor := &Cursor{
+		Sort: sortSignature(keys),
+		ID:   id.Hex(),
+		Prev: prev,
+	}
+
+	for _, k := range keys {
+		v := lookupPath(doc, k.Spec.mongoField(k.Param))
+		if v == nil {
+			cursor.Values = append(cursor.Values, nil)
+			continue
+		}
+
+		s := formatValue(v)
+		cursor.Values = append(cursor.Values, &s)
+	}
+
+	return cursor, nil
+}
+
+// afterFilter matches the documents that come after (or, when paging
+// backwards, before) the cursor position: for sort keys k1..kn and _id,
+// k1 > v1 OR (k1 = v1 AND k2 > v2) OR ... OR (k1..kn = v1..vn AND _id > id),
+// with comparisons flipped for descending keys. Documents lacking a sort
+// field sort lowest, as Mongo does.
+func afterFilter(keys []*SortKey, cursor *Cursor) (bson.M, error) {
+	values := make([]interface{}, len(keys))
+
+	for i, k := range keys {
+		if cursor.Values[i] == nil {
+			continue
+		}
+
+		v, err := parseValue(k.Spec.Type, *cursor.Values[i])
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		values[i] = v
+	}
+
+	or := []bson.M{}
+
+	for i := 0; i <= len(keys); i++ {
+		clause := bson.M{}
+
+		for j := 0; j < i; j++ {
+			clause[keys[j].Spec.mongoField(keys[j].Param)] = values[j]
+		}
+
+		if i < len(keys) {
+			field := keys[i].Spec.mongoField(keys[i].Param)
+
+			switch op := compareOp(keys[i].Desc, cursor.Prev); {
+			case values[i] == nil && op == "$lt":
+				// Nothing sorts lower than a missing value
+				continue
+			case values[i] == nil:
+				clause[field] = bson.M{"$ne": nil}
+			case op == "$lt":
+				// Comparisons never match missing values
+				clause["$or"] = []bson.M{{field: bson.M{op: values[i]}}, {field: nil}}
+			default:
+				clause[field] = bson.M{op: values[i]}
+			}
+		} else {
+			clause["_id"] = bson.M{compareOp(idDesc(keys), cursor.Prev): bson.ObjectIdHex(cursor.ID)}
+		}
+
+		or = append(or, clause)
+	}
+
+	return bson.M{"$or": or}, nil
+}
+
+func compareOp(desc, prev bool) string {
+	if desc != prev {
+		return "$lt"
+	}
+
+	return "$gt"
+}
+
+// _id breaks ties in the same direction as the last sort key
+func idDesc(keys []*SortKey) bool {
+	return len(keys) > 0 && keys[len(keys)-1].Desc
+}
+
+// sortFields renders keys (plus the _id tie breaker) for FindOpts.Sort,
+// reversed when paging backwards
+func sortFields(keys []*SortKey, prev bool) []string {
+	out := make([]string, 0, len(keys)+1)
+
+	add := func(field string, desc bool) {
+		if desc != prev {
+			field = "-" + field
+		}
+
+		out = append(out, field)
+	}
+
+	for _, k := range keys {
+		add(k.Spec.mongoField(k.Param), k.Desc)
+	}
+
+	add("_id", idDesc(keys))
+
+	return out
+}
+
+func lookupPath(doc bson.M, path string) interface{} {
+	var cur interface{} = doc
+
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(bson.M)
+		if !ok {
+			return nil
+		}
+
+		cur = m[part]
+	}
+
+	return cur
+}
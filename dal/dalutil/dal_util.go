@@ -1,14 +1,16 @@
 package dalutil
 
 import (
+	"context"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
-	newrelic "github.com/newrelic/go-agent"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/mgo.v2"
+
+	"github.com/dfraglabs/go-microservice-1/apm"
+	"github.com/dfraglabs/go-microservice-1/metrics"
 )
 
 var log *logrus.Entry
@@ -63,91 +65,95 @@ func (c *CacheStats) GetStats() map[string]int {
  Smart Collection
 *****************/
 
+// Instrumentation is shared by every SmartCollection; it determines where
+// the timing, tracing and slow query information for each operation goes.
+type Instrumentation struct {
+	Tracer  apm.ITracer
+	Metrics metrics.IMetrics
+
+	// Operations slower than this are logged (with a redacted query shape);
+	// 0 disables slow query logging
+	SlowQueryThreshold time.Duration
+}
+
+// SmartCollection wraps a single collection. Every operation runs on its own
+// session copied from the SessionPool (socket timeout derived from the ctx
+// deadline), so there is no shared session to keep refreshed.
 type SmartCollection struct {
-	coll *mgo.Collection
-	mu   RWLocker
-	last time.Time
-	freq time.Duration
+	pool *SessionPool
+	name string
+	inst *Instrumentation
 }
 
-func NewSmartCollection(c *mgo.Collection, freq time.Duration) *SmartCollection {
-	return &SmartCollection{
-		coll: c,
-		mu:   &sync.RWMutex{},
-		last: time.Now(),
-		freq: freq,
+// NewSmartCollection wraps the named collection; a nil inst (or nil members)
+// disables the corresponding instrumentation
+func NewSmartCollection(pool *SessionPool, name string, inst *Instrumentation) *SmartCollection {
+	i := &Instrumentation{}
+	if inst != nil {
+		*i = *inst
 	}
-}
 
-func (s *SmartCollection) Collection() *mgo.Collection {
-	s.mu.RLock()
-	elapsed := time.Since(s.last)
-	s.mu.RUnlock()
+	if i.Tracer == nil {
+		i.Tracer = apm.NewNoop()
+	}
 
-	if elapsed > s.freq {
-		s.mu.Lock()
-		s.last = time.Now()
-		s.mu.Unlock()
+	if i.Metrics == nil {
+		i.Metrics = metrics.NewNoop()
+	}
 
-		// this is safe to do without a lock because it implements its own lock
-		s.coll.Database.Session.Refresh()
+	return &SmartCollection{
+		pool: pool,
+		name: name,
+		inst: i,
 	}
+}
 
-	return s.coll
+// Name returns the collection name
+func (s *SmartCollection) Name() string {
+	return s.name
 }
 
-func (s *SmartCollection) EnsureIndexes(idxs []*mgo.Index) error {
-	for _, idx := range idxs {
-		log.Debugf("Ensuring index: %s", idx.Name)
-		if err := s.UpsertIndex(idx); err != nil {
-			return fmt.Errorf("Could not ensure indexes on DB: %v", err)
-		}
+// WithCollection runs fn against the collection using a session from the
+// pool. Unlike Do(), the call is not instrumented - use it for
+// administrative work (ie. indexes) rather than queries.
+func (s *SmartCollection) WithCollection(ctx context.Context, fn func(c *mgo.Collection) error) error {
+	sess, release, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return err
 	}
+	defer release()
 
-	return nil
+	return fn(s.pool.DB(sess).C(s.name))
 }
 
-// Ensure new index. If index already exists with same options, remove it and add new one.
-func (s *SmartCollection) UpsertIndex(idx *mgo.Index) error {
-	if err := s.coll.EnsureIndex(*idx); err != nil {
-		if strings.Contains(err.Error(), "already exists with different options") ||
-			strings.Contains(err.Error(), "Trying to create an index with same name") {
-			log.Warnf("index already exists with name '%s'. replacing...", idx.Name)
-
-			//drop that one
-			if err := s.coll.DropIndexName(idx.Name); err != nil {
-				return fmt.Errorf("failed to remove old index: %v", err)
-			}
+// EnsureIndexes plans the desired indexes against the ones on the collection
+// and applies the plan. Rebuilds of indexes whose options changed are only
+// applied with allowDestructive; otherwise the drift is logged. Indexes not
+// in idxs are reported but never dropped.
+func (s *SmartCollection) EnsureIndexes(idxs []*mgo.Index, allowDestructive bool) error {
+	ctx := context.Background()
 
-			if err := s.coll.EnsureIndex(*idx); err != nil {
-				return fmt.Errorf("failed to add new index: %v", err)
-			}
-
-			return nil
-		}
+	plan, err := s.PlanIndexes(ctx, idxs, false)
+	if err != nil {
+		return fmt.Errorf("Could not ensure indexes on DB: %v", err)
+	}
 
-		return fmt.Errorf("failed to ensure index: %v", err)
+	if err := s.ApplyIndexPlan(ctx, plan, allowDestructive); err != nil {
+		return fmt.Errorf("Could not ensure indexes on DB: %v", err)
 	}
 
 	return nil
 }
 
-func (s *SmartCollection) StartMongoDatastoreSegment(txn newrelic.Transaction, op string, query map[string]interface{}) *newrelic.DatastoreSegment {
-	return &newrelic.DatastoreSegment{
-		StartTime:       newrelic.StartSegmentNow(txn),
-		Product:         newrelic.DatastoreMongoDB,
-		DatabaseName:    s.coll.Database.Name,
-		Collection:      s.coll.Name,
-		Operation:       op,
-		QueryParameters: query,
-	}
-}
-
-//go:generate counterfeiter -o ../../fakes/rwlocker/rwlocker.go . RWLocker
-
-type RWLocker interface {
-	RLock()
-	RUnlock()
-	Lock()
-	Unlock()
+// StartDatastoreSegment starts an APM datastore segment for an operation on
+// this collection. The segment is attached to the transaction carried in ctx
+// (if any); callers must End() it once the operation completes.
+func (s *SmartCollection) StartDatastoreSegment(ctx context.Context, op, statement string) apm.ISegment {
+	return s.inst.Tracer.StartDatastoreSegment(ctx, apm.Datastore{
+		Product:    apm.DATASTORE_MONGODB,
+		Database:   s.pool.dbName,
+		Collection: s.name,
+		Operation:  op,
+		Statement:  statement,
+	})
 }
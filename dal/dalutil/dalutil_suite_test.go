@@ -0,0 +1,17 @@
+package dalutil
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDALUtilSuite(t *testing.T) {
+	// reduce the noise when testing
+	logrus.SetLevel(logrus.FatalLevel)
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DALUtil Suite")
+}
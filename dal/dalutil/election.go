@@ -0,0 +1,108 @@
+package dalutil
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Elector makes sure that exactly one replica runs a piece of singleton work
+// (ie. cron jobs or TTL sweeps) at a time, by holding the lock named after
+// the election for as long as it leads
+type Elector struct {
+	locks *LockService
+	name  string
+	ttl   time.Duration
+
+	mu     sync.RWMutex
+	leader bool
+	token  int64
+}
+
+func NewElector(locks *LockService, name string, ttl time.Duration) *Elector {
+	return &Elector{
+		locks: locks,
+		name:  name,
+		ttl:   ttl,
+	}
+}
+
+// Run campaigns until ctx is done, calling fn whenever this replica is
+// elected. fn's ctx is canceled when leadership is lost, after which the
+// replica campaigns again (and calls fn again once re-elected). Run returns
+// when ctx is done or when fn returns on its own while still leading.
+func (e *Elector) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	llog := log.WithField("election", e.name)
+
+	for {
+		lease, err := e.locks.Acquire(ctx, e.name, e.ttl)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			llog.WithError(err).Warnf("Unable to campaign; retrying in %v", LOCK_POLL_INTERVAL)
+
+			select {
+			case <-time.After(LOCK_POLL_INTERVAL):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		llog.WithField("token", lease.Token).Info("Elected leader")
+
+		lctx, release := lease.KeepAlive(ctx)
+
+		e.setLeader(true, lease.Token)
+		err = fn(lctx)
+		e.setLeader(false, 0)
+
+		lost := lctx.Err() != nil && ctx.Err() == nil
+		release()
+
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case lost:
+			llog.WithError(err).Warn("Lost leadership; campaigning again")
+		default:
+			llog.Info("Stepped down")
+			return err
+		}
+	}
+}
+
+// IsLeader reports whether this replica currently leads
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.leader
+}
+
+// Token returns the fencing token of the current lease (0 when not leading)
+func (e *Elector) Token() int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.token
+}
+
+// Status meets the go-health ICheckable interface; an elector is healthy
+// whether or not it leads
+func (e *Elector) Status() (interface{}, error) {
+	return map[string]interface{}{
+		"election": e.name,
+		"leader":   e.IsLeader(),
+		"token":    e.Token(),
+	}, nil
+}
+
+func (e *Elector) setLeader(leader bool, token int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leader, e.token = leader, token
+}
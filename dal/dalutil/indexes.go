@@ -0,0 +1,310 @@
+package dalutil
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	INDEX_CREATE    = "create"
+	INDEX_REBUILD   = "rebuild" // drop + create; destructive
+	INDEX_DROP      = "drop"    // destructive
+	INDEX_UNCHANGED = "unchanged"
+	INDEX_EXTRA     = "extra" // exists but is not desired; reported only
+
+	ID_INDEX_NAME = "_id_"
+
+	// Mongo error code for listIndexes on a collection that does not exist yet
+	namespaceNotFoundCode = 26
+)
+
+// IndexChange is a single step of an IndexPlan
+type IndexChange struct {
+	Action   string
+	Name     string
+	Desired  *mgo.Index // nil for drop/extra
+	Existing *mgo.Index // nil for create
+	Reason   string
+}
+
+// Destructive reports whether the change drops an existing index
+func (c *IndexChange) Destructive() bool {
+	return c.Action == INDEX_REBUILD || c.Action == INDEX_DROP
+}
+
+func (c *IndexChange) String() string {
+	if c.Reason == "" {
+		return fmt.Sprintf("%-9s %s", c.Action, c.Name)
+	}
+
+	return fmt.Sprintf("%-9s %s (%s)", c.Action, c.Name, c.Reason)
+}
+
+// IndexPlan is the diff between the desired and the existing indexes of a
+// collection
+type IndexPlan struct {
+	Collection string
+	Changes    []*IndexChange
+}
+
+// HasChanges reports whether applying the plan would do anything
+func (p *IndexPlan) HasChanges() bool {
+	for _, c := range p.Changes {
+		if c.Action == INDEX_CREATE || c.Destructive() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasDestructive reports whether the plan would drop any index
+func (p *IndexPlan) HasDestructive() bool {
+	for _, c := range p.Changes {
+		if c.Destructive() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PlanIndexes diffs desired against existing. Indexes are matched by name
+// (mgo's generated name when Name is empty) and, failing that, by key so
+// that renaming an index results in a rebuild rather than a conflict.
+//
+// Existing indexes that are not desired are reported as INDEX_EXTRA, or as
+// INDEX_DROP when dropExtra is set. The _id index is always left alone.
+func PlanIndexes(collection string, desired []*mgo.Index, existing []mgo.Index, dropExtra bool) *IndexPlan {
+	plan := &IndexPlan{Collection: collection}
+
+	byName := map[string]*mgo.Index{}
+	for i := range existing {
+		byName[existing[i].Name] = &existing[i]
+	}
+
+	matched := map[string]bool{ID_INDEX_NAME: true}
+
+	for _, want := range desired {
+		name := IndexName(want)
+
+		have, ok := byName[name]
+		if !ok {
+			// Same key under another (not desired) name
+			have = findByKey(existing, want.Key, desired)
+		}
+
+		change := &IndexChange{Name: name, Desired: want, Existing: have}
+
+		switch {
+		case have == nil:
+			change.Action = INDEX_CREATE
+		case have.Name != name:
+			change.Action = INDEX_REBUILD
+			change.Reason = fmt.Sprintf("renamed from '%s'", have.Name)
+		default:
+			if diff := indexDiff(want, have); len(diff) > 0 {
+				change.Action = INDEX_REBUILD
+				change.Reason = strings.Join(diff, ", ")
+			} else {
+				change.Action = INDEX_UNCHANGED
+			}
+		}
+
+		if have != nil {
+			matched[have.Name] = true
+		}
+
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	for i := range existing {
+		have := &existing[i]
+		if matched[have.Name] {
+			continue
+		}
+
+		action := INDEX_EXTRA
+		if dropExtra {
+			action = INDEX_DROP
+		}
+
+		plan.Changes = append(plan.Changes, &IndexChange{
+			Action:   action,
+			Name:     have.Name,
+			Existing: have,
+			Reason:   "not declared by the DAL",
+		})
+	}
+
+	return plan
+}
+
+// IndexName returns the name of idx, computing it the same way mgo does
+// when Name is empty
+func IndexName(idx *mgo.Index) string {
+	if idx.Name != "" {
+		return idx.Name
+	}
+
+	parts := make([]string, 0, len(idx.Key))
+
+	for _, field := range normalizeKey(idx.Key) {
+		switch {
+		case strings.HasPrefix(field, "$"):
+			if c := strings.Index(field, ":"); c > 1 {
+				parts = append(parts, field[c+1:]+"_"+field[1:c])
+				continue
+			}
+
+			parts = append(parts, field)
+		case strings.HasPrefix(field, "-"):
+			parts = append(parts, field[1:]+"_-1")
+		default:
+			parts = append(parts, field+"_1")
+		}
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// normalizeKey rewrites the shorthand forms mgo accepts ("+field", "@field")
+// into the form returned by Indexes()
+func normalizeKey(key []string) []string {
+	out := make([]string, 0, len(key))
+
+	for _, field := range key {
+		switch {
+		case strings.HasPrefix(field, "+"):
+			field = field[1:]
+		case strings.HasPrefix(field, "@"):
+			field = "$2d:" + field[1:]
+		}
+
+		out = append(out, field)
+	}
+
+	return out
+}
+
+func findByKey(existing []mgo.Index, key []string, desired []*mgo.Index) *mgo.Index {
+	for i := range existing {
+		if existing[i].Name == ID_INDEX_NAME || !reflect.DeepEqual(normalizeKey(existing[i].Key), normalizeKey(key)) {
+			continue
+		}
+
+		// Leave it alone if it is desired under its own name
+		isDesired := false
+		for _, d := range desired {
+			if IndexName(d) == existing[i].Name {
+				isDesired = true
+				break
+			}
+		}
+
+		if !isDesired {
+			return &existing[i]
+		}
+	}
+
+	return nil
+}
+
+// indexDiff lists the options that differ; Background and DropDups only
+// affect the build itself and are ignored
+func indexDiff(want, have *mgo.Index) []string {
+	var diff []string
+
+	if w, h := normalizeKey(want.Key), normalizeKey(have.Key); !reflect.DeepEqual(w, h) {
+		diff = append(diff, fmt.Sprintf("key: %v -> %v", h, w))
+	}
+
+	if want.Unique != have.Unique {
+		diff = append(diff, fmt.Sprintf("unique: %v -> %v", have.Unique, want.Unique))
+	}
+
+	if want.Sparse != have.Sparse {
+		diff = append(diff, fmt.Sprintf("sparse: %v -> %v", have.Sparse, want.Sparse))
+	}
+
+	// Mongo stores expireAfterSeconds
+	if w, h := want.ExpireAfter/time.Second, have.ExpireAfter/time.Second; w != h {
+		diff = append(diff, fmt.Sprintf("expireAfter: %ds -> %ds", h, w))
+	}
+
+	if !reflect.DeepEqual(want.Collation, have.Collation) {
+		diff = append(diff, "collation")
+	}
+
+	return diff
+}
+
+// PlanIndexes diffs desired against the indexes currently on the collection
+func (s *SmartCollection) PlanIndexes(ctx context.Context, desired []*mgo.Index, dropExtra bool) (*IndexPlan, error) {
+	var existing []mgo.Index
+
+	err := s.WithCollection(ctx, func(c *mgo.Collection) error {
+		var err error
+		existing, err = c.Indexes()
+		return err
+	})
+
+	if qe, ok := err.(*mgo.QueryError); ok && qe.Code == namespaceNotFoundCode {
+		err = nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list indexes on '%s': %v", s.name, err)
+	}
+
+	return PlanIndexes(s.name, desired, existing, dropExtra), nil
+}
+
+// ApplyIndexPlan creates missing indexes. Rebuilds and drops are only carried
+// out when allowDestructive is set; otherwise they are logged as warnings.
+func (s *SmartCollection) ApplyIndexPlan(ctx context.Context, plan *IndexPlan, allowDestructive bool) error {
+	return s.WithCollection(ctx, func(c *mgo.Collection) error {
+		for _, change := range plan.Changes {
+			llog := log.WithField("collection", plan.Collection).WithField("index", change.Name)
+
+			if change.Destructive() && !allowDestructive {
+				llog.Warnf("Index drift, not applying destructive change: %v", change)
+				continue
+			}
+
+			switch change.Action {
+			case INDEX_EXTRA:
+				llog.Warnf("Index drift: %v", change)
+			case INDEX_CREATE:
+				llog.Infof("Creating index")
+
+				if err := c.EnsureIndex(*change.Desired); err != nil {
+					return fmt.Errorf("Unable to create index '%s': %v", change.Name, err)
+				}
+			case INDEX_REBUILD:
+				llog.Warnf("Rebuilding index: %s", change.Reason)
+
+				if err := c.DropIndexName(change.Existing.Name); err != nil {
+					return fmt.Errorf("Unable to drop index '%s': %v", change.Existing.Name, err)
+				}
+
+				if err := c.EnsureIndex(*change.Desired); err != nil {
+					return fmt.Errorf("Unable to recreate index '%s': %v", change.Name, err)
+				}
+			case INDEX_DROP:
+				llog.Warnf("Dropping index")
+
+				if err := c.DropIndexName(change.Name); err != nil {
+					return fmt.Errorf("Unable to drop index '%s': %v", change.Name, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
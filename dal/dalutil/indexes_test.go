@@ -0,0 +1,88 @@
+package dalutil
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Indexes", func() {
+	Describe("IndexName", func() {
+		It("should prefer the explicit name", func() {
+			Expect(IndexName(&mgo.Index{Name: "foo", Key: []string{"a"}})).To(Equal("foo"))
+		})
+
+		It("should generate the same name as mgo", func() {
+			Expect(IndexName(&mgo.Index{Key: []string{"a", "-b", "$2dsphere:loc", "@pos"}})).
+				To(Equal("a_1_b_-1_loc_2dsphere_pos_2d"))
+		})
+	})
+
+	Describe("PlanIndexes", func() {
+		var existing []mgo.Index
+
+		actions := func(p *IndexPlan) map[string]string {
+			out := map[string]string{}
+			for _, c := range p.Changes {
+				out[c.Name] = c.Action
+			}
+
+			return out
+		}
+
+		BeforeEach(func() {
+			existing = []mgo.Index{
+				{Name: "_id_", Key: []string{"_id"}},
+				{Name: "same", Key: []string{"a"}, Unique: true},
+				{Name: "ttl", Key: []string{"t"}, ExpireAfter: 10 * time.Second},
+				{Name: "old-name", Key: []string{"r"}},
+				{Name: "leftover", Key: []string{"z"}},
+			}
+		})
+
+		It("should diff desired against existing indexes", func() {
+			plan := PlanIndexes("coll", []*mgo.Index{
+				{Name: "same", Key: []string{"a"}, Unique: true, Background: true},
+				{Name: "ttl", Key: []string{"t"}, ExpireAfter: 20 * time.Second},
+				{Name: "new-name", Key: []string{"r"}},
+				{Key: []string{"n"}},
+			}, existing, false)
+
+			Expect(actions(plan)).To(Equal(map[string]string{
+				"same":     INDEX_UNCHANGED,
+				"ttl":      INDEX_REBUILD,
+				"new-name": INDEX_REBUILD,
+				"n_1":      INDEX_CREATE,
+				"leftover": INDEX_EXTRA,
+			}))
+			Expect(plan.HasChanges()).To(BeTrue())
+			Expect(plan.HasDestructive()).To(BeTrue())
+		})
+
+		It("should explain why an index needs a rebuild", func() {
+			plan := PlanIndexes("coll", []*mgo.Index{
+				{Name: "ttl", Key: []string{"t"}, ExpireAfter: 20 * time.Second},
+			}, existing, false)
+
+			Expect(plan.Changes[0].Reason).To(Equal("expireAfter: 10s -> 20s"))
+		})
+
+		It("should drop extra indexes only when asked to", func() {
+			plan := PlanIndexes("coll", nil, existing, true)
+
+			Expect(actions(plan)).To(HaveKeyWithValue("leftover", INDEX_DROP))
+			Expect(actions(plan)).ToNot(HaveKey("_id_"))
+		})
+
+		It("should have no changes when everything matches", func() {
+			plan := PlanIndexes("coll", []*mgo.Index{
+				{Name: "same", Key: []string{"a"}, Unique: true},
+			}, existing[:2], false)
+
+			Expect(plan.HasChanges()).To(BeFalse())
+		})
+	})
+})
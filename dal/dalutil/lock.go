@@ -0,0 +1,246 @@
+package dalutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	LOCKS_COLLECTION_NAME = "locks"
+
+	// How often Acquire() retries a lock held elsewhere
+	LOCK_POLL_INTERVAL = time.Second
+
+	// Renewals are attempted this many times per TTL
+	lockRenewalsPerTTL = 3
+
+	// Releasing is not bound to the caller's ctx (which is usually done by then)
+	lockReleaseTimeout = 10 * time.Second
+)
+
+var (
+	ErrLockHeld = errors.New("lock is held by another owner")
+	ErrLockLost = errors.New("lock lease was lost")
+)
+
+// lockRecord is stored in the locks collection. Records are never removed so
+// that fencing tokens keep increasing across acquisitions.
+type lockRecord struct {
+	Name       string    `bson:"_id"`
+	Owner      string    `bson:"owner"`
+	Token      int64     `bson:"token"`
+	ExpiresAt  time.Time `bson:"expires_at"`
+	AcquiredAt time.Time `bson:"acquired_at"`
+}
+
+// LockService hands out leases on named locks shared by every replica. A
+// lease lasts for its TTL unless renewed (see Lease.KeepAlive), so a crashed
+// holder only blocks others until it expires. Replica clocks are assumed to
+// be roughly in sync; keep TTLs well above the expected skew.
+type LockService struct {
+	coll    *SmartCollection
+	owner   string
+	counter int64
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+func NewLockService(pool *SessionPool, inst *Instrumentation) *LockService {
+	host, _ := os.Hostname()
+
+	return &LockService{
+		coll:  NewSmartCollection(pool, LOCKS_COLLECTION_NAME, inst),
+		owner: fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+		now:   func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// TryAcquire takes the named lock for ttl if nobody holds it (or the
+// holder's lease expired); returns ErrLockHeld otherwise
+func (l *LockService) TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lease, error) {
+	now := l.now()
+	owner := fmt.Sprintf("%s-%d", l.owner, atomic.AddInt64(&l.counter, 1))
+
+	rec := &lockRecord{}
+
+	// The upsert fails with a duplicate key error if the lock is held
+	_, err := l.coll.Apply(ctx,
+		bson.M{"_id": name, "expires_at": bson.M{"$lt": now}},
+		mgo.Change{
+			Update: bson.M{
+				"$set": bson.M{"owner": owner, "expires_at": now.Add(ttl), "acquired_at": now},
+				"$inc": bson.M{"token": 1},
+			},
+			Upsert:    true,
+			ReturnNew: true,
+		},
+		rec,
+	)
+
+	switch {
+	case mgo.IsDup(err):
+		return nil, ErrLockHeld
+	case err != nil:
+		return nil, fmt.Errorf("Unable to acquire lock '%s': %v", name, err)
+	}
+
+	return &Lease{
+		locks:     l,
+		Name:      name,
+		Owner:     owner,
+		Token:     rec.Token,
+		ttl:       ttl,
+		expiresAt: rec.ExpiresAt,
+	}, nil
+}
+
+// Acquire waits for the named lock until ctx is done
+func (l *LockService) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lease, error) {
+	for {
+		lease, err := l.TryAcquire(ctx, name, ttl)
+		if err != ErrLockHeld {
+			return lease, err
+		}
+
+		log.WithField("lock", name).Debugf("Lock is held elsewhere; retrying in %v", LOCK_POLL_INTERVAL)
+
+		select {
+		case <-time.After(LOCK_POLL_INTERVAL):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Gave up waiting for lock '%s': %v", name, ctx.Err())
+		}
+	}
+}
+
+// Lease is a held lock. Token is the lock's fencing token: it increases with
+// every acquisition, so resources guarded by the lock can reject writes
+// carrying a lower token than one they have already seen (ie. from a holder
+// that was paused past its lease).
+type Lease struct {
+	Name  string
+	Owner string
+	Token int64
+
+	locks *LockService
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	expiresAt time.Time
+	lost      bool
+}
+
+// Renew extends the lease by its TTL; returns ErrLockLost if it expired and
+// was taken over (or released) in the meantime
+func (l *Lease) Renew(ctx context.Context) error {
+	expiresAt := l.locks.now().Add(l.ttl)
+
+	err := l.locks.coll.Update(ctx,
+		bson.M{"_id": l.Name, "owner": l.Owner},
+		bson.M{"$set": bson.M{"expires_at": expiresAt}},
+	)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case err == mgo.ErrNotFound:
+		l.lost = true
+		return ErrLockLost
+	case err != nil:
+		return err
+	}
+
+	l.expiresAt = expiresAt
+
+	return nil
+}
+
+// Release gives up the lease (if it is still held)
+func (l *Lease) Release() error {
+	ctx, cancel := context.WithTimeout(context.Background(), lockReleaseTimeout)
+	defer cancel()
+
+	err := l.locks.coll.Update(ctx,
+		bson.M{"_id": l.Name, "owner": l.Owner},
+		bson.M{"$set": bson.M{"owner": "", "expires_at": time.Unix(0, 0).UTC()}},
+	)
+
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// Lost reports whether the lease is known to be lost (or about to expire
+// without having been renewed)
+func (l *Lease) Lost() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.lost || !l.locks.now().Before(l.expiresAt)
+}
+
+// KeepAlive renews the lease in the background until the returned cancel
+// func is called (which also releases the lease) or ctx is done. The
+// returned ctx is canceled as soon as the lease is lost, ie. when renewals
+// keep failing until it expires or another owner took it over.
+func (l *Lease) KeepAlive(ctx context.Context) (context.Context, context.CancelFunc) {
+	lctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer cancel()
+
+		llog := log.WithField("lock", l.Name).WithField("token", l.Token)
+
+		ticker := time.NewTicker(l.ttl / lockRenewalsPerTTL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-lctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := l.Renew(lctx)
+
+			switch {
+			case err == nil:
+				continue
+			case err == ErrLockLost:
+				llog.Warn("Lock lease was taken over")
+				return
+			case lctx.Err() != nil:
+				return
+			}
+
+			if l.Lost() {
+				llog.WithError(err).Error("Lock lease expired; renewals kept failing")
+				return
+			}
+
+			llog.WithError(err).Warn("Unable to renew lock lease; retrying")
+		}
+	}()
+
+	return lctx, func() {
+		cancel()
+		<-done
+
+		if err := l.Release(); err != nil {
+			log.WithField("lock", l.Name).WithError(err).Warn("Unable to release lock (it will expire on its own)")
+		}
+	}
+}
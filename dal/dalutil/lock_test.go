@@ -0,0 +1,76 @@
+package dalutil
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+var _ = Describe("Locks", func() {
+	var (
+		locks *LockService
+		now   time.Time
+	)
+
+	BeforeEach(func() {
+		// Not connected; every Mongo operation fails with ErrNotConnected
+		locks = NewLockService(NewSessionPool(nil, "test", 1, time.Second, metrics.NewNoop()), nil)
+
+		now = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+		locks.now = func() time.Time { return now }
+	})
+
+	Describe("Lease", func() {
+		It("should be lost once it expires", func() {
+			lease := &Lease{locks: locks, Name: "l", ttl: time.Minute, expiresAt: now.Add(time.Minute)}
+			Expect(lease.Lost()).To(BeFalse())
+
+			now = now.Add(time.Minute)
+			Expect(lease.Lost()).To(BeTrue())
+		})
+
+		It("should cancel the ctx when it expires without being renewed", func() {
+			locks.now = func() time.Time { return time.Now().UTC() }
+
+			lease := &Lease{locks: locks, Name: "l", ttl: 30 * time.Millisecond, expiresAt: time.Now().Add(30 * time.Millisecond)}
+
+			ctx, release := lease.KeepAlive(context.Background())
+			defer release()
+
+			Eventually(ctx.Done()).Should(BeClosed())
+			Expect(lease.Lost()).To(BeTrue())
+		})
+
+		It("should cancel the ctx when released", func() {
+			lease := &Lease{locks: locks, Name: "l", ttl: time.Minute, expiresAt: now.Add(time.Minute)}
+
+			ctx, release := lease.KeepAlive(context.Background())
+			release()
+
+			Expect(ctx.Err()).To(Equal(context.Canceled))
+		})
+	})
+
+	Describe("Elector", func() {
+		It("should give up campaigning once ctx is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			elector := NewElector(locks, "singleton", time.Minute)
+
+			called := false
+			err := elector.Run(ctx, func(context.Context) error {
+				called = true
+				return nil
+			})
+
+			Expect(err).To(Equal(context.DeadlineExceeded))
+			Expect(called).To(BeFalse())
+			Expect(elector.IsLeader()).To(BeFalse())
+		})
+	})
+})
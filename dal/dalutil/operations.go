@@ -0,0 +1,256 @@
+package dalutil
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	MONGO_OPERATIONS_METRIC = "mongo.operations"
+	MONGO_ERRORS_METRIC     = "mongo.errors"
+	MONGO_DURATION_METRIC   = "mongo.operation.duration"
+
+	OP_FIND      = "find"
+	OP_FIND_ONE  = "findOne"
+	OP_INSERT    = "insert"
+	OP_UPDATE    = "update"
+	OP_UPSERT    = "upsert"
+	OP_REMOVE    = "remove"
+	OP_AGGREGATE = "aggregate"
+	OP_COUNT     = "count"
+	OP_APPLY     = "findAndModify"
+
+	statusOK       = "ok"
+	statusNotFound = "not_found"
+	statusCanceled = "canceled"
+	statusError    = "error"
+)
+
+// FindOpts narrows down the results of Find and FindOne; all fields are optional
+type FindOpts struct {
+	Select interface{}
+	Sort   []string
+	Skip   int
+	Limit  int
+}
+
+func (f *FindOpts) apply(q *mgo.Query) *mgo.Query {
+	if f == nil {
+		return q
+	}
+
+	if f.Select != nil {
+		q = q.Select(f.Select)
+	}
+
+	if len(f.Sort) > 0 {
+		q = q.Sort(f.Sort...)
+	}
+
+	if f.Skip > 0 {
+		q = q.Skip(f.Skip)
+	}
+
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+
+	return q
+}
+
+// Find fetches every document matching query into result (a pointer to a slice)
+func (s *SmartCollection) Find(ctx context.Context, query interface{}, opts *FindOpts, result interface{}) error {
+	return s.Do(ctx, OP_FIND, query, func(c *mgo.Collection) error {
+		return opts.apply(c.Find(query)).All(result)
+	})
+}
+
+// FindOne fetches the first document matching query; returns mgo.ErrNotFound
+// if there is none
+func (s *SmartCollection) FindOne(ctx context.Context, query interface{}, opts *FindOpts, result interface{}) error {
+	return s.Do(ctx, OP_FIND_ONE, query, func(c *mgo.Collection) error {
+		return opts.apply(c.Find(query)).One(result)
+	})
+}
+
+func (s *SmartCollection) Insert(ctx context.Context, docs ...interface{}) error {
+	return s.Do(ctx, OP_INSERT, nil, func(c *mgo.Collection) error {
+		return c.Insert(docs...)
+	})
+}
+
+// Update modifies the first document matching selector; returns
+// mgo.ErrNotFound if there is none
+func (s *SmartCollection) Update(ctx context.Context, selector, update interface{}) error {
+	return s.Do(ctx, OP_UPDATE, selector, func(c *mgo.Collection) error {
+		return c.Update(selector, update)
+	})
+}
+
+func (s *SmartCollection) Upsert(ctx context.Context, selector, update interface{}) (*mgo.ChangeInfo, error) {
+	var info *mgo.ChangeInfo
+
+	err := s.Do(ctx, OP_UPSERT, selector, func(c *mgo.Collection) error {
+		var err error
+		info, err = c.Upsert(selector, update)
+		return err
+	})
+
+	return info, err
+}
+
+// Remove deletes the first document matching selector; returns
+// mgo.ErrNotFound if there is none
+func (s *SmartCollection) Remove(ctx context.Context, selector interface{}) error {
+	return s.Do(ctx, OP_REMOVE, selector, func(c *mgo.Collection) error {
+		return c.Remove(selector)
+	})
+}
+
+// Apply runs a findAndModify on the first document matching query; result
+// receives the document as it was before the change (or after it, with
+// change.ReturnNew). Returns mgo.ErrNotFound if nothing matched.
+func (s *SmartCollection) Apply(ctx context.Context, query interface{}, change mgo.Change, result interface{}) (*mgo.ChangeInfo, error) {
+	return s.ApplySorted(ctx, query, nil, change, result)
+}
+
+// ApplySorted is Apply on the first document matching query in sort order
+func (s *SmartCollection) ApplySorted(ctx context.Context, query interface{}, sort []string, change mgo.Change, result interface{}) (*mgo.ChangeInfo, error) {
+	var info *mgo.ChangeInfo
+
+	err := s.Do(ctx, OP_APPLY, query, func(c *mgo.Collection) error {
+		q := c.Find(query)
+		if len(sort) > 0 {
+			q = q.Sort(sort...)
+		}
+
+		var err error
+		info, err = q.Apply(change, result)
+		return err
+	})
+
+	return info, err
+}
+
+// Aggregate runs pipeline and stores every resulting document in result
+func (s *SmartCollection) Aggregate(ctx context.Context, pipeline interface{}, result interface{}) error {
+	return s.Do(ctx, OP_AGGREGATE, pipeline, func(c *mgo.Collection) error {
+		return c.Pipe(pipeline).All(result)
+	})
+}
+
+func (s *SmartCollection) Count(ctx context.Context, query interface{}) (int, error) {
+	var n int
+
+	err := s.Do(ctx, OP_COUNT, query, func(c *mgo.Collection) error {
+		var err error
+		n, err = c.Find(query).Count()
+		return err
+	})
+
+	return n, err
+}
+
+// Do runs fn against the collection on a session from the pool while
+// recording the operation to metrics, the APM/tracer and the logs.
+//
+// If ctx is done before fn returns, Do returns ctx.Err() right away; fn keeps
+// running in the background until the socket timeout (derived from the ctx
+// deadline) kicks in, so whatever fn writes to must not be used in that case.
+func (s *SmartCollection) Do(ctx context.Context, op string, query interface{}, fn func(c *mgo.Collection) error) error {
+	// Computing the shape is not cheap; only do it for the operations that
+	// are traced or logged along with it
+	var statement string
+	shape := func() string {
+		if statement == "" {
+			statement = QueryShape(query)
+		}
+
+		return statement
+	}
+
+	if s.inst.Tracer.Enabled() {
+		shape()
+	}
+
+	seg := s.StartDatastoreSegment(ctx, op, statement)
+	start := time.Now()
+
+	err := s.run(ctx, fn)
+
+	elapsed := time.Since(start)
+
+	status := statusOK
+	switch {
+	case err == mgo.ErrNotFound:
+		status = statusNotFound
+	case err == context.Canceled || err == context.DeadlineExceeded:
+		status = statusCanceled
+		seg.SetError(err)
+	case err != nil:
+		status = statusError
+		seg.SetError(err)
+	}
+
+	seg.End()
+
+	tags := metrics.Tags{
+		"collection": s.name,
+		"operation":  op,
+		"status":     status,
+	}
+
+	s.inst.Metrics.Inc(MONGO_OPERATIONS_METRIC, 1, tags)
+	s.inst.Metrics.Timing(MONGO_DURATION_METRIC, elapsed, tags)
+
+	llog := log.WithField("collection", s.name).
+		WithField("operation", op).
+		WithField("duration_ms", float64(elapsed)/float64(time.Millisecond))
+
+	switch status {
+	case statusError:
+		s.inst.Metrics.Inc(MONGO_ERRORS_METRIC, 1, tags)
+		llog.WithError(err).WithField("query", shape()).Error("Mongo operation failed")
+	case statusCanceled:
+		llog.WithError(err).Debug("Mongo operation abandoned")
+	default:
+		llog.Debug("Mongo operation")
+	}
+
+	if s.inst.SlowQueryThreshold > 0 && elapsed > s.inst.SlowQueryThreshold {
+		llog.WithField("query", shape()).Warnf("Slow Mongo operation (threshold %v)", s.inst.SlowQueryThreshold)
+	}
+
+	return err
+}
+
+// run executes fn on a pooled session, giving up as soon as ctx is done
+func (s *SmartCollection) run(ctx context.Context, fn func(c *mgo.Collection) error) error {
+	sess, release, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(s.pool.DB(sess).C(s.name))
+	}()
+
+	select {
+	case err := <-done:
+		release()
+		return err
+	case <-ctx.Done():
+		// The session is only released once the operation actually finishes
+		go func() {
+			<-done
+			release()
+		}()
+
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,58 @@
+package dalutil
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/apm"
+)
+
+// fakeTracer records the datastore operations reported to it
+type fakeTracer struct {
+	*apm.Noop
+	enabled    bool
+	statements []string
+}
+
+func (f *fakeTracer) Enabled() bool {
+	return f.enabled
+}
+
+func (f *fakeTracer) StartDatastoreSegment(ctx context.Context, ds apm.Datastore) apm.ISegment {
+	f.statements = append(f.statements, ds.Statement)
+	return f.Noop.StartDatastoreSegment(ctx, ds)
+}
+
+var _ = Describe("SmartCollection", func() {
+	var (
+		tracer *fakeTracer
+		coll   *SmartCollection
+		query  = bson.M{"name": "a"}
+	)
+
+	BeforeEach(func() {
+		tracer = &fakeTracer{Noop: apm.NewNoop()}
+
+		// Not connected; every operation fails right away
+		coll = NewSmartCollection(NewSessionPool(nil, "db", 1, time.Second, nil), "widgets", &Instrumentation{Tracer: tracer})
+	})
+
+	Describe("Do", func() {
+		It("should trace the shape of the query", func() {
+			tracer.enabled = true
+
+			coll.FindOne(context.Background(), query, nil, &bson.M{})
+			Expect(tracer.statements).To(Equal([]string{QueryShape(query)}))
+		})
+
+		It("should not compute the shape for a disabled tracer", func() {
+			coll.FindOne(context.Background(), query, nil, &bson.M{})
+			Expect(tracer.statements).To(Equal([]string{""}))
+		})
+	})
+})
@@ -0,0 +1,417 @@
+package dalutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/events"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+const (
+	OUTBOX_COLLECTION_NAME = "outbox"
+
+	// Per aggregate counters of the events recorded via Outbox.Add
+	OUTBOX_SEQUENCES_COLLECTION_NAME = "outbox_sequences"
+
+	// Events are staged on the document they are about, in the same write
+	// (see Repository.WithOutbox), until they are drained into the outbox
+	// collection. The counter holds how many events were ever staged on the
+	// document and is what sequences them.
+	OUTBOX_FIELD     = "_outbox"
+	OUTBOX_SEQ_FIELD = "_outbox_seq"
+
+	// Documents drained per tracked collection and pass
+	outboxDrainBatch = 100
+
+	// Like audit entries, eager drains are not bound to the request ctx
+	outboxTimeout = 10 * time.Second
+)
+
+// Outbox implements events.IOutbox on top of Mongo.
+//
+// Mongo has no multi-document transactions, so a write and its events are
+// made atomic by staging the events in an array of the written document.
+// Drain moves them into the outbox collection (an upsert per event, keyed by
+// event ID, so that draining twice is harmless) and pulls them off the
+// document.
+type Outbox struct {
+	coll    *SmartCollection
+	seqs    *SmartCollection
+	indexes []*mgo.Index
+
+	mu      sync.Mutex
+	tracked []*SmartCollection
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+// NewOutbox creates the outbox; published records are kept for
+// expiresAfterSec
+func NewOutbox(pool *SessionPool, inst *Instrumentation, expiresAfterSec int) *Outbox {
+	return &Outbox{
+		coll:    NewSmartCollection(pool, OUTBOX_COLLECTION_NAME, inst),
+		seqs:    NewSmartCollection(pool, OUTBOX_SEQUENCES_COLLECTION_NAME, inst),
+		indexes: OutboxIndexes(expiresAfterSec),
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// OutboxIndexes returns the indexes the outbox collection should have
+func OutboxIndexes(expiresAfterSec int) []*mgo.Index {
+	return []*mgo.Index{
+		{
+			Name: "aggregate-sequence",
+			Key:  []string{"status", "aggregate_type", "aggregate_id", "sequence"},
+		},
+		{
+			// Only published records have a published_at
+			Name:        "expiring-published",
+			Key:         []string{"published_at"},
+			ExpireAfter: time.Second * time.Duration(expiresAfterSec),
+		},
+	}
+}
+
+// OutboxIndex returns the index collections whose repository uses
+// WithOutbox should have; it lets Drain find documents with staged events
+func OutboxIndex() *mgo.Index {
+	return &mgo.Index{
+		Name:   "outbox-staged",
+		Key:    []string{OUTBOX_FIELD + "._id"},
+		Sparse: true,
+	}
+}
+
+func (o *Outbox) EnsureIndexes(allowDestructive bool) error {
+	return o.coll.EnsureIndexes(o.indexes, allowDestructive)
+}
+
+// Track makes Drain look for events staged in coll
+func (o *Outbox) Track(coll *SmartCollection) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, c := range o.tracked {
+		if c == coll {
+			return
+		}
+	}
+
+	o.tracked = append(o.tracked, coll)
+}
+
+// Add records events that do not go along with a document write straight
+// into the outbox collection
+func (o *Outbox) Add(ctx context.Context, evs ...events.IEvent) error {
+	actor := ActorFromContext(ctx)
+
+	for _, e := range evs {
+		ev := events.New(e, actor)
+
+		seq, err := o.nextSequence(ctx, ev.AggregateType, ev.AggregateID)
+		if err != nil {
+			return fmt.Errorf("unable to sequence event: %v", err)
+		}
+
+		ev.Sequence = seq
+
+		if err := o.store(ctx, ev); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *Outbox) nextSequence(ctx context.Context, aggregateType, aggregateID string) (int64, error) {
+	counter := struct {
+		Seq int64 `bson:"seq"`
+	}{}
+
+	_, err := o.seqs.Apply(ctx, bson.M{"_id": aggregateType + ":" + aggregateID}, mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"seq": 1}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &counter)
+
+	return counter.Seq, err
+}
+
+// Drain moves the events staged on the documents of every tracked collection
+// into the outbox collection
+func (o *Outbox) Drain(ctx context.Context) (int, error) {
+	o.mu.Lock()
+	tracked := append([]*SmartCollection{}, o.tracked...)
+	o.mu.Unlock()
+
+	drained := 0
+
+	for _, coll := range tracked {
+		docs := []bson.M{}
+
+		err := coll.Find(ctx, bson.M{OUTBOX_FIELD + "._id": bson.M{"$exists": true}}, &FindOpts{
+			Select: bson.M{OUTBOX_FIELD: 1, OUTBOX_SEQ_FIELD: 1},
+			Limit:  outboxDrainBatch,
+		}, &docs)
+		if err != nil {
+			return drained, fmt.Errorf("unable to find staged events in %s: %v", coll.Name(), err)
+		}
+
+		for _, doc := range docs {
+			n, err := o.drain(ctx, coll, doc)
+			drained += n
+
+			if err != nil {
+				return drained, err
+			}
+		}
+	}
+
+	return drained, nil
+}
+
+// DrainDocument moves the events staged on a single document
+func (o *Outbox) DrainDocument(ctx context.Context, coll *SmartCollection, id bson.ObjectId) (int, error) {
+	doc := bson.M{}
+
+	err := coll.FindOne(ctx, bson.M{"_id": id}, &FindOpts{Select: bson.M{OUTBOX_FIELD: 1, OUTBOX_SEQ_FIELD: 1}}, &doc)
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return o.drain(ctx, coll, doc)
+}
+
+// drain stores the events staged on doc (as read along with its counter)
+// and pulls them off the document
+func (o *Outbox) drain(ctx context.Context, coll *SmartCollection, doc bson.M) (int, error) {
+	staged, err := Staged(doc)
+	if err != nil || len(staged) == 0 {
+		return 0, err
+	}
+
+	ids := make([]bson.ObjectId, 0, len(staged))
+
+	for _, ev := range staged {
+		if err := o.store(ctx, ev); err != nil {
+			return 0, err
+		}
+
+		ids = append(ids, ev.ID)
+	}
+
+	// Writes staging more events only append; the drained ones are still
+	// there, wherever they are in the array now
+	err = coll.Update(ctx, bson.M{"_id": doc["_id"]}, bson.M{
+		"$pull": bson.M{OUTBOX_FIELD: bson.M{"_id": bson.M{"$in": ids}}},
+	})
+
+	switch {
+	case err == mgo.ErrNotFound:
+		// Purged in the meantime (see Repository.Purge); nothing left to pull
+	case err != nil:
+		return 0, fmt.Errorf("unable to pull drained events from %s: %v", coll.Name(), err)
+	}
+
+	return len(ids), nil
+}
+
+// store inserts ev as a pending record unless it is already there
+func (o *Outbox) store(ctx context.Context, ev *events.Event) error {
+	rec, err := snapshot(&events.Record{
+		Event:         *ev,
+		Status:        events.STATUS_PENDING,
+		NextAttemptAt: o.now(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to marshal event: %v", err)
+	}
+
+	delete(rec, "_id")
+
+	if _, err := o.coll.Upsert(ctx, bson.M{"_id": ev.ID}, bson.M{"$setOnInsert": rec}); err != nil {
+		return fmt.Errorf("unable to store event %s: %v", ev.ID.Hex(), err)
+	}
+
+	return nil
+}
+
+// Heads returns the oldest pending record of up to limit aggregates, the
+// ones due soonest first
+func (o *Outbox) Heads(ctx context.Context, limit int) ([]*events.Record, error) {
+	heads := []struct {
+		Record *events.Record `bson:"record"`
+	}{}
+
+	err := o.coll.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"status": events.STATUS_PENDING}},
+		{"$sort": bson.D{{Name: "aggregate_type", Value: 1}, {Name: "aggregate_id", Value: 1}, {Name: "sequence", Value: 1}}},
+		{"$group": bson.M{
+			"_id":    bson.M{"type": "$aggregate_type", "id": "$aggregate_id"},
+			"record": bson.M{"$first": "$$ROOT"},
+		}},
+		{"$sort": bson.M{"record.next_attempt_at": 1}},
+		{"$limit": limit},
+	}, &heads)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find pending events: %v", err)
+	}
+
+	records := make([]*events.Record, 0, len(heads))
+	for _, h := range heads {
+		records = append(records, h.Record)
+	}
+
+	return records, nil
+}
+
+func (o *Outbox) Published(ctx context.Context, id bson.ObjectId) error {
+	return o.coll.Update(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"status": events.STATUS_PUBLISHED, "published_at": o.now()},
+	})
+}
+
+func (o *Outbox) Failed(ctx context.Context, id bson.ObjectId, attempts int, cause error, retryAt time.Time, dead bool) error {
+	status := events.STATUS_PENDING
+	if dead {
+		status = events.STATUS_DEAD
+	}
+
+	return o.coll.Update(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"status":          status,
+			"attempts":        attempts,
+			"last_error":      cause.Error(),
+			"next_attempt_at": retryAt,
+		},
+	})
+}
+
+func (o *Outbox) Dead(ctx context.Context, limit int) ([]*events.Record, error) {
+	records := []*events.Record{}
+
+	err := o.coll.Find(ctx, bson.M{"status": events.STATUS_DEAD}, &FindOpts{
+		Sort:  []string{"-_id"},
+		Limit: limit,
+	}, &records)
+
+	return records, err
+}
+
+// Retry makes a dead record pending again, with a fresh set of attempts;
+// returns errtype.KeyNotFoundErr if there is no dead record with that id.
+// Later events of the aggregate may have been published already.
+func (o *Outbox) Retry(ctx context.Context, id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return errtype.KeyNotFoundErr{E: fmt.Errorf("%s: invalid id '%s'", OUTBOX_COLLECTION_NAME, id)}
+	}
+
+	err := o.coll.Update(ctx, bson.M{"_id": bson.ObjectIdHex(id), "status": events.STATUS_DEAD}, bson.M{
+		"$set": bson.M{
+			"status":          events.STATUS_PENDING,
+			"attempts":        0,
+			"next_attempt_at": o.now(),
+		},
+	})
+
+	if err == mgo.ErrNotFound {
+		return errtype.KeyNotFoundErr{E: fmt.Errorf("%s: no dead event %s", OUTBOX_COLLECTION_NAME, id)}
+	}
+
+	return err
+}
+
+// Staged returns the events staged on doc, sequenced: the array holds the
+// last events counted by OUTBOX_SEQ_FIELD, in order
+func Staged(doc bson.M) ([]*events.Event, error) {
+	holder := struct {
+		Events  []*events.Event `bson:"_outbox"`
+		Counter int64           `bson:"_outbox_seq"`
+	}{}
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bson.Unmarshal(raw, &holder); err != nil {
+		return nil, fmt.Errorf("unable to read staged events: %v", err)
+	}
+
+	first := holder.Counter - int64(len(holder.Events)) + 1
+
+	for i, ev := range holder.Events {
+		ev.Sequence = first + int64(i)
+	}
+
+	return holder.Events, nil
+}
+
+// stagedFields returns the outbox fields of doc (if any) with evs appended,
+// to be written back along with a whole document
+func stagedFields(doc bson.M, evs []*events.Event) bson.M {
+	staged := []interface{}{}
+
+	if existing, ok := doc[OUTBOX_FIELD].([]interface{}); ok {
+		staged = append(staged, existing...)
+	}
+
+	for _, ev := range evs {
+		staged = append(staged, ev)
+	}
+
+	fields := bson.M{}
+
+	if len(staged) > 0 {
+		fields[OUTBOX_FIELD] = staged
+	}
+
+	// Kept even once everything was drained; sequences must not restart
+	if seq := seqOf(doc) + int64(len(evs)); seq > 0 {
+		fields[OUTBOX_SEQ_FIELD] = seq
+	}
+
+	return fields
+}
+
+func seqOf(doc bson.M) int64 {
+	switch v := doc[OUTBOX_SEQ_FIELD].(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+
+	return 0
+}
+
+// withoutOutbox returns a copy of doc without the outbox fields
+func withoutOutbox(doc bson.M) bson.M {
+	if doc == nil {
+		return nil
+	}
+
+	out := bson.M{}
+	for k, v := range doc {
+		if k != OUTBOX_FIELD && k != OUTBOX_SEQ_FIELD {
+			out[k] = v
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,89 @@
+package dalutil
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/events"
+)
+
+var _ = Describe("Outbox", func() {
+	// doc returns a document as read back from Mongo
+	doc := func(m bson.M) bson.M {
+		raw, err := bson.Marshal(m)
+		Expect(err).ToNot(HaveOccurred())
+
+		out := bson.M{}
+		Expect(bson.Unmarshal(raw, out)).To(Succeed())
+
+		return out
+	}
+
+	Describe("Staged", func() {
+		It("should sequence the staged events from the counter", func() {
+			a, b := events.New(&events.FooUpdated{ID: "x"}, ""), events.New(&events.FooDeleted{ID: "x"}, "")
+
+			// Three events were drained already
+			staged, err := Staged(doc(bson.M{OUTBOX_FIELD: []*events.Event{a, b}, OUTBOX_SEQ_FIELD: 5}))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(staged).To(HaveLen(2))
+			Expect(staged[0].ID).To(Equal(a.ID))
+			Expect(staged[0].Sequence).To(Equal(int64(4)))
+			Expect(staged[1].ID).To(Equal(b.ID))
+			Expect(staged[1].Sequence).To(Equal(int64(5)))
+		})
+
+		It("should handle documents without staged events", func() {
+			staged, err := Staged(bson.M{"_id": bson.NewObjectId()})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(staged).To(BeEmpty())
+		})
+	})
+
+	Describe("stagedFields", func() {
+		It("should append to the events still staged", func() {
+			stored := doc(bson.M{OUTBOX_FIELD: []*events.Event{events.New(&events.FooCreated{ID: "x"}, "")}, OUTBOX_SEQ_FIELD: 1})
+			ev := events.New(&events.FooUpdated{ID: "x"}, "")
+
+			fields := stagedFields(stored, []*events.Event{ev})
+
+			Expect(fields[OUTBOX_FIELD]).To(HaveLen(2))
+			Expect(fields[OUTBOX_SEQ_FIELD]).To(Equal(int64(2)))
+
+			staged, err := Staged(doc(fields))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(staged[1].ID).To(Equal(ev.ID))
+			Expect(staged[1].Sequence).To(Equal(int64(2)))
+		})
+
+		It("should keep the counter once every event was drained", func() {
+			Expect(stagedFields(doc(bson.M{OUTBOX_SEQ_FIELD: 7}), nil)).To(Equal(bson.M{OUTBOX_SEQ_FIELD: int64(7)}))
+			Expect(stagedFields(nil, nil)).To(BeEmpty())
+		})
+	})
+
+	Describe("withStaged", func() {
+		It("should push the events and bump the counter", func() {
+			ev := events.New(&events.FooDeleted{ID: "x"}, "")
+
+			u := withStaged(bson.M{"$set": bson.M{"a": 1}, "$inc": bson.M{"version": 1}}, []*events.Event{ev})
+
+			Expect(u["$push"]).To(Equal(bson.M{OUTBOX_FIELD: bson.M{"$each": []*events.Event{ev}}}))
+			Expect(u["$inc"]).To(Equal(bson.M{"version": 1, OUTBOX_SEQ_FIELD: 1}))
+		})
+
+		It("should leave the update alone without events", func() {
+			Expect(withStaged(bson.M{"$set": bson.M{"a": 1}}, nil)).To(Equal(bson.M{"$set": bson.M{"a": 1}}))
+		})
+	})
+
+	Describe("withoutOutbox", func() {
+		It("should keep the outbox fields out of audit snapshots", func() {
+			Expect(withoutOutbox(bson.M{"a": 1, OUTBOX_FIELD: []interface{}{}, OUTBOX_SEQ_FIELD: 1})).To(Equal(bson.M{"a": 1}))
+		})
+	})
+})
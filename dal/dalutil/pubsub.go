@@ -0,0 +1,217 @@
+package dalutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	PUBSUB_COLLECTION_NAME = "pubsub"
+
+	// Seconds between a message being published and this replica getting it
+	PUBSUB_LAG_METRIC        = "pubsub.lag"
+	PUBSUB_RECONNECTS_METRIC = "pubsub.reconnects"
+
+	DEFAULT_PUBSUB_SIZE_BYTES = 16 * 1024 * 1024
+
+	// How long a tail waits for new messages before checking whether it
+	// should stop
+	pubsubTailTimeout = time.Second
+
+	// Wait before reopening a failed tail
+	pubsubRetryInterval = time.Second
+
+	// ObjectIds of different replicas are only ordered as well as their
+	// clocks are; resuming starts this much before the last message seen
+	pubsubResumeOverlap = 5 * time.Second
+
+	// Mongo error code for creating a collection that exists
+	namespaceExistsCode = 48
+)
+
+// PubSubMessage is stored in the capped pubsub collection
+type PubSubMessage struct {
+	ID          bson.ObjectId `bson:"_id"`
+	Channel     string        `bson:"channel"`
+	Payload     bson.Raw      `bson:"payload"`
+	PublishedAt time.Time     `bson:"published_at"`
+}
+
+// Decode unmarshals the payload into v
+func (m *PubSubMessage) Decode(v interface{}) error {
+	return m.Payload.Unmarshal(v)
+}
+
+// PubSub broadcasts messages to every replica through a capped collection:
+// publishing inserts a message, and Run tails the collection (with a
+// tailable cursor) and hands every message to the handlers subscribed to its
+// channel.
+//
+// Delivery is at-most-once (the collection wraps around) and, as a resumed
+// tail starts a little before the last message seen, may repeat messages;
+// handlers must be idempotent. Run holds one pooled session for as long as
+// it tails.
+type PubSub struct {
+	coll      *SmartCollection
+	sizeBytes int
+	metrics   metrics.IMetrics
+
+	mu       sync.RWMutex
+	handlers map[string][]func(m *PubSubMessage)
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+// NewPubSub creates the pub/sub; the collection holds up to sizeBytes of
+// messages (DEFAULT_PUBSUB_SIZE_BYTES if <= 0)
+func NewPubSub(pool *SessionPool, inst *Instrumentation, sizeBytes int, m metrics.IMetrics) *PubSub {
+	if sizeBytes <= 0 {
+		sizeBytes = DEFAULT_PUBSUB_SIZE_BYTES
+	}
+
+	if m == nil {
+		m = metrics.NewNoop()
+	}
+
+	return &PubSub{
+		coll:      NewSmartCollection(pool, PUBSUB_COLLECTION_NAME, inst),
+		sizeBytes: sizeBytes,
+		metrics:   m,
+		handlers:  map[string][]func(m *PubSubMessage){},
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// EnsureCollection creates the capped collection unless it exists; an
+// existing collection is left as is (even if its size differs)
+func (p *PubSub) EnsureCollection() error {
+	return p.coll.WithCollection(context.Background(), func(c *mgo.Collection) error {
+		err := c.Create(&mgo.CollectionInfo{Capped: true, MaxBytes: p.sizeBytes})
+
+		if qe, ok := err.(*mgo.QueryError); ok && qe.Code == namespaceExistsCode {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("Unable to create the pubsub collection: %v", err)
+		}
+
+		// Tailable cursors on an empty collection die right away
+		return c.Insert(bson.M{"_id": bson.NewObjectId(), "channel": "", "published_at": p.now()})
+	})
+}
+
+// Subscribe has fn called (from Run) with every message of channel
+func (p *PubSub) Subscribe(channel string, fn func(m *PubSubMessage)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handlers[channel] = append(p.handlers[channel], fn)
+}
+
+// Publish sends payload to the subscribers of channel on every replica
+// (this one included)
+func (p *PubSub) Publish(ctx context.Context, channel string, payload interface{}) error {
+	return p.coll.Insert(ctx, bson.M{
+		"_id":          bson.NewObjectId(),
+		"channel":      channel,
+		"payload":      payload,
+		"published_at": p.now(),
+	})
+}
+
+// Run tails the collection until ctx is done, starting with the messages
+// published from now on. Dropped cursors and failed tails are reopened
+// where they left off.
+func (p *PubSub) Run(ctx context.Context) error {
+	since := p.now()
+
+	for {
+		last, err := p.tail(ctx, since)
+		if !last.IsZero() {
+			since = last
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			log.WithError(err).Warnf("Pubsub tail failed; reopening in %v", pubsubRetryInterval)
+		}
+
+		p.metrics.Inc(PUBSUB_RECONNECTS_METRIC, 1, nil)
+
+		select {
+		case <-time.After(pubsubRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// tail dispatches the messages published after since until the cursor dies
+// or ctx is done; returns when the last message it saw was published
+func (p *PubSub) tail(ctx context.Context, since time.Time) (time.Time, error) {
+	var last time.Time
+
+	err := p.coll.WithCollection(ctx, func(c *mgo.Collection) error {
+		from := bson.NewObjectIdWithTime(since.Add(-pubsubResumeOverlap))
+
+		iter := c.Find(bson.M{"_id": bson.M{"$gt": from}}).Sort("$natural").Tail(pubsubTailTimeout)
+		defer iter.Close()
+
+		for {
+			m := &PubSubMessage{}
+
+			for iter.Next(m) {
+				p.dispatch(m)
+
+				if m.PublishedAt.After(last) {
+					last = m.PublishedAt
+				}
+
+				m = &PubSubMessage{}
+			}
+
+			if err := iter.Err(); err != nil {
+				return err
+			}
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			// Dead cursor; reopened by Run
+			if !iter.Timeout() {
+				return nil
+			}
+		}
+	})
+
+	return last, err
+}
+
+func (p *PubSub) dispatch(m *PubSubMessage) {
+	if m.Channel == "" {
+		return
+	}
+
+	p.metrics.Gauge(PUBSUB_LAG_METRIC, p.now().Sub(m.PublishedAt).Seconds(), metrics.Tags{"channel": m.Channel})
+
+	p.mu.RLock()
+	handlers := p.handlers[m.Channel]
+	p.mu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(m)
+	}
+}
@@ -0,0 +1,365 @@
+package dalutil
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Field types understood by the query builder
+const (
+	FIELD_STRING   = "string"
+	FIELD_INT      = "int"
+	FIELD_FLOAT    = "float"
+	FIELD_BOOL     = "bool"
+	FIELD_TIME     = "time" // RFC 3339
+	FIELD_OBJECTID = "objectid"
+)
+
+// Filter operators; `filter[field]=v` is shorthand for `filter[field][eq]=v`
+const (
+	OP_EQ     = "eq"
+	OP_NE     = "ne"
+	OP_GT     = "gt"
+	OP_GTE    = "gte"
+	OP_LT     = "lt"
+	OP_LTE    = "lte"
+	OP_IN     = "in"  // comma separated
+	OP_NIN    = "nin" // comma separated
+	OP_EXISTS = "exists"
+	OP_PREFIX = "prefix" // strings only
+)
+
+const (
+	FILTER_PARAM = "filter"
+	SORT_PARAM   = "sort"
+	LIMIT_PARAM  = "limit"
+	CURSOR_PARAM = "cursor"
+)
+
+var (
+	filterParamRegexp = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([^\[\]]+)\])?$`)
+
+	mongoOps = map[string]string{
+		OP_EQ:     "$eq",
+		OP_NE:     "$ne",
+		OP_GT:     "$gt",
+		OP_GTE:    "$gte",
+		OP_LT:     "$lt",
+		OP_LTE:    "$lte",
+		OP_IN:     "$in",
+		OP_NIN:    "$nin",
+		OP_EXISTS: "$exists",
+	}
+
+	// Convenience operator sets for FieldSpec.Ops
+	EQUALITY_OPS   = []string{OP_EQ, OP_NE, OP_IN, OP_NIN}
+	COMPARISON_OPS = []string{OP_EQ, OP_NE, OP_GT, OP_GTE, OP_LT, OP_LTE, OP_IN, OP_NIN}
+)
+
+// FieldSpec allowlists a field for filtering and/or sorting
+type FieldSpec struct {
+	// Mongo field (dotted paths are fine); defaults to the param name
+	Field    string
+	Type     string
+	Ops      []string
+	Sortable bool
+}
+
+// QuerySpec describes what a list endpoint accepts; keys of Fields are the
+// names used in query params
+type QuerySpec struct {
+	Fields       map[string]*FieldSpec
+	DefaultSort  []string // ie. []string{"-created_at"}
+	DefaultLimit int
+	MaxLimit     int
+}
+
+// SortKey is a single, validated sort field
+type SortKey struct {
+	Param string
+	Desc  bool
+	Spec  *FieldSpec
+}
+
+// Query is the parsed and validated form of a list request
+type Query struct {
+	Filter bson.M
+	Sort   []*SortKey
+	Limit  int
+	Cursor *Cursor // nil for the first page
+}
+
+// QueryError lists every problem found in a list request
+type QueryError struct {
+	Problems []string
+}
+
+func (e *QueryError) Error() string {
+	return "invalid query: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *QueryError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// ParseQuery turns `filter[field][op]=value`, `sort=-created_at,field`,
+// `limit` and `cursor` params into a Query, checking fields and operators
+// against spec. Every problem is reported at once via *QueryError.
+func ParseQuery(spec *QuerySpec, values url.Values, codec *CursorCodec) (*Query, error) {
+	qerr := &QueryError{}
+	q := &Query{
+		Filter: bson.M{},
+		Limit:  spec.DefaultLimit,
+	}
+
+	// Sorted so that problems are reported in a stable order
+	params := make([]string, 0, len(values))
+	for p := range values {
+		params = append(params, p)
+	}
+
+	sort.Strings(params)
+
+	for _, p := range params {
+		if !strings.HasPrefix(p, FILTER_PARAM+"[") {
+			continue
+		}
+
+		m := filterParamRegexp.FindStringSubmatch(p)
+		if m == nil {
+			qerr.add("malformed filter param '%s'", p)
+			continue
+		}
+
+		name, op := m[1], m[2]
+		if op == "" {
+			op = OP_EQ
+		}
+
+		fs, ok := spec.Fields[name]
+		if !ok || len(fs.Ops) == 0 {
+			qerr.add("filtering on '%s' is not supported", name)
+			continue
+		}
+
+		if !contains(fs.Ops, op) {
+			qerr.add("operator '%s' is not supported for '%s' (allowed: %s)", op, name, strings.Join(fs.Ops, ", "))
+			continue
+		}
+
+		cond, err := buildCondition(fs, op, values.Get(p))
+		if err != nil {
+			qerr.add("invalid value for '%s': %v", p, err)
+			continue
+		}
+
+		field := fs.mongoField(name)
+
+		existing, _ := q.Filter[field].(bson.M)
+		if existing == nil {
+			existing = bson.M{}
+		}
+
+		for k, v := range cond {
+			existing[k] = v
+		}
+
+		q.Filter[field] = existing
+	}
+
+	// Sort
+	sortParam := spec.DefaultSort
+	if s := values.Get(SORT_PARAM); s != "" {
+		sortParam = strings.Split(s, ",")
+	}
+
+	sorted := map[string]bool{}
+
+	for _, s := range sortParam {
+		key := &SortKey{Param: strings.TrimSpace(s)}
+
+		if strings.HasPrefix(key.Param, "-") {
+			key.Param, key.Desc = key.Param[1:], true
+		}
+
+		fs, ok := spec.Fields[key.Param]
+		if !ok || !fs.Sortable {
+			qerr.add("sorting on '%s' is not supported", key.Param)
+			continue
+		}
+
+		if sorted[key.Param] {
+			qerr.add("cannot sort on '%s' more than once", key.Param)
+			continue
+		}
+
+		sorted[key.Param] = true
+
+		key.Spec = fs
+		q.Sort = append(q.Sort, key)
+	}
+
+	// Limit
+	if l := values.Get(LIMIT_PARAM); l != "" {
+		n, err := strconv.Atoi(l)
+
+		switch {
+		case err != nil || n < 1:
+			qerr.add("limit must be a positive integer")
+		case spec.MaxLimit > 0 && n > spec.MaxLimit:
+			qerr.add("limit must be at most %d", spec.MaxLimit)
+		default:
+			q.Limit = n
+		}
+	}
+
+	if q.Limit < 1 {
+		q.Limit = DEFAULT_PER_PAGE
+	}
+
+	// Cursor (only meaningful if the sort is valid)
+	if c := values.Get(CURSOR_PARAM); c != "" && len(qerr.Problems) == 0 {
+		cursor, err := codec.Decode(c)
+
+		switch {
+		case err != nil:
+			qerr.add("invalid cursor")
+		case cursor.Sort != sortSignature(q.Sort) || len(cursor.Values) != len(q.Sort):
+			qerr.add("cursor does not match the requested sort")
+		default:
+			q.Cursor = cursor
+		}
+	}
+
+	if len(qerr.Problems) > 0 {
+		return nil, qerr
+	}
+
+	return q, nil
+}
+
+func (fs *FieldSpec) mongoField(name string) string {
+	if fs.Field != "" {
+		return fs.Field
+	}
+
+	return name
+}
+
+func buildCondition(fs *FieldSpec, op, raw string) (bson.M, error) {
+	switch op {
+	case OP_EXISTS:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("expected true or false")
+		}
+
+		return bson.M{"$exists": b}, nil
+	case OP_PREFIX:
+		if fs.Type != FIELD_STRING {
+			return nil, fmt.Errorf("prefix only applies to strings")
+		}
+
+		return bson.M{"$regex": "^" + regexp.QuoteMeta(raw)}, nil
+	case OP_IN, OP_NIN:
+		list := []interface{}{}
+
+		for _, part := range strings.Split(raw, ",") {
+			v, err := parseValue(fs.Type, part)
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, v)
+		}
+
+		return bson.M{mongoOps[op]: list}, nil
+	}
+
+	mongoOp, ok := mongoOps[op]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator '%s'", op)
+	}
+
+	v, err := parseValue(fs.Type, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.M{mongoOp: v}, nil
+}
+
+// parseValue converts a query param (or cursor) value to the field's type
+func parseValue(fieldType, raw string) (interface{}, error) {
+	switch fieldType {
+	case FIELD_STRING, "":
+		return raw, nil
+	case FIELD_INT:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer")
+		}
+
+		return v, nil
+	case FIELD_FLOAT:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number")
+		}
+
+		return v, nil
+	case FIELD_BOOL:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("expected true or false")
+		}
+
+		return v, nil
+	case FIELD_TIME:
+		v, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, fmt.Errorf("expected an RFC 3339 timestamp")
+		}
+
+		return v.UTC(), nil
+	case FIELD_OBJECTID:
+		if !bson.IsObjectIdHex(raw) {
+			return nil, fmt.Errorf("expected an id")
+		}
+
+		return bson.ObjectIdHex(raw), nil
+	}
+
+	return nil, fmt.Errorf("unsupported field type '%s'", fieldType)
+}
+
+// formatValue is the inverse of parseValue; used to store values in cursors
+func formatValue(v interface{}) string {
+	switch tv := v.(type) {
+	case time.Time:
+		return tv.UTC().Format(time.RFC3339Nano)
+	case bson.ObjectId:
+		return tv.Hex()
+	case float64:
+		return strconv.FormatFloat(tv, 'g', -1, 64)
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
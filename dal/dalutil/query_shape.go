@@ -0,0 +1,81 @@
+package dalutil
+
+import (
+	"encoding/json"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	redacted = "?"
+)
+
+// QueryShape returns a JSON representation of query with every value
+// replaced by "?" - keys and operators are kept so that the shape of the
+// query is visible in logs/traces without leaking any data.
+//
+// Arrays are collapsed to the shape of their first element; the exception
+// being a top level array (ie. an aggregation pipeline) where every stage is kept.
+func QueryShape(query interface{}) string {
+	if query == nil {
+		return "{}"
+	}
+
+	// Round-trip through BSON so structs, bson.D, bson.M etc. all end up as
+	// the same generic types
+	raw, err := bson.Marshal(bson.M{"q": query})
+	if err != nil {
+		return redacted
+	}
+
+	doc := bson.M{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return redacted
+	}
+
+	var shape interface{}
+
+	if stages, ok := doc["q"].([]interface{}); ok {
+		redactedStages := make([]interface{}, 0, len(stages))
+		for _, stage := range stages {
+			redactedStages = append(redactedStages, redact(stage))
+		}
+
+		shape = redactedStages
+	} else {
+		shape = redact(doc["q"])
+	}
+
+	b, err := json.Marshal(shape)
+	if err != nil {
+		return redacted
+	}
+
+	return string(b)
+}
+
+func redact(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case bson.M:
+		return redactMap(tv)
+	case map[string]interface{}:
+		return redactMap(tv)
+	case []interface{}:
+		if len(tv) == 0 {
+			return []interface{}{}
+		}
+
+		return []interface{}{redact(tv[0])}
+	}
+
+	return redacted
+}
+
+func redactMap(m map[string]interface{}) interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = redact(v)
+	}
+
+	return out
+}
@@ -0,0 +1,38 @@
+package dalutil
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QueryShape", func() {
+	It("should redact every value but keep keys and operators", func() {
+		shape := QueryShape(bson.M{
+			"email": "someone@example.com",
+			"age":   bson.M{"$gt": 21},
+			"tags":  bson.M{"$in": []string{"a", "b"}},
+		})
+
+		Expect(shape).To(MatchJSON(`{"age":{"$gt":"?"},"email":"?","tags":{"$in":["?"]}}`))
+	})
+
+	It("should handle bson.D and structs", func() {
+		type q struct {
+			Name string `bson:"name"`
+		}
+
+		Expect(QueryShape(bson.D{{Name: "a", Value: 1}})).To(MatchJSON(`{"a":"?"}`))
+		Expect(QueryShape(q{Name: "secret"})).To(MatchJSON(`{"name":"?"}`))
+	})
+
+	It("should handle aggregation pipelines", func() {
+		shape := QueryShape([]bson.M{{"$match": bson.M{"a": 1}}, {"$limit": 10}})
+		Expect(shape).To(MatchJSON(`[{"$match":{"a":"?"}},{"$limit":"?"}]`))
+	})
+
+	It("should handle empty queries", func() {
+		Expect(QueryShape(nil)).To(Equal("{}"))
+	})
+})
@@ -0,0 +1,187 @@
+package dalutil
+
+import (
+	"net/url"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query", func() {
+	var (
+		spec  *QuerySpec
+		codec *CursorCodec
+	)
+
+	BeforeEach(func() {
+		spec = &QuerySpec{
+			Fields: map[string]*FieldSpec{
+				"name":       {Field: "n", Type: FIELD_STRING, Ops: append([]string{OP_PREFIX}, EQUALITY_OPS...), Sortable: true},
+				"value":      {Type: FIELD_INT, Ops: COMPARISON_OPS, Sortable: true},
+				"created_at": {Type: FIELD_TIME, Ops: []string{OP_GT, OP_LT}, Sortable: true},
+				"secret":     {Type: FIELD_STRING},
+			},
+			DefaultSort:  []string{"-created_at"},
+			DefaultLimit: 10,
+			MaxLimit:     100,
+		}
+
+		codec = NewCursorCodec([]byte("secret"))
+	})
+
+	parse := func(raw string) (*Query, error) {
+		values, err := url.ParseQuery(raw)
+		Expect(err).ToNot(HaveOccurred())
+
+		return ParseQuery(spec, values, codec)
+	}
+
+	Describe("ParseQuery", func() {
+		It("should apply the defaults", func() {
+			q, err := parse("")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(q.Filter).To(BeEmpty())
+			Expect(q.Limit).To(Equal(10))
+			Expect(q.Sort).To(HaveLen(1))
+			Expect(q.Sort[0].Param).To(Equal("created_at"))
+			Expect(q.Sort[0].Desc).To(BeTrue())
+			Expect(q.Cursor).To(BeNil())
+		})
+
+		It("should build a typed filter on the mongo field names", func() {
+			q, err := parse("filter[name]=a&filter[value][gte]=1&filter[value][lt]=5&filter[created_at][gt]=2026-10-19T00:00:00Z")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(q.Filter).To(Equal(bson.M{
+				"n":          bson.M{"$eq": "a"},
+				"value":      bson.M{"$gte": int64(1), "$lt": int64(5)},
+				"created_at": bson.M{"$gt": time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+			}))
+		})
+
+		It("should split lists and escape prefixes", func() {
+			q, err := parse("filter[value][in]=1,2&filter[name][prefix]=a.b")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(q.Filter["value"]).To(Equal(bson.M{"$in": []interface{}{int64(1), int64(2)}}))
+			Expect(q.Filter["n"]).To(Equal(bson.M{"$regex": `^a\.b`}))
+		})
+
+		It("should report every problem at once", func() {
+			_, err := parse("filter[nope]=1&filter[secret]=x&filter[value][prefix]=1&filter[value][gt]=x&filter[value=1&sort=secret&limit=1000")
+			Expect(err).To(HaveOccurred())
+
+			qerr, ok := err.(*QueryError)
+			Expect(ok).To(BeTrue())
+			Expect(qerr.Problems).To(ConsistOf(
+				"filtering on 'nope' is not supported",
+				"filtering on 'secret' is not supported",
+				"operator 'prefix' is not supported for 'value' (allowed: eq, ne, gt, gte, lt, lte, in, nin)",
+				"invalid value for 'filter[value][gt]': expected an integer",
+				"malformed filter param 'filter[value'",
+				"sorting on 'secret' is not supported",
+				"limit must be at most 100",
+			))
+		})
+
+		It("should reject tampered cursors", func() {
+			c, err := codec.Encode(&Cursor{Sort: "-created_at", Values: []*string{nil}, ID: bson.NewObjectId().Hex()})
+			Expect(err).ToNot(HaveOccurred())
+
+			q, err := parse("cursor=" + c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(q.Cursor).ToNot(BeNil())
+
+			_, err = parse("cursor=x" + c)
+			Expect(err).To(MatchError(ContainSubstring("invalid cursor")))
+
+			_, err = ParseQuery(spec, url.Values{"cursor": {c}}, NewCursorCodec([]byte("other")))
+			Expect(err).To(MatchError(ContainSubstring("invalid cursor")))
+		})
+
+		It("should reject duplicate sort keys", func() {
+			_, err := parse("sort=value,-value")
+			Expect(err).To(MatchError(ContainSubstring("cannot sort on 'value' more than once")))
+		})
+
+		It("should reject cursors issued for another sort", func() {
+			c, err := codec.Encode(&Cursor{Sort: "-created_at", Values: []*string{nil}, ID: bson.NewObjectId().Hex()})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = parse("sort=value&cursor=" + c)
+			Expect(err).To(MatchError(ContainSubstring("cursor does not match the requested sort")))
+		})
+	})
+
+	Describe("cursors", func() {
+		var (
+			keys []*SortKey
+			id   = bson.ObjectIdHex("5bc9d3d2e138230001a4b1c2")
+			at   = time.Date(2026, 10, 19, 1, 2, 3, 4000000, time.UTC)
+		)
+
+		BeforeEach(func() {
+			keys = []*SortKey{
+				{Param: "created_at", Desc: true, Spec: spec.Fields["created_at"]},
+				{Param: "name", Spec: spec.Fields["name"]},
+			}
+		})
+
+		It("should round trip the position of a document", func() {
+			cursor, err := newCursor(keys, bson.M{"_id": id, "created_at": at, "n": "a"}, false)
+			Expect(err).ToNot(HaveOccurred())
+
+			s, err := codec.Encode(cursor)
+			Expect(err).ToNot(HaveOccurred())
+
+			decoded, err := codec.Decode(s)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal(cursor))
+			Expect(decoded.Sort).To(Equal("-created_at,name"))
+		})
+
+		It("should match the documents after the position", func() {
+			cursor, err := newCursor(keys, bson.M{"_id": id, "created_at": at, "n": "a"}, false)
+			Expect(err).ToNot(HaveOccurred())
+
+			filter, err := afterFilter(keys, cursor)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filter).To(Equal(bson.M{"$or": []bson.M{
+				{"$or": []bson.M{{"created_at": bson.M{"$lt": at}}, {"created_at": nil}}},
+				{"created_at": at, "n": bson.M{"$gt": "a"}},
+				{"created_at": at, "n": "a", "_id": bson.M{"$gt": id}},
+			}}))
+		})
+
+		It("should page past documents lacking sort fields", func() {
+			cursor, err := newCursor(keys, bson.M{"_id": id}, false)
+			Expect(err).ToNot(HaveOccurred())
+
+			filter, err := afterFilter(keys, cursor)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Descending, nothing sorts lower than a missing created_at
+			Expect(filter).To(Equal(bson.M{"$or": []bson.M{
+				{"created_at": nil, "n": bson.M{"$ne": nil}},
+				{"created_at": nil, "n": nil, "_id": bson.M{"$gt": id}},
+			}}))
+		})
+
+		It("should flip comparisons and sort when paging backwards", func() {
+			cursor, err := newCursor(keys, bson.M{"_id": id, "created_at": at, "n": "a"}, true)
+			Expect(err).ToNot(HaveOccurred())
+
+			filter, err := afterFilter(keys, cursor)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filter["$or"].([]bson.M)[0]).To(Equal(bson.M{"created_at": bson.M{"$gt": at}}))
+			Expect(sortFields(keys, false)).To(Equal([]string{"-created_at", "n", "_id"}))
+			Expect(sortFields(keys, true)).To(Equal([]string{"created_at", "-n", "-_id"}))
+		})
+	})
+})
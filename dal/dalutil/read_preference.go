@@ -0,0 +1,50 @@
+package dalutil
+
+import (
+	"context"
+	"fmt"
+
+	"gopkg.in/mgo.v2"
+)
+
+type modeKey struct{}
+
+var modes = map[string]mgo.Mode{
+	"primary":            mgo.Primary,
+	"primaryPreferred":   mgo.PrimaryPreferred,
+	"secondary":          mgo.Secondary,
+	"secondaryPreferred": mgo.SecondaryPreferred,
+	"nearest":            mgo.Nearest,
+	"eventual":           mgo.Eventual,
+}
+
+// ParseMode maps a read preference name (as used in the config and in
+// mongodb:// URIs) to the matching mgo session mode
+func ParseMode(name string) (mgo.Mode, error) {
+	mode, ok := modes[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown Mongo read preference '%s'", name)
+	}
+
+	return mode, nil
+}
+
+// WithMode returns a copy of ctx that makes operations run with the given
+// read preference instead of the default one, ie. to send analytics reads to
+// secondaries:
+//
+//	err := coll.Aggregate(dalutil.WithMode(ctx, mgo.SecondaryPreferred), pipeline, &res)
+func WithMode(ctx context.Context, mode mgo.Mode) context.Context {
+	return context.WithValue(ctx, modeKey{}, mode)
+}
+
+// ModeFromContext returns the read preference set via WithMode (if any)
+func ModeFromContext(ctx context.Context) (mgo.Mode, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+
+	mode, ok := ctx.Value(modeKey{}).(mgo.Mode)
+
+	return mode, ok
+}
@@ -0,0 +1,43 @@
+package dalutil
+
+import (
+	"context"
+
+	"gopkg.in/mgo.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Read preference", func() {
+	Describe("ParseMode", func() {
+		It("should map every supported name", func() {
+			mode, err := ParseMode("secondaryPreferred")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mode).To(Equal(mgo.SecondaryPreferred))
+		})
+
+		It("should reject unknown names", func() {
+			_, err := ParseMode("tertiary")
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("tertiary"))
+		})
+	})
+
+	Describe("WithMode", func() {
+		It("should carry the mode in the context", func() {
+			mode, ok := ModeFromContext(WithMode(context.Background(), mgo.Nearest))
+
+			Expect(ok).To(BeTrue())
+			Expect(mode).To(Equal(mgo.Nearest))
+		})
+
+		It("should report when no mode was set", func() {
+			_, ok := ModeFromContext(context.Background())
+
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,1024 @@
+package dalutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/events"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+const (
+	DEFAULT_PER_PAGE = 50
+	MAX_PER_PAGE     = 1000
+
+	// Set on soft deleted documents
+	DELETED_AT_FIELD = "deleted_at"
+)
+
+// IDocument is implemented by every type stored through a Repository;
+// embedding Document is the easiest way to do so.
+type IDocument interface {
+	GetID() bson.ObjectId
+	SetID(id bson.ObjectId)
+	SetCreatedAt(t time.Time)
+	SetUpdatedAt(t time.Time)
+	GetVersion() int64
+	SetVersion(v int64)
+}
+
+// Document holds the fields managed by the Repository. Embed it inline:
+//
+//	type Widget struct {
+//		dalutil.Document `bson:",inline"`
+//		Name string `bson:"name" json:"name"`
+//	}
+type Document struct {
+	ID        bson.ObjectId `bson:"_id,omitempty" json:"id"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time     `bson:"updated_at" json:"updated_at"`
+
+	// Incremented on every write; used for optimistic concurrency control
+	Version int64 `bson:"version" json:"version"`
+
+	// Only set on soft deleted documents (see Repository.WithSoftDelete)
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+}
+
+func (d *Document) GetID() bson.ObjectId     { return d.ID }
+func (d *Document) SetID(id bson.ObjectId)   { d.ID = id }
+func (d *Document) SetCreatedAt(t time.Time) { d.CreatedAt = t }
+func (d *Document) SetUpdatedAt(t time.Time) { d.UpdatedAt = t }
+func (d *Document) GetVersion() int64        { return d.Version }
+func (d *Document) SetVersion(v int64)       { d.Version = v }
+
+// ListOpts controls List(); pages start at 1
+type ListOpts struct {
+	Select  interface{}
+	Sort    []string
+	Page    int
+	PerPage int
+}
+
+// ListResult describes the page returned by List()
+type ListResult struct {
+	Total   int `json:"total"`
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+}
+
+// Repository implements the usual CRUD operations on top of a
+// SmartCollection. It maintains the created_at/updated_at/version fields and
+// translates mgo errors into errtype errors (errtype.KeyNotFoundErr,
+// errtype.DuplicateKeyErr, errtype.VersionConflictErr). DALs embed it and
+// only add domain methods.
+//
+// Every write increments the version. Replace() and UpdateVersion() only
+// apply if the stored version still matches the expected one (optimistic
+// concurrency control); see RetryOnConflict for read-modify-write loops.
+//
+// Optionally, writes are recorded in the audit trail (WithAudit), deletes
+// only mark documents as deleted (WithSoftDelete), writes record domain
+// events in the outbox (WithOutbox), local subscribers are told about them
+// (WithBroker) and Get reads through a cache (WithCache).
+type Repository struct {
+	coll       *SmartCollection
+	audit      *Auditor
+	outbox     *Outbox
+	broker     *events.Broker
+	cache      *Cache
+	softDelete bool
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+func NewRepository(coll *SmartCollection) *Repository {
+	return &Repository{
+		coll: coll,
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// WithAudit makes every write record an AuditEntry (attributed to the actor
+// set via WithActor) and enables Restore(). Entries are written right after
+// the change itself; failing to write one is logged rather than failing the
+// (already applied) write.
+func (r *Repository) WithAudit(a *Auditor) *Repository {
+	r.audit = a
+	return r
+}
+
+// WithSoftDelete makes Delete() set deleted_at instead of removing documents.
+// Every read and write of the repository skips deleted documents; use
+// Restore() to bring one back and Purge() to remove it for good.
+func (r *Repository) WithSoftDelete() *Repository {
+	r.softDelete = true
+	return r
+}
+
+// WithOutbox makes the events passed to writes part of the write itself:
+// they are staged on the written document and moved to the outbox right
+// after (or by the relay, if that fails). Collections using it should have
+// OutboxIndex().
+func (r *Repository) WithOutbox(o *Outbox) *Repository {
+	r.outbox = o
+	o.Track(r.coll)
+
+	return r
+}
+
+// WithBroker publishes the events passed to writes to b once the write is
+// made, for the subscribers of this replica (regardless of WithOutbox)
+func (r *Repository) WithBroker(b *events.Broker) *Repository {
+	r.broker = b
+	return r
+}
+
+// WithCache makes Get (without options) read through c; every write made
+// through the repository invalidates the document it changed. Writes made
+// straight to Collection() bypass the invalidation.
+func (r *Repository) WithCache(c *Cache) *Repository {
+	r.cache = c
+	return r
+}
+
+// Collection gives access to the underlying collection for anything not
+// covered by the repository
+func (r *Repository) Collection() *SmartCollection {
+	return r.coll
+}
+
+// Create inserts doc, assigning it an ID (if it does not have one), setting
+// both timestamps and starting the version at 1; evs are recorded along with
+// it (see WithOutbox)
+func (r *Repository) Create(ctx context.Context, doc IDocument, evs ...events.IEvent) error {
+	if doc.GetID() == "" {
+		doc.SetID(bson.NewObjectId())
+	}
+
+	now := r.now()
+	doc.SetCreatedAt(now)
+	doc.SetUpdatedAt(now)
+	doc.SetVersion(1)
+
+	var insert interface{} = doc
+
+	staged := r.stage(ctx, evs)
+
+	if r.outbox != nil && len(staged) > 0 {
+		m, err := snapshot(doc)
+		if err != nil {
+			return err
+		}
+
+		for k, v := range stagedFields(nil, staged) {
+			m[k] = v
+		}
+
+		insert = m
+	}
+
+	if err := r.coll.Insert(ctx, insert); err != nil {
+		return r.translate(err, doc.GetID())
+	}
+
+	r.record(ctx, AUDIT_CREATE, doc.GetID(), nil, doc)
+	r.drain(doc.GetID(), evs)
+	r.broadcast(ctx, staged)
+
+	return nil
+}
+
+// Get fetches the document with the given ID into result
+func (r *Repository) Get(ctx context.Context, id bson.ObjectId, result interface{}) error {
+	return r.GetWithOpts(ctx, id, nil, result)
+}
+
+// GetWithOpts is Get with a projection (opts.Select)
+func (r *Repository) GetWithOpts(ctx context.Context, id bson.ObjectId, opts *FindOpts, result interface{}) error {
+	if r.cache == nil || opts != nil {
+		return r.translate(r.coll.FindOne(ctx, r.scope(bson.M{"_id": id}), opts, result), id)
+	}
+
+	if cached, ok := r.cache.Get(id.Hex()); ok {
+		return bson.Unmarshal(cached, result)
+	}
+
+	gen := r.cache.Generation()
+
+	raw := bson.Raw{}
+	if err := r.coll.FindOne(ctx, r.scope(bson.M{"_id": id}), nil, &raw); err != nil {
+		return r.translate(err, id)
+	}
+
+	r.cache.Set(id.Hex(), append([]byte(nil), raw.Data...), gen)
+
+	return raw.Unmarshal(result)
+}
+
+// FindOne fetches the first document matching query into result
+func (r *Repository) FindOne(ctx context.Context, query interface{}, opts *FindOpts, result interface{}) error {
+	return r.translate(r.coll.FindOne(ctx, r.scope(query), opts, result), query)
+}
+
+// Find fetches every document matching query into result (a pointer to a slice)
+func (r *Repository) Find(ctx context.Context, query interface{}, opts *FindOpts, result interface{}) error {
+	return r.translate(r.coll.Find(ctx, r.scope(query), opts, result), query)
+}
+
+// List fetches a page of documents matching query into result (a pointer to
+// a slice) along with the total number of matching documents
+func (r *Repository) List(ctx context.Context, query interface{}, opts *ListOpts, result interface{}) (*ListResult, error) {
+	if opts == nil {
+		opts = &ListOpts{}
+	}
+
+	query = r.scope(query)
+
+	res := &ListResult{
+		Page:    opts.Page,
+		PerPage: opts.PerPage,
+	}
+
+	if res.Page < 1 {
+		res.Page = 1
+	}
+
+	switch {
+	case res.PerPage < 1:
+		res.PerPage = DEFAULT_PER_PAGE
+	case res.PerPage > MAX_PER_PAGE:
+		res.PerPage = MAX_PER_PAGE
+	}
+
+	total, err := r.coll.Count(ctx, query)
+	if err != nil {
+		return nil, r.translate(err, query)
+	}
+
+	res.Total = total
+
+	err = r.coll.Find(ctx, query, &FindOpts{
+		Select: opts.Select,
+		Sort:   opts.Sort,
+		Skip:   (res.Page - 1) * res.PerPage,
+		Limit:  res.PerPage,
+	}, result)
+
+	if err != nil {
+		return nil, r.translate(err, query)
+	}
+
+	return res, nil
+}
+
+// Count returns the number of documents matching query
+func (r *Repository) Count(ctx context.Context, query interface{}) (int, error) {
+	n, err := r.coll.Count(ctx, r.scope(query))
+	return n, r.translate(err, query)
+}
+
+// Exists reports whether any document matches query
+func (r *Repository) Exists(ctx context.Context, query interface{}) (bool, error) {
+	err := r.coll.FindOne(ctx, r.scope(query), &FindOpts{Select: bson.M{"_id": 1}}, &bson.M{})
+
+	switch {
+	case err == nil:
+		return true, nil
+	case err == mgo.ErrNotFound:
+		return false, nil
+	}
+
+	return false, r.translate(err, query)
+}
+
+// Update applies update (made of $-operators, ie. {"$set": {...}}) to the
+// document with the given ID regardless of its version, bumping updated_at
+// and the version; evs are recorded along with it (see WithOutbox)
+func (r *Repository) Update(ctx context.Context, id bson.ObjectId, update bson.M, evs ...events.IEvent) error {
+	u, err := r.withManagedFields(update, false)
+	if err != nil {
+		return err
+	}
+
+	staged := r.stage(ctx, evs)
+
+	if err := r.modify(ctx, AUDIT_UPDATE, id, bson.M{"_id": id}, r.stageOn(u, staged), nil); err != nil {
+		return r.translate(err, id)
+	}
+
+	r.invalidate(id)
+	r.drain(id, evs)
+	r.broadcast(ctx, staged)
+
+	return nil
+}
+
+// UpdateVersion is Update that only applies if the stored document is still
+// at version; returns errtype.VersionConflictErr otherwise
+func (r *Repository) UpdateVersion(ctx context.Context, id bson.ObjectId, version int64, update bson.M, evs ...events.IEvent) error {
+	u, err := r.withManagedFields(update, false)
+	if err != nil {
+		return err
+	}
+
+	staged := r.stage(ctx, evs)
+
+	err = r.modify(ctx, AUDIT_UPDATE, id, bson.M{"_id": id, "version": version}, r.stageOn(u, staged), nil)
+	if err == mgo.ErrNotFound {
+		return r.conflictOrNotFound(ctx, id, version)
+	}
+
+	if err != nil {
+		return r.translate(err, id)
+	}
+
+	r.invalidate(id)
+	r.drain(id, evs)
+	r.broadcast(ctx, staged)
+
+	return nil
+}
+
+// Replace overwrites the fields doc declares on the stored document (matched
+// by ID) if it is still at doc's version, bumping updated_at and the version
+// (doc is updated accordingly); fields stored but not declared by doc are
+// left alone. created_at is kept as found in doc. Returns
+// errtype.VersionConflictErr if the document was modified in the meantime.
+// evs are recorded along with it (see WithOutbox).
+func (r *Repository) Replace(ctx context.Context, doc IDocument, evs ...events.IEvent) error {
+	version, updatedAt := doc.GetVersion(), r.now()
+	selector := bson.M{"_id": doc.GetID(), "version": version}
+
+	doc.SetVersion(version + 1)
+	doc.SetUpdatedAt(updatedAt)
+
+	staged := r.stage(ctx, evs)
+
+	// Only the fields doc declares are written; fields it does not know
+	// about (or events staged on the stored document) are kept
+	update, err := replacementOf(doc)
+	if err == nil {
+		err = r.modify(ctx, AUDIT_UPDATE, doc.GetID(), selector, r.stageOn(update, staged), nil)
+	}
+
+	if err == nil {
+		r.invalidate(doc.GetID())
+		r.drain(doc.GetID(), evs)
+		r.broadcast(ctx, staged)
+
+		return nil
+	}
+
+	doc.SetVersion(version)
+
+	if err == mgo.ErrNotFound {
+		return r.conflictOrNotFound(ctx, doc.GetID(), version)
+	}
+
+	return r.translate(err, doc.GetID())
+}
+
+// Upsert applies update (made of $-operators) to the document matching
+// selector, inserting it if there is none; created_at is only set on insert
+func (r *Repository) Upsert(ctx context.Context, selector interface{}, update bson.M) (*mgo.ChangeInfo, error) {
+	u, err := r.withManagedFields(update, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.audit == nil {
+		info, err := r.coll.Upsert(ctx, r.scope(selector), u)
+		if err != nil {
+			return nil, r.translate(err, selector)
+		}
+
+		// Which document was updated is not known
+		if info.UpsertedId == nil && r.cache != nil {
+			r.cache.Invalidate("")
+		}
+
+		return info, nil
+	}
+
+	before := bson.M{}
+
+	info, err := r.coll.Apply(ctx, r.scope(selector), mgo.Change{Update: u, Upsert: true}, &before)
+	if err != nil {
+		return nil, r.translate(err, selector)
+	}
+
+	if id, ok := info.UpsertedId.(bson.ObjectId); ok {
+		r.recordAfter(ctx, AUDIT_CREATE, id, nil)
+	} else if id, ok := before["_id"].(bson.ObjectId); ok {
+		r.invalidate(id)
+		r.recordAfter(ctx, AUDIT_UPDATE, id, before)
+	}
+
+	return info, nil
+}
+
+// Delete removes the document with the given ID or, with WithSoftDelete,
+// marks it as deleted; evs are recorded along with it (see WithOutbox)
+func (r *Repository) Delete(ctx context.Context, id bson.ObjectId, evs ...events.IEvent) error {
+	if !r.softDelete {
+		return r.Purge(ctx, id, evs...)
+	}
+
+	u, err := r.withManagedFields(bson.M{"$set": bson.M{DELETED_AT_FIELD: r.now()}}, false)
+	if err != nil {
+		return err
+	}
+
+	staged := r.stage(ctx, evs)
+
+	if err := r.modify(ctx, AUDIT_SOFT_DELETE, id, bson.M{"_id": id}, r.stageOn(u, staged), nil); err != nil {
+		return r.translate(err, id)
+	}
+
+	r.invalidate(id)
+	r.drain(id, evs)
+	r.broadcast(ctx, staged)
+
+	return nil
+}
+
+// Purge removes the document with the given ID, even if it is soft deleted.
+// As there is no document left to stage them on, evs (and any events still
+// staged on the document) are moved to the outbox right after the removal.
+func (r *Repository) Purge(ctx context.Context, id bson.ObjectId, evs ...events.IEvent) error {
+	staged := r.stage(ctx, evs)
+
+	if r.audit == nil && r.outbox == nil {
+		if err := r.coll.Remove(ctx, bson.M{"_id": id}); err != nil {
+			return r.translate(err, id)
+		}
+
+		r.invalidate(id)
+		r.broadcast(ctx, staged)
+
+		return nil
+	}
+
+	before := bson.M{}
+
+	if _, err := r.coll.Apply(ctx, bson.M{"_id": id}, mgo.Change{Remove: true}, &before); err != nil {
+		return r.translate(err, id)
+	}
+
+	r.invalidate(id)
+	r.record(ctx, AUDIT_DELETE, id, before, nil)
+
+	if r.outbox != nil {
+		for k, v := range stagedFields(before, staged) {
+			before[k] = v
+		}
+
+		r.withOutboxCtx(func(octx context.Context) error {
+			_, err := r.outbox.drain(octx, r.coll, before)
+			return err
+		})
+	}
+
+	r.broadcast(ctx, staged)
+
+	return nil
+}
+
+// Restore brings the document with the given ID back to a version recorded
+// in the audit trail (undeleting it if needed) as a new version. Requires
+// WithAudit; returns errtype.KeyNotFoundErr if the version was not recorded.
+func (r *Repository) Restore(ctx context.Context, id bson.ObjectId, version int64) (bson.M, error) {
+	if r.audit == nil {
+		return nil, errors.New("restoring requires the repository to be audited")
+	}
+
+	entry, err := r.audit.Snapshot(ctx, r.coll.Name(), id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := bson.M{}
+	for k, v := range entry.After {
+		doc[k] = v
+	}
+
+	delete(doc, DELETED_AT_FIELD)
+	doc["updated_at"] = r.now()
+
+	// Deliberately not scoped; deleted documents can be restored
+	current := bson.M{}
+	err = r.coll.FindOne(ctx, bson.M{"_id": id}, nil, &current)
+
+	switch {
+	case err == nil:
+		doc["version"] = versionOf(current) + 1
+
+		// Events still staged on the stored document must survive
+		for k, v := range stagedFields(current, nil) {
+			doc[k] = v
+		}
+
+		err = r.coll.Update(ctx, bson.M{"_id": id, "version": versionOf(current)}, doc)
+		if err == mgo.ErrNotFound {
+			return nil, errtype.VersionConflictErr{E: fmt.Errorf("%s: document %s changed while being restored", r.coll.Name(), id.Hex())}
+		}
+	case err == mgo.ErrNotFound:
+		// Purged; carry on from the last recorded version
+		latest, lerr := r.audit.LatestVersion(ctx, r.coll.Name(), id)
+		if lerr != nil {
+			return nil, lerr
+		}
+
+		current = nil
+		doc["version"] = latest + 1
+
+		err = r.coll.Insert(ctx, doc)
+	}
+
+	if err != nil {
+		return nil, r.translate(err, id)
+	}
+
+	doc = withoutOutbox(doc)
+
+	r.invalidate(id)
+	r.record(ctx, AUDIT_RESTORE, id, current, doc)
+
+	return doc, nil
+}
+
+// scope excludes soft deleted documents from query
+func (r *Repository) scope(query interface{}) interface{} {
+	if !r.softDelete {
+		return query
+	}
+
+	live := bson.M{DELETED_AT_FIELD: bson.M{"$exists": false}}
+
+	if m, ok := query.(bson.M); query == nil || (ok && len(m) == 0) {
+		return live
+	}
+
+	return bson.M{"$and": []interface{}{query, live}}
+}
+
+// modify applies update to the (live) document matching selector. When
+// audited, the document is fetched as it was before the change in the same
+// operation and the change is recorded; after is the document as written
+// (nil to fetch it).
+func (r *Repository) modify(ctx context.Context, action string, id bson.ObjectId, selector bson.M, update, after interface{}) error {
+	if r.audit == nil {
+		return r.coll.Update(ctx, r.scope(selector), update)
+	}
+
+	before := bson.M{}
+
+	if _, err := r.coll.Apply(ctx, r.scope(selector), mgo.Change{Update: update}, &before); err != nil {
+		return err
+	}
+
+	if after != nil {
+		r.record(ctx, action, id, before, after)
+	} else {
+		r.recordAfter(ctx, action, id, before)
+	}
+
+	return nil
+}
+
+// recordAfter records a change made by an update operator, fetching the
+// resulting document by its version. If it was changed again in the meantime
+// no snapshot is kept; the later change records its own.
+func (r *Repository) recordAfter(ctx context.Context, action string, id bson.ObjectId, before bson.M) {
+	after := bson.M{}
+
+	err := r.coll.FindOne(ctx, bson.M{"_id": id, "version": versionOf(before) + 1}, nil, &after)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			log.WithError(err).WithField("collection", r.coll.Name()).Warn("Unable to fetch document for the audit trail")
+		}
+
+		after = nil
+	}
+
+	r.record(ctx, action, id, before, after)
+}
+
+// record stores an AuditEntry for a change if the repository is audited;
+// before/after are nil when the document did not/no longer exist(s)
+func (r *Repository) record(ctx context.Context, action string, id bson.ObjectId, before bson.M, after interface{}) {
+	if r.audit == nil {
+		return
+	}
+
+	llog := log.WithField("collection", r.coll.Name()).WithField("document_id", id.Hex()).WithField("action", action)
+
+	var snap bson.M
+
+	switch a := after.(type) {
+	case nil:
+	case bson.M:
+		snap = withoutOutbox(a)
+	default:
+		var err error
+		if snap, err = snapshot(a); err != nil {
+			llog.WithError(err).Error("Unable to record audit entry")
+			return
+		}
+	}
+
+	entry := &AuditEntry{
+		Collection: r.coll.Name(),
+		DocumentID: id,
+		Action:     action,
+		Actor:      ActorFromContext(ctx),
+		Version:    versionOf(snap),
+		Changes:    Diff(before, snap),
+		After:      snap,
+		Timestamp:  r.now(),
+	}
+
+	// Not bound to the caller's ctx; the change has been made already
+	actx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+	defer cancel()
+
+	if err := r.audit.Record(actx, entry); err != nil {
+		llog.WithError(err).Error("Unable to record audit entry")
+	}
+}
+
+// stage wraps evs in envelopes attributed to the actor of ctx; nil if the
+// repository has neither an outbox nor a broker
+func (r *Repository) stage(ctx context.Context, evs []events.IEvent) []*events.Event {
+	if (r.outbox == nil && r.broker == nil) || len(evs) == 0 {
+		return nil
+	}
+
+	actor := ActorFromContext(ctx)
+
+	staged := make([]*events.Event, 0, len(evs))
+	for _, e := range evs {
+		staged = append(staged, events.New(e, actor))
+	}
+
+	return staged
+}
+
+// stageOn adds staged events to update if the repository has an outbox
+func (r *Repository) stageOn(update bson.M, staged []*events.Event) bson.M {
+	if r.outbox == nil {
+		return update
+	}
+
+	return withStaged(update, staged)
+}
+
+// replacementOf builds the update replacing the fields doc declares: set to
+// their value, or unset if left out (omitempty)
+func replacementOf(doc interface{}) (bson.M, error) {
+	set, err := snapshot(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(set, "_id")
+
+	update := bson.M{"$set": set}
+
+	unset := bson.M{}
+	for _, field := range declaredFields(reflect.TypeOf(doc)) {
+		if _, ok := set[field]; !ok && field != "_id" {
+			unset[field] = ""
+		}
+	}
+
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	return update, nil
+}
+
+// declaredFields returns the (top level) bson keys of a struct type,
+// following inlined structs
+func declaredFields(t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		tag := f.Tag.Get("bson")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+
+		if strings.Contains(opts, ",inline") {
+			fields = append(fields, declaredFields(f.Type)...)
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		fields = append(fields, name)
+	}
+
+	return fields
+}
+
+// withStaged adds staged events to an update made of $-operators
+func withStaged(update bson.M, staged []*events.Event) bson.M {
+	if len(staged) == 0 {
+		return update
+	}
+
+	update["$push"] = mergeM(update["$push"], bson.M{OUTBOX_FIELD: bson.M{"$each": staged}})
+	update["$inc"] = mergeM(update["$inc"], bson.M{OUTBOX_SEQ_FIELD: len(staged)})
+
+	return update
+}
+
+// drain moves the events just staged on a document to the outbox. Failing to
+// do so is only logged; the relay drains whatever is left behind.
+func (r *Repository) drain(id bson.ObjectId, evs []events.IEvent) {
+	if r.outbox == nil || len(evs) == 0 {
+		return
+	}
+
+	r.withOutboxCtx(func(octx context.Context) error {
+		_, err := r.outbox.DrainDocument(octx, r.coll, id)
+		return err
+	})
+}
+
+// invalidate drops the cached copy of a document that was just written
+func (r *Repository) invalidate(id bson.ObjectId) {
+	if r.cache != nil {
+		r.cache.Invalidate(id.Hex())
+	}
+}
+
+// broadcast publishes the events of a write that was just made to the
+// broker
+func (r *Repository) broadcast(ctx context.Context, staged []*events.Event) {
+	if r.broker == nil {
+		return
+	}
+
+	for _, e := range staged {
+		r.broker.Publish(ctx, e)
+	}
+}
+
+// withOutboxCtx runs fn with a ctx not bound to the caller's (the write has
+// been made already), logging its error
+func (r *Repository) withOutboxCtx(fn func(octx context.Context) error) {
+	octx, cancel := context.WithTimeout(context.Background(), outboxTimeout)
+	defer cancel()
+
+	if err := fn(octx); err != nil {
+		log.WithError(err).WithField("collection", r.coll.Name()).Warn("Unable to move events to the outbox")
+	}
+}
+
+// conflictOrNotFound tells apart a missing document from one whose version
+// moved on after a versioned write matched nothing
+func (r *Repository) conflictOrNotFound(ctx context.Context, id bson.ObjectId, version int64) error {
+	// The version the write expected may have been read from a stale cache
+	// entry; the retry should read the current one
+	if r.cache != nil {
+		r.cache.Forget(id.Hex())
+	}
+
+	exists, err := r.Exists(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return r.translate(mgo.ErrNotFound, id)
+	}
+
+	return errtype.VersionConflictErr{E: fmt.Errorf("%s: document %s is no longer at version %d", r.coll.Name(), id.Hex(), version)}
+}
+
+// withManagedFields returns a copy of update that also sets updated_at,
+// increments the version (and sets created_at on insert when upserting)
+func (r *Repository) withManagedFields(update bson.M, upsert bool) (bson.M, error) {
+	u := bson.M{}
+	for k, v := range update {
+		if len(k) == 0 || k[0] != '$' {
+			return nil, errors.New("update must only contain $-operators; use Replace() to overwrite a document")
+		}
+
+		u[k] = v
+	}
+
+	now := r.now()
+
+	u["$set"] = mergeM(u["$set"], bson.M{"updated_at": now})
+	u["$inc"] = mergeM(u["$inc"], bson.M{"version": 1})
+
+	if upsert {
+		u["$setOnInsert"] = mergeM(u["$setOnInsert"], bson.M{"created_at": now})
+	}
+
+	return u, nil
+}
+
+func mergeM(existing interface{}, add bson.M) bson.M {
+	out := bson.M{}
+
+	switch m := existing.(type) {
+	case bson.M:
+		for k, v := range m {
+			out[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range m {
+			out[k] = v
+		}
+	case bson.D:
+		for k, v := range m.Map() {
+			out[k] = v
+		}
+	}
+
+	for k, v := range add {
+		out[k] = v
+	}
+
+	return out
+}
+
+// translate maps mgo errors to errtype errors
+func (r *Repository) translate(err error, key interface{}) error {
+	switch {
+	case err == nil:
+		return nil
+	case err == mgo.ErrNotFound:
+		return errtype.KeyNotFoundErr{E: fmt.Errorf("%s: no document matching %s", r.coll.Name(), describeKey(key))}
+	case mgo.IsDup(err):
+		return errtype.DuplicateKeyErr{E: fmt.Errorf("%s: %v", r.coll.Name(), err)}
+	}
+
+	return err
+}
+
+// describeKey is used in error messages; IDs are safe to include as-is while
+// queries are reduced to their shape
+func describeKey(key interface{}) string {
+	if id, ok := key.(bson.ObjectId); ok {
+		return id.Hex()
+	}
+
+	return QueryShape(key)
+}
+
+// PageInfo describes the page returned by Page(); Next/Prev are empty when
+// there is nothing further in that direction
+type PageInfo struct {
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Limit int    `json:"limit"`
+}
+
+// Page fetches the page of documents matching both base (ie. a tenant or
+// ownership filter, may be nil) and q into result (a pointer to a slice),
+// positioned by q.Cursor. Cursors for the adjacent pages are encoded with
+// codec.
+//
+// Unlike List() this is stable under concurrent inserts and does not scan
+// skipped documents; sort keys should be covered by an index.
+func (r *Repository) Page(ctx context.Context, base bson.M, q *Query, codec *CursorCodec, result interface{}) (*PageInfo, error) {
+	prev := q.Cursor != nil && q.Cursor.Prev
+
+	and := []bson.M{}
+	if len(base) > 0 {
+		and = append(and, base)
+	}
+
+	if r.softDelete {
+		and = append(and, bson.M{DELETED_AT_FIELD: bson.M{"$exists": false}})
+	}
+
+	if len(q.Filter) > 0 {
+		and = append(and, q.Filter)
+	}
+
+	if q.Cursor != nil {
+		after, err := afterFilter(q.Sort, q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		and = append(and, after)
+	}
+
+	query := bson.M{}
+	if len(and) > 0 {
+		query["$and"] = and
+	}
+
+	// One extra document tells whether there is another page
+	err := r.coll.Find(ctx, query, &FindOpts{
+		Sort:  sortFields(q.Sort, prev),
+		Limit: q.Limit + 1,
+	}, result)
+
+	if err != nil {
+		return nil, r.translate(err, query)
+	}
+
+	slice := reflect.ValueOf(result).Elem()
+
+	more := slice.Len() > q.Limit
+	if more {
+		slice.Set(slice.Slice(0, q.Limit))
+	}
+
+	if prev {
+		reverse(slice)
+	}
+
+	info := &PageInfo{Limit: q.Limit}
+
+	if slice.Len() == 0 {
+		return info, nil
+	}
+
+	// Paging forwards there is a previous page if we came from a cursor, and
+	// a next page if there were more results; the other way around backwards
+	hasNext, hasPrev := more, q.Cursor != nil
+	if prev {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		if info.Next, err = r.cursorAt(slice.Index(slice.Len()-1), q.Sort, false, codec); err != nil {
+			return nil, err
+		}
+	}
+
+	if hasPrev {
+		if info.Prev, err = r.cursorAt(slice.Index(0), q.Sort, true, codec); err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+func (r *Repository) cursorAt(item reflect.Value, keys []*SortKey, prev bool, codec *CursorCodec) (string, error) {
+	raw, err := bson.Marshal(item.Interface())
+	if err != nil {
+		return "", err
+	}
+
+	doc := bson.M{}
+	if err := bson.Unmarshal(raw, doc); err != nil {
+		return "", err
+	}
+
+	cursor, err := newCursor(keys, doc, prev)
+	if err != nil {
+		return "", err
+	}
+
+	return codec.Encode(cursor)
+}
+
+func reverse(slice reflect.Value) {
+	for i, j := 0, slice.Len()-1; i < j; i, j = i+1, j-1 {
+		tmp := reflect.New(slice.Type().Elem()).Elem()
+		tmp.Set(slice.Index(i))
+		slice.Index(i).Set(slice.Index(j))
+		slice.Index(j).Set(tmp)
+	}
+}
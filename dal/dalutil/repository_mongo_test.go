@@ -0,0 +1,406 @@
+package dalutil
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+// Set to a Mongo URI (ie. mongodb://localhost:27017) to run the tests
+// against a real database; each test uses (and drops) its own database
+const TEST_MONGO_URI_ENV = "GO_MICROSERVICE_1_TEST_MONGO_URI"
+
+type widget struct {
+	Document `bson:",inline"`
+
+	Name  string `bson:"name" json:"name"`
+	Color string `bson:"color,omitempty" json:"color,omitempty"`
+}
+
+// testPool returns a pool on a fresh database, and a func dropping it; the
+// test is skipped unless TEST_MONGO_URI_ENV is set
+func testPool() (*SessionPool, func()) {
+	uri := os.Getenv(TEST_MONGO_URI_ENV)
+	if uri == "" {
+		Skip(TEST_MONGO_URI_ENV + " is not set")
+	}
+
+	root, err := mgo.DialWithTimeout(uri, 5*time.Second)
+	Expect(err).ToNot(HaveOccurred())
+
+	dbName := "dalutil_test_" + bson.NewObjectId().Hex()
+
+	return NewSessionPool(root, dbName, 1, 10*time.Second, nil), func() {
+		root.DB(dbName).DropDatabase()
+		root.Close()
+	}
+}
+
+var _ = Describe("Repository (Mongo)", func() {
+	var (
+		ctx     = context.Background()
+		pool    *SessionPool
+		cleanup func()
+		coll    *SmartCollection
+		repo    *Repository
+	)
+
+	BeforeEach(func() {
+		pool, cleanup = testPool()
+		coll = NewSmartCollection(pool, "widgets", nil)
+		repo = NewRepository(coll)
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	create := func(names ...string) []*widget {
+		ws := []*widget{}
+		for _, name := range names {
+			w := &widget{Name: name}
+			Expect(repo.Create(ctx, w)).To(Succeed())
+			ws = append(ws, w)
+		}
+
+		return ws
+	}
+
+	Describe("Create", func() {
+		It("should assign an ID, the timestamps and version 1", func() {
+			now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+			repo.now = func() time.Time { return now }
+
+			w := create("a")[0]
+
+			stored := &widget{}
+			Expect(repo.Get(ctx, w.ID, stored)).To(Succeed())
+			Expect(stored.ID).ToNot(BeEmpty())
+			Expect(stored.CreatedAt.UTC()).To(Equal(now))
+			Expect(stored.UpdatedAt.UTC()).To(Equal(now))
+			Expect(stored.Version).To(Equal(int64(1)))
+			Expect(stored.Name).To(Equal("a"))
+		})
+
+		It("should return a DuplicateKeyErr when the ID is taken", func() {
+			w := create("a")[0]
+
+			err := repo.Create(ctx, &widget{Document: Document{ID: w.ID}, Name: "b"})
+
+			Expect(err).To(BeAssignableToTypeOf(errtype.DuplicateKeyErr{}))
+		})
+	})
+
+	Describe("Update", func() {
+		It("should bump updated_at and leave created_at alone", func() {
+			created := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+			repo.now = func() time.Time { return created }
+			w := create("a")[0]
+
+			updated := created.Add(time.Hour)
+			repo.now = func() time.Time { return updated }
+			Expect(repo.Update(ctx, w.ID, bson.M{"$set": bson.M{"name": "b"}})).To(Succeed())
+
+			stored := &widget{}
+			Expect(repo.Get(ctx, w.ID, stored)).To(Succeed())
+			Expect(stored.CreatedAt.UTC()).To(Equal(created))
+			Expect(stored.UpdatedAt.UTC()).To(Equal(updated))
+			Expect(stored.Name).To(Equal("b"))
+		})
+	})
+
+	Describe("Get", func() {
+		It("should return a KeyNotFoundErr for unknown IDs", func() {
+			err := repo.Get(ctx, bson.NewObjectId(), &widget{})
+
+			Expect(err).To(BeAssignableToTypeOf(errtype.KeyNotFoundErr{}))
+		})
+	})
+
+	Describe("FindOne", func() {
+		It("should return a KeyNotFoundErr when nothing matches", func() {
+			create("a")
+
+			err := repo.FindOne(ctx, bson.M{"name": "b"}, nil, &widget{})
+
+			Expect(err).To(BeAssignableToTypeOf(errtype.KeyNotFoundErr{}))
+		})
+	})
+
+	Describe("Find", func() {
+		It("should return every matching document", func() {
+			create("a", "b", "a")
+
+			ws := []*widget{}
+			Expect(repo.Find(ctx, bson.M{"name": "a"}, nil, &ws)).To(Succeed())
+			Expect(ws).To(HaveLen(2))
+		})
+	})
+
+	Describe("List", func() {
+		It("should return the requested page and the total", func() {
+			create("a", "b", "c")
+
+			ws := []*widget{}
+			res, err := repo.List(ctx, nil, &ListOpts{Sort: []string{"name"}, Page: 2, PerPage: 2}, &ws)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(Equal(&ListResult{Total: 3, Page: 2, PerPage: 2}))
+			Expect(ws).To(HaveLen(1))
+			Expect(ws[0].Name).To(Equal("c"))
+		})
+	})
+
+	Describe("Count and Exists", func() {
+		It("should only consider matching documents", func() {
+			create("a", "a", "b")
+
+			Expect(repo.Count(ctx, bson.M{"name": "a"})).To(Equal(2))
+			Expect(repo.Exists(ctx, bson.M{"name": "b"})).To(BeTrue())
+			Expect(repo.Exists(ctx, bson.M{"name": "c"})).To(BeFalse())
+		})
+	})
+
+	Describe("Replace", func() {
+		It("should keep fields the document does not declare", func() {
+			w := &widget{Name: "a"}
+			Expect(repo.Create(ctx, w)).To(Succeed())
+			Expect(coll.Update(ctx, bson.M{"_id": w.ID}, bson.M{"$set": bson.M{"expires-after": "soon"}})).To(Succeed())
+
+			w.Name = "b"
+			Expect(repo.Replace(ctx, w)).To(Succeed())
+
+			stored := bson.M{}
+			Expect(coll.FindOne(ctx, bson.M{"_id": w.ID}, nil, &stored)).To(Succeed())
+			Expect(stored).To(HaveKeyWithValue("name", "b"))
+			Expect(stored).To(HaveKeyWithValue("expires-after", "soon"))
+		})
+
+		It("should clear declared fields left out of the document", func() {
+			w := &widget{Name: "a", Color: "red"}
+			Expect(repo.Create(ctx, w)).To(Succeed())
+
+			w.Color = ""
+			Expect(repo.Replace(ctx, w)).To(Succeed())
+
+			stored := bson.M{}
+			Expect(coll.FindOne(ctx, bson.M{"_id": w.ID}, nil, &stored)).To(Succeed())
+			Expect(stored).ToNot(HaveKey("color"))
+		})
+
+		It("should increment the version", func() {
+			w := create("a")[0]
+
+			Expect(repo.Replace(ctx, w)).To(Succeed())
+			Expect(w.Version).To(Equal(int64(2)))
+
+			stored := &widget{}
+			Expect(repo.Get(ctx, w.ID, stored)).To(Succeed())
+			Expect(stored.Version).To(Equal(int64(2)))
+		})
+
+		It("should return a VersionConflictErr for stale versions", func() {
+			w := create("a")[0]
+
+			stale := *w
+			Expect(repo.Replace(ctx, w)).To(Succeed())
+
+			stale.Name = "b"
+			err := repo.Replace(ctx, &stale)
+
+			Expect(err).To(BeAssignableToTypeOf(errtype.VersionConflictErr{}))
+			Expect(stale.Version).To(Equal(int64(1)))
+		})
+
+		It("should return a KeyNotFoundErr for unknown documents", func() {
+			err := repo.Replace(ctx, &widget{Document: Document{ID: bson.NewObjectId(), Version: 1}})
+
+			Expect(err).To(BeAssignableToTypeOf(errtype.KeyNotFoundErr{}))
+		})
+	})
+
+	Describe("UpdateVersion", func() {
+		It("should return a VersionConflictErr for stale versions", func() {
+			w := create("a")[0]
+			Expect(repo.UpdateVersion(ctx, w.ID, 1, bson.M{"$set": bson.M{"name": "b"}})).To(Succeed())
+
+			err := repo.UpdateVersion(ctx, w.ID, 1, bson.M{"$set": bson.M{"name": "c"}})
+
+			Expect(err).To(BeAssignableToTypeOf(errtype.VersionConflictErr{}))
+		})
+	})
+
+	Describe("RetryOnConflict", func() {
+		It("should re-read and retry writes that lost a race", func() {
+			w := create("a")[0]
+			attempts := 0
+
+			err := RetryOnConflict(ctx, DEFAULT_CONFLICT_ATTEMPTS, func() error {
+				attempts++
+
+				current := &widget{}
+				if err := repo.Get(ctx, w.ID, current); err != nil {
+					return err
+				}
+
+				// Someone else writes in between on the first attempt
+				if attempts == 1 {
+					Expect(repo.Update(ctx, w.ID, bson.M{"$set": bson.M{"color": "red"}})).To(Succeed())
+				}
+
+				current.Name = "b"
+
+				return repo.Replace(ctx, current)
+			})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(attempts).To(Equal(2))
+
+			stored := &widget{}
+			Expect(repo.Get(ctx, w.ID, stored)).To(Succeed())
+			Expect(stored.Name).To(Equal("b"))
+			Expect(stored.Color).To(Equal("red"))
+			Expect(stored.Version).To(Equal(int64(3)))
+		})
+	})
+})
+
+var _ = Describe("Repository with soft delete and audit (Mongo)", func() {
+	var (
+		ctx     = context.Background()
+		cleanup func()
+		auditor *Auditor
+		repo    *Repository
+	)
+
+	BeforeEach(func() {
+		var pool *SessionPool
+		pool, cleanup = testPool()
+
+		auditor = NewAuditor(pool, nil)
+		repo = NewRepository(NewSmartCollection(pool, "widgets", nil)).
+			WithAudit(auditor).
+			WithSoftDelete()
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	// Entries of a document in the order they were recorded
+	history := func(id bson.ObjectId) []*AuditEntry {
+		entries := []*AuditEntry{}
+		Expect(auditor.coll.Find(ctx, bson.M{"document_id": id}, &FindOpts{Sort: []string{"_id"}}, &entries)).To(Succeed())
+
+		return entries
+	}
+
+	change := func(entry *AuditEntry, field string) *FieldChange {
+		for _, c := range entry.Changes {
+			if c.Field == field {
+				return c
+			}
+		}
+
+		return nil
+	}
+
+	It("should leave soft deleted documents out of reads", func() {
+		deleted, kept := &widget{Name: "a"}, &widget{Name: "a"}
+		Expect(repo.Create(ctx, deleted)).To(Succeed())
+		Expect(repo.Create(ctx, kept)).To(Succeed())
+
+		Expect(repo.Delete(ctx, deleted.ID)).To(Succeed())
+
+		Expect(repo.Get(ctx, deleted.ID, &widget{})).To(BeAssignableToTypeOf(errtype.KeyNotFoundErr{}))
+
+		found := []*widget{}
+		Expect(repo.Find(ctx, bson.M{"name": "a"}, nil, &found)).To(Succeed())
+		Expect(found).To(HaveLen(1))
+		Expect(found[0].ID).To(Equal(kept.ID))
+
+		listed := []*widget{}
+		res, err := repo.List(ctx, nil, nil, &listed)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Total).To(Equal(1))
+		Expect(listed).To(HaveLen(1))
+		Expect(listed[0].ID).To(Equal(kept.ID))
+
+		// Still stored
+		Expect(repo.Collection().Count(ctx, nil)).To(Equal(2))
+	})
+
+	It("should restore a recorded version as a new version", func() {
+		w := &widget{Name: "a"}
+		Expect(repo.Create(ctx, w)).To(Succeed())
+
+		w.Name = "b"
+		Expect(repo.Replace(ctx, w)).To(Succeed())
+		Expect(repo.Delete(ctx, w.ID)).To(Succeed())
+
+		doc, err := repo.Restore(ctx, w.ID, 1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(doc).To(HaveKeyWithValue("name", "a"))
+
+		stored := &widget{}
+		Expect(repo.Get(ctx, w.ID, stored)).To(Succeed())
+		Expect(stored.Name).To(Equal("a"))
+		Expect(stored.Version).To(Equal(int64(4)))
+		Expect(stored.DeletedAt).To(BeNil())
+	})
+
+	It("should return a KeyNotFoundErr when restoring an unrecorded version", func() {
+		w := &widget{Name: "a"}
+		Expect(repo.Create(ctx, w)).To(Succeed())
+
+		_, err := repo.Restore(ctx, w.ID, 7)
+
+		Expect(err).To(BeAssignableToTypeOf(errtype.KeyNotFoundErr{}))
+	})
+
+	It("should record every write with what it changed", func() {
+		w := &widget{Name: "a"}
+		Expect(repo.Create(ctx, w)).To(Succeed())
+
+		w.Name = "b"
+		Expect(repo.Replace(ctx, w)).To(Succeed())
+		Expect(repo.Update(ctx, w.ID, bson.M{"$set": bson.M{"color": "red"}})).To(Succeed())
+		Expect(repo.Delete(ctx, w.ID)).To(Succeed())
+		_, err := repo.Restore(ctx, w.ID, 2)
+		Expect(err).ToNot(HaveOccurred())
+
+		entries := history(w.ID)
+		Expect(entries).To(HaveLen(5))
+
+		actions, versions := []string{}, []int64{}
+		for _, e := range entries {
+			actions = append(actions, e.Action)
+			versions = append(versions, e.Version)
+		}
+
+		Expect(actions).To(Equal([]string{AUDIT_CREATE, AUDIT_UPDATE, AUDIT_UPDATE, AUDIT_SOFT_DELETE, AUDIT_RESTORE}))
+		Expect(versions).To(Equal([]int64{1, 2, 3, 4, 5}))
+
+		Expect(change(entries[0], "name")).To(Equal(&FieldChange{Field: "name", Before: nil, After: "a"}))
+
+		Expect(entries[1].Changes).To(Equal([]*FieldChange{{Field: "name", Before: "a", After: "b"}}))
+		Expect(entries[2].Changes).To(Equal([]*FieldChange{{Field: "color", Before: nil, After: "red"}}))
+
+		Expect(entries[3].Changes).To(HaveLen(1))
+		Expect(entries[3].Changes[0].Field).To(Equal(DELETED_AT_FIELD))
+		Expect(entries[3].Changes[0].Before).To(BeNil())
+
+		// Back to version 2: undeleted and without the color
+		Expect(change(entries[4], DELETED_AT_FIELD).After).To(BeNil())
+		Expect(change(entries[4], "color")).To(Equal(&FieldChange{Field: "color", Before: "red", After: nil}))
+		Expect(change(entries[4], "name")).To(BeNil())
+	})
+})
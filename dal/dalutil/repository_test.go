@@ -0,0 +1,106 @@
+package dalutil
+
+import (
+	"errors"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+var _ = Describe("Repository", func() {
+	var (
+		repo *Repository
+		now  = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		repo = NewRepository(NewSmartCollection(nil, "widgets", nil))
+		repo.now = func() time.Time { return now }
+	})
+
+	Describe("withManagedFields", func() {
+		It("should add updated_at to $set and increment the version", func() {
+			u, err := repo.withManagedFields(bson.M{"$set": bson.M{"name": "a"}, "$inc": bson.M{"n": 1}}, false)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(u).To(Equal(bson.M{
+				"$set": bson.M{"name": "a", "updated_at": now},
+				"$inc": bson.M{"n": 1, "version": 1},
+			}))
+		})
+
+		It("should set created_at on insert when upserting", func() {
+			u, err := repo.withManagedFields(bson.M{"$set": bson.D{{Name: "name", Value: "a"}}}, true)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(u["$set"]).To(Equal(bson.M{"name": "a", "updated_at": now}))
+			Expect(u["$setOnInsert"]).To(Equal(bson.M{"created_at": now}))
+		})
+
+		It("should reject replacement documents", func() {
+			_, err := repo.withManagedFields(bson.M{"name": "a"}, false)
+
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("replacementOf", func() {
+		It("should only set or unset the fields the document declares", func() {
+			w := &widget{Document: Document{ID: bson.NewObjectId(), Version: 2, UpdatedAt: now}, Name: "a"}
+
+			u, err := replacementOf(w)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(u["$set"]).To(HaveKeyWithValue("name", "a"))
+			Expect(u["$set"]).To(HaveKeyWithValue("version", int64(2)))
+			Expect(u["$set"]).ToNot(HaveKey("_id"))
+			Expect(u["$unset"]).To(Equal(bson.M{"color": "", DELETED_AT_FIELD: ""}))
+			Expect(u).To(HaveLen(2))
+		})
+	})
+
+	Describe("scope", func() {
+		live := bson.M{DELETED_AT_FIELD: bson.M{"$exists": false}}
+
+		It("should leave queries alone without soft delete", func() {
+			Expect(repo.scope(bson.M{"a": 1})).To(Equal(bson.M{"a": 1}))
+			Expect(repo.scope(nil)).To(BeNil())
+		})
+
+		It("should exclude deleted documents with soft delete", func() {
+			repo.WithSoftDelete()
+
+			Expect(repo.scope(nil)).To(Equal(live))
+			Expect(repo.scope(bson.M{})).To(Equal(live))
+			Expect(repo.scope(bson.M{"a": 1})).To(Equal(bson.M{"$and": []interface{}{bson.M{"a": 1}, live}}))
+		})
+	})
+
+	Describe("translate", func() {
+		It("should map not found errors", func() {
+			err := repo.translate(mgo.ErrNotFound, bson.ObjectIdHex("5bc9d3d2e138230001a4b1c2"))
+
+			Expect(err).To(BeAssignableToTypeOf(errtype.KeyNotFoundErr{}))
+			Expect(err.Error()).To(ContainSubstring("5bc9d3d2e138230001a4b1c2"))
+		})
+
+		It("should map duplicate key errors", func() {
+			err := repo.translate(&mgo.LastError{Code: 11000, Err: "E11000 duplicate key error"}, nil)
+
+			Expect(err).To(BeAssignableToTypeOf(errtype.DuplicateKeyErr{}))
+		})
+
+		It("should pass other errors through", func() {
+			e := errors.New("boom")
+
+			Expect(repo.translate(e, nil)).To(Equal(e))
+			Expect(repo.translate(nil, nil)).To(BeNil())
+		})
+	})
+})
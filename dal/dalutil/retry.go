@@ -0,0 +1,56 @@
+package dalutil
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+const (
+	DEFAULT_CONFLICT_ATTEMPTS = 5
+
+	conflictBaseBackoff = 10 * time.Millisecond
+)
+
+// RetryOnConflict runs fn up to attempts times for as long as it returns an
+// errtype.VersionConflictErr, backing off (with jitter) in between. fn must
+// re-read the document on every call, ie.
+//
+//	err := dalutil.RetryOnConflict(ctx, dalutil.DEFAULT_CONFLICT_ATTEMPTS, func() error {
+//		w := &Widget{}
+//		if err := repo.Get(ctx, id, w); err != nil {
+//			return err
+//		}
+//
+//		w.Count++
+//
+//		return repo.Replace(ctx, w)
+//	})
+func RetryOnConflict(ctx context.Context, attempts int, fn func() error) error {
+	var err error
+
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if _, ok := err.(errtype.VersionConflictErr); !ok || i == attempts-1 {
+			return err
+		}
+
+		backoff := conflictBaseBackoff << uint(i)
+		backoff += time.Duration(rand.Int63n(int64(backoff)))
+
+		log.Debugf("Version conflict (attempt %d/%d), retrying in %v: %v", i+1, attempts, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
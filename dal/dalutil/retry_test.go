@@ -0,0 +1,65 @@
+package dalutil
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+var _ = Describe("RetryOnConflict", func() {
+	conflict := errtype.VersionConflictErr{E: errors.New("conflict")}
+
+	It("should retry until fn succeeds", func() {
+		calls := 0
+
+		err := RetryOnConflict(context.Background(), 5, func() error {
+			calls++
+			if calls < 3 {
+				return conflict
+			}
+
+			return nil
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(calls).To(Equal(3))
+	})
+
+	It("should give up after the given number of attempts", func() {
+		calls := 0
+
+		err := RetryOnConflict(context.Background(), 2, func() error {
+			calls++
+			return conflict
+		})
+
+		Expect(err).To(Equal(conflict))
+		Expect(calls).To(Equal(2))
+	})
+
+	It("should not retry other errors", func() {
+		calls := 0
+		boom := errors.New("boom")
+
+		err := RetryOnConflict(context.Background(), 5, func() error {
+			calls++
+			return boom
+		})
+
+		Expect(err).To(Equal(boom))
+		Expect(calls).To(Equal(1))
+	})
+
+	It("should stop when ctx is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := RetryOnConflict(ctx, 5, func() error { return conflict })
+
+		Expect(err).To(Equal(context.Canceled))
+	})
+})
@@ -0,0 +1,168 @@
+package dalutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	MONGO_POOL_IN_USE_METRIC    = "mongo.pool.in_use"
+	MONGO_POOL_EXHAUSTED_METRIC = "mongo.pool.exhausted"
+	MONGO_POOL_TIMEOUTS_METRIC  = "mongo.pool.timeouts"
+	MONGO_POOL_WAIT_METRIC      = "mongo.pool.wait"
+)
+
+var (
+	// ErrNotConnected is returned while the pool has no root session yet (ie.
+	// when the service was started in degraded mode and Mongo is still down)
+	ErrNotConnected = errors.New("MongoDB is not connected")
+)
+
+// SessionPool hands out copies of the root session, one per operation. The
+// number of sessions in use at the same time is bounded; once the pool is
+// exhausted callers wait until a session frees up or their ctx is done.
+type SessionPool struct {
+	root           *mgo.Session
+	rootMu         sync.RWMutex
+	size           int
+	dbName         string
+	sem            chan struct{}
+	defaultTimeout time.Duration
+	metrics        metrics.IMetrics
+}
+
+// NewSessionPool creates a pool of at most size sessions copied from root.
+// defaultTimeout is used as the socket timeout for contexts without a deadline.
+//
+// root may be nil, in which case Acquire returns ErrNotConnected until a
+// session is handed over via Connect().
+func NewSessionPool(root *mgo.Session, dbName string, size int, defaultTimeout time.Duration, m metrics.IMetrics) *SessionPool {
+	if size < 1 {
+		size = 1
+	}
+
+	if m == nil {
+		m = metrics.NewNoop()
+	}
+
+	p := &SessionPool{
+		size:           size,
+		dbName:         dbName,
+		sem:            make(chan struct{}, size),
+		defaultTimeout: defaultTimeout,
+		metrics:        m,
+	}
+
+	if root != nil {
+		p.Connect(root)
+	}
+
+	return p
+}
+
+// Connect sets the root session every pooled session is copied from
+func (p *SessionPool) Connect(root *mgo.Session) {
+	// Keep the driver from opening more sockets than we will ever use
+	root.SetPoolLimit(p.size)
+
+	p.rootMu.Lock()
+	p.root = root
+	p.rootMu.Unlock()
+}
+
+// Connected reports whether the pool has a root session
+func (p *SessionPool) Connected() bool {
+	return p.getRoot() != nil
+}
+
+func (p *SessionPool) getRoot() *mgo.Session {
+	p.rootMu.RLock()
+	defer p.rootMu.RUnlock()
+
+	return p.root
+}
+
+// Acquire returns a fresh session whose socket timeout matches the deadline
+// of ctx and whose read preference is the one set via WithMode (if any).
+// The returned release func must be called once the session is no longer
+// used; it closes the session and returns its slot to the pool.
+func (p *SessionPool) Acquire(ctx context.Context) (*mgo.Session, func(), error) {
+	root := p.getRoot()
+	if root == nil {
+		return nil, nil, ErrNotConnected
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+	default:
+		// Pool is exhausted; wait for a slot (or for the caller to give up)
+		p.metrics.Inc(MONGO_POOL_EXHAUSTED_METRIC, 1, nil)
+		start := time.Now()
+
+		select {
+		case p.sem <- struct{}{}:
+			p.metrics.Timing(MONGO_POOL_WAIT_METRIC, time.Since(start), nil)
+		case <-ctx.Done():
+			p.metrics.Inc(MONGO_POOL_TIMEOUTS_METRIC, 1, nil)
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	p.metrics.Gauge(MONGO_POOL_IN_USE_METRIC, float64(len(p.sem)), nil)
+
+	timeout := p.defaultTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	if timeout <= 0 {
+		<-p.sem
+		return nil, nil, context.DeadlineExceeded
+	}
+
+	s := root.Copy()
+	s.SetSocketTimeout(timeout)
+	s.SetSyncTimeout(timeout)
+
+	if mode, ok := ModeFromContext(ctx); ok {
+		s.SetMode(mode, true)
+	}
+
+	release := func() {
+		s.Close()
+		<-p.sem
+		p.metrics.Gauge(MONGO_POOL_IN_USE_METRIC, float64(len(p.sem)), nil)
+	}
+
+	return s, release, nil
+}
+
+// DB returns the database handle for a session obtained via Acquire
+func (p *SessionPool) DB(s *mgo.Session) *mgo.Database {
+	return s.DB(p.dbName)
+}
+
+// Ping checks connectivity using a session from the pool
+func (p *SessionPool) Ping(ctx context.Context) error {
+	s, release, err := p.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return s.Ping()
+}
+
+// Close closes the root session; sessions already handed out keep working
+// until released
+func (p *SessionPool) Close() {
+	if root := p.getRoot(); root != nil {
+		root.Close()
+	}
+}
@@ -2,9 +2,13 @@ package client
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/dfraglabs/go-microservice-1/apm"
 	"github.com/dfraglabs/go-microservice-1/dal/foo/types"
 )
 
@@ -16,17 +20,46 @@ type IClient interface {
 	GetBar(ctx context.Context, id int) (*types.Bar, error)
 }
 
-type Client struct {}
+type Client struct {
+	host        string
+	serviceName string
+	tracer      apm.ITracer
+}
+
+func NewFooClient(host, serviceName string, tracer apm.ITracer) *Client {
+	if tracer == nil {
+		tracer = apm.NewNoop()
+	}
 
-func NewFooClient(host, serviceName string) *Client {
-	return &Client{}
+	return &Client{
+		host:        strings.TrimRight(host, "/"),
+		serviceName: serviceName,
+		tracer:      tracer,
+	}
 }
 
 func (t *Client) GetBar(ctx context.Context, id int) (*types.Bar, error) {
+	seg := t.startSegment(ctx, "GET", fmt.Sprintf("/bars/%d", id))
+	defer seg.End(nil)
+
 	return &types.Bar{}, nil
 }
 
+// startSegment times a call to the foo API as an external segment of the
+// request (transaction) carried in ctx
+func (t *Client) startSegment(ctx context.Context, method, path string) apm.IExternalSegment {
+	req, err := http.NewRequest(method, t.host+path, nil)
+	if err != nil {
+		log.WithError(err).Debug("Unable to describe foo API call for tracing")
+		return apm.NewNoop().StartExternalSegment(ctx, nil)
+	}
+
+	req.Header.Set("User-Agent", t.serviceName)
+
+	return t.tracer.StartExternalSegment(ctx, req.WithContext(ctx))
+}
+
 // Satisfy go-health.ICheckable interface
 func (t *Client) Status() (interface{}, error) {
 	return nil, nil
-}
\ No newline at end of file
+}
@@ -3,16 +3,19 @@ package foo
 import (
 	"context"
 	"errors"
-	"time"
 	"fmt"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
 	"github.com/dfraglabs/go-microservice-1/dal/foo/client"
 	"github.com/dfraglabs/go-microservice-1/dal/foo/types"
 	"github.com/dfraglabs/go-microservice-1/deps/backends"
+	"github.com/dfraglabs/go-microservice-1/events"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
 )
 
 const (
@@ -25,38 +28,114 @@ var log = logrus.WithField("pkg", "fdal")
 
 type IDAL interface {
 	GetBar(ctx context.Context, id int) (*types.Bar, error)
+	CreateFoo(ctx context.Context, foo *types.Foo) error
+	GetFoo(ctx context.Context, id string) (*types.Foo, error)
+	UpdateFoo(ctx context.Context, foo *types.Foo) error
+	ListFoos(ctx context.Context, q *dalutil.Query, codec *dalutil.CursorCodec) ([]*types.Foo, *dalutil.PageInfo, error)
+	DeleteFoo(ctx context.Context, id string) error
+	FooHistory(ctx context.Context, id string, q *dalutil.Query, codec *dalutil.CursorCodec) ([]*dalutil.AuditEntry, *dalutil.PageInfo, error)
+	RestoreFoo(ctx context.Context, id string, version int64) (*types.Foo, error)
+}
+
+// ListSpec lists what foos can be filtered and sorted on; keys are the names
+// used in query params (and in the JSON representation)
+var ListSpec = &dalutil.QuerySpec{
+	Fields: map[string]*dalutil.FieldSpec{
+		"foo_field": {
+			Field:    "foo-field",
+			Type:     dalutil.FIELD_STRING,
+			Ops:      append([]string{dalutil.OP_PREFIX}, dalutil.EQUALITY_OPS...),
+			Sortable: true,
+		},
+		"value": {
+			Type:     dalutil.FIELD_INT,
+			Ops:      dalutil.COMPARISON_OPS,
+			Sortable: true,
+		},
+		"created_at": {
+			Type:     dalutil.FIELD_TIME,
+			Ops:      []string{dalutil.OP_GT, dalutil.OP_GTE, dalutil.OP_LT, dalutil.OP_LTE},
+			Sortable: true,
+		},
+		"updated_at": {
+			Type:     dalutil.FIELD_TIME,
+			Ops:      []string{dalutil.OP_GT, dalutil.OP_GTE, dalutil.OP_LT, dalutil.OP_LTE},
+			Sortable: true,
+		},
+	},
+	DefaultSort:  []string{"-created_at"},
+	DefaultLimit: dalutil.DEFAULT_PER_PAGE,
+	MaxLimit:     dalutil.MAX_PER_PAGE,
 }
 
 type DAL struct {
-	indexes        []*mgo.Index
-	fooClient    client.IClient
+	indexes   []*mgo.Index
+	fooClient client.IClient
+	audit     *dalutil.Auditor
+	outbox    *dalutil.Outbox
+	broker    *events.Broker
 
-	*dalutil.SmartCollection
+	*dalutil.Repository
 }
 
-func NewFooDAL(be *backends.Backends, expiresAfterSec int) (*DAL, error) {
-	fd := &DAL{
-		indexes: []*mgo.Index{
-			{
-				Name:   "unique-field",
-				Key:    []string{"foo-field"},
-				Unique: true,
-			},
-			{
-				Name:        "expiring-field",
-				Key:         []string{"expires-after"},
-				ExpireAfter: time.Second * time.Duration(expiresAfterSec),
-			},
+// Indexes returns the indexes the foo collection should have
+func Indexes(expiresAfterSec int) []*mgo.Index {
+	return []*mgo.Index{
+		{
+			Name:   "unique-field",
+			Key:    []string{"foo-field"},
+			Unique: true,
+		},
+		{
+			Name:        "expiring-field",
+			Key:         []string{"expires-after"},
+			ExpireAfter: time.Second * time.Duration(expiresAfterSec),
 		},
+		{
+			// Default sort of ListFoos
+			Name: "created-at",
+			Key:  []string{"-created_at", "-_id"},
+		},
+		dalutil.OutboxIndex(),
+	}
+}
+
+// NewFooDAL creates the foo DAL; every write is recorded via auditor and
+// deleted foos are only marked as deleted (they keep their foo_field taken).
+// Domain events are recorded in outbox and published to broker, and GetFoo
+// reads through cache, unless they are nil.
+func NewFooDAL(be *backends.Backends, expiresAfterSec int, auditor *dalutil.Auditor, outbox *dalutil.Outbox, broker *events.Broker, cache *dalutil.Cache) (*DAL, error) {
+	fd := &DAL{
+		indexes: Indexes(expiresAfterSec),
+		audit:   auditor,
+		outbox:  outbox,
+		broker:  broker,
 	}
 
 	if !be.IsConnected() {
 		return nil, errors.New("DAL is not connected. Connect the parent DAL first")
 	}
 
-	fd.SmartCollection = dalutil.NewSmartCollection(be.MongoDB.C(FOO_COLLECTION_NAME), time.Minute)
+	fd.Repository = dalutil.NewRepository(dalutil.NewSmartCollection(be.Mongo, FOO_COLLECTION_NAME, be.Instrumentation)).
+		WithAudit(auditor).
+		WithSoftDelete()
 
-	if err := fd.EnsureIndexes(fd.indexes); err != nil {
+	if outbox != nil {
+		fd.Repository.WithOutbox(outbox)
+	}
+
+	if broker != nil {
+		fd.Repository.WithBroker(broker)
+	}
+
+	if cache != nil {
+		fd.Repository.WithCache(cache)
+	}
+
+	// Deferred until Mongo is up when starting in degraded mode
+	if err := be.OnMongoConnect(func() error {
+		return fd.Collection().EnsureIndexes(fd.indexes, be.AllowDestructiveIndexes)
+	}); err != nil {
 		return nil, err
 	}
 
@@ -75,9 +154,118 @@ func (f *DAL) GetBar(ctx context.Context, id int) (*types.Bar, error) {
 	// Do something with bar
 	bar.Value = bar.Value + 1
 
+	// Lets streams see bar values change without polling. Reads are not
+	// recorded to the outbox, which is for writes.
+	if f.broker != nil {
+		f.broker.Publish(ctx, events.New(&events.BarFetched{ID: id, Value: bar.Value}, dalutil.ActorFromContext(ctx)))
+	}
+
 	return bar, nil
 }
 
+func (f *DAL) CreateFoo(ctx context.Context, foo *types.Foo) error {
+	// The event refers to the foo by its ID
+	if foo.ID == "" {
+		foo.ID = bson.NewObjectId()
+	}
+
+	return f.Create(ctx, foo, &events.FooCreated{ID: foo.ID.Hex(), Field: foo.Field, Value: foo.Value})
+}
+
+// GetFoo returns errtype.KeyNotFoundErr if there is no foo with the given
+// (hex encoded) id
+func (f *DAL) GetFoo(ctx context.Context, id string) (*types.Foo, error) {
+	oid, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	foo := &types.Foo{}
+	if err := f.Get(ctx, oid, foo); err != nil {
+		return nil, err
+	}
+
+	return foo, nil
+}
+
+// DeleteFoo soft deletes a foo; returns errtype.KeyNotFoundErr if there is no
+// (live) foo with the given id
+func (f *DAL) DeleteFoo(ctx context.Context, id string) error {
+	oid, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	return f.Delete(ctx, oid, &events.FooDeleted{ID: id})
+}
+
+// FooHistory returns a page of the audit trail of a foo (deleted or not)
+func (f *DAL) FooHistory(ctx context.Context, id string, q *dalutil.Query, codec *dalutil.CursorCodec) ([]*dalutil.AuditEntry, *dalutil.PageInfo, error) {
+	oid, err := objectID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f.audit.History(ctx, FOO_COLLECTION_NAME, oid, q, codec)
+}
+
+// RestoreFoo brings a foo back to a recorded version (undeleting it if
+// needed); returns errtype.KeyNotFoundErr if that version was not recorded
+func (f *DAL) RestoreFoo(ctx context.Context, id string, version int64) (*types.Foo, error) {
+	oid, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := f.Restore(ctx, oid, version)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	foo := &types.Foo{}
+	if err := bson.Unmarshal(raw, foo); err != nil {
+		return nil, err
+	}
+
+	return foo, nil
+}
+
+func objectID(id string) (bson.ObjectId, error) {
+	if !bson.IsObjectIdHex(id) {
+		return "", errtype.KeyNotFoundErr{E: fmt.Errorf("%s: invalid id '%s'", FOO_COLLECTION_NAME, id)}
+	}
+
+	return bson.ObjectIdHex(id), nil
+}
+
+// UpdateFoo stores foo if it is still at foo.Version; returns
+// errtype.VersionConflictErr otherwise
+func (f *DAL) UpdateFoo(ctx context.Context, foo *types.Foo) error {
+	return f.Replace(ctx, foo, &events.FooUpdated{
+		ID:      foo.ID.Hex(),
+		Version: foo.Version + 1,
+		Field:   foo.Field,
+		Value:   foo.Value,
+	})
+}
+
+// ListFoos returns a page of foos matching q (see ListSpec)
+func (f *DAL) ListFoos(ctx context.Context, q *dalutil.Query, codec *dalutil.CursorCodec) ([]*types.Foo, *dalutil.PageInfo, error) {
+	foos := []*types.Foo{}
+
+	info, err := f.Page(ctx, nil, q, codec, &foos)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return foos, info, nil
+}
+
 // Meets the go-health.ICheckable interface
 func (f *DAL) Status() (interface{}, error) {
 	stat := map[string]interface{}{}
@@ -94,13 +282,6 @@ func (f *DAL) Status() (interface{}, error) {
 
 // Attempt to fetch any, single element
 func (f *DAL) checkHealth() error {
-	var r interface{}
-	err := f.Collection().Find(nil).One(r)
-	if err != nil {
-		if err == mgo.ErrNotFound {
-			return nil
-		}
-	}
-
+	_, err := f.Exists(context.Background(), nil)
 	return err
 }
@@ -1,5 +1,17 @@
 package types
 
+import (
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+)
+
 type Bar struct {
 	Value int `json:"value"`
-}
\ No newline at end of file
+}
+
+// Foo is stored in the foo collection
+type Foo struct {
+	dalutil.Document `bson:",inline"`
+
+	Field string `bson:"foo-field" json:"foo_field"`
+	Value int    `bson:"value" json:"value"`
+}
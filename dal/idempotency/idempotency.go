@@ -0,0 +1,113 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	COLLECTION_NAME = "idempotency_keys"
+
+	STATUS_IN_FLIGHT = "in_flight"
+	STATUS_COMPLETED = "completed"
+
+	DEFAULT_LEASE = time.Minute
+
+	REQUESTS_METRIC = "idempotency.requests"
+)
+
+var (
+	ErrMismatch = errors.New("idempotency key was already used for a different request")
+	ErrInFlight = errors.New("a request with the same idempotency key is in flight")
+)
+
+// Record is stored in the idempotency_keys collection; there is one per
+// (scoped) key until it expires
+type Record struct {
+	Key         string `bson:"_id"`
+	Fingerprint string `bson:"fingerprint"` // see Fingerprint
+	Status      string `bson:"status"`
+
+	// Of the request holding an in-flight record; only that request may
+	// complete or release it. Once LeaseExpiresAt passes the holder is
+	// presumed dead, and a retry takes the record over.
+	Owner          string    `bson:"owner"`
+	LeaseExpiresAt time.Time `bson:"lease_expires_at"`
+
+	// Set once completed
+	Response *Response `bson:"response,omitempty"`
+
+	CreatedAt   time.Time  `bson:"created_at"`
+	CompletedAt *time.Time `bson:"completed_at,omitempty"`
+}
+
+// Response is the final response to a request, replayed to its retries
+type Response struct {
+	StatusCode int       `bson:"status_code"`
+	Headers    []*Header `bson:"headers,omitempty"`
+	Body       []byte    `bson:"body,omitempty"`
+}
+
+// Header is a response header; header names are not stored as field names
+// as they may contain dots
+type Header struct {
+	Name   string   `bson:"name"`
+	Values []string `bson:"values"`
+}
+
+//go:generate counterfeiter -o ../../fakes/idempotencystore/store.go . IStore
+
+// IStore is what the API tracks Idempotency-Key requests through
+type IStore interface {
+	// Begin claims key for the request with the given fingerprint. The
+	// record returned is either in flight, in which case the caller holds it
+	// and must Complete or Release it, or completed, in which case its
+	// response is to be replayed. Returns ErrMismatch if key was used for a
+	// different request and ErrInFlight if another request holds it.
+	Begin(ctx context.Context, key, fingerprint string) (*Record, error)
+
+	// Complete stores the response of the request holding rec
+	Complete(ctx context.Context, rec *Record, resp *Response) error
+
+	// Release drops rec so that a retry runs the request again
+	Release(ctx context.Context, rec *Record) error
+}
+
+// Fingerprint identifies a request by what it does; retries must have the
+// same one
+func Fingerprint(method, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(uri))
+	h.Write([]byte{0})
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewResponse captures a response to be stored
+func NewResponse(statusCode int, header http.Header, body []byte) *Response {
+	resp := &Response{StatusCode: statusCode, Body: body}
+
+	for name, values := range header {
+		resp.Headers = append(resp.Headers, &Header{Name: name, Values: values})
+	}
+
+	return resp
+}
+
+// Header returns the stored headers
+func (r *Response) Header() http.Header {
+	h := http.Header{}
+
+	for _, hdr := range r.Headers {
+		h[hdr.Name] = hdr.Values
+	}
+
+	return h
+}
@@ -0,0 +1,17 @@
+package idempotency
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+func TestIdempotencySuite(t *testing.T) {
+	// reduce the noise when testing
+	logrus.SetLevel(logrus.FatalLevel)
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Idempotency Suite")
+}
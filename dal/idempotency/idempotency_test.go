@@ -0,0 +1,48 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+)
+
+var _ = Describe("Idempotency", func() {
+	Describe("Fingerprint", func() {
+		It("should tell apart requests by method, URI and body", func() {
+			fp := Fingerprint("POST", "/v1/foos", []byte(`{"a":1}`))
+
+			Expect(Fingerprint("POST", "/v1/foos", []byte(`{"a":1}`))).To(Equal(fp))
+			Expect(Fingerprint("PUT", "/v1/foos", []byte(`{"a":1}`))).ToNot(Equal(fp))
+			Expect(Fingerprint("POST", "/v1/foos?x=1", []byte(`{"a":1}`))).ToNot(Equal(fp))
+			Expect(Fingerprint("POST", "/v1/foos", []byte(`{"a":2}`))).ToNot(Equal(fp))
+		})
+
+		It("should not be fooled by moving bytes between the URI and the body", func() {
+			Expect(Fingerprint("POST", "/v1/foos", []byte("x"))).ToNot(Equal(Fingerprint("POST", "/v1/foosx", nil)))
+		})
+	})
+
+	Describe("Response", func() {
+		It("should keep the headers", func() {
+			h := http.Header{"Content-Type": {"application/json"}, "X-Many": {"a", "b"}}
+
+			resp := NewResponse(http.StatusCreated, h, []byte("{}"))
+
+			Expect(resp.Header()).To(Equal(h))
+		})
+	})
+
+	Describe("Store", func() {
+		It("should fail while Mongo is not connected", func() {
+			s := New(dalutil.NewSessionPool(nil, "db", 1, time.Second, nil), nil, 0)
+
+			_, err := s.Begin(context.Background(), "key", "fingerprint")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
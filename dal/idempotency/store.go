@@ -0,0 +1,146 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+)
+
+const (
+	// Begin retries when the record it collided with is gone by the time it
+	// is read (released or expired)
+	beginAttempts = 3
+)
+
+// Store keeps Idempotency-Key records in Mongo. Records expire (whatever
+// their status) after the TTL of the collection's index, after which a key
+// can be reused.
+type Store struct {
+	coll  *dalutil.SmartCollection
+	lease time.Duration
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+// New creates a store; in-flight records are taken over once they have been
+// held for lease (DEFAULT_LEASE if <= 0), which should exceed the time a
+// request may take
+func New(pool *dalutil.SessionPool, inst *dalutil.Instrumentation, lease time.Duration) *Store {
+	if lease <= 0 {
+		lease = DEFAULT_LEASE
+	}
+
+	return &Store{
+		coll:  dalutil.NewSmartCollection(pool, COLLECTION_NAME, inst),
+		lease: lease,
+		now:   func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Indexes returns the indexes the collection should have; records expire
+// expiresAfterSec after being created
+func Indexes(expiresAfterSec int) []*mgo.Index {
+	return []*mgo.Index{
+		{
+			Name:        "expiring-created-at",
+			Key:         []string{"created_at"},
+			ExpireAfter: time.Second * time.Duration(expiresAfterSec),
+		},
+	}
+}
+
+func (s *Store) EnsureIndexes(expiresAfterSec int, allowDestructive bool) error {
+	return s.coll.EnsureIndexes(Indexes(expiresAfterSec), allowDestructive)
+}
+
+// Begin meets IStore
+func (s *Store) Begin(ctx context.Context, key, fingerprint string) (*Record, error) {
+	for i := 0; i < beginAttempts; i++ {
+		now := s.now()
+		rec := &Record{}
+
+		// Creates the record, or takes over an abandoned one of the same
+		// request; the upsert fails with a duplicate key error otherwise
+		_, err := s.coll.Apply(ctx,
+			bson.M{
+				"_id":              key,
+				"fingerprint":      fingerprint,
+				"status":           STATUS_IN_FLIGHT,
+				"lease_expires_at": bson.M{"$lt": now},
+			},
+			mgo.Change{
+				Update: bson.M{
+					"$set": bson.M{
+						"owner":            bson.NewObjectId().Hex(),
+						"lease_expires_at": now.Add(s.lease),
+					},
+					"$setOnInsert": bson.M{"created_at": now},
+				},
+				Upsert:    true,
+				ReturnNew: true,
+			},
+			rec,
+		)
+
+		if err == nil {
+			return rec, nil
+		}
+
+		if !mgo.IsDup(err) {
+			return nil, fmt.Errorf("Unable to begin idempotent request: %v", err)
+		}
+
+		err = s.coll.FindOne(ctx, bson.M{"_id": key}, nil, rec)
+
+		switch {
+		case err == mgo.ErrNotFound:
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("Unable to fetch idempotency record: %v", err)
+		case rec.Fingerprint != fingerprint:
+			return nil, ErrMismatch
+		case rec.Status == STATUS_COMPLETED:
+			return rec, nil
+		default:
+			return nil, ErrInFlight
+		}
+	}
+
+	return nil, ErrInFlight
+}
+
+// Complete meets IStore; fails with mgo.ErrNotFound if rec was taken over
+func (s *Store) Complete(ctx context.Context, rec *Record, resp *Response) error {
+	now := s.now()
+
+	err := s.coll.Update(ctx,
+		bson.M{"_id": rec.Key, "owner": rec.Owner, "status": STATUS_IN_FLIGHT},
+		bson.M{"$set": bson.M{"status": STATUS_COMPLETED, "response": resp, "completed_at": now}},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	rec.Status = STATUS_COMPLETED
+	rec.Response = resp
+	rec.CompletedAt = &now
+
+	return nil
+}
+
+// Release meets IStore; a record taken over by another request is left alone
+func (s *Store) Release(ctx context.Context, rec *Record) error {
+	err := s.coll.Remove(ctx, bson.M{"_id": rec.Key, "owner": rec.Owner, "status": STATUS_IN_FLIGHT})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+
+	return err
+}
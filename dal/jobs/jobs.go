@@ -0,0 +1,201 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var log = logrus.WithField("pkg", "jobs")
+
+const (
+	STATUS_QUEUED    = "queued"
+	STATUS_RUNNING   = "running"
+	STATUS_SUCCEEDED = "succeeded"
+	STATUS_DEAD      = "dead" // out of attempts; see Queue.Retry
+	STATUS_CANCELED  = "canceled"
+)
+
+type progressKey struct{}
+
+// Progress is reported by handlers via ReportProgress
+type Progress struct {
+	Percent int    `bson:"percent" json:"percent"` // 0-100
+	Message string `bson:"message,omitempty" json:"message,omitempty"`
+}
+
+// Job is stored in the jobs collection
+type Job struct {
+	ID       bson.ObjectId `bson:"_id" json:"id"`
+	Type     string        `bson:"type" json:"type"`
+	Payload  interface{}   `bson:"payload,omitempty" json:"payload,omitempty"`
+	Status   string        `bson:"status" json:"status"`
+	Priority int           `bson:"priority" json:"priority"` // higher runs first
+
+	// Not claimed before this time (delay and retry backoff)
+	RunAt time.Time `bson:"run_at" json:"run_at"`
+
+	Attempts    int    `bson:"attempts" json:"attempts"`
+	MaxAttempts int    `bson:"max_attempts" json:"max_attempts"`
+	LastError   string `bson:"last_error,omitempty" json:"last_error,omitempty"`
+
+	Progress *Progress   `bson:"progress,omitempty" json:"progress,omitempty"`
+	Result   interface{} `bson:"result,omitempty" json:"result,omitempty"`
+
+	// Set by Queue.Cancel on a running job; the worker running it cancels
+	// the handler's ctx once it notices
+	CancelRequested bool `bson:"cancel_requested,omitempty" json:"cancel_requested,omitempty"`
+
+	// Set while running; the job is claimable again once LockedUntil passes
+	// (ie. when the worker running it died)
+	LockedBy    string     `bson:"locked_by,omitempty" json:"-"`
+	LockedUntil *time.Time `bson:"locked_until,omitempty" json:"-"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+
+	// Finished jobs are removed by a TTL index on this field
+	FinishedAt *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job reached a final status
+func (j *Job) Finished() bool {
+	switch j.Status {
+	case STATUS_SUCCEEDED, STATUS_DEAD, STATUS_CANCELED:
+		return true
+	}
+
+	return false
+}
+
+// DecodePayload unmarshals the payload into v (a pointer to a struct with
+// bson tags)
+func (j *Job) DecodePayload(v interface{}) error {
+	raw, err := bson.Marshal(bson.M{"p": j.Payload})
+	if err != nil {
+		return err
+	}
+
+	holder := struct {
+		P bson.Raw `bson:"p"`
+	}{}
+
+	if err := bson.Unmarshal(raw, &holder); err != nil {
+		return err
+	}
+
+	if err := holder.P.Unmarshal(v); err != nil {
+		return fmt.Errorf("Invalid payload for job '%s': %v", j.Type, err)
+	}
+
+	return nil
+}
+
+// Handler runs a job and returns its result (stored on the job). ctx is
+// canceled when the job is canceled, or when the worker shuts down or loses
+// the job; handlers should return promptly when it is. Returning an error
+// schedules a retry.
+type Handler func(ctx context.Context, job *Job) (interface{}, error)
+
+// Registry maps job types to their handler
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	public   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: map[string]Handler{},
+		public:   map[string]bool{},
+	}
+}
+
+// Register adds the handler of an internal jobType, only enqueued by the
+// service itself. It panics on a duplicate type since that is a programming
+// error.
+func (r *Registry) Register(jobType string, h Handler) {
+	r.register(jobType, h, false)
+}
+
+// RegisterPublic adds the handler of a jobType that clients may submit
+// (see POST /v1/jobs); same as Register otherwise
+func (r *Registry) RegisterPublic(jobType string, h Handler) {
+	r.register(jobType, h, true)
+}
+
+func (r *Registry) register(jobType string, h Handler, public bool) {
+	if jobType == "" || h == nil {
+		panic("jobs: handler must have a type and a func")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.handlers[jobType]; ok {
+		panic(fmt.Sprintf("jobs: duplicate handler for '%s'", jobType))
+	}
+
+	r.handlers[jobType] = h
+	r.public[jobType] = public
+}
+
+// Public tells whether clients may submit jobs of jobType
+func (r *Registry) Public(jobType string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.public[jobType]
+}
+
+// Get returns the handler of jobType (nil if there is none)
+func (r *Registry) Get(jobType string) Handler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.handlers[jobType]
+}
+
+// Types lists the registered job types, sorted
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.handlers))
+	for t := range r.handlers {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+
+	return types
+}
+
+// ReportProgress records the progress of the job run by the handler that
+// was given ctx; each call is a write, so report on meaningful steps only.
+// It is a no-op outside of a handler.
+func ReportProgress(ctx context.Context, percent int, message string) error {
+	report, ok := ctx.Value(progressKey{}).(func(*Progress) error)
+	if !ok {
+		return nil
+	}
+
+	if percent < 0 {
+		percent = 0
+	}
+
+	if percent > 100 {
+		percent = 100
+	}
+
+	return report(&Progress{Percent: percent, Message: message})
+}
+
+func withProgress(ctx context.Context, report func(*Progress) error) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
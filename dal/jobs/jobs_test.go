@@ -0,0 +1,168 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Jobs", func() {
+	Describe("Registry", func() {
+		noop := func(context.Context, *Job) (interface{}, error) { return nil, nil }
+
+		It("should list registered types in order", func() {
+			r := NewRegistry()
+			r.Register("b", noop)
+			r.Register("a", noop)
+
+			Expect(r.Types()).To(Equal([]string{"a", "b"}))
+			Expect(r.Get("a")).ToNot(BeNil())
+			Expect(r.Get("c")).To(BeNil())
+		})
+
+		It("should tell public types from internal ones", func() {
+			r := NewRegistry()
+			r.Register("internal", noop)
+			r.RegisterPublic("public", noop)
+
+			Expect(r.Public("public")).To(BeTrue())
+			Expect(r.Public("internal")).To(BeFalse())
+			Expect(r.Public("unknown")).To(BeFalse())
+		})
+
+		It("should panic on duplicate types", func() {
+			r := NewRegistry()
+			r.Register("a", noop)
+
+			Expect(func() { r.Register("a", noop) }).To(Panic())
+		})
+	})
+
+	Describe("DecodePayload", func() {
+		type payload struct {
+			Names []string `bson:"names"`
+		}
+
+		It("should decode payloads read back from Mongo", func() {
+			job := &Job{Payload: bson.M{"names": []interface{}{"a", "b"}}}
+
+			p := &payload{}
+			Expect(job.DecodePayload(p)).To(Succeed())
+			Expect(p.Names).To(Equal([]string{"a", "b"}))
+		})
+
+		It("should decode payloads submitted as JSON", func() {
+			job := &Job{Payload: map[string]interface{}{"count": 2.0}}
+
+			p := &struct {
+				Count int `bson:"count"`
+			}{}
+			Expect(job.DecodePayload(p)).To(Succeed())
+			Expect(p.Count).To(Equal(2))
+		})
+
+		It("should decode payloads as enqueued", func() {
+			job := &Job{Payload: &payload{Names: []string{"a"}}}
+
+			p := &payload{}
+			Expect(job.DecodePayload(p)).To(Succeed())
+			Expect(p.Names).To(Equal([]string{"a"}))
+		})
+	})
+
+	Describe("ReportProgress", func() {
+		It("should be a no-op outside of a handler", func() {
+			Expect(ReportProgress(context.Background(), 10, "")).To(Succeed())
+		})
+	})
+
+	Describe("Finished", func() {
+		It("should only be true for final statuses", func() {
+			Expect((&Job{Status: STATUS_RUNNING}).Finished()).To(BeFalse())
+			Expect((&Job{Status: STATUS_CANCELED}).Finished()).To(BeTrue())
+		})
+	})
+
+	Describe("Backoff", func() {
+		It("should double up to the maximum", func() {
+			Expect(Backoff(1)).To(Equal(JOB_RETRY_MIN_BACKOFF))
+			Expect(Backoff(2)).To(Equal(2 * JOB_RETRY_MIN_BACKOFF))
+			Expect(Backoff(3)).To(Equal(4 * JOB_RETRY_MIN_BACKOFF))
+			Expect(Backoff(100)).To(Equal(JOB_RETRY_MAX_BACKOFF))
+		})
+	})
+
+	Describe("Claim", func() {
+		It("should not claim anything without job types", func() {
+			job, err := NewQueue(nil, nil, 0).Claim(context.Background(), "w", nil, time.Minute)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(job).To(BeNil())
+		})
+
+		It("should claim higher priority jobs first, then older ones", func() {
+			now := time.Now().UTC().Truncate(time.Millisecond)
+
+			oldLow := &Job{ID: bson.NewObjectId(), Priority: 0, RunAt: now.Add(-time.Hour)}
+			newHigh := &Job{ID: bson.NewObjectId(), Priority: 5, RunAt: now}
+			oldHigh := &Job{ID: bson.NewObjectId(), Priority: 5, RunAt: now.Add(-time.Minute)}
+
+			Expect(inClaimOrder(oldLow, newHigh, oldHigh)).To(Equal([]*Job{oldHigh, newHigh, oldLow}))
+		})
+	})
+})
+
+// inClaimOrder sorts jobs the way Mongo does with claimOrder
+func inClaimOrder(jobs ...*Job) []*Job {
+	docs := make([]bson.M, len(jobs))
+	for i, job := range jobs {
+		raw, err := bson.Marshal(job)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bson.Unmarshal(raw, &docs[i])).To(Succeed())
+	}
+
+	less := func(a, b interface{}) bool {
+		switch a := a.(type) {
+		case int:
+			return a < b.(int)
+		case time.Time:
+			return a.Before(b.(time.Time))
+		case bson.ObjectId:
+			return a < b.(bson.ObjectId)
+		}
+
+		Fail(fmt.Sprintf("unsupported sort value %T", a))
+		return false
+	}
+
+	sorted := append([]*Job(nil), jobs...)
+	idx := map[*Job]bson.M{}
+	for i, job := range jobs {
+		idx[job] = docs[i]
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for _, key := range claimOrder {
+			field, desc := strings.TrimPrefix(key, "-"), strings.HasPrefix(key, "-")
+
+			a, b := idx[sorted[i]][field], idx[sorted[j]][field]
+			switch {
+			case less(a, b):
+				return !desc
+			case less(b, a):
+				return desc
+			}
+		}
+
+		return false
+	})
+
+	return sorted
+}
@@ -0,0 +1,440 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+const (
+	JOBS_COLLECTION_NAME = "jobs"
+
+	DEFAULT_MAX_ATTEMPTS = 5
+
+	// Retries back off exponentially between these
+	JOB_RETRY_MIN_BACKOFF = 10 * time.Second
+	JOB_RETRY_MAX_BACKOFF = time.Hour
+)
+
+var (
+	// Order in which runnable jobs are claimed: most urgent first, then
+	// oldest first (see the claimable index)
+	claimOrder = []string{"-priority", "run_at", "_id"}
+)
+
+var (
+	// The job was claimed by another worker (its visibility timeout expired)
+	ErrJobLost = errors.New("job is no longer held by this worker")
+
+	// Returned by Extend once the job's cancellation was requested
+	ErrJobCanceled = errors.New("job was canceled")
+
+	// Returned by Cancel for jobs that already succeeded or died
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// EnqueueOpts are all optional
+type EnqueueOpts struct {
+	Priority    int           // higher runs first
+	Delay       time.Duration // before the first attempt
+	MaxAttempts int           // DEFAULT_MAX_ATTEMPTS if 0
+}
+
+//go:generate counterfeiter -o ../../fakes/jobqueue/queue.go . IQueue
+
+type IQueue interface {
+	Enqueue(ctx context.Context, jobType string, payload interface{}, opts *EnqueueOpts) (*Job, error)
+	Get(ctx context.Context, id string) (*Job, error)
+	Retry(ctx context.Context, id string) error
+	Cancel(ctx context.Context, id string) (*Job, error)
+	Stats(ctx context.Context) (map[string]int, error)
+
+	Claim(ctx context.Context, worker string, types []string, visibility time.Duration) (*Job, error)
+	Extend(ctx context.Context, job *Job, visibility time.Duration) error
+	SetProgress(ctx context.Context, job *Job, progress *Progress) error
+	Complete(ctx context.Context, job *Job, result interface{}) error
+	Fail(ctx context.Context, job *Job, jobErr error) error
+	Release(ctx context.Context, job *Job) error
+	MarkCanceled(ctx context.Context, job *Job) error
+}
+
+// Queue stores jobs in Mongo. Workers claim jobs atomically and hold them
+// for a visibility timeout (extended while the job runs); a job whose
+// worker died becomes claimable again once it passes. Finished jobs expire
+// after expiresAfterSec.
+type Queue struct {
+	coll    *dalutil.SmartCollection
+	indexes []*mgo.Index
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+func NewQueue(pool *dalutil.SessionPool, inst *dalutil.Instrumentation, expiresAfterSec int) *Queue {
+	return &Queue{
+		coll:    dalutil.NewSmartCollection(pool, JOBS_COLLECTION_NAME, inst),
+		indexes: Indexes(expiresAfterSec),
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Indexes returns the indexes the jobs collection should have
+func Indexes(expiresAfterSec int) []*mgo.Index {
+	return []*mgo.Index{
+		{
+			Name: "claimable",
+			Key:  []string{"status", "type", "-priority", "run_at"},
+		},
+		{
+			Name: "expired-locks",
+			Key:  []string{"status", "locked_until"},
+		},
+		{
+			// Only finished jobs have a finished_at
+			Name:        "expiring-finished",
+			Key:         []string{"finished_at"},
+			ExpireAfter: time.Second * time.Duration(expiresAfterSec),
+		},
+	}
+}
+
+func (q *Queue) EnsureIndexes(allowDestructive bool) error {
+	return q.coll.EnsureIndexes(q.indexes, allowDestructive)
+}
+
+// Enqueue stores a new job; payload must be serializable to BSON
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts *EnqueueOpts) (*Job, error) {
+	if opts == nil {
+		opts = &EnqueueOpts{}
+	}
+
+	now := q.now()
+
+	job := &Job{
+		ID:          bson.NewObjectId(),
+		Type:        jobType,
+		Payload:     payload,
+		Status:      STATUS_QUEUED,
+		Priority:    opts.Priority,
+		RunAt:       now.Add(opts.Delay),
+		MaxAttempts: opts.MaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if job.MaxAttempts < 1 {
+		job.MaxAttempts = DEFAULT_MAX_ATTEMPTS
+	}
+
+	if err := q.coll.Insert(ctx, job); err != nil {
+		return nil, fmt.Errorf("Unable to enqueue '%s' job: %v", jobType, err)
+	}
+
+	return job, nil
+}
+
+// Get returns errtype.KeyNotFoundErr if there is no job with the given (hex
+// encoded) id
+func (q *Queue) Get(ctx context.Context, id string) (*Job, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, errtype.KeyNotFoundErr{E: fmt.Errorf("%s: invalid id '%s'", JOBS_COLLECTION_NAME, id)}
+	}
+
+	job := &Job{}
+
+	err := q.coll.FindOne(ctx, bson.M{"_id": bson.ObjectIdHex(id)}, nil, job)
+	if err == mgo.ErrNotFound {
+		return nil, errtype.KeyNotFoundErr{E: fmt.Errorf("%s: no job %s", JOBS_COLLECTION_NAME, id)}
+	}
+
+	return job, err
+}
+
+// Retry requeues a dead job with a fresh set of attempts
+func (q *Queue) Retry(ctx context.Context, id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return errtype.KeyNotFoundErr{E: fmt.Errorf("%s: invalid id '%s'", JOBS_COLLECTION_NAME, id)}
+	}
+
+	now := q.now()
+
+	err := q.coll.Update(ctx,
+		bson.M{"_id": bson.ObjectIdHex(id), "status": STATUS_DEAD},
+		bson.M{
+			"$set":   bson.M{"status": STATUS_QUEUED, "attempts": 0, "run_at": now, "updated_at": now},
+			"$unset": bson.M{"finished_at": ""},
+		},
+	)
+
+	if err == mgo.ErrNotFound {
+		return errtype.KeyNotFoundErr{E: fmt.Errorf("%s: no dead job %s", JOBS_COLLECTION_NAME, id)}
+	}
+
+	return err
+}
+
+// Cancel cancels a queued job right away; for a running job it requests
+// cancellation, which the worker running it notices on its next heartbeat.
+// Canceling a canceled job is a no-op; ErrJobFinished is returned (along
+// with the job) if it already succeeded or died.
+func (q *Queue) Cancel(ctx context.Context, id string) (*Job, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, errtype.KeyNotFoundErr{E: fmt.Errorf("%s: invalid id '%s'", JOBS_COLLECTION_NAME, id)}
+	}
+
+	oid := bson.ObjectIdHex(id)
+
+	// The job can move between queued and running while this runs
+	for {
+		now := q.now()
+
+		job, err := q.apply(ctx, bson.M{"_id": oid, "status": STATUS_QUEUED}, bson.M{
+			"$set": bson.M{"status": STATUS_CANCELED, "cancel_requested": true, "finished_at": now, "updated_at": now},
+		})
+		if job != nil || err != nil {
+			return job, err
+		}
+
+		job, err = q.apply(ctx, bson.M{"_id": oid, "status": STATUS_RUNNING}, bson.M{
+			"$set": bson.M{"cancel_requested": true, "updated_at": now},
+		})
+		if job != nil || err != nil {
+			return job, err
+		}
+
+		job, err = q.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch job.Status {
+		case STATUS_CANCELED:
+			return job, nil
+		case STATUS_SUCCEEDED, STATUS_DEAD:
+			return job, ErrJobFinished
+		}
+	}
+}
+
+// Stats counts the jobs in each status (finished jobs until they expire)
+func (q *Queue) Stats(ctx context.Context) (map[string]int, error) {
+	groups := []struct {
+		Status string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}{}
+
+	err := q.coll.Aggregate(ctx, []bson.M{
+		{"$group": bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}},
+	}, &groups)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to count jobs: %v", err)
+	}
+
+	stats := map[string]int{
+		STATUS_QUEUED:    0,
+		STATUS_RUNNING:   0,
+		STATUS_SUCCEEDED: 0,
+		STATUS_DEAD:      0,
+		STATUS_CANCELED:  0,
+	}
+
+	for _, g := range groups {
+		stats[g.Status] = g.Count
+	}
+
+	return stats, nil
+}
+
+// Claim atomically takes the most urgent runnable job of one of the given
+// types for visibility; returns nil if there is none. Jobs abandoned by a
+// dead worker on their last attempt are moved to the dead state instead, and
+// jobs whose cancellation was requested are canceled.
+func (q *Queue) Claim(ctx context.Context, worker string, types []string, visibility time.Duration) (*Job, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+
+	for {
+		now := q.now()
+		lockedUntil := now.Add(visibility)
+
+		job := &Job{}
+
+		_, err := q.coll.ApplySorted(ctx,
+			bson.M{
+				"type": bson.M{"$in": types},
+				"$or": []bson.M{
+					{"status": STATUS_QUEUED, "run_at": bson.M{"$lte": now}},
+					{"status": STATUS_RUNNING, "locked_until": bson.M{"$lt": now}},
+				},
+			},
+			claimOrder,
+			mgo.Change{
+				Update: bson.M{
+					"$set": bson.M{"status": STATUS_RUNNING, "locked_by": worker, "locked_until": lockedUntil, "updated_at": now},
+					"$inc": bson.M{"attempts": 1},
+				},
+				ReturnNew: true,
+			},
+			job,
+		)
+
+		switch {
+		case err == mgo.ErrNotFound:
+			return nil, nil
+		case err != nil:
+			return nil, fmt.Errorf("Unable to claim job: %v", err)
+		}
+
+		switch {
+		case job.CancelRequested:
+			err = q.MarkCanceled(ctx, job)
+		case job.Attempts > job.MaxAttempts:
+			err = q.finish(ctx, job, STATUS_DEAD, bson.M{"last_error": "worker died while running the last attempt"})
+		default:
+			return job, nil
+		}
+
+		if err != nil && err != ErrJobLost {
+			return nil, err
+		}
+	}
+}
+
+// Extend pushes back the visibility timeout of a running job; returns
+// ErrJobCanceled if its cancellation was requested
+func (q *Queue) Extend(ctx context.Context, job *Job, visibility time.Duration) error {
+	now := q.now()
+
+	held, err := q.apply(ctx, q.heldBy(job), bson.M{
+		"$set": bson.M{"locked_until": now.Add(visibility), "updated_at": now},
+	})
+
+	switch {
+	case err != nil:
+		return err
+	case held == nil:
+		return ErrJobLost
+	case held.CancelRequested:
+		return ErrJobCanceled
+	}
+
+	return nil
+}
+
+// SetProgress records the progress of a running job
+func (q *Queue) SetProgress(ctx context.Context, job *Job, progress *Progress) error {
+	return q.held(q.coll.Update(ctx, q.heldBy(job), bson.M{
+		"$set": bson.M{"progress": progress, "updated_at": q.now()},
+	}))
+}
+
+// Complete marks a running job as succeeded
+func (q *Queue) Complete(ctx context.Context, job *Job, result interface{}) error {
+	set := bson.M{}
+	if result != nil {
+		set["result"] = result
+	}
+
+	return q.finish(ctx, job, STATUS_SUCCEEDED, set)
+}
+
+// Fail schedules a retry of a running job (backing off exponentially) or,
+// once it is out of attempts, moves it to the dead state
+func (q *Queue) Fail(ctx context.Context, job *Job, jobErr error) error {
+	if job.Attempts >= job.MaxAttempts {
+		return q.finish(ctx, job, STATUS_DEAD, bson.M{"last_error": jobErr.Error()})
+	}
+
+	now := q.now()
+
+	return q.held(q.coll.Update(ctx, q.heldBy(job), bson.M{
+		"$set": bson.M{
+			"status":     STATUS_QUEUED,
+			"run_at":     now.Add(Backoff(job.Attempts)),
+			"last_error": jobErr.Error(),
+			"updated_at": now,
+		},
+		"$unset": bson.M{"locked_by": "", "locked_until": ""},
+	}))
+}
+
+// Release puts a running job back in the queue without counting the attempt
+// (ie. when the worker shuts down)
+func (q *Queue) Release(ctx context.Context, job *Job) error {
+	now := q.now()
+
+	return q.held(q.coll.Update(ctx, q.heldBy(job), bson.M{
+		"$set":   bson.M{"status": STATUS_QUEUED, "run_at": now, "updated_at": now},
+		"$inc":   bson.M{"attempts": -1},
+		"$unset": bson.M{"locked_by": "", "locked_until": ""},
+	}))
+}
+
+// MarkCanceled finishes a running job whose cancellation was requested
+func (q *Queue) MarkCanceled(ctx context.Context, job *Job) error {
+	return q.finish(ctx, job, STATUS_CANCELED, bson.M{})
+}
+
+func (q *Queue) finish(ctx context.Context, job *Job, status string, set bson.M) error {
+	now := q.now()
+
+	set["status"] = status
+	set["finished_at"] = now
+	set["updated_at"] = now
+
+	return q.held(q.coll.Update(ctx, q.heldBy(job), bson.M{
+		"$set":   set,
+		"$unset": bson.M{"locked_by": "", "locked_until": ""},
+	}))
+}
+
+// apply returns the updated job, or nil if query matched none
+func (q *Queue) apply(ctx context.Context, query, update bson.M) (*Job, error) {
+	job := &Job{}
+
+	_, err := q.coll.Apply(ctx, query, mgo.Change{Update: update, ReturnNew: true}, job)
+
+	switch {
+	case err == mgo.ErrNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (q *Queue) heldBy(job *Job) bson.M {
+	return bson.M{"_id": job.ID, "status": STATUS_RUNNING, "locked_by": job.LockedBy}
+}
+
+func (q *Queue) held(err error) error {
+	if err == mgo.ErrNotFound {
+		return ErrJobLost
+	}
+
+	return err
+}
+
+// Backoff returns the delay before retrying after the given (1-based) attempt
+func Backoff(attempt int) time.Duration {
+	d := JOB_RETRY_MIN_BACKOFF
+
+	for i := 1; i < attempt && d < JOB_RETRY_MAX_BACKOFF; i++ {
+		d *= 2
+	}
+
+	if d > JOB_RETRY_MAX_BACKOFF {
+		d = JOB_RETRY_MAX_BACKOFF
+	}
+
+	return d
+}
@@ -0,0 +1,291 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	JOBS_PROCESSED_METRIC = "jobs.processed"
+	JOBS_DURATION_METRIC  = "jobs.duration"
+	JOBS_IN_FLIGHT_METRIC = "jobs.in_flight"
+
+	outcomeSucceeded = "succeeded"
+	outcomeFailed    = "failed"
+	outcomeReleased  = "released"
+	outcomeLost      = "lost"
+	outcomeCanceled  = "canceled"
+
+	DEFAULT_VISIBILITY    = 5 * time.Minute
+	DEFAULT_POLL_INTERVAL = time.Second
+
+	// Upper bound between heartbeats; also how long it can take for a
+	// running job to notice it was canceled
+	DEFAULT_HEARTBEAT_INTERVAL = 5 * time.Second
+
+	// Queue updates made after a job ran are not bound to its (possibly
+	// canceled) ctx
+	queueUpdateTimeout = 10 * time.Second
+)
+
+// WorkerOpts configure a Worker
+type WorkerOpts struct {
+	Concurrency int
+	// How long a claimed job stays invisible to other workers; extended
+	// while it runs
+	Visibility time.Duration
+	// Wait between polls when the queue is empty
+	PollInterval time.Duration
+	// How long in-flight jobs get to finish once shutting down; they are
+	// then canceled and released back to the queue
+	ShutdownTimeout time.Duration
+	// How often running jobs extend their visibility and check whether they
+	// were canceled; at most Visibility / 3
+	HeartbeatInterval time.Duration
+}
+
+// Worker runs the handlers of registry for jobs claimed from queue, up to
+// opts.Concurrency at a time
+type Worker struct {
+	id       string
+	queue    IQueue
+	registry *Registry
+	opts     WorkerOpts
+	metrics  metrics.IMetrics
+
+	inFlight   int64
+	inFlightMu sync.Mutex
+}
+
+func NewWorker(queue IQueue, registry *Registry, opts WorkerOpts, m metrics.IMetrics) *Worker {
+	host, _ := os.Hostname()
+
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	if opts.Visibility <= 0 {
+		opts.Visibility = DEFAULT_VISIBILITY
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DEFAULT_POLL_INTERVAL
+	}
+
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = DEFAULT_HEARTBEAT_INTERVAL
+	}
+
+	if opts.HeartbeatInterval > opts.Visibility/3 {
+		opts.HeartbeatInterval = opts.Visibility / 3
+	}
+
+	if m == nil {
+		m = metrics.NewNoop()
+	}
+
+	return &Worker{
+		id:       fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+		queue:    queue,
+		registry: registry,
+		opts:     opts,
+		metrics:  m,
+	}
+}
+
+// Run claims and runs jobs until ctx is done, then waits (up to
+// opts.ShutdownTimeout) for in-flight jobs before returning
+func (w *Worker) Run(ctx context.Context) error {
+	llog := log.WithField("worker", w.id)
+	llog.WithField("types", w.registry.Types()).Infof("Worker running %d job(s) at a time", w.opts.Concurrency)
+
+	// Jobs outlive ctx for up to the shutdown timeout
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	slots := make(chan struct{}, w.opts.Concurrency)
+	wg := &sync.WaitGroup{}
+
+	for ctx.Err() == nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		job, err := w.queue.Claim(ctx, w.id, w.registry.Types(), w.opts.Visibility)
+		if err != nil || job == nil {
+			<-slots
+
+			if err != nil && ctx.Err() == nil {
+				llog.WithError(err).Error("Unable to claim job")
+			}
+
+			select {
+			case <-time.After(w.opts.PollInterval):
+			case <-ctx.Done():
+			}
+
+			continue
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			w.process(jobsCtx, job)
+		}()
+	}
+
+	llog.Info("Worker shutting down; waiting for in-flight jobs")
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(w.opts.ShutdownTimeout):
+		llog.Warn("In-flight jobs did not finish in time; canceling them")
+		cancelJobs()
+		<-done
+	}
+
+	return nil
+}
+
+// process runs a single job, keeping it invisible to other workers while it
+// runs, and records the outcome
+func (w *Worker) process(ctx context.Context, job *Job) {
+	llog := log.WithField("job_id", job.ID.Hex()).WithField("type", job.Type).WithField("attempt", job.Attempts)
+
+	w.trackInFlight(1)
+	defer w.trackInFlight(-1)
+
+	jctx, cancel := context.WithCancel(ctx)
+	lost := make(chan struct{})
+	canceled := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go w.heartbeat(jctx, cancel, job, lost, canceled, stopped)
+
+	jctx = withProgress(jctx, func(p *Progress) error {
+		return w.queue.SetProgress(jctx, job, p)
+	})
+
+	start := time.Now()
+	result, err := w.run(jctx, job)
+	elapsed := time.Since(start)
+
+	cancel()
+	<-stopped
+
+	uctx, ucancel := context.WithTimeout(context.Background(), queueUpdateTimeout)
+	defer ucancel()
+
+	outcome := outcomeSucceeded
+
+	switch {
+	case closed(lost):
+		outcome = outcomeLost
+		llog.Warn("Job was claimed by another worker while running")
+		err = nil
+	case err == nil:
+		err = w.queue.Complete(uctx, job, result)
+	case closed(canceled):
+		outcome = outcomeCanceled
+		llog.WithError(err).Info("Job canceled")
+		err = w.queue.MarkCanceled(uctx, job)
+	case ctx.Err() != nil:
+		outcome = outcomeReleased
+		llog.WithError(err).Info("Job interrupted by shutdown; releasing it")
+		err = w.queue.Release(uctx, job)
+	default:
+		outcome = outcomeFailed
+		llog.WithError(err).Warn("Job failed")
+		err = w.queue.Fail(uctx, job, err)
+	}
+
+	if err != nil {
+		llog.WithError(err).Error("Unable to record job outcome")
+	}
+
+	tags := metrics.Tags{"type": job.Type, "outcome": outcome}
+	w.metrics.Inc(JOBS_PROCESSED_METRIC, 1, tags)
+	w.metrics.Timing(JOBS_DURATION_METRIC, elapsed, tags)
+}
+
+// run calls the job's handler, turning panics into errors
+func (w *Worker) run(ctx context.Context, job *Job) (result interface{}, err error) {
+	h := w.registry.Get(job.Type)
+	if h == nil {
+		return nil, fmt.Errorf("no handler registered for '%s'", job.Type)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+
+	return h(ctx, job)
+}
+
+// heartbeat extends the visibility timeout of job until ctx is done; cancels
+// the job and closes lost if another worker took it over, or closes canceled
+// if its cancellation was requested
+func (w *Worker) heartbeat(ctx context.Context, cancel context.CancelFunc, job *Job, lost, canceled, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(w.opts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := w.queue.Extend(ctx, job, w.opts.Visibility)
+
+		switch {
+		case err == ErrJobLost:
+			close(lost)
+			cancel()
+			return
+		case err == ErrJobCanceled:
+			close(canceled)
+			cancel()
+			return
+		case err != nil && ctx.Err() == nil:
+			log.WithField("job_id", job.ID.Hex()).WithError(err).Warn("Unable to extend job visibility")
+		}
+	}
+}
+
+func (w *Worker) trackInFlight(delta int64) {
+	w.inFlightMu.Lock()
+	defer w.inFlightMu.Unlock()
+
+	w.inFlight += delta
+	w.metrics.Gauge(JOBS_IN_FLIGHT_METRIC, float64(w.inFlight), nil)
+}
+
+func closed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,156 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/dal/jobs"
+	"github.com/dfraglabs/go-microservice-1/fakes/jobqueue"
+)
+
+var _ = Describe("Worker", func() {
+	var (
+		queue    *jobqueue.FakeIQueue
+		registry *jobs.Registry
+		opts     jobs.WorkerOpts
+	)
+
+	BeforeEach(func() {
+		queue = &jobqueue.FakeIQueue{}
+		registry = jobs.NewRegistry()
+		opts = jobs.WorkerOpts{
+			Concurrency:     2,
+			Visibility:      time.Minute,
+			PollInterval:    time.Millisecond,
+			ShutdownTimeout: time.Second,
+		}
+	})
+
+	// Hands out job once, then nothing
+	claimOnce := func(job *jobs.Job) {
+		once := &sync.Once{}
+
+		queue.ClaimStub = func(context.Context, string, []string, time.Duration) (*jobs.Job, error) {
+			var claimed *jobs.Job
+			once.Do(func() { claimed = job })
+
+			return claimed, nil
+		}
+	}
+
+	newJob := func() *jobs.Job {
+		return &jobs.Job{ID: bson.NewObjectId(), Type: "t", Attempts: 1, MaxAttempts: 3}
+	}
+
+	run := func(until func() bool) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan error)
+		go func() { done <- jobs.NewWorker(queue, registry, opts, nil).Run(ctx) }()
+
+		Eventually(until).Should(BeTrue())
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	}
+
+	It("should complete jobs whose handler succeeds", func() {
+		registry.Register("t", func(context.Context, *jobs.Job) (interface{}, error) { return "ok", nil })
+		claimOnce(newJob())
+
+		run(func() bool { return queue.CompleteCallCount() == 1 })
+
+		_, _, result := queue.CompleteArgsForCall(0)
+		Expect(result).To(Equal("ok"))
+		Expect(queue.FailCallCount()).To(Equal(0))
+
+		_, _, types, _ := queue.ClaimArgsForCall(0)
+		Expect(types).To(Equal([]string{"t"}))
+	})
+
+	It("should fail jobs whose handler errors or panics", func() {
+		registry.Register("t", func(context.Context, *jobs.Job) (interface{}, error) { panic("boom") })
+		claimOnce(newJob())
+
+		run(func() bool { return queue.FailCallCount() == 1 })
+
+		_, _, err := queue.FailArgsForCall(0)
+		Expect(err).To(MatchError(ContainSubstring("boom")))
+	})
+
+	It("should release jobs still running once the shutdown timeout passes", func() {
+		opts.ShutdownTimeout = 10 * time.Millisecond
+
+		started := make(chan struct{})
+		registry.Register("t", func(ctx context.Context, _ *jobs.Job) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		claimOnce(newJob())
+
+		run(func() bool {
+			select {
+			case <-started:
+				return true
+			default:
+				return false
+			}
+		})
+
+		Expect(queue.ReleaseCallCount()).To(Equal(1))
+		Expect(queue.FailCallCount()).To(Equal(0))
+	})
+
+	It("should cancel jobs taken over by another worker", func() {
+		opts.Visibility = 30 * time.Millisecond
+		queue.ExtendReturns(jobs.ErrJobLost)
+
+		registry.Register("t", func(ctx context.Context, _ *jobs.Job) (interface{}, error) {
+			<-ctx.Done()
+			return nil, errors.New("interrupted")
+		})
+		claimOnce(newJob())
+
+		run(func() bool { return queue.ExtendCallCount() > 0 })
+
+		Expect(queue.FailCallCount()).To(Equal(0))
+		Expect(queue.CompleteCallCount()).To(Equal(0))
+	})
+
+	It("should cancel jobs whose cancellation was requested", func() {
+		opts.HeartbeatInterval = time.Millisecond
+		queue.ExtendReturns(jobs.ErrJobCanceled)
+
+		registry.Register("t", func(ctx context.Context, _ *jobs.Job) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		claimOnce(newJob())
+
+		run(func() bool { return queue.MarkCanceledCallCount() == 1 })
+
+		Expect(queue.FailCallCount()).To(Equal(0))
+		Expect(queue.ReleaseCallCount()).To(Equal(0))
+	})
+
+	It("should record the progress reported by handlers", func() {
+		registry.Register("t", func(ctx context.Context, _ *jobs.Job) (interface{}, error) {
+			return nil, jobs.ReportProgress(ctx, 150, "done")
+		})
+		claimOnce(newJob())
+
+		run(func() bool { return queue.CompleteCallCount() == 1 })
+
+		Expect(queue.SetProgressCallCount()).To(Equal(1))
+
+		_, _, progress := queue.SetProgressArgsForCall(0)
+		Expect(progress).To(Equal(&jobs.Progress{Percent: 100, Message: "done"}))
+	})
+})
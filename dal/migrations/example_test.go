@@ -0,0 +1,33 @@
+package migrations_test
+
+import (
+	"context"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/dal/migrations"
+)
+
+// DALs register their migrations from an init() func; IDs must sort in the
+// order they should be applied
+func ExampleRegister() {
+	migrations.NewRegistry().Register(&migrations.Migration{
+		ID:          "20261019000000_foo_schema_version",
+		Description: "Backfill 'schema-version' on foo documents",
+		Up: func(ctx context.Context, db *mgo.Database) error {
+			_, err := db.C("foo").UpdateAll(
+				bson.M{"schema-version": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"schema-version": 1}},
+			)
+			return err
+		},
+		Down: func(ctx context.Context, db *mgo.Database) error {
+			_, err := db.C("foo").UpdateAll(
+				bson.M{"schema-version": 1},
+				bson.M{"$unset": bson.M{"schema-version": ""}},
+			)
+			return err
+		},
+	})
+}
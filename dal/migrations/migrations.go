@@ -0,0 +1,86 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+)
+
+var log = logrus.WithField("pkg", "migrations")
+
+// Migration is a single, versioned schema change. IDs are applied in
+// lexical order, so prefix them with a timestamp (ie.
+// "20260101120000_backfill_foo_created_at").
+type Migration struct {
+	ID          string
+	Description string
+
+	// Up applies the change; it must be safe to re-run in case the process
+	// dies before the migration is recorded as applied
+	Up func(ctx context.Context, db *mgo.Database) error
+
+	// Down reverts the change; nil marks the migration as irreversible
+	Down func(ctx context.Context, db *mgo.Database) error
+}
+
+// Registry holds the known migrations
+type Registry struct {
+	mu         sync.Mutex
+	migrations map[string]*Migration
+}
+
+// DefaultRegistry is used by the package level Register/All funcs; DALs
+// register their migrations with it from an init() func.
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		migrations: map[string]*Migration{},
+	}
+}
+
+// Register adds m to the registry. It panics on an invalid or duplicate
+// migration since that is a programming error (same as database/sql.Register).
+func (r *Registry) Register(m *Migration) {
+	if m == nil || m.ID == "" || m.Up == nil {
+		panic("migrations: migration must have an ID and an Up func")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.migrations[m.ID]; ok {
+		panic(fmt.Sprintf("migrations: duplicate migration ID '%s'", m.ID))
+	}
+
+	r.migrations[m.ID] = m
+}
+
+// All returns every registered migration ordered by ID
+func (r *Registry) All() []*Migration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all := make([]*Migration, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		all = append(all, m)
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+
+	return all
+}
+
+// Register adds m to the DefaultRegistry
+func Register(m *Migration) {
+	DefaultRegistry.Register(m)
+}
+
+// All returns every migration in the DefaultRegistry ordered by ID
+func All() []*Migration {
+	return DefaultRegistry.All()
+}
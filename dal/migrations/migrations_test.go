@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"context"
+
+	"gopkg.in/mgo.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migrations", func() {
+	var (
+		registry *Registry
+		noop     = func(ctx context.Context, db *mgo.Database) error { return nil }
+	)
+
+	ids := func(ms []*Migration) []string {
+		out := []string{}
+		for _, m := range ms {
+			out = append(out, m.ID)
+		}
+
+		return out
+	}
+
+	BeforeEach(func() {
+		registry = NewRegistry()
+		registry.Register(&Migration{ID: "0003_c", Up: noop})
+		registry.Register(&Migration{ID: "0001_a", Up: noop, Down: noop})
+		registry.Register(&Migration{ID: "0002_b", Up: noop, Down: noop})
+	})
+
+	Describe("Registry", func() {
+		It("should return migrations ordered by ID", func() {
+			Expect(ids(registry.All())).To(Equal([]string{"0001_a", "0002_b", "0003_c"}))
+		})
+
+		It("should panic on duplicate IDs", func() {
+			Expect(func() { registry.Register(&Migration{ID: "0001_a", Up: noop}) }).To(Panic())
+		})
+
+		It("should panic on migrations without an Up func", func() {
+			Expect(func() { registry.Register(&Migration{ID: "0004_d"}) }).To(Panic())
+		})
+	})
+
+	Describe("pending", func() {
+		It("should skip applied migrations and keep the order", func() {
+			applied := map[string]*Record{"0002_b": {ID: "0002_b"}}
+
+			Expect(ids(pending(registry.All(), applied))).To(Equal([]string{"0001_a", "0003_c"}))
+		})
+	})
+
+	Describe("revertible", func() {
+		It("should return the most recently applied migrations first", func() {
+			applied := map[string]*Record{
+				"0001_a": {ID: "0001_a"},
+				"0002_b": {ID: "0002_b"},
+			}
+
+			Expect(ids(revertible(registry.All(), applied, 1))).To(Equal([]string{"0002_b"}))
+			Expect(ids(revertible(registry.All(), applied, 5))).To(Equal([]string{"0002_b", "0001_a"}))
+		})
+	})
+})
@@ -0,0 +1,250 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+)
+
+const (
+	MIGRATIONS_COLLECTION_NAME = "schema_migrations"
+
+	// Name of the lock (see dalutil.LockService) held while migrating
+	LOCK_NAME = "migrations"
+
+	// Lease of the lock; it is renewed while migrating, so this only bounds
+	// how long a crashed migrator keeps the others waiting
+	LOCK_TTL = 30 * time.Second
+)
+
+var (
+	ErrIrreversible = errors.New("migration has no Down func")
+)
+
+// Record is stored in the schema_migrations collection for every applied migration
+type Record struct {
+	ID          string    `bson:"_id" json:"id"`
+	Description string    `bson:"description" json:"description"`
+	AppliedAt   time.Time `bson:"applied_at" json:"applied_at"`
+	DurationMs  int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+// Status describes a known migration and whether it has been applied
+type Status struct {
+	ID          string
+	Description string
+	Applied     *Record // nil when pending
+}
+
+// Migrator applies and reverts migrations. Only one Migrator (across every
+// replica) runs at a time; the others wait for the lock to be released.
+type Migrator struct {
+	pool       *dalutil.SessionPool
+	migrations []*Migration
+	records    *dalutil.SmartCollection
+	locks      *dalutil.LockService
+	lockTTL    time.Duration
+}
+
+// New creates a Migrator for the given (ordered) migrations. lockTTL bounds
+// how long a crashed migrator can keep others from running; the lease is
+// renewed while migrating.
+func New(pool *dalutil.SessionPool, migrations []*Migration, inst *dalutil.Instrumentation, lockTTL time.Duration) *Migrator {
+	return &Migrator{
+		pool:       pool,
+		migrations: migrations,
+		records:    dalutil.NewSmartCollection(pool, MIGRATIONS_COLLECTION_NAME, inst),
+		locks:      dalutil.NewLockService(pool, inst),
+		lockTTL:    lockTTL,
+	}
+}
+
+// Status lists every known migration along with when it was applied. Records
+// of migrations that are no longer registered are not included.
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		statuses = append(statuses, &Status{
+			ID:          mig.ID,
+			Description: mig.Description,
+			Applied:     applied[mig.ID],
+		})
+	}
+
+	return statuses, nil
+}
+
+// Up applies every pending migration in order and returns the applied IDs
+func (m *Migrator) Up(ctx context.Context) ([]string, error) {
+	done := []string{}
+
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range pending(m.migrations, applied) {
+			if err := m.apply(ctx, mig); err != nil {
+				return err
+			}
+
+			done = append(done, mig.ID)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the last steps applied migrations (most recent first) and
+// returns the reverted IDs
+func (m *Migrator) Down(ctx context.Context, steps int) ([]string, error) {
+	done := []string{}
+
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range revertible(m.migrations, applied, steps) {
+			if err := m.revert(ctx, mig); err != nil {
+				return err
+			}
+
+			done = append(done, mig.ID)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+func (m *Migrator) apply(ctx context.Context, mig *Migration) error {
+	llog := log.WithField("migration", mig.ID)
+	llog.Info("Applying migration")
+
+	start := time.Now()
+
+	if err := m.run(ctx, mig.Up); err != nil {
+		return fmt.Errorf("Migration '%s' failed: %v", mig.ID, err)
+	}
+
+	elapsed := time.Since(start)
+
+	rec := &Record{
+		ID:          mig.ID,
+		Description: mig.Description,
+		AppliedAt:   time.Now().UTC(),
+		DurationMs:  int64(elapsed / time.Millisecond),
+	}
+
+	if err := m.records.Insert(ctx, rec); err != nil {
+		return fmt.Errorf("Migration '%s' applied but could not be recorded: %v", mig.ID, err)
+	}
+
+	llog.Infof("Applied migration in %v", elapsed)
+
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, mig *Migration) error {
+	llog := log.WithField("migration", mig.ID)
+
+	if mig.Down == nil {
+		return fmt.Errorf("Unable to revert '%s': %v", mig.ID, ErrIrreversible)
+	}
+
+	llog.Info("Reverting migration")
+
+	if err := m.run(ctx, mig.Down); err != nil {
+		return fmt.Errorf("Reverting migration '%s' failed: %v", mig.ID, err)
+	}
+
+	if err := m.records.Remove(ctx, bson.M{"_id": mig.ID}); err != nil && err != mgo.ErrNotFound {
+		return fmt.Errorf("Migration '%s' reverted but its record could not be removed: %v", mig.ID, err)
+	}
+
+	llog.Info("Reverted migration")
+
+	return nil
+}
+
+func (m *Migrator) run(ctx context.Context, fn func(ctx context.Context, db *mgo.Database) error) error {
+	sess, release, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return fn(ctx, m.pool.DB(sess))
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[string]*Record, error) {
+	records := []*Record{}
+	if err := m.records.Find(ctx, nil, nil, &records); err != nil {
+		return nil, fmt.Errorf("Unable to fetch applied migrations: %v", err)
+	}
+
+	applied := make(map[string]*Record, len(records))
+	for _, r := range records {
+		applied[r.ID] = r
+	}
+
+	return applied, nil
+}
+
+// withLock runs fn while holding the migrations lock, waiting for it to be
+// released by other replicas (or to expire) until ctx is done. fn's ctx is
+// canceled if the lock is lost.
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	lease, err := m.locks.Acquire(ctx, LOCK_NAME, m.lockTTL)
+	if err != nil {
+		return fmt.Errorf("Unable to acquire migrations lock: %v", err)
+	}
+
+	lctx, release := lease.KeepAlive(ctx)
+	defer release()
+
+	return fn(lctx)
+}
+
+// pending returns the migrations that have not been applied, in order
+func pending(all []*Migration, applied map[string]*Record) []*Migration {
+	out := []*Migration{}
+
+	for _, mig := range all {
+		if _, ok := applied[mig.ID]; !ok {
+			out = append(out, mig)
+		}
+	}
+
+	return out
+}
+
+// revertible returns up to steps applied migrations, most recent first
+func revertible(all []*Migration, applied map[string]*Record, steps int) []*Migration {
+	out := []*Migration{}
+
+	for i := len(all) - 1; i >= 0 && len(out) < steps; i-- {
+		if _, ok := applied[all[i].ID]; ok {
+			out = append(out, all[i])
+		}
+	}
+
+	return out
+}
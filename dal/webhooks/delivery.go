@@ -0,0 +1,276 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/dal/jobs"
+	"github.com/dfraglabs/go-microservice-1/events"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+const (
+	outcomeSucceeded = "succeeded"
+	outcomeFailed    = "failed"
+
+	// Of the response body kept on a failed attempt
+	maxErrorBody = 256
+)
+
+// DeliveryPayload is the payload of DELIVERY_JOB
+type DeliveryPayload struct {
+	DeliveryID string `bson:"delivery_id" json:"delivery_id"`
+}
+
+// Publish creates a delivery of event for every active subscription whose
+// filter matches it. Meets events.ISink; publishing the same event again
+// only schedules the deliveries that could not be scheduled before.
+func (w *Webhooks) Publish(ctx context.Context, event *events.Event) error {
+	subs := []*Subscription{}
+
+	if err := w.subs.Find(ctx, bson.M{"status": SUBSCRIPTION_ACTIVE}, nil, &subs); err != nil {
+		return fmt.Errorf("Unable to find webhook subscriptions: %v", err)
+	}
+
+	for _, sub := range subs {
+		if !Matches(sub.Events, event.Type) {
+			continue
+		}
+
+		now := w.now()
+		d := &Delivery{}
+
+		_, err := w.deliveries.Apply(ctx, bson.M{"event._id": event.ID, "subscription_id": sub.ID}, mgo.Change{
+			Update: bson.M{"$setOnInsert": bson.M{
+				"event":         event,
+				"status":        DELIVERY_PENDING,
+				"attempt_count": 0,
+				"created_at":    now,
+				"updated_at":    now,
+			}},
+			Upsert:    true,
+			ReturnNew: true,
+		}, d)
+		if err != nil {
+			return fmt.Errorf("Unable to create webhook delivery: %v", err)
+		}
+
+		if d.JobID != "" {
+			continue
+		}
+
+		if _, err := w.schedule(ctx, d, bson.M{}); err != nil {
+			return fmt.Errorf("Unable to schedule webhook delivery: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Deliver is the handler of DELIVERY_JOB: it POSTs the event to the
+// subscription and records the attempt. A failed attempt fails the job (so
+// that it is retried) unless it was the last one or it got the subscription
+// disabled.
+func (w *Webhooks) Deliver(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	payload := &DeliveryPayload{}
+	if err := job.DecodePayload(payload); err != nil {
+		return nil, err
+	}
+
+	if !bson.IsObjectIdHex(payload.DeliveryID) {
+		return nil, fmt.Errorf("Invalid delivery id '%s'", payload.DeliveryID)
+	}
+
+	d := &Delivery{}
+
+	err := w.deliveries.FindOne(ctx, bson.M{"_id": bson.ObjectIdHex(payload.DeliveryID)}, nil, d)
+
+	switch {
+	case err == mgo.ErrNotFound:
+		return nil, nil // expired
+	case err != nil:
+		return nil, err
+	case d.JobID != job.ID:
+		// Redelivered since; the newer job is in charge
+		return nil, nil
+	}
+
+	llog := log.WithField("delivery_id", d.ID.Hex()).WithField("subscription_id", d.SubscriptionID.Hex())
+
+	sub := &Subscription{}
+
+	err = w.subs.Get(ctx, d.SubscriptionID, sub)
+	if err != nil || sub.Status != SUBSCRIPTION_ACTIVE {
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+
+		llog.Info("Subscription disabled or deleted; canceling delivery")
+
+		return nil, w.finish(ctx, d, DELIVERY_CANCELED, nil)
+	}
+
+	attempt := w.post(ctx, sub, d)
+
+	if attempt.Error == "" {
+		w.metrics.Inc(DELIVERIES_METRIC, 1, metrics.Tags{"event_type": d.Event.Type, "outcome": outcomeSucceeded})
+
+		if err := w.succeeded(ctx, sub); err != nil {
+			llog.WithError(err).Warn("Unable to reset subscription failures")
+		}
+
+		return nil, w.finish(ctx, d, DELIVERY_SUCCEEDED, attempt)
+	}
+
+	w.metrics.Inc(DELIVERIES_METRIC, 1, metrics.Tags{"event_type": d.Event.Type, "outcome": outcomeFailed})
+
+	disabled, err := w.failed(ctx, sub, attempt)
+	if err != nil {
+		llog.WithError(err).Warn("Unable to record subscription failure")
+	}
+
+	if disabled || job.Attempts >= job.MaxAttempts {
+		llog.WithField("error", attempt.Error).Warn("Giving up on webhook delivery")
+		return nil, w.finish(ctx, d, DELIVERY_FAILED, attempt)
+	}
+
+	if err := w.record(ctx, d, DELIVERY_RETRYING, attempt, nil); err != nil {
+		llog.WithError(err).Warn("Unable to record delivery attempt")
+	}
+
+	return nil, fmt.Errorf("webhook delivery failed: %s", attempt.Error)
+}
+
+// post makes a single, signed attempt; the attempt has an Error unless the
+// endpoint answered with a 2xx
+func (w *Webhooks) post(ctx context.Context, sub *Subscription, d *Delivery) *Attempt {
+	start := w.now()
+	attempt := &Attempt{At: start}
+
+	defer func() {
+		attempt.DurationMs = int64(w.now().Sub(start) / time.Millisecond)
+	}()
+
+	body, err := json.Marshal(d.Event)
+	if err != nil {
+		attempt.Error = fmt.Sprintf("unable to marshal event: %v", err)
+		return attempt
+	}
+
+	req, err := http.NewRequest("POST", sub.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ID_HEADER, d.ID.Hex())
+	req.Header.Set(EVENT_HEADER, d.Event.Type)
+	req.Header.Set(TIMESTAMP_HEADER, strconv.FormatInt(start.Unix(), 10))
+	req.Header.Set(SIGNATURE_HEADER, Sign(sub.Secret, start, body))
+
+	resp, err := w.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		attempt.Error = strings.TrimSpace(fmt.Sprintf("unexpected status code %d: %s", resp.StatusCode, b))
+	}
+
+	return attempt
+}
+
+// record adds attempt (if any) to d and moves it to status
+func (w *Webhooks) record(ctx context.Context, d *Delivery, status string, attempt *Attempt, set bson.M) error {
+	if set == nil {
+		set = bson.M{}
+	}
+
+	set["status"] = status
+	set["updated_at"] = w.now()
+
+	update := bson.M{"$set": set}
+
+	if attempt != nil {
+		update["$push"] = bson.M{"attempts": bson.M{"$each": []*Attempt{attempt}, "$slice": -MAX_RECORDED_ATTEMPTS}}
+		update["$inc"] = bson.M{"attempt_count": 1}
+	}
+
+	// Only while the job is still in charge (see Redeliver)
+	err := w.deliveries.Update(ctx, bson.M{"_id": d.ID, "job_id": d.JobID}, update)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (w *Webhooks) finish(ctx context.Context, d *Delivery, status string, attempt *Attempt) error {
+	return w.record(ctx, d, status, attempt, bson.M{"finished_at": w.now()})
+}
+
+func (w *Webhooks) succeeded(ctx context.Context, sub *Subscription) error {
+	return w.subs.Collection().Update(ctx, bson.M{"_id": sub.ID}, bson.M{
+		"$set": bson.M{"consecutive_failures": 0, "last_success_at": w.now()},
+	})
+}
+
+// failed counts a failed attempt against sub, disabling it once it failed
+// Opts.DisableAfter times in a row; reports whether it did
+func (w *Webhooks) failed(ctx context.Context, sub *Subscription, attempt *Attempt) (bool, error) {
+	now := w.now()
+
+	err := w.subs.Collection().Update(ctx, bson.M{"_id": sub.ID}, bson.M{
+		"$set": bson.M{"last_failure_at": now},
+		"$inc": bson.M{"consecutive_failures": 1},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = w.subs.Collection().Update(ctx, bson.M{
+		"_id":                  sub.ID,
+		"status":               SUBSCRIPTION_ACTIVE,
+		"consecutive_failures": bson.M{"$gte": w.opts.DisableAfter},
+	}, bson.M{
+		"$set": bson.M{
+			"status":          SUBSCRIPTION_DISABLED,
+			"disabled_at":     now,
+			"disabled_reason": fmt.Sprintf("%d consecutive failed deliveries; last: %s", w.opts.DisableAfter, attempt.Error),
+		},
+	})
+
+	switch {
+	case err == mgo.ErrNotFound:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	log.WithField("subscription_id", sub.ID.Hex()).WithField("url", sub.URL).Warn("Disabled failing webhook subscription")
+
+	return true, nil
+}
+
+func isNotFound(err error) bool {
+	_, ok := err.(errtype.KeyNotFoundErr)
+	return ok
+}
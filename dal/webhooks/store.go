@@ -0,0 +1,278 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/dal/jobs"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+const (
+	secretBytes = 32
+)
+
+// Opts configure Webhooks; zero values fall back to the defaults
+type Opts struct {
+	MaxAttempts  int           // per delivery, before it fails
+	DisableAfter int           // consecutive failed attempts before a subscription is disabled
+	Timeout      time.Duration // of every attempt
+}
+
+// Webhooks stores subscriptions and their deliveries in Mongo. It is the
+// sink turning domain events into deliveries (see Publish) and the handler of
+// the DELIVERY_JOB jobs making them (see Deliver); retries and their backoff
+// are the job queue's.
+type Webhooks struct {
+	subs       *dalutil.Repository
+	deliveries *dalutil.SmartCollection
+	queue      jobs.IQueue
+	opts       Opts
+	metrics    metrics.IMetrics
+	httpClient *http.Client
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+func New(pool *dalutil.SessionPool, inst *dalutil.Instrumentation, queue jobs.IQueue, opts Opts, m metrics.IMetrics) *Webhooks {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DEFAULT_MAX_ATTEMPTS
+	}
+
+	if opts.DisableAfter <= 0 {
+		opts.DisableAfter = DEFAULT_DISABLE_AFTER
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEFAULT_TIMEOUT
+	}
+
+	if m == nil {
+		m = metrics.NewNoop()
+	}
+
+	return &Webhooks{
+		subs:       dalutil.NewRepository(dalutil.NewSmartCollection(pool, SUBSCRIPTIONS_COLLECTION_NAME, inst)),
+		deliveries: dalutil.NewSmartCollection(pool, DELIVERIES_COLLECTION_NAME, inst),
+		queue:      queue,
+		opts:       opts,
+		metrics:    m,
+		httpClient: &http.Client{Timeout: opts.Timeout},
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// SubscriptionIndexes returns the indexes the subscriptions collection
+// should have
+func SubscriptionIndexes() []*mgo.Index {
+	return []*mgo.Index{
+		{
+			Name: "status",
+			Key:  []string{"status"},
+		},
+	}
+}
+
+// DeliveryIndexes returns the indexes the deliveries collection should have;
+// finished deliveries expire after expiresAfterSec
+func DeliveryIndexes(expiresAfterSec int) []*mgo.Index {
+	return []*mgo.Index{
+		{
+			// Publishing an event twice does not deliver it twice
+			Name:   "unique-event-subscription",
+			Key:    []string{"event._id", "subscription_id"},
+			Unique: true,
+		},
+		{
+			Name: "subscription-created-at",
+			Key:  []string{"subscription_id", "-created_at"},
+		},
+		{
+			Name:        "expiring-finished",
+			Key:         []string{"finished_at"},
+			ExpireAfter: time.Second * time.Duration(expiresAfterSec),
+		},
+	}
+}
+
+func (w *Webhooks) EnsureIndexes(expiresAfterSec int, allowDestructive bool) error {
+	if err := w.subs.Collection().EnsureIndexes(SubscriptionIndexes(), allowDestructive); err != nil {
+		return err
+	}
+
+	return w.deliveries.EnsureIndexes(DeliveryIndexes(expiresAfterSec), allowDestructive)
+}
+
+// CreateSubscription stores an active subscription, generating its secret
+// if it has none
+func (w *Webhooks) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	if sub.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return err
+		}
+
+		sub.Secret = secret
+	}
+
+	sub.Status = SUBSCRIPTION_ACTIVE
+	sub.ConsecutiveFailures = 0
+
+	return w.subs.Create(ctx, sub)
+}
+
+func (w *Webhooks) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	subs := []*Subscription{}
+
+	if err := w.subs.Find(ctx, bson.M{}, &dalutil.FindOpts{Sort: []string{"created_at"}}, &subs); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// GetSubscription returns errtype.KeyNotFoundErr if there is no subscription
+// with the given (hex encoded) id
+func (w *Webhooks) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	oid, err := objectID(SUBSCRIPTIONS_COLLECTION_NAME, id)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &Subscription{}
+	if err := w.subs.Get(ctx, oid, sub); err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// DeleteSubscription removes a subscription; its pending deliveries are
+// canceled when their turn comes
+func (w *Webhooks) DeleteSubscription(ctx context.Context, id string) error {
+	oid, err := objectID(SUBSCRIPTIONS_COLLECTION_NAME, id)
+	if err != nil {
+		return err
+	}
+
+	return w.subs.Delete(ctx, oid)
+}
+
+// EnableSubscription re-activates a (disabled) subscription, resetting its
+// failure count. Deliveries canceled while it was disabled are not resent;
+// see Redeliver.
+func (w *Webhooks) EnableSubscription(ctx context.Context, id string) (*Subscription, error) {
+	oid, err := objectID(SUBSCRIPTIONS_COLLECTION_NAME, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.subs.Update(ctx, oid, bson.M{
+		"$set":   bson.M{"status": SUBSCRIPTION_ACTIVE, "consecutive_failures": 0},
+		"$unset": bson.M{"disabled_at": "", "disabled_reason": ""},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return w.GetSubscription(ctx, id)
+}
+
+func (w *Webhooks) Deliveries(ctx context.Context, subscriptionID string, limit int) ([]*Delivery, error) {
+	oid, err := objectID(SUBSCRIPTIONS_COLLECTION_NAME, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []*Delivery{}
+
+	err = w.deliveries.Find(ctx, bson.M{"subscription_id": oid}, &dalutil.FindOpts{
+		Sort:  []string{"-created_at"},
+		Limit: limit,
+	}, &deliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver hands a delivery to a new job, with a fresh set of attempts;
+// returns ErrSubscriptionDisabled unless its subscription is active
+func (w *Webhooks) Redeliver(ctx context.Context, deliveryID string) (*Delivery, error) {
+	oid, err := objectID(DELIVERIES_COLLECTION_NAME, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Delivery{}
+
+	err = w.deliveries.FindOne(ctx, bson.M{"_id": oid}, nil, d)
+	if err == mgo.ErrNotFound {
+		return nil, errtype.KeyNotFoundErr{E: fmt.Errorf("%s: no delivery %s", DELIVERIES_COLLECTION_NAME, deliveryID)}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := w.GetSubscription(ctx, d.SubscriptionID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	if sub.Status != SUBSCRIPTION_ACTIVE {
+		return nil, ErrSubscriptionDisabled
+	}
+
+	return w.schedule(ctx, d, bson.M{"$unset": bson.M{"finished_at": ""}})
+}
+
+// schedule enqueues a job for d and makes it d's job; update is applied to d
+// along with it
+func (w *Webhooks) schedule(ctx context.Context, d *Delivery, update bson.M) (*Delivery, error) {
+	job, err := w.queue.Enqueue(ctx, DELIVERY_JOB, &DeliveryPayload{DeliveryID: d.ID.Hex()}, &jobs.EnqueueOpts{
+		MaxAttempts: w.opts.MaxAttempts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	update["$set"] = bson.M{"job_id": job.ID, "status": DELIVERY_PENDING, "updated_at": w.now()}
+
+	updated := &Delivery{}
+
+	_, err = w.deliveries.Apply(ctx, bson.M{"_id": d.ID}, mgo.Change{Update: update, ReturnNew: true}, updated)
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func objectID(collection, id string) (bson.ObjectId, error) {
+	if !bson.IsObjectIdHex(id) {
+		return "", errtype.KeyNotFoundErr{E: fmt.Errorf("%s: invalid id '%s'", collection, id)}
+	}
+
+	return bson.ObjectIdHex(id), nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Unable to generate webhook secret: %v", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
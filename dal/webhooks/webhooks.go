@@ -0,0 +1,173 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/events"
+)
+
+var log = logrus.WithField("pkg", "webhooks")
+
+const (
+	SUBSCRIPTIONS_COLLECTION_NAME = "webhook_subscriptions"
+	DELIVERIES_COLLECTION_NAME    = "webhook_deliveries"
+
+	// Job type of a single delivery; retries are the job's
+	DELIVERY_JOB = "webhooks.deliver"
+
+	SUBSCRIPTION_ACTIVE   = "active"
+	SUBSCRIPTION_DISABLED = "disabled" // see Opts.DisableAfter and EnableSubscription
+
+	DELIVERY_PENDING   = "pending"
+	DELIVERY_RETRYING  = "retrying"
+	DELIVERY_SUCCEEDED = "succeeded"
+	DELIVERY_FAILED    = "failed"   // out of attempts
+	DELIVERY_CANCELED  = "canceled" // the subscription was disabled or deleted
+
+	// Headers of every delivery; see Sign
+	ID_HEADER        = "X-Webhook-Id"
+	EVENT_HEADER     = "X-Webhook-Event"
+	TIMESTAMP_HEADER = "X-Webhook-Timestamp"
+	SIGNATURE_HEADER = "X-Webhook-Signature"
+
+	SIGNATURE_VERSION = "v1"
+
+	// Matches every event type in a subscription filter
+	WILDCARD = "*"
+
+	DEFAULT_MAX_ATTEMPTS  = 8
+	DEFAULT_DISABLE_AFTER = 20
+	DEFAULT_TIMEOUT       = 10 * time.Second
+
+	// Only the latest attempts of a delivery are kept
+	MAX_RECORDED_ATTEMPTS = 20
+
+	DELIVERIES_METRIC = "webhooks.deliveries"
+)
+
+var (
+	ErrSubscriptionDisabled = errors.New("webhook subscription is disabled")
+)
+
+// Subscription is stored in the webhook_subscriptions collection
+type Subscription struct {
+	dalutil.Document `bson:",inline"`
+
+	URL         string   `bson:"url" json:"url"`
+	Events      []string `bson:"events" json:"events"` // event types, "prefix.*" or "*"
+	Description string   `bson:"description,omitempty" json:"description,omitempty"`
+
+	// Deliveries are signed with it; only handed out on creation
+	Secret string `bson:"secret" json:"-"`
+
+	Status string `bson:"status" json:"status"`
+
+	// Failed attempts since the last successful one
+	ConsecutiveFailures int        `bson:"consecutive_failures" json:"consecutive_failures"`
+	LastSuccessAt       *time.Time `bson:"last_success_at,omitempty" json:"last_success_at,omitempty"`
+	LastFailureAt       *time.Time `bson:"last_failure_at,omitempty" json:"last_failure_at,omitempty"`
+	DisabledAt          *time.Time `bson:"disabled_at,omitempty" json:"disabled_at,omitempty"`
+	DisabledReason      string     `bson:"disabled_reason,omitempty" json:"disabled_reason,omitempty"`
+}
+
+// Delivery is an event sent (or to be sent) to a subscription; stored in the
+// webhook_deliveries collection
+type Delivery struct {
+	ID             bson.ObjectId `bson:"_id" json:"id"`
+	SubscriptionID bson.ObjectId `bson:"subscription_id" json:"subscription_id"`
+	Event          *events.Event `bson:"event" json:"event"`
+	Status         string        `bson:"status" json:"status"`
+
+	// The last MAX_RECORDED_ATTEMPTS, oldest first; AttemptCount counts all
+	// of them
+	Attempts     []*Attempt `bson:"attempts,omitempty" json:"attempts"`
+	AttemptCount int        `bson:"attempt_count" json:"attempt_count"`
+
+	// The job currently in charge of the delivery
+	JobID bson.ObjectId `bson:"job_id,omitempty" json:"-"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+
+	// Finished deliveries are removed by a TTL index on this field
+	FinishedAt *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// Attempt is a single POST of a delivery
+type Attempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	DurationMs int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+//go:generate counterfeiter -o ../../fakes/webhooksvc/webhooks.go . IWebhooks
+
+// IWebhooks is what the admin API manages webhooks through
+type IWebhooks interface {
+	CreateSubscription(ctx context.Context, sub *Subscription) error
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	GetSubscription(ctx context.Context, id string) (*Subscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	EnableSubscription(ctx context.Context, id string) (*Subscription, error)
+
+	// Deliveries returns the latest deliveries of a subscription, newest first
+	Deliveries(ctx context.Context, subscriptionID string, limit int) ([]*Delivery, error)
+	// Redeliver sends a delivery again, whatever its status
+	Redeliver(ctx context.Context, deliveryID string) (*Delivery, error)
+}
+
+// Matches reports whether filter (as in Subscription.Events) selects
+// eventType
+func Matches(filter []string, eventType string) bool {
+	for _, f := range filter {
+		switch {
+		case f == WILDCARD, f == eventType:
+			return true
+		case strings.HasSuffix(f, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(f, "*")):
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateFilter returns an error if filter selects nothing or has a
+// malformed entry
+func ValidateFilter(filter []string) error {
+	if len(filter) == 0 {
+		return errors.New("events must not be empty")
+	}
+
+	for _, f := range filter {
+		if f == "" || (strings.Contains(f, "*") && f != WILDCARD && !(strings.HasSuffix(f, ".*") && strings.Count(f, "*") == 1)) {
+			return fmt.Errorf("invalid event filter '%s'", f)
+		}
+	}
+
+	return nil
+}
+
+// Sign returns the SIGNATURE_HEADER of a delivery: an HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the subscription secret. Receivers should
+// recompute it and reject old timestamps (replays).
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return SIGNATURE_VERSION + "=" + hex.EncodeToString(mac.Sum(nil))
+}
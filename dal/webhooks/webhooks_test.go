@@ -0,0 +1,122 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/events"
+)
+
+var _ = Describe("Webhooks", func() {
+	Describe("Matches", func() {
+		It("should match exact types, prefixes and the wildcard", func() {
+			Expect(Matches([]string{events.FOO_CREATED}, events.FOO_CREATED)).To(BeTrue())
+			Expect(Matches([]string{"foo.*"}, events.FOO_DELETED)).To(BeTrue())
+			Expect(Matches([]string{WILDCARD}, events.BAR_FETCHED)).To(BeTrue())
+
+			Expect(Matches([]string{"foo.*"}, events.BAR_FETCHED)).To(BeFalse())
+			Expect(Matches([]string{"foo"}, events.FOO_CREATED)).To(BeFalse())
+			Expect(Matches(nil, events.FOO_CREATED)).To(BeFalse())
+		})
+	})
+
+	Describe("ValidateFilter", func() {
+		It("should accept types, prefixes and the wildcard", func() {
+			Expect(ValidateFilter([]string{events.FOO_CREATED, "bar.*", WILDCARD})).To(Succeed())
+		})
+
+		It("should reject empty and malformed filters", func() {
+			Expect(ValidateFilter(nil)).ToNot(Succeed())
+			Expect(ValidateFilter([]string{""})).ToNot(Succeed())
+			Expect(ValidateFilter([]string{"foo*"})).ToNot(Succeed())
+			Expect(ValidateFilter([]string{"*.created"})).ToNot(Succeed())
+		})
+	})
+
+	Describe("Sign", func() {
+		It("should sign the timestamp and body", func() {
+			ts := time.Unix(1500000000, 0)
+
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write([]byte("1500000000.{}"))
+
+			Expect(Sign("secret", ts, []byte("{}"))).To(Equal("v1=" + hex.EncodeToString(mac.Sum(nil))))
+			Expect(Sign("other", ts, []byte("{}"))).ToNot(Equal(Sign("secret", ts, []byte("{}"))))
+		})
+	})
+
+	Describe("post", func() {
+		var (
+			w        *Webhooks
+			sub      *Subscription
+			d        *Delivery
+			status   int
+			received *http.Request
+			body     []byte
+			server   *httptest.Server
+		)
+
+		BeforeEach(func() {
+			status = http.StatusNoContent
+
+			server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				received = r
+				body, _ = ioutil.ReadAll(r.Body)
+				rw.WriteHeader(status)
+				rw.Write([]byte("go away"))
+			}))
+
+			w = New(nil, nil, nil, Opts{}, nil)
+			sub = &Subscription{URL: server.URL, Secret: "secret"}
+			d = &Delivery{ID: bson.NewObjectId(), Event: events.New(&events.FooDeleted{ID: "x"}, "")}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should POST the signed event", func() {
+			attempt := w.post(context.Background(), sub, d)
+
+			Expect(attempt.Error).To(BeEmpty())
+			Expect(attempt.StatusCode).To(Equal(http.StatusNoContent))
+
+			Expect(received.Header.Get(ID_HEADER)).To(Equal(d.ID.Hex()))
+			Expect(received.Header.Get(EVENT_HEADER)).To(Equal(events.FOO_DELETED))
+
+			ts, err := strconv.ParseInt(received.Header.Get(TIMESTAMP_HEADER), 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(received.Header.Get(SIGNATURE_HEADER)).To(Equal(Sign("secret", time.Unix(ts, 0), body)))
+		})
+
+		It("should fail on a non 2xx response", func() {
+			status = http.StatusGone
+
+			attempt := w.post(context.Background(), sub, d)
+
+			Expect(attempt.StatusCode).To(Equal(http.StatusGone))
+			Expect(attempt.Error).To(ContainSubstring("410: go away"))
+		})
+
+		It("should fail when the endpoint is unreachable", func() {
+			server.Close()
+
+			attempt := w.post(context.Background(), sub, d)
+
+			Expect(attempt.StatusCode).To(BeZero())
+			Expect(attempt.Error).ToNot(BeEmpty())
+		})
+	})
+})
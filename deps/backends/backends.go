@@ -1,17 +1,17 @@
 package backends
 
 import (
-	"crypto/tls"
-	"fmt"
-	"net"
+	"sync"
 	"time"
 
-	"github.com/sirupsen/logrus"
-	"gopkg.in/mgo.v2"
 	"github.com/InVisionApp/go-health"
+	"github.com/sirupsen/logrus"
 
+	"github.com/dfraglabs/go-microservice-1/apm"
 	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
 	"github.com/dfraglabs/go-microservice-1/dal/foo/client"
+	"github.com/dfraglabs/go-microservice-1/metrics"
 )
 
 var (
@@ -24,11 +24,21 @@ func init() {
 
 type Backends struct {
 	//Direct connection backends
-	MongoDB *mgo.Database
+	Mongo *dalutil.SessionPool
 
 	//API clients
 	FooClient client.IClient
 
+	//Run once Mongo is connected (see OnMongoConnect)
+	mongoHooks   []func() error
+	mongoHooksMu sync.Mutex
+
+	//Whether DALs may rebuild indexes whose options changed at startup
+	AllowDestructiveIndexes bool
+
+	//Instrumentation shared with the DALs
+	Instrumentation *dalutil.Instrumentation
+
 	//backends dependency health
 	Statuses []*health.Config
 
@@ -38,31 +48,40 @@ type Backends struct {
 	connected bool
 }
 
-func NewBackends(cfg *config.Config) (*Backends, error) {
+func NewBackends(cfg *config.Config, tracer apm.ITracer, m metrics.IMetrics) (*Backends, error) {
 	b := &Backends{
-		Statuses:  []*health.Config{},
-		connected: false, //ensure
+		Statuses: []*health.Config{},
+		Instrumentation: &dalutil.Instrumentation{
+			Tracer:             tracer,
+			Metrics:            m,
+			SlowQueryThreshold: time.Duration(cfg.MongoDBSlowQueryMs) * time.Millisecond,
+		},
+		AllowDestructiveIndexes: cfg.MongoDBIndexAllowDestructive,
+		connected:               false, //ensure
 	}
 
 	//Connect to DBs
-	mongoDB, err := connectMongoDB(&MongoConfig{
-		Hosts:      cfg.MongoDBHosts,
-		Name:       cfg.MongoDBName,
-		ReplicaSet: cfg.MongoDBReplicaSet,
-		Source:     cfg.MongoDBSource,
-		User:       cfg.MongoDBUser,
-		Password:   cfg.MongoDBPassword,
-		Timeout:    time.Duration(cfg.MongoDBConnTimeoutSec) * time.Second,
-		UseSSL:     cfg.MongoDBConnUseSSL,
-	})
+	mongoCfg, err := NewMongoConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	b.MongoDB = mongoDB
+	session, err := connectMongoDBWithRetry(mongoCfg, mongoRetryDeadline(cfg))
+	if err != nil && !cfg.MongoDBDegradedStart {
+		return nil, err
+	}
+
+	// session is nil when starting degraded; the pool reports
+	// dalutil.ErrNotConnected until the background connect succeeds
+	b.Mongo = newSessionPool(cfg, mongoCfg, session, m)
+
+	if err != nil {
+		log.Warnf("Starting in degraded mode, connecting to MongoDB in the background: %v", err)
+		go b.connectMongoInBackground(mongoCfg)
+	}
 
 	// Foo client setup
-	fc := client.NewFooClient(cfg.FooAPIHost, cfg.ServiceName)
+	fc := client.NewFooClient(cfg.FooAPIHost, cfg.ServiceName, tracer)
 	b.FooClient = fc
 	b.Statuses = append(b.Statuses, &health.Config{
 		Name:     "foo-client",
@@ -75,52 +94,44 @@ func NewBackends(cfg *config.Config) (*Backends, error) {
 	return b, nil
 }
 
-type MongoConfig struct {
-	Hosts      []string
-	Name       string
-	ReplicaSet string
-	Source     string
-	User       string
-	Password   string
-	Timeout    time.Duration
-	UseSSL     bool
-}
+// OnMongoConnect runs fn once Mongo is connected - right away (returning its
+// error) if it already is, otherwise after the background connect in degraded
+// mode succeeds (in which case errors are only logged).
+func (b *Backends) OnMongoConnect(fn func() error) error {
+	b.mongoHooksMu.Lock()
 
-func connectMongoDB(cfg *MongoConfig) (*mgo.Database, error) {
-	log.Infof("Connecting to DB: %q hosts: %v with timeout %d sec", cfg.Name, cfg.Hosts, cfg.Timeout)
-	log.Debugf("DB name: '%s'; replica set: '%s'; auth source: '%s'; user: '%s'; pass len: %d; use SSL: %v",
-		cfg.Name, cfg.ReplicaSet, cfg.Source, cfg.User, len(cfg.Password), cfg.UseSSL)
-
-	dialInfo := &mgo.DialInfo{
-		Addrs:          cfg.Hosts,
-		Database:       cfg.Name,
-		ReplicaSetName: cfg.ReplicaSet,
-		Source:         cfg.Source,
-		Username:       cfg.User,
-		Password:       cfg.Password,
-		Timeout:        cfg.Timeout,
-	}
+	if !b.Mongo.Connected() {
+		b.mongoHooks = append(b.mongoHooks, fn)
+		b.mongoHooksMu.Unlock()
 
-	if cfg.UseSSL {
-		dialInfo.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
-			conn, err := tls.Dial("tcp", addr.String(), &tls.Config{})
-			if conn != nil {
-				log.Debugf("Connection local address: %s, remote address: %s", conn.LocalAddr(), conn.RemoteAddr())
-			}
-			return conn, err
-		}
+		return nil
 	}
 
-	session, err := mgo.DialWithInfo(dialInfo)
-	if err != nil {
-		return nil, fmt.Errorf("Could not connect to MongoDB: %v", err)
-	}
+	b.mongoHooksMu.Unlock()
 
-	//TODO: Look into modes and set here
+	return fn()
+}
 
-	return session.DB(cfg.Name), nil
+func (b *Backends) connectMongoInBackground(cfg *MongoConfig) {
+	session, _ := connectMongoDBWithRetry(cfg, time.Time{})
+
+	b.mongoHooksMu.Lock()
+	b.Mongo.Connect(session)
+	hooks := b.mongoHooks
+	b.mongoHooks = nil
+	b.mongoHooksMu.Unlock()
+
+	log.Info("Connected to MongoDB, leaving degraded mode")
+
+	for _, fn := range hooks {
+		if err := fn(); err != nil {
+			log.Errorf("Mongo connect hook failed: %v", err)
+		}
+	}
 }
 
+// IsConnected reports whether the backends have been set up. In degraded mode
+// Mongo may still be unavailable, use Mongo.Connected() to check for it.
 func (b *Backends) IsConnected() bool {
 	return b.connected
 }
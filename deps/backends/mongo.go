@@ -0,0 +1,307 @@
+package backends
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	MONGO_RETRY_MIN_BACKOFF = time.Second
+	MONGO_RETRY_MAX_BACKOFF = 30 * time.Second
+)
+
+type MongoConfig struct {
+	Hosts      []string
+	Name       string
+	ReplicaSet string
+	Source     string
+	Mechanism  string
+	User       string
+	Password   string
+	Timeout    time.Duration
+
+	// Default read preference; DALs can override it per operation via dalutil.WithMode()
+	Mode mgo.Mode
+
+	// Write concern applied to every session
+	Safe *mgo.Safe
+
+	UseSSL        bool
+	TLSCAFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSServerName string
+}
+
+// NewMongoConfig builds the connection settings from the service config.
+//
+// When GO_MICROSERVICE_1_MONGO_URI is set, it takes precedence over the
+// defaults of the individual GO_MICROSERVICE_1_MONGO_DB_* vars, while any of
+// those vars that are explicitly set take precedence over the URI. TLS is
+// then off unless the URI asks for it (or is a mongodb+srv:// one).
+func NewMongoConfig(cfg *config.Config) (*MongoConfig, error) {
+	mc := &MongoConfig{
+		Safe: &mgo.Safe{},
+	}
+
+	always := func(string) bool { return true }
+
+	if err := applyMongoVars(mc, cfg, always); err != nil {
+		return nil, err
+	}
+
+	if cfg.MongoURI == "" {
+		return mc, nil
+	}
+
+	// Whether to use TLS is up to the URI (as per connection string
+	// semantics) unless GO_MICROSERVICE_1_MONGO_DB_USE_SSL is explicitly set
+	mc.UseSSL = false
+
+	if err := applyMongoURI(mc, cfg.MongoURI); err != nil {
+		return nil, fmt.Errorf("Unable to parse GO_MICROSERVICE_1_MONGO_URI: %v", err)
+	}
+
+	if err := applyMongoVars(mc, cfg, cfg.IsSet); err != nil {
+		return nil, err
+	}
+
+	if len(mc.Hosts) == 0 || mc.Name == "" {
+		return nil, errors.New("Mongo hosts and DB name must be set either in GO_MICROSERVICE_1_MONGO_URI " +
+			"or via GO_MICROSERVICE_1_MONGO_DB_HOSTS and GO_MICROSERVICE_1_MONGO_DB_NAME")
+	}
+
+	return mc, nil
+}
+
+// applyMongoVars copies the individual Mongo settings for which set() is true
+func applyMongoVars(mc *MongoConfig, cfg *config.Config, set func(envVar string) bool) error {
+	if set("GO_MICROSERVICE_1_MONGO_DB_HOSTS") {
+		mc.Hosts = cfg.MongoDBHosts
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_NAME") {
+		mc.Name = cfg.MongoDBName
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_REPLICA_SET") {
+		mc.ReplicaSet = cfg.MongoDBReplicaSet
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_AUTH_SOURCE") {
+		mc.Source = cfg.MongoDBSource
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_AUTH_MECHANISM") {
+		mc.Mechanism = cfg.MongoDBAuthMechanism
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_USER") {
+		mc.User = cfg.MongoDBUser
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_PASS") {
+		mc.Password = cfg.MongoDBPassword
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_TIMEOUT_SEC") {
+		mc.Timeout = time.Duration(cfg.MongoDBConnTimeoutSec) * time.Second
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_MODE") {
+		mode, err := dalutil.ParseMode(cfg.MongoDBMode)
+		if err != nil {
+			return err
+		}
+
+		mc.Mode = mode
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_WRITE_CONCERN") {
+		setW(mc.Safe, cfg.MongoDBWriteConcern)
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_WRITE_JOURNAL") {
+		mc.Safe.J = cfg.MongoDBWriteJournal
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_WRITE_TIMEOUT_MS") {
+		mc.Safe.WTimeout = cfg.MongoDBWriteTimeoutMs
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_USE_SSL") {
+		mc.UseSSL = cfg.MongoDBConnUseSSL
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_TLS_CA_FILE") {
+		mc.TLSCAFile = cfg.MongoDBTLSCAFile
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_TLS_CERT_FILE") {
+		mc.TLSCertFile = cfg.MongoDBTLSCertFile
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_TLS_KEY_FILE") {
+		mc.TLSKeyFile = cfg.MongoDBTLSKeyFile
+	}
+
+	if set("GO_MICROSERVICE_1_MONGO_DB_TLS_SERVER_NAME") {
+		mc.TLSServerName = cfg.MongoDBTLSServerName
+	}
+
+	return nil
+}
+
+// setW sets the write concern; w is either a number of nodes or a mode such
+// as "majority"
+func setW(safe *mgo.Safe, w string) {
+	if n, err := strconv.Atoi(w); err == nil {
+		safe.W = n
+		safe.WMode = ""
+	} else {
+		safe.W = 0
+		safe.WMode = w
+	}
+}
+
+// newTLSConfig loads the CA bundle and client certificate (if any)
+func newTLSConfig(cfg *MongoConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: cfg.TLSServerName,
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read Mongo CA file: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in Mongo CA file '%s'", cfg.TLSCAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load Mongo client certificate: %v", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func connectMongoDB(cfg *MongoConfig) (*mgo.Session, error) {
+	log.Infof("Connecting to DB: %q hosts: %v with timeout %d sec", cfg.Name, cfg.Hosts, cfg.Timeout)
+	log.Debugf("DB name: '%s'; replica set: '%s'; auth source: '%s'; mechanism: '%s'; user: '%s'; pass len: %d; use SSL: %v",
+		cfg.Name, cfg.ReplicaSet, cfg.Source, cfg.Mechanism, cfg.User, len(cfg.Password), cfg.UseSSL)
+
+	dialInfo := &mgo.DialInfo{
+		Addrs:          cfg.Hosts,
+		Database:       cfg.Name,
+		ReplicaSetName: cfg.ReplicaSet,
+		Source:         cfg.Source,
+		Mechanism:      cfg.Mechanism,
+		Username:       cfg.User,
+		Password:       cfg.Password,
+		Timeout:        cfg.Timeout,
+	}
+
+	if cfg.UseSSL {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		dialInfo.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			conn, err := tls.Dial("tcp", addr.String(), tlsConfig)
+			if conn != nil {
+				log.Debugf("Connection local address: %s, remote address: %s", conn.LocalAddr(), conn.RemoteAddr())
+			}
+			return conn, err
+		}
+	}
+
+	session, err := mgo.DialWithInfo(dialInfo)
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to MongoDB: %v", err)
+	}
+
+	session.SetMode(cfg.Mode, true)
+	session.SetSafe(cfg.Safe)
+
+	return session, nil
+}
+
+// ConnectMongo connects to Mongo (retrying up to
+// GO_MICROSERVICE_1_MONGO_DB_CONNECT_RETRY_SEC) without setting up any of the
+// other backends; meant for one-off commands such as `migrate`.
+func ConnectMongo(cfg *config.Config, m metrics.IMetrics) (*dalutil.SessionPool, error) {
+	mongoCfg, err := NewMongoConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := connectMongoDBWithRetry(mongoCfg, mongoRetryDeadline(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	return newSessionPool(cfg, mongoCfg, session, m), nil
+}
+
+func newSessionPool(cfg *config.Config, mongoCfg *MongoConfig, session *mgo.Session, m metrics.IMetrics) *dalutil.SessionPool {
+	return dalutil.NewSessionPool(
+		session,
+		mongoCfg.Name,
+		cfg.MongoDBMaxSessions,
+		time.Duration(cfg.MongoDBOpTimeoutSec)*time.Second,
+		m,
+	)
+}
+
+func mongoRetryDeadline(cfg *config.Config) time.Time {
+	return time.Now().Add(time.Duration(cfg.MongoDBConnectRetrySec) * time.Second)
+}
+
+// connectMongoDBWithRetry keeps trying to connect (with exponential backoff)
+// until it succeeds or until is reached; a zero until retries forever.
+func connectMongoDBWithRetry(cfg *MongoConfig, until time.Time) (*mgo.Session, error) {
+	backoff := MONGO_RETRY_MIN_BACKOFF
+
+	for {
+		session, err := connectMongoDB(cfg)
+		if err == nil {
+			return session, nil
+		}
+
+		if !until.IsZero() && time.Now().Add(backoff).After(until) {
+			return nil, err
+		}
+
+		log.Warnf("%v; retrying in %v", err, backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > MONGO_RETRY_MAX_BACKOFF {
+			backoff = MONGO_RETRY_MAX_BACKOFF
+		}
+	}
+}
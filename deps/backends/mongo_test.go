@@ -0,0 +1,190 @@
+package backends
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+)
+
+var _ = Describe("Mongo config", func() {
+	var (
+		cfg     *config.Config
+		envVars map[string]string
+	)
+
+	BeforeEach(func() {
+		envVars = map[string]string{}
+
+		cfg = config.New()
+		cfg.MongoDBMode = "primary"
+		cfg.MongoDBWriteConcern = "1"
+		cfg.MongoDBConnTimeoutSec = 30
+		cfg.MongoDBConnUseSSL = true
+	})
+
+	AfterEach(func() {
+		for k := range envVars {
+			os.Unsetenv(k)
+		}
+	})
+
+	setEnv := func(k, v string) {
+		envVars[k] = v
+		os.Setenv(k, v)
+	}
+
+	Describe("NewMongoConfig", func() {
+		Context("without a URI", func() {
+			It("should use the individual settings", func() {
+				cfg.MongoDBHosts = []string{"host1:27017"}
+				cfg.MongoDBName = "foo"
+				cfg.MongoDBWriteConcern = "majority"
+
+				mc, err := NewMongoConfig(cfg)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(mc.Hosts).To(Equal([]string{"host1:27017"}))
+				Expect(mc.Name).To(Equal("foo"))
+				Expect(mc.Timeout).To(Equal(30 * time.Second))
+				Expect(mc.Mode).To(Equal(mgo.Primary))
+				Expect(mc.Safe.WMode).To(Equal("majority"))
+				Expect(mc.UseSSL).To(BeTrue())
+			})
+		})
+
+		Context("with a mongodb:// URI", func() {
+			It("should parse hosts, credentials, DB name and options", func() {
+				cfg.MongoURI = "mongodb://us%40er:p%3Ass@h1,h2:27018/mydb?replicaSet=rs0&authSource=admin" +
+					"&ssl=false&readPreference=secondaryPreferred&w=2&journal=true&wtimeoutMS=500&connectTimeoutMS=1500"
+
+				mc, err := NewMongoConfig(cfg)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(mc.Hosts).To(Equal([]string{"h1:27017", "h2:27018"}))
+				Expect(mc.User).To(Equal("us@er"))
+				Expect(mc.Password).To(Equal("p:ss"))
+				Expect(mc.Name).To(Equal("mydb"))
+				Expect(mc.ReplicaSet).To(Equal("rs0"))
+				Expect(mc.Source).To(Equal("admin"))
+				Expect(mc.UseSSL).To(BeFalse())
+				Expect(mc.Mode).To(Equal(mgo.SecondaryPreferred))
+				Expect(mc.Safe).To(Equal(&mgo.Safe{W: 2, J: true, WTimeout: 500}))
+				Expect(mc.Timeout).To(Equal(1500 * time.Millisecond))
+			})
+
+			It("should let explicitly set vars override the URI", func() {
+				cfg.MongoURI = "mongodb://h1/mydb?readPreference=nearest"
+				cfg.MongoDBName = "other"
+				cfg.MongoDBMode = "secondary"
+				setEnv("GO_MICROSERVICE_1_MONGO_DB_NAME", "other")
+				setEnv("GO_MICROSERVICE_1_MONGO_DB_MODE", "secondary")
+
+				mc, err := NewMongoConfig(cfg)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(mc.Name).To(Equal("other"))
+				Expect(mc.Mode).To(Equal(mgo.Secondary))
+			})
+
+			It("should not use TLS unless the URI asks for it", func() {
+				cfg.MongoURI = "mongodb://h1/mydb"
+
+				mc, err := NewMongoConfig(cfg)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(mc.UseSSL).To(BeFalse())
+
+				cfg.MongoURI = "mongodb://h1/mydb?tls=true"
+
+				mc, err = NewMongoConfig(cfg)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(mc.UseSSL).To(BeTrue())
+			})
+
+			It("should use TLS when explicitly set", func() {
+				cfg.MongoURI = "mongodb://h1/mydb"
+				setEnv("GO_MICROSERVICE_1_MONGO_DB_USE_SSL", "true")
+
+				mc, err := NewMongoConfig(cfg)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(mc.UseSSL).To(BeTrue())
+			})
+
+			It("should error without a DB name", func() {
+				cfg.MongoURI = "mongodb://h1"
+
+				_, err := NewMongoConfig(cfg)
+
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("should error on invalid option values", func() {
+				cfg.MongoURI = "mongodb://h1/db?readPreference=tertiary"
+
+				_, err := NewMongoConfig(cfg)
+
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("readPreference"))
+			})
+		})
+
+		Context("with a mongodb+srv:// URI", func() {
+			var origSRV, origTXT = lookupSRV, lookupTXT
+
+			BeforeEach(func() {
+				lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+					Expect(name).To(Equal("cluster.example.com"))
+
+					return "", []*net.SRV{
+						{Target: "a.example.com.", Port: 27017},
+						{Target: "b.example.com.", Port: 27017},
+					}, nil
+				}
+
+				lookupTXT = func(name string) ([]string, error) {
+					return []string{"replicaSet=rs0&authSource=admin"}, nil
+				}
+			})
+
+			AfterEach(func() {
+				lookupSRV, lookupTXT = origSRV, origTXT
+			})
+
+			It("should resolve hosts and TXT options and enable TLS", func() {
+				cfg.MongoDBConnUseSSL = false
+				cfg.MongoURI = "mongodb+srv://cluster.example.com/mydb?authSource=other"
+
+				mc, err := NewMongoConfig(cfg)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(mc.Hosts).To(Equal([]string{"a.example.com:27017", "b.example.com:27017"}))
+				Expect(mc.ReplicaSet).To(Equal("rs0"))
+				Expect(mc.Source).To(Equal("other"))
+				Expect(mc.UseSSL).To(BeTrue())
+			})
+
+			It("should error when the SRV lookup fails", func() {
+				lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+					return "", nil, errors.New("no such host")
+				}
+
+				cfg.MongoURI = "mongodb+srv://cluster.example.com/mydb"
+
+				_, err := NewMongoConfig(cfg)
+
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("no such host"))
+			})
+		})
+	})
+})
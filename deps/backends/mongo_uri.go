@@ -0,0 +1,217 @@
+package backends
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+)
+
+const (
+	MONGO_SCHEME     = "mongodb://"
+	MONGO_SRV_SCHEME = "mongodb+srv://"
+
+	DEFAULT_MONGO_PORT = "27017"
+)
+
+// Overridden in tests
+var (
+	lookupSRV = net.LookupSRV
+	lookupTXT = net.LookupTXT
+)
+
+// applyMongoURI overrides the settings of mc with the ones present in a
+// mongodb:// or mongodb+srv:// connection string:
+//
+//	mongodb://[user:pass@]host1[:port1][,host2[:port2],...][/db][?options]
+//
+// For mongodb+srv:// the (single) host is resolved via DNS: SRV records give
+// the actual hosts and an optional TXT record gives default options (ie.
+// replicaSet and authSource). TLS is on by default for mongodb+srv://.
+func applyMongoURI(mc *MongoConfig, uri string) error {
+	var rest string
+	srv := false
+
+	switch {
+	case strings.HasPrefix(uri, MONGO_SRV_SCHEME):
+		rest = strings.TrimPrefix(uri, MONGO_SRV_SCHEME)
+		srv = true
+	case strings.HasPrefix(uri, MONGO_SCHEME):
+		rest = strings.TrimPrefix(uri, MONGO_SCHEME)
+	default:
+		return fmt.Errorf("scheme must be %q or %q", MONGO_SCHEME, MONGO_SRV_SCHEME)
+	}
+
+	// Options
+	rawQuery := ""
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest, rawQuery = rest[:i], rest[i+1:]
+	}
+
+	opts, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return fmt.Errorf("invalid options: %v", err)
+	}
+
+	// Credentials; the password may itself contain '@' if not escaped
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		if err := applyMongoCredentials(mc, rest[:i]); err != nil {
+			return err
+		}
+
+		rest = rest[i+1:]
+	}
+
+	// Hosts and DB name
+	hostList := rest
+	if i := strings.Index(rest, "/"); i >= 0 {
+		hostList = rest[:i]
+
+		if name, err := url.PathUnescape(rest[i+1:]); err != nil {
+			return fmt.Errorf("invalid DB name: %v", err)
+		} else if name != "" {
+			mc.Name = name
+		}
+	}
+
+	if hostList == "" {
+		return errors.New("no hosts specified")
+	}
+
+	hosts := strings.Split(hostList, ",")
+
+	if srv {
+		if hosts, err = resolveMongoSRV(hostList, opts); err != nil {
+			return err
+		}
+
+		mc.UseSSL = true
+	} else {
+		for i, h := range hosts {
+			if _, _, err := net.SplitHostPort(h); err != nil {
+				hosts[i] = net.JoinHostPort(h, DEFAULT_MONGO_PORT)
+			}
+		}
+	}
+
+	mc.Hosts = hosts
+
+	return applyMongoOptions(mc, opts)
+}
+
+func applyMongoCredentials(mc *MongoConfig, userInfo string) error {
+	user, pass := userInfo, ""
+	hasPass := false
+
+	if i := strings.Index(userInfo, ":"); i >= 0 {
+		user, pass = userInfo[:i], userInfo[i+1:]
+		hasPass = true
+	}
+
+	var err error
+
+	if mc.User, err = url.PathUnescape(user); err != nil {
+		return fmt.Errorf("invalid user: %v", err)
+	}
+
+	if hasPass {
+		if mc.Password, err = url.PathUnescape(pass); err != nil {
+			return fmt.Errorf("invalid password: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// resolveMongoSRV looks up the hosts behind a mongodb+srv:// host and merges
+// the options from its TXT record into opts (options already in the URI win)
+func resolveMongoSRV(host string, opts url.Values) ([]string, error) {
+	if strings.Contains(host, ",") || strings.Contains(host, ":") {
+		return nil, fmt.Errorf("%s URIs take a single host without a port", MONGO_SRV_SCHEME)
+	}
+
+	_, records, err := lookupSRV("mongodb", "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("SRV lookup for '%s' failed: %v", host, err)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no SRV records found for '%s'", host)
+	}
+
+	hosts := make([]string, 0, len(records))
+	for _, r := range records {
+		hosts = append(hosts, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+	}
+
+	// A missing TXT record is fine
+	txts, err := lookupTXT(host)
+	if err != nil {
+		log.Debugf("TXT lookup for '%s' failed: %v", host, err)
+		return hosts, nil
+	}
+
+	for _, txt := range txts {
+		txtOpts, err := url.ParseQuery(txt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TXT record for '%s': %v", host, err)
+		}
+
+		for k, v := range txtOpts {
+			if _, ok := opts[k]; !ok {
+				opts[k] = v
+			}
+		}
+	}
+
+	return hosts, nil
+}
+
+func applyMongoOptions(mc *MongoConfig, opts url.Values) error {
+	for k := range opts {
+		v := opts.Get(k)
+
+		var err error
+
+		switch k {
+		case "replicaSet":
+			mc.ReplicaSet = v
+		case "authSource":
+			mc.Source = v
+		case "authMechanism":
+			mc.Mechanism = v
+		case "ssl", "tls":
+			mc.UseSSL, err = strconv.ParseBool(v)
+		case "tlsCAFile":
+			mc.TLSCAFile = v
+		case "tlsCertificateKeyFile":
+			// Cert and key live in the same PEM file
+			mc.TLSCertFile, mc.TLSKeyFile = v, v
+		case "readPreference":
+			mc.Mode, err = dalutil.ParseMode(v)
+		case "w":
+			setW(mc.Safe, v)
+		case "journal":
+			mc.Safe.J, err = strconv.ParseBool(v)
+		case "wtimeoutMS":
+			mc.Safe.WTimeout, err = strconv.Atoi(v)
+		case "connectTimeoutMS":
+			var ms int
+			ms, err = strconv.Atoi(v)
+			mc.Timeout = time.Duration(ms) * time.Millisecond
+		default:
+			log.Warnf("Ignoring unsupported Mongo URI option '%s'", k)
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid value for option '%s': %v", k, err)
+		}
+	}
+
+	return nil
+}
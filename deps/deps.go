@@ -1,19 +1,47 @@
 package deps
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/InVisionApp/go-health"
 	gllogrus "github.com/InVisionApp/go-logger/shims/logrus"
 	"github.com/InVisionApp/rye"
 	"github.com/cactus/go-statsd-client/statsd"
-	"github.com/newrelic/go-agent"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
 
+	"github.com/dfraglabs/go-microservice-1/apm"
 	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
 	"github.com/dfraglabs/go-microservice-1/dal/foo"
+	"github.com/dfraglabs/go-microservice-1/dal/idempotency"
+	"github.com/dfraglabs/go-microservice-1/dal/jobs"
+	"github.com/dfraglabs/go-microservice-1/dal/migrations"
+	"github.com/dfraglabs/go-microservice-1/dal/webhooks"
 	"github.com/dfraglabs/go-microservice-1/deps/backends"
+	"github.com/dfraglabs/go-microservice-1/deps/scheduler"
+	"github.com/dfraglabs/go-microservice-1/events"
+	"github.com/dfraglabs/go-microservice-1/loadshed"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+	"github.com/dfraglabs/go-microservice-1/ratelimit"
+	"github.com/dfraglabs/go-microservice-1/tracing"
+)
+
+const (
+	FOO_EXPIRES_AFTER_SEC = 10
+
+	// Finished jobs (and their results) are kept this long
+	JOBS_EXPIRE_AFTER_SEC = 7 * 24 * 60 * 60
+
+	// Responses to Idempotency-Key requests are replayed for this long
+	IDEMPOTENCY_EXPIRE_AFTER_SEC = 24 * 60 * 60
+
+	// Finished webhook deliveries (and their attempts) are kept this long
+	WEBHOOK_DELIVERIES_EXPIRE_AFTER_SEC = 7 * 24 * 60 * 60
 )
 
 var (
@@ -25,14 +53,58 @@ func init() {
 }
 
 type Dependencies struct {
-	StatsD    statsd.Statter
-	MWHandler *rye.MWHandler
-	NRApp     newrelic.Application
+	StatsD     statsd.Statter
+	Metrics    metrics.IMetrics
+	Prometheus *metrics.Prometheus // nil unless the prometheus metrics backend is enabled
+	MWHandler  *rye.MWHandler
+	Tracer     apm.ITracer
 
 	FooDAL foo.IDAL
 
-	Backends    *backends.Backends
-	Health      health.IHealth
+	// Shared by every audited DAL
+	Auditor *dalutil.Auditor
+
+	// Locks and leader elections shared across replicas
+	Locks *dalutil.LockService
+
+	// Background jobs; handlers are run by the `worker` command (or by the
+	// API server with GO_MICROSERVICE_1_WORKER_IN_PROCESS)
+	Jobs        jobs.IQueue
+	JobRegistry *jobs.Registry
+
+	// Periodic tasks; run by whichever replica is elected
+	Scheduler *scheduler.Scheduler
+
+	// Domain events recorded by DAL writes and the relay publishing them;
+	// both nil with GO_MICROSERVICE_1_EVENTS_SINK=none
+	Outbox     events.IOutbox
+	EventRelay *events.Relay
+
+	// Domain events made through this replica, as streamed by /v1/stream;
+	// nil unless GO_MICROSERVICE_1_STREAM_ENABLED
+	Broker *events.Broker
+
+	// Carries cache invalidations across replicas; nil unless
+	// GO_MICROSERVICE_1_CACHE_ENABLED
+	PubSub *dalutil.PubSub
+
+	// Responses of Idempotency-Key requests; nil unless
+	// GO_MICROSERVICE_1_IDEMPOTENCY_ENABLED
+	Idempotency idempotency.IStore
+	idempotency *idempotency.Store
+
+	// Applies GO_MICROSERVICE_1_RATE_LIMITS; nil if there are none
+	RateLimiter *ratelimit.Limiter
+
+	// Webhook subscriptions; nil unless GO_MICROSERVICE_1_WEBHOOKS_ENABLED
+	Webhooks webhooks.IWebhooks
+	hooks    *webhooks.Webhooks
+
+	// Encodes pagination cursors handed out by list endpoints
+	Cursors *dalutil.CursorCodec
+
+	Backends *backends.Backends
+	Health   health.IHealth
 }
 
 func New(cfg *config.Config) (*Dependencies, error) {
@@ -40,25 +112,38 @@ func New(cfg *config.Config) (*Dependencies, error) {
 	gohealth.Logger = gllogrus.New(nil)
 
 	d := &Dependencies{
-		Health: gohealth,
+		Health:  gohealth,
+		Cursors: dalutil.NewCursorCodec(CursorSecret(cfg)),
 	}
 
-	// StatsD
-	if err := d.setupStatsdClient(cfg); err != nil {
+	// StatsD + Prometheus
+	if err := d.setupMetrics(cfg); err != nil {
 		return nil, err
 	}
 
-	// Rye
-	d.setupRyeMiddleware(cfg, d.StatsD)
+	// Rye (reports through our metrics abstraction instead of straight to statsd)
+	d.setupRyeMiddleware(cfg, metrics.NewStatter(d.Metrics))
+
+	// APM + tracing (noop unless New Relic and/or a trace exporter is enabled)
+	if err := d.setupTracer(cfg); err != nil {
+		return nil, err
+	}
 
 	//Connect to backend DBs and APIs
-	be, err := backends.NewBackends(cfg)
+	be, err := backends.NewBackends(cfg, d.Tracer, d.Metrics)
 	if err != nil {
 		return nil, err
 	}
 
 	d.Backends = be
 
+	// Pending schema migrations go first so DALs see the current schema
+	if cfg.MigrationsOnStartup {
+		if err := be.OnMongoConnect(func() error { return RunMigrations(cfg, be.Mongo, be.Instrumentation) }); err != nil {
+			return nil, err
+		}
+	}
+
 	// Setup DALs and Managers
 	// NOTE: All DALs must be created before Managers because Managers depend on DALs
 
@@ -71,11 +156,28 @@ func New(cfg *config.Config) (*Dependencies, error) {
 		return nil, err
 	}
 
+	if err := d.setupRateLimiter(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := d.setupEvents(cfg); err != nil {
+		return nil, err
+	}
+
+	schedulerHealthchecks, err := d.setupScheduler(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// Health related calls should always be the last thing here
 	if err := d.Health.AddChecks(dalHealthchecks); err != nil {
 		return nil, err
 	}
 
+	if err := d.Health.AddChecks(schedulerHealthchecks); err != nil {
+		return nil, err
+	}
+
 	if err := d.Health.AddChecks(d.Backends.Statuses); err != nil {
 		return nil, err
 	}
@@ -90,7 +192,80 @@ func New(cfg *config.Config) (*Dependencies, error) {
 func (d *Dependencies) setupDALs(cfg *config.Config) ([]*health.Config, error) {
 	hcs := make([]*health.Config, 0)
 
-	fd, err := foo.NewFooDAL(d.Backends, 10)
+	d.Auditor = dalutil.NewAuditor(d.Backends.Mongo, d.Backends.Instrumentation)
+	d.Locks = dalutil.NewLockService(d.Backends.Mongo, d.Backends.Instrumentation)
+	queue := jobs.NewQueue(d.Backends.Mongo, d.Backends.Instrumentation, JOBS_EXPIRE_AFTER_SEC)
+	d.Jobs = queue
+
+	var outbox *dalutil.Outbox
+	if cfg.EventsSink != events.SINK_NONE || cfg.WebhooksEnabled {
+		outbox = dalutil.NewOutbox(d.Backends.Mongo, d.Backends.Instrumentation, EVENTS_EXPIRE_AFTER_SEC)
+		d.Outbox = outbox
+	}
+
+	if cfg.StreamEnabled {
+		d.Broker = events.NewBroker(events.BrokerOpts{
+			ReplaySize:       cfg.StreamReplaySize,
+			SubscriberBuffer: cfg.StreamBufferSize,
+		})
+	}
+
+	var cache *dalutil.Cache
+	if cfg.CacheEnabled {
+		d.PubSub = dalutil.NewPubSub(d.Backends.Mongo, d.Backends.Instrumentation, cfg.PubSubSizeMB*1024*1024, d.Metrics)
+		cache = dalutil.NewCache(foo.FOO_COLLECTION_NAME, time.Duration(cfg.CacheTTLSec)*time.Second, cfg.CacheMaxEntries, d.Metrics).
+			WithPubSub(d.PubSub)
+	}
+
+	if cfg.IdempotencyEnabled {
+		d.idempotency = idempotency.New(d.Backends.Mongo, d.Backends.Instrumentation, time.Duration(cfg.IdempotencyLeaseSec)*time.Second)
+		d.Idempotency = d.idempotency
+	}
+
+	if cfg.WebhooksEnabled {
+		d.hooks = webhooks.New(d.Backends.Mongo, d.Backends.Instrumentation, queue, webhooks.Opts{
+			MaxAttempts:  cfg.WebhooksMaxAttempts,
+			DisableAfter: cfg.WebhooksDisableAfter,
+			Timeout:      time.Duration(cfg.WebhooksTimeoutSec) * time.Second,
+		}, d.Metrics)
+		d.Webhooks = d.hooks
+	}
+
+	if err := d.Backends.OnMongoConnect(func() error {
+		if err := d.Auditor.EnsureIndexes(d.Backends.AllowDestructiveIndexes); err != nil {
+			return err
+		}
+
+		if outbox != nil {
+			if err := outbox.EnsureIndexes(d.Backends.AllowDestructiveIndexes); err != nil {
+				return err
+			}
+		}
+
+		if d.PubSub != nil {
+			if err := d.PubSub.EnsureCollection(); err != nil {
+				return err
+			}
+		}
+
+		if d.idempotency != nil {
+			if err := d.idempotency.EnsureIndexes(IDEMPOTENCY_EXPIRE_AFTER_SEC, d.Backends.AllowDestructiveIndexes); err != nil {
+				return err
+			}
+		}
+
+		if d.hooks != nil {
+			if err := d.hooks.EnsureIndexes(WEBHOOK_DELIVERIES_EXPIRE_AFTER_SEC, d.Backends.AllowDestructiveIndexes); err != nil {
+				return err
+			}
+		}
+
+		return queue.EnsureIndexes(d.Backends.AllowDestructiveIndexes)
+	}); err != nil {
+		return nil, err
+	}
+
+	fd, err := foo.NewFooDAL(d.Backends, FOO_EXPIRES_AFTER_SEC, d.Auditor, outbox, d.Broker, cache)
 	if err != nil {
 		return nil, err
 	}
@@ -107,6 +282,106 @@ func (d *Dependencies) setupDALs(cfg *config.Config) ([]*health.Config, error) {
 	return hcs, nil
 }
 
+// setupRateLimiter parses GO_MICROSERVICE_1_RATE_LIMITS
+func (d *Dependencies) setupRateLimiter(cfg *config.Config) error {
+	if len(cfg.RateLimits) == 0 {
+		return nil
+	}
+
+	var store ratelimit.IStore = ratelimit.NewMemoryStore()
+
+	if cfg.RateLimitStore == ratelimit.STORE_MONGO {
+		ms := ratelimit.NewMongoStore(d.Backends.Mongo, d.Backends.Instrumentation)
+		store = ms
+
+		if err := d.Backends.OnMongoConnect(func() error { return ms.EnsureIndexes(d.Backends.AllowDestructiveIndexes) }); err != nil {
+			return err
+		}
+	}
+
+	limiter, err := ratelimit.NewLimiter(cfg.RateLimits, store, d.Metrics)
+	if err != nil {
+		return err
+	}
+
+	d.RateLimiter = limiter
+
+	return nil
+}
+
+// CursorSecret returns GO_MICROSERVICE_1_CURSOR_SECRET or, if unset, a
+// secret derived from the access tokens (which every replica shares)
+func CursorSecret(cfg *config.Config) []byte {
+	if cfg.CursorSecret != "" {
+		return []byte(cfg.CursorSecret)
+	}
+
+	h := sha256.New()
+	h.Write([]byte("cursor"))
+
+	for _, t := range cfg.Tokens {
+		h.Write([]byte{0})
+		h.Write([]byte(t))
+	}
+
+	return h.Sum(nil)
+}
+
+// RunPubSub dispatches cache invalidations published by every replica until
+// ctx is done; returns right away if caching is disabled
+func (d *Dependencies) RunPubSub(ctx context.Context) error {
+	if d.PubSub == nil {
+		return nil
+	}
+
+	return d.PubSub.Run(ctx)
+}
+
+// IndexSpecs lists the desired indexes of every DAL; used by the
+// `indexes plan|apply` commands
+func IndexSpecs() map[string][]*mgo.Index {
+	return map[string][]*mgo.Index{
+		foo.FOO_COLLECTION_NAME:                foo.Indexes(FOO_EXPIRES_AFTER_SEC),
+		dalutil.AUDIT_COLLECTION_NAME:          dalutil.AuditIndexes(),
+		jobs.JOBS_COLLECTION_NAME:              jobs.Indexes(JOBS_EXPIRE_AFTER_SEC),
+		dalutil.OUTBOX_COLLECTION_NAME:         dalutil.OutboxIndexes(EVENTS_EXPIRE_AFTER_SEC),
+		idempotency.COLLECTION_NAME:            idempotency.Indexes(IDEMPOTENCY_EXPIRE_AFTER_SEC),
+		ratelimit.COLLECTION_NAME:              ratelimit.Indexes(),
+		webhooks.SUBSCRIPTIONS_COLLECTION_NAME: webhooks.SubscriptionIndexes(),
+		webhooks.DELIVERIES_COLLECTION_NAME:    webhooks.DeliveryIndexes(WEBHOOK_DELIVERIES_EXPIRE_AFTER_SEC),
+	}
+}
+
+// NewMigrator returns a migrator for every registered migration
+func NewMigrator(pool *dalutil.SessionPool, inst *dalutil.Instrumentation) *migrations.Migrator {
+	return migrations.New(pool, migrations.All(), inst, migrations.LOCK_TTL)
+}
+
+// NewWorker returns a worker running the registered job handlers
+func (d *Dependencies) NewWorker(cfg *config.Config) *jobs.Worker {
+	return jobs.NewWorker(d.Jobs, d.JobRegistry, jobs.WorkerOpts{
+		Concurrency:     cfg.WorkerConcurrency,
+		Visibility:      time.Duration(cfg.JobVisibilityTimeoutSec) * time.Second,
+		PollInterval:    time.Duration(cfg.WorkerPollIntervalMs) * time.Millisecond,
+		ShutdownTimeout: time.Duration(cfg.ShutdownTimeoutSec) * time.Second,
+	}, d.Metrics)
+}
+
+// RunMigrations applies every pending migration
+func RunMigrations(cfg *config.Config, pool *dalutil.SessionPool, inst *dalutil.Instrumentation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.MigrationsTimeoutSec)*time.Second)
+	defer cancel()
+
+	applied, err := NewMigrator(pool, inst).Up(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Applied %d pending migration(s)", len(applied))
+
+	return nil
+}
+
 // Managers provide a way to abstract DAL's.
 //
 // _USE_ them if you have a bunch of DAL's that need to be called as part of the
@@ -115,9 +390,93 @@ func (d *Dependencies) setupDALs(cfg *config.Config) ([]*health.Config, error) {
 // _DO NOT_ use them only if you have just a couple of loosely related DAL's
 // that can be used directly in the handler(s) (without creating a 200 line handler).
 func (d *Dependencies) setupManagers(cfg *config.Config) error {
+	d.JobRegistry = jobs.NewRegistry()
+	d.registerJobHandlers()
+
+	return nil
+}
+
+// setupScheduler registers the scheduled tasks; their state shows up in the
+// healthcheck (without failing it)
+func (d *Dependencies) setupScheduler(cfg *config.Config) ([]*health.Config, error) {
+	d.Scheduler = scheduler.New(d.Backends.Mongo, d.Backends.Instrumentation, d.Locks, scheduler.Opts{
+		LeaseTTL: time.Duration(cfg.SchedulerLeaseSec) * time.Second,
+		CatchUp:  cfg.SchedulerCatchUp,
+	}, d.Metrics)
+
+	if err := d.registerTasks(); err != nil {
+		return nil, err
+	}
+
+	return []*health.Config{
+		{
+			Name:     "scheduler",
+			Checker:  d.Scheduler,
+			Interval: time.Duration(cfg.HealthFreqSec) * time.Second,
+			Fatal:    false,
+		},
+	}, nil
+}
+
+func (d *Dependencies) setupMetrics(cfg *config.Config) error {
+	backendList := make([]metrics.IMetrics, 0)
+
+	// Always have a statter available (noop unless the statsd backend is enabled)
+	d.StatsD, _ = statsd.NewNoopClient()
+
+	for _, name := range cfg.MetricsBackends {
+		switch name {
+		case metrics.BACKEND_STATSD:
+			if err := d.setupStatsdClient(cfg); err != nil {
+				return err
+			}
+
+			backendList = append(backendList, metrics.NewStatsD(d.StatsD, cfg.StatsDRate, cfg.StatsDTagFormat))
+		case metrics.BACKEND_PROMETHEUS:
+			d.Prometheus = metrics.NewPrometheus(cfg.ServiceName, nil)
+			d.describePrometheusMetrics()
+			backendList = append(backendList, d.Prometheus)
+		default:
+			return fmt.Errorf("Unknown metrics backend '%s'", name)
+		}
+	}
+
+	d.Metrics = metrics.NewMulti(backendList...)
+
 	return nil
 }
 
+func (d *Dependencies) describePrometheusMetrics() {
+	d.Prometheus.Describe(metrics.HTTP_REQUESTS_METRIC, "Number of HTTP requests by method, route template and status class")
+	d.Prometheus.Describe(metrics.HTTP_ERRORS_METRIC, "Number of HTTP requests that resulted in a 5xx")
+	d.Prometheus.Describe(metrics.HTTP_DURATION_METRIC, "HTTP request duration by method, route template and status class")
+	d.Prometheus.Describe(metrics.HTTP_IN_FLIGHT_METRIC, "Number of HTTP requests currently being served")
+	d.Prometheus.Describe(dalutil.MONGO_OPERATIONS_METRIC, "Number of Mongo operations by collection, operation and status")
+	d.Prometheus.Describe(dalutil.MONGO_ERRORS_METRIC, "Number of failed Mongo operations")
+	d.Prometheus.Describe(dalutil.MONGO_DURATION_METRIC, "Mongo operation duration by collection, operation and status")
+	d.Prometheus.Describe(dalutil.MONGO_POOL_IN_USE_METRIC, "Number of Mongo sessions currently checked out of the pool")
+	d.Prometheus.Describe(dalutil.MONGO_POOL_EXHAUSTED_METRIC, "Number of times an operation had to wait for a free Mongo session")
+	d.Prometheus.Describe(dalutil.MONGO_POOL_TIMEOUTS_METRIC, "Number of operations that gave up waiting for a Mongo session")
+	d.Prometheus.Describe(dalutil.MONGO_POOL_WAIT_METRIC, "Time spent waiting for a free Mongo session")
+	d.Prometheus.Describe(jobs.JOBS_PROCESSED_METRIC, "Number of jobs run by type and outcome")
+	d.Prometheus.Describe(jobs.JOBS_DURATION_METRIC, "Job run duration by type and outcome")
+	d.Prometheus.Describe(jobs.JOBS_IN_FLIGHT_METRIC, "Number of jobs currently running in this worker")
+	d.Prometheus.Describe(JOBS_BY_STATUS_METRIC, "Number of jobs by status")
+	d.Prometheus.Describe(scheduler.TASK_RUNS_METRIC, "Number of scheduled task runs by task and outcome")
+	d.Prometheus.Describe(scheduler.TASK_DURATION_METRIC, "Scheduled task run duration by task and outcome")
+	d.Prometheus.Describe(events.EVENTS_PUBLISHED_METRIC, "Number of domain event publish attempts by type and outcome")
+	d.Prometheus.Describe(webhooks.DELIVERIES_METRIC, "Number of webhook delivery attempts by event type and outcome")
+	d.Prometheus.Describe(idempotency.REQUESTS_METRIC, "Number of Idempotency-Key requests by result (new, replayed, mismatch, in_flight)")
+	d.Prometheus.Describe(loadshed.SHED_METRIC, "Number of requests shed under load by priority and reason")
+	d.Prometheus.Describe(loadshed.LIMIT_METRIC, "Number of requests that may be in flight at once")
+	d.Prometheus.Describe(loadshed.QUEUE_WAIT_METRIC, "Time requests spent queued for a slot by priority")
+	d.Prometheus.Describe(ratelimit.REJECTED_METRIC, "Number of requests rejected by a rate limit by route group, key and algorithm")
+	d.Prometheus.Describe(ratelimit.ERRORS_METRIC, "Number of rate limit checks that failed by route group")
+	d.Prometheus.Describe(dalutil.CACHE_LOOKUPS_METRIC, "Number of cache lookups by cache and result")
+	d.Prometheus.Describe(dalutil.PUBSUB_LAG_METRIC, "Seconds between a pubsub message being published and this replica receiving it")
+	d.Prometheus.Describe(dalutil.PUBSUB_RECONNECTS_METRIC, "Number of times the pubsub tail was reopened")
+}
+
 func (d *Dependencies) setupStatsdClient(cfg *config.Config) error {
 	flushInterval := time.Duration(100 * time.Millisecond)
 
@@ -131,9 +490,73 @@ func (d *Dependencies) setupStatsdClient(cfg *config.Config) error {
 	return nil
 }
 
+func (d *Dependencies) setupTracer(cfg *config.Config) error {
+	tracers := make([]apm.ITracer, 0)
+
+	if cfg.NewRelicEnabled {
+		nr, err := apm.NewNewRelic(cfg.NewRelicAppName, cfg.NewRelicLicenseKey)
+		if err != nil {
+			return err
+		}
+
+		log.WithField("app", cfg.NewRelicAppName).Info("New Relic enabled")
+
+		tracers = append(tracers, nr)
+	}
+
+	if cfg.TracingExporter != tracing.EXPORTER_NONE {
+		exporter, err := newSpanExporter(cfg)
+		if err != nil {
+			return err
+		}
+
+		log.WithField("exporter", cfg.TracingExporter).Info("Tracing enabled")
+
+		tracers = append(tracers, tracing.New(&tracing.Config{
+			ServiceName:          cfg.ServiceName,
+			SampleRate:           cfg.TracingSampleRate,
+			IgnoreParentSampling: cfg.TracingIgnoreParent,
+			Exporter:             exporter,
+		}))
+	}
+
+	switch len(tracers) {
+	case 0:
+		d.Tracer = apm.NewNoop()
+	case 1:
+		d.Tracer = tracers[0]
+	default:
+		d.Tracer = apm.NewMulti(tracers...)
+	}
+
+	return nil
+}
+
+func newSpanExporter(cfg *config.Config) (tracing.IExporter, error) {
+	switch cfg.TracingExporter {
+	case tracing.EXPORTER_STDOUT:
+		return tracing.NewJSONExporter(os.Stdout), nil
+	case tracing.EXPORTER_FILE:
+		f, err := os.OpenFile(cfg.TracingFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to open trace file: %v", err)
+		}
+
+		return tracing.NewJSONExporter(f), nil
+	case tracing.EXPORTER_OTLP:
+		return tracing.NewOTLPExporter(&tracing.OTLPConfig{
+			Endpoint:      cfg.TracingOTLPEndpoint,
+			ServiceName:   cfg.ServiceName,
+			FlushInterval: time.Duration(cfg.TracingFlushInterval) * time.Second,
+		}), nil
+	}
+
+	return nil, fmt.Errorf("Unknown tracing exporter '%s'", cfg.TracingExporter)
+}
+
 func (d *Dependencies) setupRyeMiddleware(cfg *config.Config, statter statsd.Statter) {
 	d.MWHandler = rye.NewMWHandler(rye.Config{
 		Statter:  statter,
 		StatRate: cfg.StatsDRate,
 	})
-}
\ No newline at end of file
+}
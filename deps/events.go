@@ -0,0 +1,83 @@
+package deps
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/events"
+)
+
+const (
+	// Published events are kept in the outbox this long
+	EVENTS_EXPIRE_AFTER_SEC = 24 * 60 * 60
+
+	// Another replica takes over relaying this long after the relaying one died
+	EVENTS_RELAY_LEASE_TTL = 30 * time.Second
+)
+
+// setupEvents creates the relay publishing the outbox to the configured sink
+// and webhooks
+func (d *Dependencies) setupEvents(cfg *config.Config) error {
+	if d.Outbox == nil {
+		return nil
+	}
+
+	sinks := []events.ISink{}
+
+	if cfg.EventsSink != events.SINK_NONE {
+		sink, err := newEventSink(cfg)
+		if err != nil {
+			return err
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	if d.hooks != nil {
+		sinks = append(sinks, d.hooks)
+	}
+
+	var sink events.ISink = events.NewMultiSink(sinks...)
+	if len(sinks) == 1 {
+		sink = sinks[0]
+	}
+
+	d.EventRelay = events.NewRelay(d.Outbox, sink, events.RelayOpts{
+		PollInterval: time.Duration(cfg.EventsPollIntervalMs) * time.Millisecond,
+		MaxAttempts:  cfg.EventsMaxAttempts,
+	}, d.Metrics)
+
+	return nil
+}
+
+func newEventSink(cfg *config.Config) (events.ISink, error) {
+	switch cfg.EventsSink {
+	case events.SINK_HTTP:
+		return events.NewHTTPSink(cfg.EventsSinkURL), nil
+	case events.SINK_SNS:
+		return events.NewSNSSink(cfg.EventsSinkURL, cfg.EventsSNSTopicARN), nil
+	case events.SINK_FILE:
+		f, err := os.OpenFile(cfg.EventsFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to open events file: %v", err)
+		}
+
+		return events.NewJSONSink(f), nil
+	}
+
+	return nil, fmt.Errorf("Unknown events sink '%s'", cfg.EventsSink)
+}
+
+// RunEventRelay relays events until ctx is done, whenever this replica is
+// the one elected to; returns right away if events are disabled
+func (d *Dependencies) RunEventRelay(ctx context.Context) error {
+	if d.EventRelay == nil {
+		return nil
+	}
+
+	return dalutil.NewElector(d.Locks, events.RELAY_ELECTION_NAME, EVENTS_RELAY_LEASE_TTL).Run(ctx, d.EventRelay.Run)
+}
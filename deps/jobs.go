@@ -0,0 +1,75 @@
+package deps
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dfraglabs/go-microservice-1/dal/foo/types"
+	"github.com/dfraglabs/go-microservice-1/dal/jobs"
+	"github.com/dfraglabs/go-microservice-1/dal/webhooks"
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+const (
+	FOO_IMPORT_JOB = "foo.import"
+
+	// Imports report their progress every this many foos
+	fooImportProgressEvery = 100
+)
+
+// FooImportPayload is the payload of FOO_IMPORT_JOB
+type FooImportPayload struct {
+	Foos []*FooImportItem `bson:"foos" json:"foos"`
+}
+
+type FooImportItem struct {
+	Field string `bson:"foo_field" json:"foo_field"`
+	Value int    `bson:"value" json:"value"`
+}
+
+// registerJobHandlers is where every job type gets its handler
+func (d *Dependencies) registerJobHandlers() {
+	d.JobRegistry.RegisterPublic(FOO_IMPORT_JOB, d.importFoos)
+
+	if d.hooks != nil {
+		d.JobRegistry.Register(webhooks.DELIVERY_JOB, d.hooks.Deliver)
+	}
+}
+
+// importFoos creates foos in bulk. Retries start over, so foos that already
+// exist (from a previous attempt) are skipped rather than failing the job.
+func (d *Dependencies) importFoos(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	payload := &FooImportPayload{}
+	if err := job.DecodePayload(payload); err != nil {
+		return nil, err
+	}
+
+	created, skipped := 0, 0
+
+	for i, item := range payload.Foos {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		err := d.FooDAL.CreateFoo(ctx, &types.Foo{Field: item.Field, Value: item.Value})
+
+		switch err.(type) {
+		case nil:
+			created++
+		case errtype.DuplicateKeyErr:
+			skipped++
+		default:
+			return nil, fmt.Errorf("Unable to import foo #%d: %v", i, err)
+		}
+
+		if n := i + 1; n%fooImportProgressEvery == 0 {
+			msg := fmt.Sprintf("%d of %d foos imported", n, len(payload.Foos))
+
+			if err := jobs.ReportProgress(ctx, n*100/len(payload.Foos), msg); err != nil {
+				log.WithError(err).WithField("job_id", job.ID.Hex()).Warn("Unable to report import progress")
+			}
+		}
+	}
+
+	return map[string]int{"created": created, "skipped": skipped}, nil
+}
@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schedule", func() {
+	// Monday
+	start := time.Date(2026, 10, 19, 12, 34, 56, 0, time.UTC)
+
+	next := func(spec string, from time.Time) time.Time {
+		s, err := ParseSchedule(spec)
+		Expect(err).ToNot(HaveOccurred())
+
+		return s.Next(from)
+	}
+
+	It("should run intervals at multiples of the interval", func() {
+		Expect(next("@every 15m", start)).To(Equal(time.Date(2026, 10, 19, 12, 45, 0, 0, time.UTC)))
+		Expect(next("@every 15m", time.Date(2026, 10, 19, 12, 45, 0, 0, time.UTC))).To(Equal(time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)))
+	})
+
+	It("should expand macros", func() {
+		Expect(next("@hourly", start)).To(Equal(time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)))
+		Expect(next("@daily", start)).To(Equal(time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)))
+		Expect(next("@weekly", start)).To(Equal(time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)))
+		Expect(next("@yearly", start)).To(Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("should handle lists, ranges, steps and names", func() {
+		Expect(next("*/20 9-17 * * MON-FRI", start)).To(Equal(time.Date(2026, 10, 19, 12, 40, 0, 0, time.UTC)))
+		Expect(next("0 9,18 * * *", start)).To(Equal(time.Date(2026, 10, 19, 18, 0, 0, 0, time.UTC)))
+		Expect(next("30 2 * * sat", start)).To(Equal(time.Date(2026, 10, 24, 2, 30, 0, 0, time.UTC)))
+		Expect(next("0 0 1 jan,jul *", start)).To(Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(next("0 0 * * 7", start)).To(Equal(time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("should match either restricted day of month or day of week", func() {
+		// The 1st or any Friday, whichever comes first
+		Expect(next("0 0 1 * 5", start)).To(Equal(time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("should find leap days", func() {
+		Expect(next("0 0 29 2 *", start)).To(Equal(time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("should reject invalid specs", func() {
+		for _, spec := range []string{
+			"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *",
+			"* * * FOO *", "0 0 30 2 *", "@every 10ms", "@every soon", "@sometimes",
+		} {
+			_, err := ParseSchedule(spec)
+			Expect(err).To(HaveOccurred(), spec)
+		}
+	})
+})
@@ -0,0 +1,459 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+var log = logrus.WithField("pkg", "scheduler")
+
+const (
+	TASKS_COLLECTION_NAME = "scheduled_tasks"
+
+	// Name of the lock held by the replica running the tasks
+	ELECTION_NAME = "scheduler"
+
+	TASK_RUNS_METRIC     = "scheduler.runs"
+	TASK_DURATION_METRIC = "scheduler.duration"
+
+	OUTCOME_SUCCEEDED = "succeeded"
+	OUTCOME_FAILED    = "failed"
+
+	// What to do about runs that were missed (ie. while no replica was
+	// running, or because the previous run overran)
+	CATCH_UP_SKIP = "skip" // drop them
+	CATCH_UP_ONCE = "once" // run once for all of them
+	CATCH_UP_ALL  = "all"  // run each of them (up to MAX_CATCH_UP_RUNS), back to back
+
+	MAX_CATCH_UP_RUNS = 10
+
+	// A run starting later than this after it was due counts as missed
+	MISFIRE_GRACE = time.Minute
+
+	// How long to wait before retrying when the task state can't be loaded
+	stateRetryInterval = 5 * time.Second
+
+	// Recording a run is not bound to the (possibly canceled) task ctx
+	stateUpdateTimeout = 10 * time.Second
+)
+
+var CATCH_UP_POLICIES = []string{CATCH_UP_SKIP, CATCH_UP_ONCE, CATCH_UP_ALL}
+
+// TaskFunc runs a task; ctx is canceled when the task times out, when this
+// replica stops running the tasks or on shutdown
+type TaskFunc func(ctx context.Context) error
+
+// TaskOpts are all optional
+type TaskOpts struct {
+	Timeout time.Duration // none if 0
+	CatchUp string        // the scheduler's policy if empty
+}
+
+// TaskState is stored in the scheduled_tasks collection and reported by
+// Status
+type TaskState struct {
+	Name      string    `bson:"_id" json:"-"`
+	Schedule  string    `bson:"schedule" json:"schedule"`
+	NextRunAt time.Time `bson:"next_run_at" json:"next_run_at"`
+
+	LastRunAt      *time.Time `bson:"last_run_at,omitempty" json:"last_run_at,omitempty"`
+	LastDurationMs int64      `bson:"last_duration_ms" json:"last_duration_ms"`
+	LastOutcome    string     `bson:"last_outcome,omitempty" json:"last_outcome,omitempty"`
+	LastError      string     `bson:"last_error,omitempty" json:"last_error,omitempty"`
+
+	Runs     int64 `bson:"runs" json:"runs"`
+	Failures int64 `bson:"failures" json:"failures"`
+	Missed   int64 `bson:"missed" json:"missed"` // dropped by the catch-up policy
+}
+
+// Opts configure a Scheduler
+type Opts struct {
+	// How long the elected replica holds on to the tasks if it stops
+	// renewing its lease (ie. because it crashed)
+	LeaseTTL time.Duration
+	// Default catch-up policy of tasks
+	CatchUp string
+}
+
+type task struct {
+	name     string
+	spec     string
+	schedule Schedule
+	fn       TaskFunc
+	timeout  time.Duration
+	catchUp  string
+}
+
+// Scheduler runs named tasks on a cron schedule. Only one replica (the one
+// holding the ELECTION_NAME lease) runs them; the state of every task is
+// kept in Mongo so that a newly elected replica picks up where the previous
+// one left off, catching up on missed runs according to the task's policy.
+type Scheduler struct {
+	coll    *dalutil.SmartCollection
+	elector *dalutil.Elector
+	opts    Opts
+	metrics metrics.IMetrics
+
+	mu    sync.RWMutex
+	tasks map[string]*task
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+func New(pool *dalutil.SessionPool, inst *dalutil.Instrumentation, locks *dalutil.LockService, opts Opts, m metrics.IMetrics) *Scheduler {
+	if opts.CatchUp == "" {
+		opts.CatchUp = CATCH_UP_SKIP
+	}
+
+	if m == nil {
+		m = metrics.NewNoop()
+	}
+
+	return &Scheduler{
+		coll:    dalutil.NewSmartCollection(pool, TASKS_COLLECTION_NAME, inst),
+		elector: dalutil.NewElector(locks, ELECTION_NAME, opts.LeaseTTL),
+		opts:    opts,
+		metrics: m,
+		tasks:   map[string]*task{},
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Register adds a task running on spec (see ParseSchedule); tasks must be
+// registered before Run
+func (s *Scheduler) Register(name, spec string, fn TaskFunc, opts *TaskOpts) error {
+	if opts == nil {
+		opts = &TaskOpts{}
+	}
+
+	if name == "" || fn == nil {
+		return fmt.Errorf("Task must have a name and a func")
+	}
+
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("Unable to register task '%s': %v", name, err)
+	}
+
+	catchUp := opts.CatchUp
+	if catchUp == "" {
+		catchUp = s.opts.CatchUp
+	}
+
+	if !validCatchUp(catchUp) {
+		return fmt.Errorf("Unable to register task '%s': unknown catch-up policy '%s'", name, catchUp)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("Unable to register task '%s': duplicate name", name)
+	}
+
+	s.tasks[name] = &task{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		fn:       fn,
+		timeout:  opts.Timeout,
+		catchUp:  catchUp,
+	}
+
+	return nil
+}
+
+// Run campaigns for the ELECTION_NAME lease until ctx is done and runs the
+// tasks while holding it
+func (s *Scheduler) Run(ctx context.Context) error {
+	tasks := s.sortedTasks()
+	if len(tasks) == 0 {
+		log.Info("No scheduled tasks registered")
+		return nil
+	}
+
+	err := s.elector.Run(ctx, func(lctx context.Context) error {
+		log.Infof("Running %d scheduled task(s)", len(tasks))
+
+		wg := &sync.WaitGroup{}
+
+		for _, t := range tasks {
+			wg.Add(1)
+
+			go func(t *task) {
+				defer wg.Done()
+				s.loop(lctx, t)
+			}(t)
+		}
+
+		wg.Wait()
+
+		return lctx.Err()
+	})
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// loop runs t whenever it is due until ctx is done
+func (s *Scheduler) loop(ctx context.Context, t *task) {
+	llog := log.WithField("task", t.name)
+
+	state, err := s.load(ctx, t)
+	for err != nil {
+		llog.WithError(err).Warnf("Unable to load task state; retrying in %v", stateRetryInterval)
+
+		select {
+		case <-time.After(stateRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+
+		state, err = s.load(ctx, t)
+	}
+
+	for {
+		if wait := state.NextRunAt.Sub(s.now()); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		p := plan(t.schedule, t.catchUp, state.NextRunAt, s.now())
+		if p.missed > 0 {
+			llog.WithField("policy", t.catchUp).Warnf("Missed %d run(s)", p.missed)
+		}
+
+		state.Missed += int64(p.missed)
+
+		if p.run {
+			s.run(ctx, t, state)
+
+			// Leave the run due for the next leader (which may be running
+			// already)
+			if ctx.Err() != nil {
+				llog.Warn("Scheduled task interrupted; it will run again once a replica is elected")
+				return
+			}
+		}
+
+		state.NextRunAt = p.next(s.now())
+
+		if err := s.save(state); err != nil {
+			llog.WithError(err).Error("Unable to record task state")
+		}
+	}
+}
+
+// run calls t, turning panics into errors, and records the outcome in state
+func (s *Scheduler) run(ctx context.Context, t *task, state *TaskState) {
+	llog := log.WithField("task", t.name)
+
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	start := s.now()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("task panicked: %v", r)
+			}
+		}()
+
+		return t.fn(ctx)
+	}()
+
+	elapsed := s.now().Sub(start)
+
+	state.LastRunAt = &start
+	state.LastDurationMs = int64(elapsed / time.Millisecond)
+	state.LastOutcome = OUTCOME_SUCCEEDED
+	state.LastError = ""
+	state.Runs++
+
+	if err != nil {
+		llog.WithError(err).Error("Scheduled task failed")
+
+		state.LastOutcome = OUTCOME_FAILED
+		state.LastError = err.Error()
+		state.Failures++
+	} else {
+		llog.WithField("duration", elapsed).Debug("Scheduled task ran")
+	}
+
+	tags := metrics.Tags{"task": t.name, "outcome": state.LastOutcome}
+	s.metrics.Inc(TASK_RUNS_METRIC, 1, tags)
+	s.metrics.Timing(TASK_DURATION_METRIC, elapsed, tags)
+}
+
+// runPlan is what to do about a run that is due
+type runPlan struct {
+	run    bool
+	missed int
+	next   func(now time.Time) time.Time // when the run after this one is due
+}
+
+// plan decides what to do once the run due at due is reached at now
+func plan(schedule Schedule, catchUp string, due, now time.Time) *runPlan {
+	afterDue := func(time.Time) time.Time { return schedule.Next(due) }
+	afterNow := func(now time.Time) time.Time { return schedule.Next(now) }
+
+	if now.Sub(due) <= MISFIRE_GRACE {
+		return &runPlan{run: true, next: afterDue}
+	}
+
+	// Every run due up to now was missed
+	slots := []time.Time{}
+	for t := due; !t.After(now); t = schedule.Next(t) {
+		slots = append(slots, t)
+	}
+
+	switch catchUp {
+	case CATCH_UP_ONCE:
+		return &runPlan{run: true, missed: len(slots) - 1, next: afterNow}
+	case CATCH_UP_ALL:
+		if len(slots) <= MAX_CATCH_UP_RUNS {
+			return &runPlan{run: true, next: afterDue}
+		}
+
+		// Start over from the oldest run that is made up
+		oldest := slots[len(slots)-MAX_CATCH_UP_RUNS]
+
+		return &runPlan{
+			run:    true,
+			missed: len(slots) - MAX_CATCH_UP_RUNS,
+			next:   func(time.Time) time.Time { return schedule.Next(oldest) },
+		}
+	default:
+		return &runPlan{missed: len(slots), next: afterNow}
+	}
+}
+
+// load returns the stored state of t; tasks that were never scheduled (or
+// whose schedule changed) are first due on their next run from now
+func (s *Scheduler) load(ctx context.Context, t *task) (*TaskState, error) {
+	state := &TaskState{}
+
+	err := s.coll.FindOne(ctx, bson.M{"_id": t.name}, nil, state)
+
+	switch {
+	case err == nil && state.Schedule == t.spec:
+		return state, nil
+	case err != nil && err != mgo.ErrNotFound:
+		return nil, err
+	}
+
+	state.Name = t.name
+	state.Schedule = t.spec
+	state.NextRunAt = t.schedule.Next(s.now())
+
+	return state, s.save(state)
+}
+
+func (s *Scheduler) save(state *TaskState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), stateUpdateTimeout)
+	defer cancel()
+
+	_, err := s.coll.Upsert(ctx, bson.M{"_id": state.Name}, state)
+
+	return err
+}
+
+// States returns the stored state of every registered task, by name; tasks
+// that have not been scheduled yet are missing
+func (s *Scheduler) States(ctx context.Context) (map[string]*TaskState, error) {
+	tasks := s.sortedTasks()
+
+	names := make([]string, len(tasks))
+	for i, t := range tasks {
+		names[i] = t.name
+	}
+
+	found := []*TaskState{}
+	if err := s.coll.Find(ctx, bson.M{"_id": bson.M{"$in": names}}, nil, &found); err != nil {
+		return nil, err
+	}
+
+	states := map[string]*TaskState{}
+	for _, state := range found {
+		states[state.Name] = state
+	}
+
+	return states, nil
+}
+
+// Status meets the go-health ICheckable interface: it reports the state of
+// every task and fails when the last run of any of them failed
+func (s *Scheduler) Status() (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), stateUpdateTimeout)
+	defer cancel()
+
+	states, err := s.States(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load scheduled task states: %v", err)
+	}
+
+	failing := []string{}
+	for name, state := range states {
+		if state.LastOutcome == OUTCOME_FAILED {
+			failing = append(failing, name)
+		}
+	}
+
+	details := map[string]interface{}{
+		"leader": s.elector.IsLeader(),
+		"tasks":  states,
+	}
+
+	if len(failing) > 0 {
+		sort.Strings(failing)
+		return details, fmt.Errorf("Last run of scheduled task(s) failed: %s", strings.Join(failing, ", "))
+	}
+
+	return details, nil
+}
+
+func (s *Scheduler) sortedTasks() []*task {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := make([]*task, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, t)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].name < tasks[j].name })
+
+	return tasks
+}
+
+func validCatchUp(policy string) bool {
+	for _, p := range CATCH_UP_POLICIES {
+		if p == policy {
+			return true
+		}
+	}
+
+	return false
+}
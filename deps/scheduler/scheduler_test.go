@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+var _ = Describe("Scheduler", func() {
+	var (
+		s    *Scheduler
+		pool *dalutil.SessionPool
+	)
+
+	noop := func(context.Context) error { return nil }
+
+	BeforeEach(func() {
+		// Not connected; every Mongo operation fails with ErrNotConnected
+		pool = dalutil.NewSessionPool(nil, "test", 1, time.Second, metrics.NewNoop())
+		s = New(pool, nil, dalutil.NewLockService(pool, nil), Opts{LeaseTTL: time.Minute}, nil)
+	})
+
+	Describe("Register", func() {
+		It("should default to the scheduler's catch-up policy", func() {
+			Expect(s.Register("a", "@hourly", noop, nil)).To(Succeed())
+			Expect(s.Register("b", "@hourly", noop, &TaskOpts{CatchUp: CATCH_UP_ALL})).To(Succeed())
+
+			Expect(s.tasks["a"].catchUp).To(Equal(CATCH_UP_SKIP))
+			Expect(s.tasks["b"].catchUp).To(Equal(CATCH_UP_ALL))
+		})
+
+		It("should reject duplicates, invalid schedules and unknown policies", func() {
+			Expect(s.Register("a", "@hourly", noop, nil)).To(Succeed())
+
+			Expect(s.Register("a", "@daily", noop, nil)).To(MatchError(ContainSubstring("duplicate")))
+			Expect(s.Register("b", "@never", noop, nil)).ToNot(Succeed())
+			Expect(s.Register("c", "@hourly", noop, &TaskOpts{CatchUp: "later"})).ToNot(Succeed())
+			Expect(s.Register("", "@hourly", noop, nil)).ToNot(Succeed())
+		})
+	})
+
+	Describe("Run", func() {
+		It("should return right away without tasks", func() {
+			Expect(s.Run(context.Background())).To(Succeed())
+		})
+
+		It("should stop campaigning once ctx is done", func() {
+			Expect(s.Register("a", "@hourly", noop, nil)).To(Succeed())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			Expect(s.Run(ctx)).To(Succeed())
+			Expect(s.elector.IsLeader()).To(BeFalse())
+		})
+	})
+
+	Describe("run", func() {
+		It("should record the outcome", func() {
+			Expect(s.Register("a", "@hourly", func(context.Context) error { return errors.New("boom") }, nil)).To(Succeed())
+
+			state := &TaskState{Name: "a"}
+			s.run(context.Background(), s.tasks["a"], state)
+
+			Expect(state.LastRunAt).ToNot(BeNil())
+			Expect(state.LastOutcome).To(Equal(OUTCOME_FAILED))
+			Expect(state.LastError).To(Equal("boom"))
+			Expect(state.Runs).To(Equal(int64(1)))
+			Expect(state.Failures).To(Equal(int64(1)))
+		})
+
+		It("should turn panics into failures and enforce the timeout", func() {
+			Expect(s.Register("a", "@hourly", func(ctx context.Context) error {
+				<-ctx.Done()
+				panic(ctx.Err())
+			}, &TaskOpts{Timeout: time.Millisecond})).To(Succeed())
+
+			state := &TaskState{Name: "a"}
+			s.run(context.Background(), s.tasks["a"], state)
+
+			Expect(state.LastOutcome).To(Equal(OUTCOME_FAILED))
+			Expect(state.LastError).To(ContainSubstring("deadline exceeded"))
+		})
+	})
+
+	Describe("plan", func() {
+		schedule, _ := ParseSchedule("@every 1h")
+		due := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+		It("should run on time runs", func() {
+			now := due.Add(MISFIRE_GRACE)
+
+			for _, policy := range CATCH_UP_POLICIES {
+				p := plan(schedule, policy, due, now)
+
+				Expect(p.run).To(BeTrue())
+				Expect(p.missed).To(Equal(0))
+				Expect(p.next(now)).To(Equal(due.Add(time.Hour)))
+			}
+		})
+
+		// 3 runs were due, at 12:00, 13:00 and 14:00
+		now := due.Add(2*time.Hour + 30*time.Minute)
+
+		It("should skip missed runs", func() {
+			p := plan(schedule, CATCH_UP_SKIP, due, now)
+
+			Expect(p.run).To(BeFalse())
+			Expect(p.missed).To(Equal(3))
+			Expect(p.next(now)).To(Equal(due.Add(3 * time.Hour)))
+		})
+
+		It("should run once for all missed runs", func() {
+			p := plan(schedule, CATCH_UP_ONCE, due, now)
+
+			Expect(p.run).To(BeTrue())
+			Expect(p.missed).To(Equal(2))
+			Expect(p.next(now)).To(Equal(due.Add(3 * time.Hour)))
+		})
+
+		It("should make up each missed run", func() {
+			p := plan(schedule, CATCH_UP_ALL, due, now)
+
+			Expect(p.run).To(BeTrue())
+			Expect(p.missed).To(Equal(0))
+			Expect(p.next(now)).To(Equal(due.Add(time.Hour)))
+		})
+
+		It("should only make up the latest MAX_CATCH_UP_RUNS runs", func() {
+			p := plan(schedule, CATCH_UP_ALL, due, due.Add((MAX_CATCH_UP_RUNS+4)*time.Hour))
+
+			Expect(p.run).To(BeTrue())
+			Expect(p.missed).To(Equal(5))
+
+			// The run made now stands for the oldest one made up
+			Expect(p.next(now)).To(Equal(due.Add(6 * time.Hour)))
+		})
+	})
+
+	Describe("Status", func() {
+		It("should fail when the task states can't be loaded", func() {
+			Expect(s.Register("a", "@hourly", noop, nil)).To(Succeed())
+
+			_, err := s.Status()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
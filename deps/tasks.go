@@ -0,0 +1,38 @@
+package deps
+
+import (
+	"context"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/deps/scheduler"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	JOBS_REPORT_TASK = "jobs.report"
+
+	// Gauge of jobs by status, emitted by JOBS_REPORT_TASK
+	JOBS_BY_STATUS_METRIC = "jobs.by_status"
+)
+
+// registerTasks is where every scheduled task gets registered
+func (d *Dependencies) registerTasks() error {
+	return d.Scheduler.Register(JOBS_REPORT_TASK, "@every 1m", d.reportJobs, &scheduler.TaskOpts{
+		Timeout: 30 * time.Second,
+	})
+}
+
+// reportJobs emits the number of jobs in each status (ie. to alert on dead
+// jobs piling up)
+func (d *Dependencies) reportJobs(ctx context.Context) error {
+	stats, err := d.Jobs.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	for status, n := range stats {
+		d.Metrics.Gauge(JOBS_BY_STATUS_METRIC, float64(n), metrics.Tags{"status": status})
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DEFAULT_REPLAY_SIZE       = 1000
+	DEFAULT_SUBSCRIBER_BUFFER = 64
+
+	// Separates the broker epoch from the sequence in Message IDs
+	messageIDSeparator = "-"
+)
+
+// Message is an event as handed to local subscribers
+type Message struct {
+	// "<epoch>-<seq>"; only meaningful to the broker that published it (see
+	// Broker.Subscribe)
+	ID    string
+	Seq   uint64
+	Topic string
+	Event *Event
+}
+
+// Topic identifies the aggregate an event is about, ie. "foo:<id>"
+func Topic(aggregateType, aggregateID string) string {
+	return aggregateType + ":" + aggregateID
+}
+
+// BrokerOpts configure a Broker; zero values fall back to the defaults
+type BrokerOpts struct {
+	ReplaySize       int // latest messages kept for resuming subscribers
+	SubscriberBuffer int // messages a subscriber may lag behind before it is dropped
+}
+
+// Broker is an in-process pub/sub of the events made by this replica: DAL
+// writes publish to it (see dalutil.Repository.WithBroker) and every
+// subscriber of a topic gets the events about it. The latest messages are
+// kept so that a subscriber can resume from the last one it saw.
+//
+// Publishing never blocks: a subscriber lagging more than SubscriberBuffer
+// messages behind is dropped (its channel is closed) and is expected to
+// resume.
+type Broker struct {
+	opts BrokerOpts
+
+	// Tells apart the messages of this broker from those of a previous run
+	// (or of another replica)
+	epoch string
+
+	mu     sync.Mutex
+	seq    uint64
+	replay []*Message // ring buffer; replay[next] is the oldest once full
+	next   int
+	subs   map[*Subscription]struct{}
+}
+
+// Subscription receives the messages of its topics on C until it is closed
+// or dropped
+type Subscription struct {
+	C <-chan *Message
+
+	c       chan *Message
+	topics  map[string]bool
+	broker  *Broker
+	dropped bool
+}
+
+func NewBroker(opts BrokerOpts) *Broker {
+	if opts.ReplaySize <= 0 {
+		opts.ReplaySize = DEFAULT_REPLAY_SIZE
+	}
+
+	if opts.SubscriberBuffer <= 0 {
+		opts.SubscriberBuffer = DEFAULT_SUBSCRIBER_BUFFER
+	}
+
+	b := make([]byte, 4)
+	rand.Read(b)
+
+	return &Broker{
+		opts:   opts,
+		epoch:  hex.EncodeToString(b),
+		replay: make([]*Message, 0, opts.ReplaySize),
+		subs:   map[*Subscription]struct{}{},
+	}
+}
+
+// Publish hands event to the subscribers of its aggregate; meets ISink
+func (b *Broker) Publish(ctx context.Context, event *Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+
+	m := &Message{
+		ID:    b.epoch + messageIDSeparator + strconv.FormatUint(b.seq, 10),
+		Seq:   b.seq,
+		Topic: Topic(event.AggregateType, event.AggregateID),
+		Event: event,
+	}
+
+	if len(b.replay) < b.opts.ReplaySize {
+		b.replay = append(b.replay, m)
+	} else {
+		b.replay[b.next] = m
+		b.next = (b.next + 1) % b.opts.ReplaySize
+	}
+
+	for sub := range b.subs {
+		if !sub.topics[m.Topic] {
+			continue
+		}
+
+		select {
+		case sub.c <- m:
+		default:
+			log.WithField("topic", m.Topic).Warn("Dropping lagging subscriber")
+
+			sub.dropped = true
+			b.remove(sub)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe subscribes to topics. With the ID of the last message seen
+// (lastID), the messages published since are returned as well; complete is
+// false if some of them are no longer kept (or lastID is from another
+// broker), in which case the subscriber should catch up some other way.
+func (b *Broker) Subscribe(topics []string, lastID string) (sub *Subscription, missed []*Message, complete bool) {
+	c := make(chan *Message, b.opts.SubscriberBuffer)
+
+	sub = &Subscription{
+		C:      c,
+		c:      c,
+		topics: map[string]bool{},
+		broker: b,
+	}
+
+	for _, t := range topics {
+		sub.topics[t] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Subscribed before the lock is released; nothing falls in between
+	b.subs[sub] = struct{}{}
+
+	if lastID == "" {
+		return sub, nil, true
+	}
+
+	after, ok := b.parseID(lastID)
+	if !ok || after > b.seq {
+		return sub, nil, false
+	}
+
+	complete = true
+
+	for i := range b.replay {
+		m := b.replay[(b.next+i)%len(b.replay)]
+
+		if i == 0 && m.Seq > after+1 {
+			complete = false
+		}
+
+		if m.Seq > after && sub.topics[m.Topic] {
+			missed = append(missed, m)
+		}
+	}
+
+	return sub, missed, complete
+}
+
+// Subscribers returns how many subscriptions are open
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subs)
+}
+
+func (b *Broker) parseID(id string) (uint64, bool) {
+	parts := strings.SplitN(id, messageIDSeparator, 2)
+	if len(parts) != 2 || parts[0] != b.epoch {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+
+	return seq, err == nil
+}
+
+// remove closes sub; b.mu must be held
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+
+	delete(b.subs, sub)
+	close(sub.c)
+}
+
+// Close unsubscribes; C is closed
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.remove(s)
+}
+
+// Dropped reports whether the subscription was closed for lagging behind
+func (s *Subscription) Dropped() bool {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	return s.dropped
+}
@@ -0,0 +1,119 @@
+package events
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Broker", func() {
+	var (
+		broker *Broker
+		ctx    = context.Background()
+		fooA   = Topic(FOO_AGGREGATE, "a")
+	)
+
+	publish := func(id string) {
+		broker.Publish(ctx, New(&FooUpdated{ID: id}, ""))
+	}
+
+	BeforeEach(func() {
+		broker = NewBroker(BrokerOpts{ReplaySize: 3, SubscriberBuffer: 2})
+	})
+
+	It("should only hand subscribers the events of their topics", func() {
+		sub, missed, complete := broker.Subscribe([]string{fooA}, "")
+		defer sub.Close()
+
+		Expect(missed).To(BeEmpty())
+		Expect(complete).To(BeTrue())
+
+		publish("b")
+		publish("a")
+
+		m := <-sub.C
+		Expect(m.Topic).To(Equal(fooA))
+		Expect(m.Event.AggregateID).To(Equal("a"))
+		Expect(sub.C).ToNot(Receive())
+	})
+
+	It("should replay the events published since the last one seen", func() {
+		first, _, _ := broker.Subscribe([]string{fooA}, "")
+		publish("a")
+
+		seen := <-first.C
+		first.Close()
+
+		publish("b")
+		publish("a")
+
+		sub, missed, complete := broker.Subscribe([]string{fooA}, seen.ID)
+		defer sub.Close()
+
+		Expect(complete).To(BeTrue())
+		Expect(missed).To(HaveLen(1))
+		Expect(missed[0].Seq).To(Equal(seen.Seq + 2))
+	})
+
+	It("should report events that are no longer kept", func() {
+		first, _, _ := broker.Subscribe([]string{fooA}, "")
+		publish("a")
+
+		seen := <-first.C
+		first.Close()
+
+		for i := 0; i < 4; i++ {
+			publish("a")
+		}
+
+		_, missed, complete := broker.Subscribe([]string{fooA}, seen.ID)
+
+		Expect(complete).To(BeFalse())
+		Expect(missed).To(HaveLen(3))
+	})
+
+	It("should not resume from the IDs of another broker", func() {
+		publish("a")
+
+		other := NewBroker(BrokerOpts{})
+		other.Publish(ctx, New(&FooUpdated{ID: "a"}, ""))
+
+		osub, _, _ := other.Subscribe([]string{fooA}, "")
+		defer osub.Close()
+		other.Publish(ctx, New(&FooUpdated{ID: "a"}, ""))
+		m := <-osub.C
+
+		_, missed, complete := broker.Subscribe([]string{fooA}, m.ID)
+
+		Expect(complete).To(BeFalse())
+		Expect(missed).To(BeEmpty())
+
+		_, _, complete = broker.Subscribe([]string{fooA}, "garbage")
+		Expect(complete).To(BeFalse())
+	})
+
+	It("should drop subscribers lagging behind", func() {
+		sub, _, _ := broker.Subscribe([]string{fooA}, "")
+
+		for i := 0; i < 3; i++ {
+			publish("a")
+		}
+
+		Eventually(sub.C).Should(BeClosed())
+		Expect(sub.Dropped()).To(BeTrue())
+		Expect(broker.Subscribers()).To(BeZero())
+	})
+
+	It("should close subscriptions", func() {
+		sub, _, _ := broker.Subscribe([]string{fooA}, "")
+		Expect(broker.Subscribers()).To(Equal(1))
+
+		sub.Close()
+		sub.Close()
+
+		Expect(sub.C).To(BeClosed())
+		Expect(sub.Dropped()).To(BeFalse())
+		Expect(broker.Subscribers()).To(BeZero())
+	})
+})
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"strconv"
+)
+
+const (
+	FOO_CREATED = "foo.created"
+	FOO_UPDATED = "foo.updated"
+	FOO_DELETED = "foo.deleted"
+	BAR_FETCHED = "bar.fetched"
+
+	FOO_AGGREGATE = "foo"
+	BAR_AGGREGATE = "bar"
+)
+
+type FooCreated struct {
+	ID    string `bson:"id" json:"id"`
+	Field string `bson:"foo_field" json:"foo_field"`
+	Value int    `bson:"value" json:"value"`
+}
+
+func (e *FooCreated) EventType() string     { return FOO_CREATED }
+func (e *FooCreated) AggregateType() string { return FOO_AGGREGATE }
+func (e *FooCreated) AggregateID() string   { return e.ID }
+
+// FooUpdated carries the foo as of Version
+type FooUpdated struct {
+	ID      string `bson:"id" json:"id"`
+	Version int64  `bson:"version" json:"version"`
+	Field   string `bson:"foo_field" json:"foo_field"`
+	Value   int    `bson:"value" json:"value"`
+}
+
+func (e *FooUpdated) EventType() string     { return FOO_UPDATED }
+func (e *FooUpdated) AggregateType() string { return FOO_AGGREGATE }
+func (e *FooUpdated) AggregateID() string   { return e.ID }
+
+type FooDeleted struct {
+	ID string `bson:"id" json:"id"`
+}
+
+func (e *FooDeleted) EventType() string     { return FOO_DELETED }
+func (e *FooDeleted) AggregateType() string { return FOO_AGGREGATE }
+func (e *FooDeleted) AggregateID() string   { return e.ID }
+
+// BarFetched is published (to streams only) whenever a bar is read from the
+// foo API
+type BarFetched struct {
+	ID    int `bson:"id" json:"id"`
+	Value int `bson:"value" json:"value"`
+}
+
+func (e *BarFetched) EventType() string     { return BAR_FETCHED }
+func (e *BarFetched) AggregateType() string { return BAR_AGGREGATE }
+func (e *BarFetched) AggregateID() string   { return strconv.Itoa(e.ID) }
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var log = logrus.WithField("pkg", "events")
+
+const (
+	// Delivery status of outbox records
+	STATUS_PENDING   = "pending"
+	STATUS_PUBLISHED = "published"
+	STATUS_DEAD      = "dead" // out of attempts; see IOutbox.Retry
+)
+
+// IEvent is implemented by every typed domain event (see domain.go)
+type IEvent interface {
+	// ie. "foo.created"
+	EventType() string
+	// The entity the event is about; events of the same aggregate are
+	// published in the order they were recorded
+	AggregateType() string
+	AggregateID() string
+}
+
+// Event is the envelope domain events are stored in and published as
+type Event struct {
+	ID            bson.ObjectId `bson:"_id" json:"id"`
+	Type          string        `bson:"type" json:"type"`
+	AggregateType string        `bson:"aggregate_type" json:"aggregate_type"`
+	AggregateID   string        `bson:"aggregate_id" json:"aggregate_id"`
+
+	// Increases with every event of the aggregate; assigned once the event
+	// reaches the outbox collection
+	Sequence int64 `bson:"sequence" json:"sequence"`
+
+	OccurredAt time.Time   `bson:"occurred_at" json:"occurred_at"`
+	Actor      string      `bson:"actor,omitempty" json:"actor,omitempty"`
+	Payload    interface{} `bson:"payload" json:"payload"`
+}
+
+// New wraps e in an envelope with a fresh ID
+func New(e IEvent, actor string) *Event {
+	return &Event{
+		ID:            bson.NewObjectId(),
+		Type:          e.EventType(),
+		AggregateType: e.AggregateType(),
+		AggregateID:   e.AggregateID(),
+		OccurredAt:    time.Now().UTC(),
+		Actor:         actor,
+		Payload:       e,
+	}
+}
+
+// DecodePayload unmarshals the payload of an event read back from the
+// outbox into v (a pointer to the typed event)
+func (e *Event) DecodePayload(v interface{}) error {
+	raw, err := bson.Marshal(bson.M{"p": e.Payload})
+	if err != nil {
+		return err
+	}
+
+	holder := struct {
+		P bson.Raw `bson:"p"`
+	}{}
+
+	if err := bson.Unmarshal(raw, &holder); err != nil {
+		return err
+	}
+
+	return holder.P.Unmarshal(v)
+}
+
+// Record is an event stored in the outbox collection along with the state
+// of its delivery
+type Record struct {
+	Event `bson:",inline"`
+
+	Status        string     `bson:"status" json:"status"`
+	Attempts      int        `bson:"attempts" json:"attempts"`
+	LastError     string     `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `bson:"next_attempt_at" json:"next_attempt_at"`
+	PublishedAt   *time.Time `bson:"published_at,omitempty" json:"published_at,omitempty"`
+}
+
+//go:generate counterfeiter -o ../fakes/eventoutbox/outbox.go . IOutbox
+
+// IOutbox is where the relay takes events from (see dalutil.Outbox)
+type IOutbox interface {
+	// Drain moves events recorded along with DAL writes into the outbox
+	// collection; returns how many were moved
+	Drain(ctx context.Context) (int, error)
+	// Heads returns the oldest pending record of (up to limit) aggregates
+	Heads(ctx context.Context, limit int) ([]*Record, error)
+	Published(ctx context.Context, id bson.ObjectId) error
+	// Failed records a failed attempt; the record is retried at retryAt or,
+	// if dead, moved to the dead letter status
+	Failed(ctx context.Context, id bson.ObjectId, attempts int, cause error, retryAt time.Time, dead bool) error
+
+	// Dead lists dead records, newest first
+	Dead(ctx context.Context, limit int) ([]*Record, error)
+	// Retry makes a dead record pending again
+	Retry(ctx context.Context, id string) error
+}
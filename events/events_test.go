@@ -0,0 +1,41 @@
+package events
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Events", func() {
+	Describe("New", func() {
+		It("should wrap the event in an envelope", func() {
+			ev := New(&FooCreated{ID: "5bc9d3d2e138230001a4b1c2", Field: "f", Value: 1}, "jane")
+
+			Expect(ev.ID.Valid()).To(BeTrue())
+			Expect(ev.Type).To(Equal(FOO_CREATED))
+			Expect(ev.AggregateType).To(Equal(FOO_AGGREGATE))
+			Expect(ev.AggregateID).To(Equal("5bc9d3d2e138230001a4b1c2"))
+			Expect(ev.Actor).To(Equal("jane"))
+			Expect(ev.OccurredAt.IsZero()).To(BeFalse())
+		})
+
+		It("should identify bars by their numeric ID", func() {
+			Expect(New(&BarFetched{ID: 42}, "").AggregateID).To(Equal("42"))
+		})
+	})
+
+	Describe("DecodePayload", func() {
+		It("should decode the payload of an event read back from Mongo", func() {
+			raw, err := bson.Marshal(New(&FooUpdated{ID: "x", Version: 3, Field: "f", Value: 7}, ""))
+			Expect(err).ToNot(HaveOccurred())
+
+			ev := &Event{}
+			Expect(bson.Unmarshal(raw, ev)).To(Succeed())
+
+			payload := &FooUpdated{}
+			Expect(ev.DecodePayload(payload)).To(Succeed())
+			Expect(payload).To(Equal(&FooUpdated{ID: "x", Version: 3, Field: "f", Value: 7}))
+		})
+	})
+})
@@ -0,0 +1,183 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	EVENTS_PUBLISHED_METRIC = "events.published"
+
+	// Name of the lock held by the replica running the relay
+	RELAY_ELECTION_NAME = "events-relay"
+
+	DEFAULT_RELAY_POLL_INTERVAL = time.Second
+	DEFAULT_RELAY_BATCH_SIZE    = 100
+	DEFAULT_RELAY_MAX_ATTEMPTS  = 10
+
+	// Retries back off exponentially between these
+	RELAY_RETRY_MIN_BACKOFF = 5 * time.Second
+	RELAY_RETRY_MAX_BACKOFF = 30 * time.Minute
+
+	outcomePublished = "published"
+	outcomeFailed    = "failed"
+	outcomeDead      = "dead"
+
+	relayPublishTimeout = 30 * time.Second
+)
+
+// RelayOpts configure a Relay; zero values fall back to the defaults
+type RelayOpts struct {
+	PollInterval time.Duration
+	BatchSize    int // aggregates handled per poll
+	MaxAttempts  int // before an event is dead lettered
+}
+
+// Relay publishes the events of the outbox to a sink, in order per
+// aggregate: an aggregate's next event is only published once the previous
+// one was (or was dead lettered). Run a single relay at a time (ie. under
+// the RELAY_ELECTION_NAME election).
+type Relay struct {
+	outbox  IOutbox
+	sink    ISink
+	opts    RelayOpts
+	metrics metrics.IMetrics
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+func NewRelay(outbox IOutbox, sink ISink, opts RelayOpts, m metrics.IMetrics) *Relay {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DEFAULT_RELAY_POLL_INTERVAL
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DEFAULT_RELAY_BATCH_SIZE
+	}
+
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DEFAULT_RELAY_MAX_ATTEMPTS
+	}
+
+	if m == nil {
+		m = metrics.NewNoop()
+	}
+
+	return &Relay{
+		outbox:  outbox,
+		sink:    sink,
+		opts:    opts,
+		metrics: m,
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run relays events until ctx is done
+func (r *Relay) Run(ctx context.Context) error {
+	log.Info("Relaying events")
+
+	for ctx.Err() == nil {
+		published, err := r.Relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.WithError(err).Error("Unable to relay events")
+		}
+
+		// Keep going while there is a backlog
+		if published > 0 {
+			continue
+		}
+
+		select {
+		case <-time.After(r.opts.PollInterval):
+		case <-ctx.Done():
+		}
+	}
+
+	return nil
+}
+
+// Relay makes one pass over the outbox; returns how many events were
+// published
+func (r *Relay) Relay(ctx context.Context) (int, error) {
+	if _, err := r.outbox.Drain(ctx); err != nil {
+		return 0, err
+	}
+
+	heads, err := r.outbox.Heads(ctx, r.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+
+	for _, rec := range heads {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Backing off; the aggregate's later events wait as well
+		if rec.NextAttemptAt.After(r.now()) {
+			continue
+		}
+
+		if r.publish(ctx, rec) {
+			published++
+		}
+	}
+
+	return published, nil
+}
+
+func (r *Relay) publish(ctx context.Context, rec *Record) bool {
+	llog := log.WithField("event_id", rec.ID.Hex()).WithField("type", rec.Type).WithField("aggregate_id", rec.AggregateID)
+
+	pctx, cancel := context.WithTimeout(ctx, relayPublishTimeout)
+	err := r.sink.Publish(pctx, &rec.Event)
+	cancel()
+
+	outcome := outcomePublished
+
+	if err == nil {
+		err = r.outbox.Published(ctx, rec.ID)
+	} else {
+		attempts := rec.Attempts + 1
+		dead := attempts >= r.opts.MaxAttempts
+
+		outcome = outcomeFailed
+		if dead {
+			outcome = outcomeDead
+			llog.WithError(err).Errorf("Unable to publish event after %d attempts; dead lettering it", attempts)
+		} else {
+			llog.WithError(err).Warn("Unable to publish event; retrying")
+		}
+
+		err = r.outbox.Failed(ctx, rec.ID, attempts, err, r.now().Add(Backoff(attempts)), dead)
+	}
+
+	r.metrics.Inc(EVENTS_PUBLISHED_METRIC, 1, metrics.Tags{"type": rec.Type, "outcome": outcome})
+
+	if err != nil {
+		llog.WithError(err).Error("Unable to record event delivery")
+		return false
+	}
+
+	return outcome == outcomePublished
+}
+
+// Backoff returns the delay before retrying after the given (1-based) attempt
+func Backoff(attempt int) time.Duration {
+	d := RELAY_RETRY_MIN_BACKOFF
+
+	for i := 1; i < attempt && d < RELAY_RETRY_MAX_BACKOFF; i++ {
+		d *= 2
+	}
+
+	if d > RELAY_RETRY_MAX_BACKOFF {
+		d = RELAY_RETRY_MAX_BACKOFF
+	}
+
+	return d
+}
@@ -0,0 +1,138 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/events"
+	"github.com/dfraglabs/go-microservice-1/fakes/eventoutbox"
+)
+
+var _ = Describe("Relay", func() {
+	var (
+		outbox *eventoutbox.FakeIOutbox
+		sink   *events.MemorySink
+		relay  *events.Relay
+	)
+
+	record := func(e events.IEvent, attempts int) *events.Record {
+		return &events.Record{Event: *events.New(e, ""), Status: events.STATUS_PENDING, Attempts: attempts}
+	}
+
+	BeforeEach(func() {
+		outbox = &eventoutbox.FakeIOutbox{}
+		sink = events.NewMemorySink()
+		relay = events.NewRelay(outbox, sink, events.RelayOpts{MaxAttempts: 3}, nil)
+	})
+
+	Describe("Relay", func() {
+		It("should drain the outbox and publish the head of every aggregate", func() {
+			a, b := record(&events.FooCreated{ID: "a"}, 0), record(&events.FooCreated{ID: "b"}, 0)
+			outbox.HeadsReturns([]*events.Record{a, b}, nil)
+
+			published, err := relay.Relay(context.Background())
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(published).To(Equal(2))
+			Expect(outbox.DrainCallCount()).To(Equal(1))
+			Expect(sink.Events()).To(HaveLen(2))
+
+			Expect(outbox.PublishedCallCount()).To(Equal(2))
+			_, id := outbox.PublishedArgsForCall(0)
+			Expect(id).To(Equal(a.ID))
+		})
+
+		It("should skip aggregates that are backing off", func() {
+			rec := record(&events.FooCreated{ID: "a"}, 1)
+			rec.NextAttemptAt = time.Now().Add(time.Hour)
+			outbox.HeadsReturns([]*events.Record{rec}, nil)
+
+			published, err := relay.Relay(context.Background())
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(published).To(Equal(0))
+			Expect(sink.Events()).To(BeEmpty())
+		})
+
+		It("should schedule a retry when publishing fails", func() {
+			sink.Fail = func(*events.Event) error { return errors.New("unavailable") }
+			rec := record(&events.FooCreated{ID: "a"}, 0)
+			outbox.HeadsReturns([]*events.Record{rec}, nil)
+
+			published, err := relay.Relay(context.Background())
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(published).To(Equal(0))
+			Expect(outbox.FailedCallCount()).To(Equal(1))
+
+			_, id, attempts, cause, retryAt, dead := outbox.FailedArgsForCall(0)
+			Expect(id).To(Equal(rec.ID))
+			Expect(attempts).To(Equal(1))
+			Expect(cause).To(MatchError("unavailable"))
+			Expect(retryAt).To(BeTemporally("~", time.Now().Add(events.RELAY_RETRY_MIN_BACKOFF), time.Second))
+			Expect(dead).To(BeFalse())
+		})
+
+		It("should dead letter an event out of attempts", func() {
+			sink.Fail = func(*events.Event) error { return errors.New("unavailable") }
+			outbox.HeadsReturns([]*events.Record{record(&events.FooCreated{ID: "a"}, 2)}, nil)
+
+			_, err := relay.Relay(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+
+			_, _, attempts, _, _, dead := outbox.FailedArgsForCall(0)
+			Expect(attempts).To(Equal(3))
+			Expect(dead).To(BeTrue())
+		})
+
+		It("should not count events whose delivery could not be recorded", func() {
+			outbox.HeadsReturns([]*events.Record{record(&events.FooCreated{ID: "a"}, 0)}, nil)
+			outbox.PublishedReturns(errors.New("mongo is down"))
+
+			published, err := relay.Relay(context.Background())
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(published).To(Equal(0))
+		})
+
+		It("should stop if the outbox cannot be drained", func() {
+			outbox.DrainReturns(0, errors.New("mongo is down"))
+
+			_, err := relay.Relay(context.Background())
+
+			Expect(err).To(HaveOccurred())
+			Expect(outbox.HeadsCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("Run", func() {
+		It("should relay until ctx is done", func() {
+			relay = events.NewRelay(outbox, sink, events.RelayOpts{PollInterval: time.Millisecond}, nil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+
+			outbox.HeadsStub = func(context.Context, int) ([]*events.Record, error) {
+				if outbox.HeadsCallCount() >= 3 {
+					cancel()
+				}
+
+				return nil, nil
+			}
+
+			Expect(relay.Run(ctx)).To(Succeed())
+			Expect(outbox.HeadsCallCount()).To(BeNumerically(">=", 3))
+		})
+	})
+
+	Describe("Backoff", func() {
+		It("should double up to the maximum", func() {
+			Expect(events.Backoff(1)).To(Equal(events.RELAY_RETRY_MIN_BACKOFF))
+			Expect(events.Backoff(2)).To(Equal(2 * events.RELAY_RETRY_MIN_BACKOFF))
+			Expect(events.Backoff(100)).To(Equal(events.RELAY_RETRY_MAX_BACKOFF))
+		})
+	})
+})
@@ -0,0 +1,233 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+const (
+	SINK_NONE = "none"
+	SINK_HTTP = "http"
+	SINK_SNS  = "sns"
+	SINK_FILE = "file"
+
+	EVENT_ID_HEADER   = "X-Event-Id"
+	EVENT_TYPE_HEADER = "X-Event-Type"
+
+	sinkHTTPTimeout = 10 * time.Second
+)
+
+// ISink is where the relay publishes events to. Delivery is at-least-once:
+// consumers should dedupe on the event ID.
+type ISink interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+/*****************
+ HTTP
+*****************/
+
+// HTTPSink POSTs every event as JSON to an endpoint; any 2xx is a success
+type HTTPSink struct {
+	url        string
+	httpClient *http.Client
+}
+
+func NewHTTPSink(endpoint string) *HTTPSink {
+	return &HTTPSink{
+		url:        endpoint,
+		httpClient: &http.Client{Timeout: sinkHTTPTimeout},
+	}
+}
+
+func (h *HTTPSink) Publish(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to marshal event: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EVENT_ID_HEADER, event.ID.Hex())
+	req.Header.Set(EVENT_TYPE_HEADER, event.Type)
+
+	return post(h.httpClient, req.WithContext(ctx))
+}
+
+/*****************
+ SNS
+*****************/
+
+// SNSSink publishes every event to a topic through the SNS Publish action
+// (ie. on localstack or an SNS-compatible gateway; requests are not signed).
+// On FIFO topics the aggregate ID is the message group, preserving the
+// per-aggregate order.
+type SNSSink struct {
+	endpoint   string
+	topicARN   string
+	httpClient *http.Client
+}
+
+func NewSNSSink(endpoint, topicARN string) *SNSSink {
+	return &SNSSink{
+		endpoint:   endpoint,
+		topicARN:   topicARN,
+		httpClient: &http.Client{Timeout: sinkHTTPTimeout},
+	}
+}
+
+func (s *SNSSink) Publish(ctx context.Context, event *Event) error {
+	msg, err := json.Marshal(event)
+	if err != nil {
+		return errtype.SNSPublishErr{E: fmt.Errorf("unable to marshal event: %v", err)}
+	}
+
+	form := url.Values{
+		"Action":   {"Publish"},
+		"Version":  {"2010-03-31"},
+		"TopicArn": {s.topicARN},
+		"Message":  {string(msg)},
+
+		"MessageAttributes.entry.1.Name":              {"event_type"},
+		"MessageAttributes.entry.1.Value.DataType":    {"String"},
+		"MessageAttributes.entry.1.Value.StringValue": {event.Type},
+	}
+
+	if strings.HasSuffix(s.topicARN, ".fifo") {
+		form.Set("MessageGroupId", event.AggregateType+":"+event.AggregateID)
+		form.Set("MessageDeduplicationId", event.ID.Hex())
+	}
+
+	req, err := http.NewRequest("POST", s.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return errtype.SNSPublishErr{E: err}
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if err := post(s.httpClient, req.WithContext(ctx)); err != nil {
+		return errtype.SNSPublishErr{E: err}
+	}
+
+	return nil
+}
+
+func post(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+/*****************
+ JSON lines
+*****************/
+
+// JSONSink writes every event as a single JSON document per line (ie. to a
+// local file)
+type JSONSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (j *JSONSink) Publish(ctx context.Context, event *Event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.enc.Encode(event)
+}
+
+/*****************
+ Multi
+*****************/
+
+// MultiSink publishes every event to each of its sinks; it fails if any of
+// them does, in which case the event is published again to all of them
+type MultiSink struct {
+	sinks []ISink
+}
+
+func NewMultiSink(sinks ...ISink) *MultiSink {
+	return &MultiSink{
+		sinks: sinks,
+	}
+}
+
+func (m *MultiSink) Publish(ctx context.Context, event *Event) error {
+	for _, s := range m.sinks {
+		if err := s.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*****************
+ In-memory
+*****************/
+
+// MemorySink keeps published events around; meant for tests
+type MemorySink struct {
+	// Optional; its error fails the publish
+	Fail func(event *Event) error
+
+	mu     sync.Mutex
+	events []*Event
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (m *MemorySink) Publish(ctx context.Context, event *Event) error {
+	if m.Fail != nil {
+		if err := m.Fail(event); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, event)
+
+	return nil
+}
+
+// Events returns the events published so far
+func (m *MemorySink) Events() []*Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*Event{}, m.events...)
+}
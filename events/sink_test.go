@@ -0,0 +1,134 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/util/errtype"
+)
+
+var _ = Describe("Sinks", func() {
+	var (
+		ev       *Event
+		server   *httptest.Server
+		status   int
+		received *http.Request
+		body     []byte
+	)
+
+	BeforeEach(func() {
+		ev = New(&FooDeleted{ID: "5bc9d3d2e138230001a4b1c2"}, "jane")
+		status = http.StatusOK
+
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			received = r
+			body, _ = ioutil.ReadAll(r.Body)
+			rw.WriteHeader(status)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("HTTPSink", func() {
+		It("should POST the event as JSON", func() {
+			Expect(NewHTTPSink(server.URL).Publish(context.Background(), ev)).To(Succeed())
+
+			Expect(received.Method).To(Equal("POST"))
+			Expect(received.Header.Get(EVENT_ID_HEADER)).To(Equal(ev.ID.Hex()))
+			Expect(received.Header.Get(EVENT_TYPE_HEADER)).To(Equal(FOO_DELETED))
+
+			got := map[string]interface{}{}
+			Expect(json.Unmarshal(body, &got)).To(Succeed())
+			Expect(got["aggregate_id"]).To(Equal("5bc9d3d2e138230001a4b1c2"))
+		})
+
+		It("should fail on a non 2xx response", func() {
+			status = http.StatusBadGateway
+
+			Expect(NewHTTPSink(server.URL).Publish(context.Background(), ev)).To(MatchError(ContainSubstring("502")))
+		})
+	})
+
+	Describe("SNSSink", func() {
+		It("should publish the event to the topic", func() {
+			Expect(NewSNSSink(server.URL, "arn:aws:sns:us-east-1:000000000000:events").Publish(context.Background(), ev)).To(Succeed())
+
+			form, err := url.ParseQuery(string(body))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(form.Get("Action")).To(Equal("Publish"))
+			Expect(form.Get("TopicArn")).To(Equal("arn:aws:sns:us-east-1:000000000000:events"))
+			Expect(form.Get("Message")).To(ContainSubstring(ev.ID.Hex()))
+			Expect(form.Get("MessageGroupId")).To(BeEmpty())
+		})
+
+		It("should group messages by aggregate on FIFO topics", func() {
+			Expect(NewSNSSink(server.URL, "arn:aws:sns:us-east-1:000000000000:events.fifo").Publish(context.Background(), ev)).To(Succeed())
+
+			form, err := url.ParseQuery(string(body))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(form.Get("MessageGroupId")).To(Equal("foo:5bc9d3d2e138230001a4b1c2"))
+			Expect(form.Get("MessageDeduplicationId")).To(Equal(ev.ID.Hex()))
+		})
+
+		It("should return an SNSPublishErr on failure", func() {
+			status = http.StatusForbidden
+
+			err := NewSNSSink(server.URL, "arn").Publish(context.Background(), ev)
+			Expect(err).To(BeAssignableToTypeOf(errtype.SNSPublishErr{}))
+		})
+	})
+
+	Describe("JSONSink", func() {
+		It("should write one event per line", func() {
+			buf := &bytes.Buffer{}
+			sink := NewJSONSink(buf)
+
+			Expect(sink.Publish(context.Background(), ev)).To(Succeed())
+			Expect(sink.Publish(context.Background(), ev)).To(Succeed())
+
+			Expect(bytes.Count(buf.Bytes(), []byte("\n"))).To(Equal(2))
+		})
+	})
+
+	Describe("MultiSink", func() {
+		It("should publish to every sink until one fails", func() {
+			a, b, c := NewMemorySink(), NewMemorySink(), NewMemorySink()
+			b.Fail = func(*Event) error { return errors.New("nope") }
+
+			Expect(NewMultiSink(a, b, c).Publish(context.Background(), ev)).To(MatchError("nope"))
+
+			Expect(a.Events()).To(HaveLen(1))
+			Expect(c.Events()).To(BeEmpty())
+		})
+	})
+
+	Describe("MemorySink", func() {
+		It("should keep the events that were not failed", func() {
+			sink := NewMemorySink()
+			sink.Fail = func(e *Event) error {
+				if e.Type == FOO_DELETED {
+					return errors.New("nope")
+				}
+
+				return nil
+			}
+
+			Expect(sink.Publish(context.Background(), ev)).ToNot(Succeed())
+			Expect(sink.Publish(context.Background(), New(&FooCreated{ID: "x"}, ""))).To(Succeed())
+
+			Expect(sink.Events()).To(HaveLen(1))
+			Expect(sink.Events()[0].Type).To(Equal(FOO_CREATED))
+		})
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"context"
 	"sync"
 
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
 	"github.com/dfraglabs/go-microservice-1/dal/foo"
 	"github.com/dfraglabs/go-microservice-1/dal/foo/types"
 )
@@ -24,6 +25,106 @@ type FakeIDAL struct {
 		result1 *types.Bar
 		result2 error
 	}
+	CreateFooStub        func(ctx context.Context, foo *types.Foo) error
+	createFooMutex       sync.RWMutex
+	createFooArgsForCall []struct {
+		ctx context.Context
+		foo *types.Foo
+	}
+	createFooReturns struct {
+		result1 error
+	}
+	createFooReturnsOnCall map[int]struct {
+		result1 error
+	}
+	GetFooStub        func(ctx context.Context, id string) (*types.Foo, error)
+	getFooMutex       sync.RWMutex
+	getFooArgsForCall []struct {
+		ctx context.Context
+		id  string
+	}
+	getFooReturns struct {
+		result1 *types.Foo
+		result2 error
+	}
+	getFooReturnsOnCall map[int]struct {
+		result1 *types.Foo
+		result2 error
+	}
+	UpdateFooStub        func(ctx context.Context, foo *types.Foo) error
+	updateFooMutex       sync.RWMutex
+	updateFooArgsForCall []struct {
+		ctx context.Context
+		foo *types.Foo
+	}
+	updateFooReturns struct {
+		result1 error
+	}
+	updateFooReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ListFoosStub        func(ctx context.Context, q *dalutil.Query, codec *dalutil.CursorCodec) ([]*types.Foo, *dalutil.PageInfo, error)
+	listFoosMutex       sync.RWMutex
+	listFoosArgsForCall []struct {
+		ctx   context.Context
+		q     *dalutil.Query
+		codec *dalutil.CursorCodec
+	}
+	listFoosReturns struct {
+		result1 []*types.Foo
+		result2 *dalutil.PageInfo
+		result3 error
+	}
+	listFoosReturnsOnCall map[int]struct {
+		result1 []*types.Foo
+		result2 *dalutil.PageInfo
+		result3 error
+	}
+	DeleteFooStub        func(ctx context.Context, id string) error
+	deleteFooMutex       sync.RWMutex
+	deleteFooArgsForCall []struct {
+		ctx context.Context
+		id  string
+	}
+	deleteFooReturns struct {
+		result1 error
+	}
+	deleteFooReturnsOnCall map[int]struct {
+		result1 error
+	}
+	FooHistoryStub        func(ctx context.Context, id string, q *dalutil.Query, codec *dalutil.CursorCodec) ([]*dalutil.AuditEntry, *dalutil.PageInfo, error)
+	fooHistoryMutex       sync.RWMutex
+	fooHistoryArgsForCall []struct {
+		ctx   context.Context
+		id    string
+		q     *dalutil.Query
+		codec *dalutil.CursorCodec
+	}
+	fooHistoryReturns struct {
+		result1 []*dalutil.AuditEntry
+		result2 *dalutil.PageInfo
+		result3 error
+	}
+	fooHistoryReturnsOnCall map[int]struct {
+		result1 []*dalutil.AuditEntry
+		result2 *dalutil.PageInfo
+		result3 error
+	}
+	RestoreFooStub        func(ctx context.Context, id string, version int64) (*types.Foo, error)
+	restoreFooMutex       sync.RWMutex
+	restoreFooArgsForCall []struct {
+		ctx     context.Context
+		id      string
+		version int64
+	}
+	restoreFooReturns struct {
+		result1 *types.Foo
+		result2 error
+	}
+	restoreFooReturnsOnCall map[int]struct {
+		result1 *types.Foo
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -80,11 +181,390 @@ func (fake *FakeIDAL) GetBarReturnsOnCall(i int, result1 *types.Bar, result2 err
 	}{result1, result2}
 }
 
+func (fake *FakeIDAL) CreateFoo(ctx context.Context, foo *types.Foo) error {
+	fake.createFooMutex.Lock()
+	ret, specificReturn := fake.createFooReturnsOnCall[len(fake.createFooArgsForCall)]
+	fake.createFooArgsForCall = append(fake.createFooArgsForCall, struct {
+		ctx context.Context
+		foo *types.Foo
+	}{ctx, foo})
+	fake.recordInvocation("CreateFoo", []interface{}{ctx, foo})
+	fake.createFooMutex.Unlock()
+	if fake.CreateFooStub != nil {
+		return fake.CreateFooStub(ctx, foo)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.createFooReturns.result1
+}
+
+func (fake *FakeIDAL) CreateFooCallCount() int {
+	fake.createFooMutex.RLock()
+	defer fake.createFooMutex.RUnlock()
+	return len(fake.createFooArgsForCall)
+}
+
+func (fake *FakeIDAL) CreateFooArgsForCall(i int) (context.Context, *types.Foo) {
+	fake.createFooMutex.RLock()
+	defer fake.createFooMutex.RUnlock()
+	return fake.createFooArgsForCall[i].ctx, fake.createFooArgsForCall[i].foo
+}
+
+func (fake *FakeIDAL) CreateFooReturns(result1 error) {
+	fake.CreateFooStub = nil
+	fake.createFooReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeIDAL) CreateFooReturnsOnCall(i int, result1 error) {
+	fake.CreateFooStub = nil
+	if fake.createFooReturnsOnCall == nil {
+		fake.createFooReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.createFooReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeIDAL) GetFoo(ctx context.Context, id string) (*types.Foo, error) {
+	fake.getFooMutex.Lock()
+	ret, specificReturn := fake.getFooReturnsOnCall[len(fake.getFooArgsForCall)]
+	fake.getFooArgsForCall = append(fake.getFooArgsForCall, struct {
+		ctx context.Context
+		id  string
+	}{ctx, id})
+	fake.recordInvocation("GetFoo", []interface{}{ctx, id})
+	fake.getFooMutex.Unlock()
+	if fake.GetFooStub != nil {
+		return fake.GetFooStub(ctx, id)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.getFooReturns.result1, fake.getFooReturns.result2
+}
+
+func (fake *FakeIDAL) GetFooCallCount() int {
+	fake.getFooMutex.RLock()
+	defer fake.getFooMutex.RUnlock()
+	return len(fake.getFooArgsForCall)
+}
+
+func (fake *FakeIDAL) GetFooArgsForCall(i int) (context.Context, string) {
+	fake.getFooMutex.RLock()
+	defer fake.getFooMutex.RUnlock()
+	return fake.getFooArgsForCall[i].ctx, fake.getFooArgsForCall[i].id
+}
+
+func (fake *FakeIDAL) GetFooReturns(result1 *types.Foo, result2 error) {
+	fake.GetFooStub = nil
+	fake.getFooReturns = struct {
+		result1 *types.Foo
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeIDAL) GetFooReturnsOnCall(i int, result1 *types.Foo, result2 error) {
+	fake.GetFooStub = nil
+	if fake.getFooReturnsOnCall == nil {
+		fake.getFooReturnsOnCall = make(map[int]struct {
+			result1 *types.Foo
+			result2 error
+		})
+	}
+	fake.getFooReturnsOnCall[i] = struct {
+		result1 *types.Foo
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeIDAL) UpdateFoo(ctx context.Context, foo *types.Foo) error {
+	fake.updateFooMutex.Lock()
+	ret, specificReturn := fake.updateFooReturnsOnCall[len(fake.updateFooArgsForCall)]
+	fake.updateFooArgsForCall = append(fake.updateFooArgsForCall, struct {
+		ctx context.Context
+		foo *types.Foo
+	}{ctx, foo})
+	fake.recordInvocation("UpdateFoo", []interface{}{ctx, foo})
+	fake.updateFooMutex.Unlock()
+	if fake.UpdateFooStub != nil {
+		return fake.UpdateFooStub(ctx, foo)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.updateFooReturns.result1
+}
+
+func (fake *FakeIDAL) UpdateFooCallCount() int {
+	fake.updateFooMutex.RLock()
+	defer fake.updateFooMutex.RUnlock()
+	return len(fake.updateFooArgsForCall)
+}
+
+func (fake *FakeIDAL) UpdateFooArgsForCall(i int) (context.Context, *types.Foo) {
+	fake.updateFooMutex.RLock()
+	defer fake.updateFooMutex.RUnlock()
+	return fake.updateFooArgsForCall[i].ctx, fake.updateFooArgsForCall[i].foo
+}
+
+func (fake *FakeIDAL) UpdateFooReturns(result1 error) {
+	fake.UpdateFooStub = nil
+	fake.updateFooReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeIDAL) UpdateFooReturnsOnCall(i int, result1 error) {
+	fake.UpdateFooStub = nil
+	if fake.updateFooReturnsOnCall == nil {
+		fake.updateFooReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.updateFooReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeIDAL) ListFoos(ctx context.Context, q *dalutil.Query, codec *dalutil.CursorCodec) ([]*types.Foo, *dalutil.PageInfo, error) {
+	fake.listFoosMutex.Lock()
+	ret, specificReturn := fake.listFoosReturnsOnCall[len(fake.listFoosArgsForCall)]
+	fake.listFoosArgsForCall = append(fake.listFoosArgsForCall, struct {
+		ctx   context.Context
+		q     *dalutil.Query
+		codec *dalutil.CursorCodec
+	}{ctx, q, codec})
+	fake.recordInvocation("ListFoos", []interface{}{ctx, q, codec})
+	fake.listFoosMutex.Unlock()
+	if fake.ListFoosStub != nil {
+		return fake.ListFoosStub(ctx, q, codec)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fake.listFoosReturns.result1, fake.listFoosReturns.result2, fake.listFoosReturns.result3
+}
+
+func (fake *FakeIDAL) ListFoosCallCount() int {
+	fake.listFoosMutex.RLock()
+	defer fake.listFoosMutex.RUnlock()
+	return len(fake.listFoosArgsForCall)
+}
+
+func (fake *FakeIDAL) ListFoosArgsForCall(i int) (context.Context, *dalutil.Query, *dalutil.CursorCodec) {
+	fake.listFoosMutex.RLock()
+	defer fake.listFoosMutex.RUnlock()
+	return fake.listFoosArgsForCall[i].ctx, fake.listFoosArgsForCall[i].q, fake.listFoosArgsForCall[i].codec
+}
+
+func (fake *FakeIDAL) ListFoosReturns(result1 []*types.Foo, result2 *dalutil.PageInfo, result3 error) {
+	fake.ListFoosStub = nil
+	fake.listFoosReturns = struct {
+		result1 []*types.Foo
+		result2 *dalutil.PageInfo
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeIDAL) ListFoosReturnsOnCall(i int, result1 []*types.Foo, result2 *dalutil.PageInfo, result3 error) {
+	fake.ListFoosStub = nil
+	if fake.listFoosReturnsOnCall == nil {
+		fake.listFoosReturnsOnCall = make(map[int]struct {
+			result1 []*types.Foo
+			result2 *dalutil.PageInfo
+			result3 error
+		})
+	}
+	fake.listFoosReturnsOnCall[i] = struct {
+		result1 []*types.Foo
+		result2 *dalutil.PageInfo
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeIDAL) DeleteFoo(ctx context.Context, id string) error {
+	fake.deleteFooMutex.Lock()
+	ret, specificReturn := fake.deleteFooReturnsOnCall[len(fake.deleteFooArgsForCall)]
+	fake.deleteFooArgsForCall = append(fake.deleteFooArgsForCall, struct {
+		ctx context.Context
+		id  string
+	}{ctx, id})
+	fake.recordInvocation("DeleteFoo", []interface{}{ctx, id})
+	fake.deleteFooMutex.Unlock()
+	if fake.DeleteFooStub != nil {
+		return fake.DeleteFooStub(ctx, id)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.deleteFooReturns.result1
+}
+
+func (fake *FakeIDAL) DeleteFooCallCount() int {
+	fake.deleteFooMutex.RLock()
+	defer fake.deleteFooMutex.RUnlock()
+	return len(fake.deleteFooArgsForCall)
+}
+
+func (fake *FakeIDAL) DeleteFooArgsForCall(i int) (context.Context, string) {
+	fake.deleteFooMutex.RLock()
+	defer fake.deleteFooMutex.RUnlock()
+	return fake.deleteFooArgsForCall[i].ctx, fake.deleteFooArgsForCall[i].id
+}
+
+func (fake *FakeIDAL) DeleteFooReturns(result1 error) {
+	fake.DeleteFooStub = nil
+	fake.deleteFooReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeIDAL) DeleteFooReturnsOnCall(i int, result1 error) {
+	fake.DeleteFooStub = nil
+	if fake.deleteFooReturnsOnCall == nil {
+		fake.deleteFooReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.deleteFooReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeIDAL) FooHistory(ctx context.Context, id string, q *dalutil.Query, codec *dalutil.CursorCodec) ([]*dalutil.AuditEntry, *dalutil.PageInfo, error) {
+	fake.fooHistoryMutex.Lock()
+	ret, specificReturn := fake.fooHistoryReturnsOnCall[len(fake.fooHistoryArgsForCall)]
+	fake.fooHistoryArgsForCall = append(fake.fooHistoryArgsForCall, struct {
+		ctx   context.Context
+		id    string
+		q     *dalutil.Query
+		codec *dalutil.CursorCodec
+	}{ctx, id, q, codec})
+	fake.recordInvocation("FooHistory", []interface{}{ctx, id, q, codec})
+	fake.fooHistoryMutex.Unlock()
+	if fake.FooHistoryStub != nil {
+		return fake.FooHistoryStub(ctx, id, q, codec)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fake.fooHistoryReturns.result1, fake.fooHistoryReturns.result2, fake.fooHistoryReturns.result3
+}
+
+func (fake *FakeIDAL) FooHistoryCallCount() int {
+	fake.fooHistoryMutex.RLock()
+	defer fake.fooHistoryMutex.RUnlock()
+	return len(fake.fooHistoryArgsForCall)
+}
+
+func (fake *FakeIDAL) FooHistoryArgsForCall(i int) (context.Context, string, *dalutil.Query, *dalutil.CursorCodec) {
+	fake.fooHistoryMutex.RLock()
+	defer fake.fooHistoryMutex.RUnlock()
+	return fake.fooHistoryArgsForCall[i].ctx, fake.fooHistoryArgsForCall[i].id, fake.fooHistoryArgsForCall[i].q, fake.fooHistoryArgsForCall[i].codec
+}
+
+func (fake *FakeIDAL) FooHistoryReturns(result1 []*dalutil.AuditEntry, result2 *dalutil.PageInfo, result3 error) {
+	fake.FooHistoryStub = nil
+	fake.fooHistoryReturns = struct {
+		result1 []*dalutil.AuditEntry
+		result2 *dalutil.PageInfo
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeIDAL) FooHistoryReturnsOnCall(i int, result1 []*dalutil.AuditEntry, result2 *dalutil.PageInfo, result3 error) {
+	fake.FooHistoryStub = nil
+	if fake.fooHistoryReturnsOnCall == nil {
+		fake.fooHistoryReturnsOnCall = make(map[int]struct {
+			result1 []*dalutil.AuditEntry
+			result2 *dalutil.PageInfo
+			result3 error
+		})
+	}
+	fake.fooHistoryReturnsOnCall[i] = struct {
+		result1 []*dalutil.AuditEntry
+		result2 *dalutil.PageInfo
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeIDAL) RestoreFoo(ctx context.Context, id string, version int64) (*types.Foo, error) {
+	fake.restoreFooMutex.Lock()
+	ret, specificReturn := fake.restoreFooReturnsOnCall[len(fake.restoreFooArgsForCall)]
+	fake.restoreFooArgsForCall = append(fake.restoreFooArgsForCall, struct {
+		ctx     context.Context
+		id      string
+		version int64
+	}{ctx, id, version})
+	fake.recordInvocation("RestoreFoo", []interface{}{ctx, id, version})
+	fake.restoreFooMutex.Unlock()
+	if fake.RestoreFooStub != nil {
+		return fake.RestoreFooStub(ctx, id, version)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.restoreFooReturns.result1, fake.restoreFooReturns.result2
+}
+
+func (fake *FakeIDAL) RestoreFooCallCount() int {
+	fake.restoreFooMutex.RLock()
+	defer fake.restoreFooMutex.RUnlock()
+	return len(fake.restoreFooArgsForCall)
+}
+
+func (fake *FakeIDAL) RestoreFooArgsForCall(i int) (context.Context, string, int64) {
+	fake.restoreFooMutex.RLock()
+	defer fake.restoreFooMutex.RUnlock()
+	return fake.restoreFooArgsForCall[i].ctx, fake.restoreFooArgsForCall[i].id, fake.restoreFooArgsForCall[i].version
+}
+
+func (fake *FakeIDAL) RestoreFooReturns(result1 *types.Foo, result2 error) {
+	fake.RestoreFooStub = nil
+	fake.restoreFooReturns = struct {
+		result1 *types.Foo
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeIDAL) RestoreFooReturnsOnCall(i int, result1 *types.Foo, result2 error) {
+	fake.RestoreFooStub = nil
+	if fake.restoreFooReturnsOnCall == nil {
+		fake.restoreFooReturnsOnCall = make(map[int]struct {
+			result1 *types.Foo
+			result2 error
+		})
+	}
+	fake.restoreFooReturnsOnCall[i] = struct {
+		result1 *types.Foo
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeIDAL) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
 	fake.getBarMutex.RLock()
 	defer fake.getBarMutex.RUnlock()
+	fake.createFooMutex.RLock()
+	defer fake.createFooMutex.RUnlock()
+	fake.getFooMutex.RLock()
+	defer fake.getFooMutex.RUnlock()
+	fake.updateFooMutex.RLock()
+	defer fake.updateFooMutex.RUnlock()
+	fake.listFoosMutex.RLock()
+	defer fake.listFoosMutex.RUnlock()
+	fake.deleteFooMutex.RLock()
+	defer fake.deleteFooMutex.RUnlock()
+	fake.fooHistoryMutex.RLock()
+	defer fake.fooHistoryMutex.RUnlock()
+	fake.restoreFooMutex.RLock()
+	defer fake.restoreFooMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/deps"
+	"github.com/dfraglabs/go-microservice-1/deps/backends"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+// Index builds on big collections can take a while
+const indexesTimeout = time.Hour
+
+// runIndexes handles the `indexes plan|apply` subcommands. Unlike startup,
+// `apply` carries out rebuilds (and drops with --drop-extra).
+func runIndexes(cfg *config.Config, cmd string) error {
+	pool, err := backends.ConnectMongo(cfg, metrics.NewNoop())
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), indexesTimeout)
+	defer cancel()
+
+	specs := deps.IndexSpecs()
+
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		coll := dalutil.NewSmartCollection(pool, name, nil)
+
+		plan, err := coll.PlanIndexes(ctx, specs[name], *indexesDropExtra)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s:\n", name)
+		for _, c := range plan.Changes {
+			fmt.Printf("  %v\n", c)
+		}
+
+		if cmd == indexesApplyCmd.FullCommand() && plan.HasChanges() {
+			if err := coll.ApplyIndexPlan(ctx, plan, true); err != nil {
+				return err
+			}
+
+			fmt.Println("  applied")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package loadshed
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// AIMD multiplies the limit by it when latency exceeds the target
+	aimdBackoffRatio = 0.9
+
+	// The gradient limit tracks the long term latency over about this many
+	// requests
+	gradientLongWindow = 600
+
+	// Latency up to this many times the long term one does not lower the
+	// gradient limit
+	gradientTolerance = 1.5
+
+	// Weight of every new gradient limit in the smoothed one
+	gradientSmoothing = 0.2
+)
+
+// ILimit computes how many requests may be in flight; calls are serialized
+// by the Limiter
+type ILimit interface {
+	Limit() int
+
+	// Observe is called with the latency of every request served and the
+	// number of requests in flight when it started
+	Observe(rtt time.Duration, inFlight int)
+}
+
+// StaticLimit never changes
+type StaticLimit struct {
+	limit int
+}
+
+func NewStaticLimit(limit int) *StaticLimit {
+	return &StaticLimit{limit: limit}
+}
+
+func (s *StaticLimit) Limit() int {
+	return s.limit
+}
+
+func (s *StaticLimit) Observe(rtt time.Duration, inFlight int) {}
+
+// Bounds of the adaptive limits; Initial is where they start
+type Bounds struct {
+	Initial int
+	Min     int
+	Max     int
+}
+
+func (b Bounds) clamp(limit float64) float64 {
+	return math.Max(float64(b.Min), math.Min(float64(b.Max), limit))
+}
+
+// AIMDLimit grows by one request for every round of requests served within
+// the latency target while the limit is in use, and backs off by
+// aimdBackoffRatio (at most once per target) when they take longer
+type AIMDLimit struct {
+	bounds Bounds
+	target time.Duration
+	limit  float64
+
+	// When the last backoff happened; latencies of the requests started
+	// before it do not back off again
+	backedOffAt time.Time
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+func NewAIMDLimit(bounds Bounds, target time.Duration) *AIMDLimit {
+	return &AIMDLimit{
+		bounds: bounds,
+		target: target,
+		limit:  bounds.clamp(float64(bounds.Initial)),
+		now:    time.Now,
+	}
+}
+
+func (a *AIMDLimit) Limit() int {
+	return int(a.limit)
+}
+
+func (a *AIMDLimit) Observe(rtt time.Duration, inFlight int) {
+	if rtt > a.target {
+		if now := a.now(); now.Sub(a.backedOffAt) >= a.target {
+			a.limit = a.bounds.clamp(a.limit * aimdBackoffRatio)
+			a.backedOffAt = now
+		}
+
+		return
+	}
+
+	// Growing a limit that is not in use says nothing about the load the
+	// service can take
+	if float64(inFlight)*2 < a.limit {
+		return
+	}
+
+	a.limit = a.bounds.clamp(a.limit + 1/a.limit)
+}
+
+// GradientLimit follows the ratio of the long term latency to the current
+// one: the limit shrinks as requests queue up (and take longer) and grows
+// by about its square root while latency holds
+type GradientLimit struct {
+	bounds  Bounds
+	limit   float64
+	longRTT float64 // ns; average of the last gradientLongWindow or so
+}
+
+func NewGradientLimit(bounds Bounds) *GradientLimit {
+	return &GradientLimit{
+		bounds: bounds,
+		limit:  bounds.clamp(float64(bounds.Initial)),
+	}
+}
+
+func (g *GradientLimit) Limit() int {
+	return int(g.limit)
+}
+
+func (g *GradientLimit) Observe(rtt time.Duration, inFlight int) {
+	short := float64(rtt)
+	if short <= 0 {
+		return
+	}
+
+	if g.longRTT == 0 {
+		g.longRTT = short
+	} else {
+		g.longRTT += (short - g.longRTT) / gradientLongWindow
+	}
+
+	// Recovering from a latency spike; let the long term latency catch up
+	// faster than its window would
+	if g.longRTT/short > 2 {
+		g.longRTT *= 0.95
+	}
+
+	if float64(inFlight)*2 < g.limit {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1, gradientTolerance*g.longRTT/short))
+	next := g.limit*gradient + math.Sqrt(g.limit)
+
+	g.limit = g.bounds.clamp(g.limit*(1-gradientSmoothing) + next*gradientSmoothing)
+}
@@ -0,0 +1,248 @@
+package loadshed
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+type Priority string
+
+const (
+	PRIORITY_CRITICAL Priority = "critical" // never queued nor shed, and not counted
+	PRIORITY_NORMAL   Priority = "normal"
+	PRIORITY_LOW      Priority = "low" // served after normal requests; only takes half the queue
+
+	LIMIT_NONE     = "none"
+	LIMIT_STATIC   = "static"
+	LIMIT_AIMD     = "aimd"
+	LIMIT_GRADIENT = "gradient"
+
+	SHED_METRIC       = "loadshed.shed"
+	LIMIT_METRIC      = "loadshed.limit"
+	QUEUE_WAIT_METRIC = "loadshed.queue_wait"
+)
+
+var (
+	ErrShed = errors.New("Server is overloaded")
+)
+
+// Opts configure a Limiter
+type Opts struct {
+	QueueSize    int           // requests that may wait for a slot; 0 sheds right away
+	QueueTimeout time.Duration // a queued request is shed after waiting this long
+}
+
+type waiter struct {
+	ready    chan struct{}
+	priority Priority
+	elem     *list.Element
+}
+
+// Limiter caps the requests in flight at what its ILimit allows. Requests
+// over it wait in a bounded queue, normal ones ahead of low ones, and are
+// shed (ErrShed) when the queue is full or they waited too long.
+type Limiter struct {
+	limit   ILimit
+	opts    Opts
+	metrics metrics.IMetrics
+
+	mu        sync.Mutex
+	inFlight  int
+	queues    map[Priority]*list.List
+	queued    int
+	lastLimit int
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+func NewLimiter(limit ILimit, opts Opts, m metrics.IMetrics) *Limiter {
+	if m == nil {
+		m = metrics.NewNoop()
+	}
+
+	return &Limiter{
+		limit:   limit,
+		opts:    opts,
+		metrics: m,
+		queues: map[Priority]*list.List{
+			PRIORITY_NORMAL: list.New(),
+			PRIORITY_LOW:    list.New(),
+		},
+		now: time.Now,
+	}
+}
+
+// Token is held by a request in flight; Release it once served
+type Token struct {
+	limiter  *Limiter
+	start    time.Time
+	inFlight int
+	counted  bool
+}
+
+// Release frees the request's slot, reporting its latency to the limit
+func (t *Token) Release() {
+	if !t.counted {
+		return
+	}
+
+	t.counted = false
+	t.limiter.release(t)
+}
+
+// Acquire waits for a slot; returns ErrShed if none frees up in time, or
+// ctx.Err() if ctx is done first
+func (l *Limiter) Acquire(ctx context.Context, priority Priority) (*Token, error) {
+	if priority == PRIORITY_CRITICAL {
+		return &Token{limiter: l}, nil
+	}
+
+	if _, ok := l.queues[priority]; !ok {
+		priority = PRIORITY_NORMAL
+	}
+
+	l.mu.Lock()
+
+	if l.inFlight < l.limit.Limit() && l.queued == 0 {
+		t := l.take()
+		l.mu.Unlock()
+
+		return t, nil
+	}
+
+	room := l.opts.QueueSize
+	if priority == PRIORITY_LOW {
+		room /= 2
+	}
+
+	if l.queued >= room {
+		l.mu.Unlock()
+		l.metrics.Inc(SHED_METRIC, 1, metrics.Tags{"priority": string(priority), "reason": "queue_full"})
+
+		return nil, ErrShed
+	}
+
+	w := &waiter{ready: make(chan struct{}), priority: priority}
+	w.elem = l.queues[priority].PushBack(w)
+	l.queued++
+
+	l.mu.Unlock()
+
+	start := l.now()
+
+	timer := time.NewTimer(l.opts.QueueTimeout)
+	defer timer.Stop()
+
+	var err error
+
+	select {
+	case <-w.ready:
+	case <-timer.C:
+		err = ErrShed
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil && l.dequeue(w) {
+		if err == ErrShed {
+			l.metrics.Inc(SHED_METRIC, 1, metrics.Tags{"priority": string(priority), "reason": "timeout"})
+		}
+
+		return nil, err
+	}
+
+	// Granted (possibly just as it timed out); see release
+	l.metrics.Timing(QUEUE_WAIT_METRIC, l.now().Sub(start), metrics.Tags{"priority": string(priority)})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.token(), nil
+}
+
+// InFlight returns how many requests hold a slot
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.inFlight
+}
+
+// Queued returns how many requests wait for a slot
+func (l *Limiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.queued
+}
+
+// Limit returns the current limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit.Limit()
+}
+
+// take counts a request in; l.mu must be held
+func (l *Limiter) take() *Token {
+	l.inFlight++
+	return l.token()
+}
+
+// token for a request already counted in; l.mu must be held
+func (l *Limiter) token() *Token {
+	return &Token{limiter: l, start: l.now(), inFlight: l.inFlight, counted: true}
+}
+
+// dequeue removes w from its queue unless it was granted a slot already
+func (l *Limiter) dequeue(w *waiter) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return false
+	default:
+	}
+
+	l.queues[w.priority].Remove(w.elem)
+	l.queued--
+
+	return true
+}
+
+func (l *Limiter) release(t *Token) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	l.limit.Observe(l.now().Sub(t.start), t.inFlight)
+
+	limit := l.limit.Limit()
+	if limit != l.lastLimit {
+		l.lastLimit = limit
+		l.metrics.Gauge(LIMIT_METRIC, float64(limit), nil)
+	}
+
+	// Slots are handed to waiters directly (counted in here), so that new
+	// requests do not jump the queue
+	for l.inFlight < limit && l.queued > 0 {
+		q := l.queues[PRIORITY_NORMAL]
+		if q.Len() == 0 {
+			q = l.queues[PRIORITY_LOW]
+		}
+
+		w := q.Remove(q.Front()).(*waiter)
+		l.queued--
+		l.inFlight++
+
+		close(w.ready)
+	}
+}
@@ -0,0 +1,241 @@
+package loadshed
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+// fakeLimit records observations
+type fakeLimit struct {
+	limit    int
+	observed []int
+}
+
+func (f *fakeLimit) Limit() int {
+	return f.limit
+}
+
+func (f *fakeLimit) Observe(rtt time.Duration, inFlight int) {
+	f.observed = append(f.observed, inFlight)
+}
+
+var _ = Describe("Limiter", func() {
+	var (
+		limit    *fakeLimit
+		recorder *metrics.Recorder
+		limiter  *Limiter
+		ctx      context.Context
+	)
+
+	BeforeEach(func() {
+		limit = &fakeLimit{limit: 2}
+		recorder = metrics.NewRecorder()
+		limiter = NewLimiter(limit, Opts{QueueSize: 2, QueueTimeout: time.Minute}, recorder)
+		ctx = context.Background()
+	})
+
+	acquire := func(p Priority) *Token {
+		t, err := limiter.Acquire(ctx, p)
+		Expect(err).ToNot(HaveOccurred())
+		return t
+	}
+
+	// queue acquires in the background; the token arrives on the channel
+	// returned once granted
+	queue := func(p Priority) <-chan *Token {
+		c := make(chan *Token, 1)
+		before := limiter.Queued()
+
+		go func() {
+			defer GinkgoRecover()
+			c <- acquire(p)
+		}()
+
+		Eventually(limiter.Queued).Should(Equal(before + 1))
+
+		return c
+	}
+
+	It("should let requests through up to the limit", func() {
+		acquire(PRIORITY_NORMAL)
+		acquire(PRIORITY_NORMAL)
+
+		Expect(limiter.InFlight()).To(Equal(2))
+	})
+
+	It("should hand freed slots to queued requests, normal ones first", func() {
+		first := acquire(PRIORITY_NORMAL)
+		second := acquire(PRIORITY_NORMAL)
+
+		low := queue(PRIORITY_LOW)
+		normal := queue(PRIORITY_NORMAL)
+
+		first.Release()
+		Eventually(normal).Should(Receive())
+		Consistently(low, 50*time.Millisecond).ShouldNot(Receive())
+
+		second.Release()
+		Eventually(low).Should(Receive())
+
+		Expect(limiter.InFlight()).To(Equal(2))
+		Expect(limit.observed).To(Equal([]int{1, 2}))
+	})
+
+	It("should shed requests once the queue is full", func() {
+		acquire(PRIORITY_NORMAL)
+		acquire(PRIORITY_NORMAL)
+		queue(PRIORITY_NORMAL)
+
+		// Low priority requests only take half the queue
+		_, err := limiter.Acquire(ctx, PRIORITY_LOW)
+		Expect(err).To(Equal(ErrShed))
+
+		queue(PRIORITY_NORMAL)
+
+		_, err = limiter.Acquire(ctx, PRIORITY_NORMAL)
+		Expect(err).To(Equal(ErrShed))
+
+		Expect(recorder.Counter(SHED_METRIC, metrics.Tags{"priority": "normal", "reason": "queue_full"})).To(Equal(int64(1)))
+		Expect(recorder.Counter(SHED_METRIC, metrics.Tags{"priority": "low", "reason": "queue_full"})).To(Equal(int64(1)))
+	})
+
+	It("should shed queued requests that waited too long", func() {
+		limiter.opts.QueueTimeout = 10 * time.Millisecond
+
+		acquire(PRIORITY_NORMAL)
+		acquire(PRIORITY_NORMAL)
+
+		_, err := limiter.Acquire(ctx, PRIORITY_NORMAL)
+		Expect(err).To(Equal(ErrShed))
+		Expect(limiter.Queued()).To(Equal(0))
+		Expect(recorder.Counter(SHED_METRIC, metrics.Tags{"priority": "normal", "reason": "timeout"})).To(Equal(int64(1)))
+	})
+
+	It("should give up when the request is canceled", func() {
+		acquire(PRIORITY_NORMAL)
+		acquire(PRIORITY_NORMAL)
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := limiter.Acquire(cctx, PRIORITY_NORMAL)
+		Expect(err).To(Equal(context.Canceled))
+		Expect(limiter.Queued()).To(Equal(0))
+	})
+
+	It("should never queue nor count critical requests", func() {
+		limiter.opts.QueueSize = 0
+
+		acquire(PRIORITY_NORMAL)
+		acquire(PRIORITY_NORMAL)
+
+		t := acquire(PRIORITY_CRITICAL)
+		Expect(limiter.InFlight()).To(Equal(2))
+
+		t.Release()
+		Expect(limiter.InFlight()).To(Equal(2))
+		Expect(limit.observed).To(BeEmpty())
+	})
+
+	It("should only release a token once", func() {
+		t := acquire(PRIORITY_NORMAL)
+
+		t.Release()
+		t.Release()
+
+		Expect(limiter.InFlight()).To(Equal(0))
+	})
+})
+
+var _ = Describe("Limits", func() {
+	var (
+		bounds = Bounds{Initial: 10, Min: 5, Max: 20}
+	)
+
+	Describe("AIMDLimit", func() {
+		var (
+			a   *AIMDLimit
+			now time.Time
+		)
+
+		BeforeEach(func() {
+			now = time.Now()
+			a = NewAIMDLimit(bounds, 100*time.Millisecond)
+			a.now = func() time.Time { return now }
+		})
+
+		It("should grow by one per round of fast requests while in use", func() {
+			n := 0
+			for a.Limit() == 10 {
+				a.Observe(10*time.Millisecond, 10)
+				n++
+			}
+
+			Expect(n).To(BeNumerically("~", 10, 1))
+			Expect(a.Limit()).To(Equal(11))
+		})
+
+		It("should not grow while mostly idle", func() {
+			for i := 0; i < 100; i++ {
+				a.Observe(10*time.Millisecond, 1)
+			}
+
+			Expect(a.Limit()).To(Equal(10))
+		})
+
+		It("should back off once per target when requests are slow", func() {
+			a.Observe(time.Second, 10)
+			a.Observe(time.Second, 10)
+			Expect(a.Limit()).To(Equal(9))
+
+			now = now.Add(100 * time.Millisecond)
+			a.Observe(time.Second, 10)
+			Expect(a.Limit()).To(Equal(8))
+
+			for i := 0; i < 100; i++ {
+				now = now.Add(time.Second)
+				a.Observe(time.Second, 10)
+			}
+
+			Expect(a.Limit()).To(Equal(5))
+		})
+	})
+
+	Describe("GradientLimit", func() {
+		It("should grow while latency holds, up to the max", func() {
+			g := NewGradientLimit(bounds)
+
+			for i := 0; i < 100; i++ {
+				g.Observe(10*time.Millisecond, 20)
+			}
+
+			Expect(g.Limit()).To(Equal(20))
+		})
+
+		It("should shrink when latency grows, down to the min", func() {
+			g := NewGradientLimit(bounds)
+
+			g.Observe(10*time.Millisecond, 10)
+
+			for i := 0; i < 100; i++ {
+				g.Observe(time.Second, 10)
+			}
+
+			Expect(g.Limit()).To(Equal(5))
+		})
+	})
+
+	Describe("StaticLimit", func() {
+		It("should not change", func() {
+			s := NewStaticLimit(7)
+			s.Observe(time.Hour, 7)
+
+			Expect(s.Limit()).To(Equal(7))
+		})
+	})
+})
@@ -9,13 +9,13 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh/terminal"
 	"gopkg.in/alecthomas/kingpin.v2"
 
-	"github.com/dfraglabs/go-microservice-1/api"
 	"github.com/dfraglabs/go-microservice-1/config"
 	"github.com/dfraglabs/go-microservice-1/deps"
 )
@@ -25,6 +25,23 @@ var (
 
 	envFile = kingpin.Flag("envfile", "Local Env file to read at startup").Short('e').Default(".env").String()
 	debug   = kingpin.Flag("debug", "Enable debug output").Short('d').Bool()
+
+	serveCmd = kingpin.Command("serve", "Run the API server (default)").Default()
+
+	migrateCmd       = kingpin.Command("migrate", "Manage schema migrations")
+	migrateUpCmd     = migrateCmd.Command("up", "Apply every pending migration")
+	migrateDownCmd   = migrateCmd.Command("down", "Revert the most recently applied migration(s)")
+	migrateDownSteps = migrateDownCmd.Flag("steps", "Number of migrations to revert").Default("1").Int()
+	migrateStatusCmd = migrateCmd.Command("status", "List migrations and whether they have been applied")
+
+	indexesCmd       = kingpin.Command("indexes", "Compare the indexes declared by the DALs with the ones in Mongo")
+	indexesPlanCmd   = indexesCmd.Command("plan", "Show the changes 'apply' would make (dry-run)")
+	indexesApplyCmd  = indexesCmd.Command("apply", "Create missing indexes and rebuild the ones whose options changed")
+	indexesDropExtra = indexesCmd.Flag("drop-extra", "Drop indexes that are not declared by any DAL").Bool()
+
+	workerCmd = kingpin.Command("worker", "Run background jobs")
+
+	command string
 )
 
 func init() {
@@ -32,7 +49,7 @@ func init() {
 	kingpin.Version(version)
 	kingpin.CommandLine.HelpFlag.Short('h')
 	kingpin.CommandLine.VersionFlag.Short('v')
-	kingpin.Parse()
+	command = kingpin.Parse()
 }
 
 func main() {
@@ -60,14 +77,55 @@ func main() {
 
 	llog = llog.WithField("environment", cfg.EnvName)
 
-	llog.Info("Launching go-microservice-1 API")
+	switch command {
+	case migrateUpCmd.FullCommand(), migrateDownCmd.FullCommand(), migrateStatusCmd.FullCommand():
+		if err := runMigrate(cfg, command); err != nil {
+			llog.WithError(err).Fatal("Migration command failed")
+		}
+
+		return
+	case indexesPlanCmd.FullCommand(), indexesApplyCmd.FullCommand():
+		if err := runIndexes(cfg, command); err != nil {
+			llog.WithError(err).Fatal("Indexes command failed")
+		}
+
+		return
+	}
 
 	d, err := deps.New(cfg)
 	if err != nil {
 		llog.WithError(err).Fatal("Could not setup dependencies")
 	}
 
-	// Start the API server
-	a := api.New(cfg, d, version)
-	llog.Fatal(a.Run())
+	// Canceled on SIGINT/SIGTERM
+	ctx, stop := shutdownContext()
+	defer stop()
+
+	// Scheduled tasks, the event relay and cache invalidations run alongside
+	// either command
+	schedulerDone := runScheduler(ctx, cfg, d)
+	relayDone := runEventRelay(ctx, d)
+	pubsubDone := runPubSub(ctx, d)
+
+	if command == workerCmd.FullCommand() {
+		llog.Info("Launching go-microservice-1 worker")
+		err = d.NewWorker(cfg).Run(ctx)
+	} else {
+		llog.Info("Launching go-microservice-1 API")
+		err = runAPI(ctx, cfg, d)
+	}
+
+	stop()
+	<-schedulerDone
+	<-relayDone
+	<-pubsubDone
+
+	// Flush any buffered spans before going away
+	d.Tracer.Shutdown(5 * time.Second)
+
+	if err != nil {
+		llog.Fatal(err)
+	}
+
+	llog.Info("Shut down")
 }
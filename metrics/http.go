@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	HTTP_REQUESTS_METRIC  = "http.requests"
+	HTTP_ERRORS_METRIC    = "http.errors"
+	HTTP_DURATION_METRIC  = "http.request.duration"
+	HTTP_IN_FLIGHT_METRIC = "http.requests.in_flight"
+
+	// Used as the route tag when the request did not go through a mux route
+	UNMATCHED_ROUTE = "unmatched"
+)
+
+// HTTPMiddleware records RED (rate, errors, duration) metrics for every
+// request, tagged with the method, the mux route *template* (ie.
+// "/v1/bars/{id}" instead of the raw path) and the status class.
+type HTTPMiddleware struct {
+	m IMetrics
+
+	mu       sync.Mutex
+	inFlight map[string]int64
+}
+
+func NewHTTPMiddleware(m IMetrics) *HTTPMiddleware {
+	return &HTTPMiddleware{
+		m:        m,
+		inFlight: map[string]int64{},
+	}
+}
+
+// Wrap must be applied to the handler registered on the route (rather than
+// the router itself) so that the matched route is available on the request.
+func (h *HTTPMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		route := RouteTemplate(r)
+		start := time.Now()
+
+		inFlightTags := Tags{"method": r.Method, "route": route}
+		h.trackInFlight(inFlightTags, 1)
+		defer h.trackInFlight(inFlightTags, -1)
+
+		sr := NewStatusRecorder(rw)
+		next.ServeHTTP(sr, r)
+
+		tags := Tags{
+			"method":       r.Method,
+			"route":        route,
+			"status_class": StatusClass(sr.Status()),
+		}
+
+		h.m.Inc(HTTP_REQUESTS_METRIC, 1, tags)
+		h.m.Timing(HTTP_DURATION_METRIC, time.Since(start), tags)
+
+		if sr.Status() >= http.StatusInternalServerError {
+			h.m.Inc(HTTP_ERRORS_METRIC, 1, tags)
+		}
+	})
+}
+
+func (h *HTTPMiddleware) trackInFlight(tags Tags, delta int64) {
+	key := tags.String()
+
+	h.mu.Lock()
+	h.inFlight[key] += delta
+	current := h.inFlight[key]
+	h.mu.Unlock()
+
+	h.m.Gauge(HTTP_IN_FLIGHT_METRIC, float64(current), tags)
+}
+
+// RouteTemplate returns the path template of the mux route matched for r
+func RouteTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return UNMATCHED_ROUTE
+	}
+
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return UNMATCHED_ROUTE
+	}
+
+	return tpl
+}
+
+// StatusClass converts a status code into its class (ie. 404 -> "4xx")
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+
+	return strconv.Itoa(status/100) + "xx"
+}
+
+/*****************
+ Status Recorder
+*****************/
+
+// StatusRecorder is a http.ResponseWriter that remembers the status code
+type StatusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func NewStatusRecorder(rw http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{
+		ResponseWriter: rw,
+	}
+}
+
+func (s *StatusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *StatusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush allows streaming handlers to keep working through the recorder
+func (s *StatusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Status returns the recorded status code (200 if nothing was written)
+func (s *StatusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+
+	return s.status
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/mux"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTPMiddleware", func() {
+	var (
+		r      *Recorder
+		mw     *HTTPMiddleware
+		router *mux.Router
+		status int
+	)
+
+	BeforeEach(func() {
+		r = NewRecorder()
+		mw = NewHTTPMiddleware(r)
+		status = http.StatusOK
+
+		router = mux.NewRouter()
+		router.Handle("/v1/bars/{id}", mw.Wrap(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(status)
+		}))).Methods("GET")
+	})
+
+	serve := func(path string) {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	Context("when the request succeeds", func() {
+		It("should record the request by route template and status class", func() {
+			serve("/v1/bars/1")
+			serve("/v1/bars/2")
+
+			tags := Tags{"method": "GET", "route": "/v1/bars/{id}", "status_class": "2xx"}
+			Expect(r.Counter(HTTP_REQUESTS_METRIC, tags)).To(Equal(int64(2)))
+			Expect(r.Timings(HTTP_DURATION_METRIC, tags)).To(HaveLen(2))
+			Expect(r.Counter(HTTP_ERRORS_METRIC, tags)).To(Equal(int64(0)))
+		})
+
+		It("should return the in-flight gauge to zero", func() {
+			serve("/v1/bars/1")
+
+			v, ok := r.GaugeValue(HTTP_IN_FLIGHT_METRIC, Tags{"method": "GET", "route": "/v1/bars/{id}"})
+			Expect(ok).To(BeTrue())
+			Expect(v).To(Equal(0.0))
+		})
+	})
+
+	Context("when the handler fails", func() {
+		It("should record an error", func() {
+			status = http.StatusBadGateway
+			serve("/v1/bars/1")
+
+			tags := Tags{"method": "GET", "route": "/v1/bars/{id}", "status_class": "5xx"}
+			Expect(r.Counter(HTTP_REQUESTS_METRIC, tags)).To(Equal(int64(1)))
+			Expect(r.Counter(HTTP_ERRORS_METRIC, tags)).To(Equal(int64(1)))
+		})
+	})
+
+	Context("when used outside of a mux route", func() {
+		It("should tag the request as unmatched", func() {
+			mw.Wrap(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nope", nil))
+
+			tags := Tags{"method": "GET", "route": UNMATCHED_ROUTE, "status_class": "4xx"}
+			Expect(r.Counter(HTTP_REQUESTS_METRIC, tags)).To(Equal(int64(1)))
+		})
+	})
+})
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	BACKEND_STATSD     = "statsd"
+	BACKEND_PROMETHEUS = "prometheus"
+)
+
+var log = logrus.WithField("pkg", "metrics")
+
+// IMetrics is the metrics abstraction used throughout the service. Every
+// backend (StatsD, Prometheus, in-memory recorder) implements it so callers
+// never have to care where their numbers end up.
+type IMetrics interface {
+	// Inc adds value to the counter identified by name + tags
+	Inc(name string, value int64, tags Tags)
+
+	// Gauge sets the gauge identified by name + tags to value
+	Gauge(name string, value float64, tags Tags)
+
+	// Histogram records a single observation of value
+	Histogram(name string, value float64, tags Tags)
+
+	// Timing records a single observed duration
+	Timing(name string, d time.Duration, tags Tags)
+}
+
+// Tags are the labels (Prometheus) or tags (DogStatsD) attached to a metric
+type Tags map[string]string
+
+// Merge returns a new set of tags containing t overlaid with other
+func (t Tags) Merge(other Tags) Tags {
+	merged := make(Tags, len(t)+len(other))
+
+	for k, v := range t {
+		merged[k] = v
+	}
+
+	for k, v := range other {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// keys returns the tag keys in a stable (sorted) order
+func (t Tags) keys() []string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// String returns a stable representation of the tags; useful as a map key
+func (t Tags) String() string {
+	pairs := make([]string, 0, len(t))
+	for _, k := range t.keys() {
+		pairs = append(pairs, k+"="+t[k])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+/*****************
+ Noop
+*****************/
+
+// Noop discards everything
+type Noop struct{}
+
+func NewNoop() *Noop {
+	return &Noop{}
+}
+
+func (n *Noop) Inc(name string, value int64, tags Tags)         {}
+func (n *Noop) Gauge(name string, value float64, tags Tags)     {}
+func (n *Noop) Histogram(name string, value float64, tags Tags) {}
+func (n *Noop) Timing(name string, d time.Duration, tags Tags)  {}
+
+/*****************
+ Multi
+*****************/
+
+// Multi fans every metric out to all of the wrapped backends
+type Multi struct {
+	backends []IMetrics
+}
+
+func NewMulti(backends ...IMetrics) *Multi {
+	return &Multi{
+		backends: backends,
+	}
+}
+
+func (m *Multi) Inc(name string, value int64, tags Tags) {
+	for _, b := range m.backends {
+		b.Inc(name, value, tags)
+	}
+}
+
+func (m *Multi) Gauge(name string, value float64, tags Tags) {
+	for _, b := range m.backends {
+		b.Gauge(name, value, tags)
+	}
+}
+
+func (m *Multi) Histogram(name string, value float64, tags Tags) {
+	for _, b := range m.backends {
+		b.Histogram(name, value, tags)
+	}
+}
+
+func (m *Multi) Timing(name string, d time.Duration, tags Tags) {
+	for _, b := range m.backends {
+		b.Timing(name, d, tags)
+	}
+}
@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type captureSender struct {
+	sent []string
+}
+
+func (c *captureSender) Send(data []byte) (int, error) {
+	c.sent = append(c.sent, string(data))
+	return len(data), nil
+}
+
+func (c *captureSender) Close() error { return nil }
+
+var _ = Describe("metrics", func() {
+	var (
+		tags = Tags{"method": "GET", "route": "/v1/bars/{id}"}
+	)
+
+	Describe("StatsD", func() {
+		var (
+			sender *captureSender
+			s      *StatsD
+		)
+
+		BeforeEach(func() {
+			sender = &captureSender{}
+		})
+
+		Context("with the name tag format", func() {
+			BeforeEach(func() {
+				statter, err := statsd.NewClientWithSender(sender, "prefix")
+				Expect(err).ToNot(HaveOccurred())
+
+				s = NewStatsD(statter, 1.0, TAG_FORMAT_NAME)
+			})
+
+			It("should fold tag values into the metric name", func() {
+				s.Inc("http.requests", 1, tags)
+				Expect(sender.sent).To(ConsistOf("prefix.http.requests.GET.v1_bars_id:1|c"))
+			})
+
+			It("should send untagged metrics as-is", func() {
+				s.Gauge("inflight", 2.5, nil)
+				Expect(sender.sent).To(ConsistOf("prefix.inflight:2.5|g"))
+			})
+
+			It("should send histograms as timers", func() {
+				s.Histogram("size", 10, nil)
+				Expect(sender.sent).To(ConsistOf("prefix.size:10|ms"))
+			})
+		})
+
+		Context("with the dogstatsd tag format", func() {
+			BeforeEach(func() {
+				statter, err := statsd.NewClientWithSender(sender, "")
+				Expect(err).ToNot(HaveOccurred())
+
+				s = NewStatsD(statter, 1.0, TAG_FORMAT_DOGSTATSD)
+			})
+
+			It("should append tags", func() {
+				s.Timing("http.duration", 1500*time.Microsecond, tags)
+				Expect(sender.sent).To(ConsistOf("http.duration:1.5|ms|#method:GET,route:v1_bars_id"))
+			})
+
+			It("should use the histogram type", func() {
+				s.Histogram("size", 10, Tags{"a": "b"})
+				Expect(sender.sent).To(ConsistOf("size:10|h|#a:b"))
+			})
+		})
+	})
+
+	Describe("Prometheus", func() {
+		var (
+			p *Prometheus
+		)
+
+		BeforeEach(func() {
+			p = NewPrometheus("go-microservice-1", []float64{0.1, 1})
+		})
+
+		render := func() string {
+			buf := &bytes.Buffer{}
+			w := bufio.NewWriter(buf)
+			p.WriteTo(w)
+			w.Flush()
+
+			return buf.String()
+		}
+
+		It("should render counters with labels", func() {
+			p.Describe("http.requests", "Number of requests")
+			p.Inc("http.requests", 1, tags)
+			p.Inc("http.requests", 2, tags)
+
+			Expect(render()).To(Equal(
+				"# HELP go_microservice_1_http_requests_total Number of requests\n" +
+					"# TYPE go_microservice_1_http_requests_total counter\n" +
+					`go_microservice_1_http_requests_total{method="GET",route="/v1/bars/{id}"} 3` + "\n"))
+		})
+
+		It("should render gauges", func() {
+			p.Gauge("inflight", 4, nil)
+			Expect(render()).To(ContainSubstring("# TYPE go_microservice_1_inflight gauge\ngo_microservice_1_inflight 4\n"))
+		})
+
+		It("should render timings as histograms in seconds", func() {
+			p.Timing("duration", 50*time.Millisecond, Tags{"a": "b"})
+			p.Timing("duration", 2*time.Second, Tags{"a": "b"})
+
+			out := render()
+			Expect(out).To(ContainSubstring("# TYPE go_microservice_1_duration_seconds histogram\n"))
+			Expect(out).To(ContainSubstring(`go_microservice_1_duration_seconds_bucket{a="b",le="0.1"} 1`))
+			Expect(out).To(ContainSubstring(`go_microservice_1_duration_seconds_bucket{a="b",le="1"} 1`))
+			Expect(out).To(ContainSubstring(`go_microservice_1_duration_seconds_bucket{a="b",le="+Inf"} 2`))
+			Expect(out).To(ContainSubstring(`go_microservice_1_duration_seconds_sum{a="b"} 2.05`))
+			Expect(out).To(ContainSubstring(`go_microservice_1_duration_seconds_count{a="b"} 2`))
+		})
+
+		It("should escape label values", func() {
+			p.Gauge("g", 1, Tags{"v": "a\"b\\c\n"})
+			Expect(render()).To(ContainSubstring(`go_microservice_1_g{v="a\"b\\c\n"} 1`))
+		})
+
+		It("should drop updates with a conflicting type", func() {
+			p.Gauge("thing", 1, nil)
+			p.Histogram("thing", 1, nil)
+			Expect(render()).ToNot(ContainSubstring("histogram"))
+		})
+
+		It("should serve the exposition format over HTTP", func() {
+			p.Inc("c", 1, nil)
+
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+			Expect(rec.Code).To(Equal(200))
+			Expect(rec.Header().Get("Content-Type")).To(Equal(PROMETHEUS_CONTENT_TYPE))
+			Expect(rec.Body.String()).To(ContainSubstring("go_microservice_1_c_total 1"))
+		})
+	})
+
+	Describe("Recorder + Statter", func() {
+		var (
+			r *Recorder
+		)
+
+		BeforeEach(func() {
+			r = NewRecorder()
+		})
+
+		It("should record everything sent through the statter adapter", func() {
+			st := NewStatter(r)
+			st.Inc("handlers.foo.2xx", 1, 1.0)
+			st.TimingDuration("handlers.foo.runtime", time.Second, 1.0)
+			st.NewSubStatter("sub").Gauge("g", 3, 1.0)
+
+			Expect(r.Counter("handlers.foo.2xx", nil)).To(Equal(int64(1)))
+			Expect(r.Timings("handlers.foo.runtime", nil)).To(ConsistOf(time.Second))
+
+			v, ok := r.GaugeValue("sub.g", nil)
+			Expect(ok).To(BeTrue())
+			Expect(v).To(Equal(3.0))
+		})
+
+		It("should drop what cannot be recorded, such as decrements", func() {
+			st := NewStatter(r)
+			st.Inc("c", 2, 1.0)
+			st.Dec("c", 1, 1.0)
+			st.Inc("c", -1, 1.0)
+			st.GaugeDelta("g", -1, 1.0)
+
+			Expect(r.Counter("c", nil)).To(Equal(int64(2)))
+
+			_, ok := r.GaugeValue("g", nil)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should fan out through Multi", func() {
+			other := NewRecorder()
+			m := NewMulti(r, other)
+
+			m.Inc("c", 2, tags)
+			m.Histogram("h", 1.5, tags)
+
+			Expect(r.Counter("c", tags)).To(Equal(int64(2)))
+			Expect(other.Counter("c", tags)).To(Equal(int64(2)))
+			Expect(other.Observations("h", tags)).To(ConsistOf(1.5))
+		})
+	})
+})
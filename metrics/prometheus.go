@@ -0,0 +1,274 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PROMETHEUS_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+	promCounter   = "counter"
+	promGauge     = "gauge"
+	promHistogram = "histogram"
+)
+
+var (
+	// DefaultBuckets are used for histograms when no buckets are given (seconds)
+	DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// Prometheus keeps every metric in memory and renders them in the
+// Prometheus text exposition format (v0.0.4) when scraped.
+type Prometheus struct {
+	namespace string
+	buckets   []float64
+
+	mu       sync.RWMutex
+	families map[string]*promFamily
+	help     map[string]string
+}
+
+type promFamily struct {
+	name   string
+	base   string
+	kind   string
+	series map[string]*promSeries
+}
+
+type promSeries struct {
+	labels Tags
+
+	// counter + gauge
+	value float64
+
+	// histogram
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheus creates a Prometheus backend; every metric name will be
+// prefixed with the namespace. A nil bucket list uses DefaultBuckets.
+func NewPrometheus(namespace string, buckets []float64) *Prometheus {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+
+	return &Prometheus{
+		namespace: sanitizePrometheus(namespace),
+		buckets:   sorted,
+		families:  map[string]*promFamily{},
+		help:      map[string]string{},
+	}
+}
+
+// Describe sets the HELP text for a metric (name as passed to Inc, Gauge etc.)
+func (p *Prometheus) Describe(name, help string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.help[p.fullName(name)] = help
+}
+
+func (p *Prometheus) Inc(name string, value int64, tags Tags) {
+	p.update(name, "_total", promCounter, tags, func(s *promSeries) {
+		s.value += float64(value)
+	})
+}
+
+func (p *Prometheus) Gauge(name string, value float64, tags Tags) {
+	p.update(name, "", promGauge, tags, func(s *promSeries) {
+		s.value = value
+	})
+}
+
+func (p *Prometheus) Histogram(name string, value float64, tags Tags) {
+	p.observe(name, "", value, tags)
+}
+
+func (p *Prometheus) Timing(name string, d time.Duration, tags Tags) {
+	p.observe(name, "_seconds", d.Seconds(), tags)
+}
+
+func (p *Prometheus) observe(name, suffix string, value float64, tags Tags) {
+	p.update(name, suffix, promHistogram, tags, func(s *promSeries) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(p.buckets))
+		}
+
+		for i, upper := range p.buckets {
+			if value <= upper {
+				s.counts[i]++
+			}
+		}
+
+		s.sum += value
+		s.count++
+	})
+}
+
+func (p *Prometheus) update(name, suffix, kind string, tags Tags, fn func(s *promSeries)) {
+	base := p.fullName(name)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, ok := p.families[base+suffix]
+	if !ok {
+		f = &promFamily{
+			name:   base + suffix,
+			base:   base,
+			kind:   kind,
+			series: map[string]*promSeries{},
+		}
+		p.families[f.name] = f
+	}
+
+	if f.kind != kind {
+		log.WithField("metric", name).Warnf("Metric already registered as %s; dropping %s update", f.kind, kind)
+		return
+	}
+
+	key := tags.String()
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &promSeries{labels: tags.Merge(nil)}
+		f.series[key] = s
+	}
+
+	fn(s)
+}
+
+func (p *Prometheus) fullName(name string) string {
+	if p.namespace == "" {
+		return sanitizePrometheus(name)
+	}
+
+	return p.namespace + "_" + sanitizePrometheus(name)
+}
+
+// ServeHTTP exposes all metrics in the Prometheus text format
+func (p *Prometheus) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", PROMETHEUS_CONTENT_TYPE)
+	rw.WriteHeader(http.StatusOK)
+
+	w := bufio.NewWriter(rw)
+	defer w.Flush()
+
+	p.WriteTo(w)
+}
+
+// WriteTo renders all metrics in the Prometheus text format, sorted by name
+// and labels so the output is stable between scrapes.
+func (p *Prometheus) WriteTo(w *bufio.Writer) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := p.families[name]
+
+		if help, ok := p.help[f.base]; ok {
+			fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(help))
+		}
+
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			s := f.series[k]
+
+			if f.kind != promHistogram {
+				fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(s.labels, "", ""), formatFloat(s.value))
+				continue
+			}
+
+			for i, upper := range p.buckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(s.labels, "le", formatFloat(upper)), s.counts[i])
+			}
+
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", f.name, formatLabels(s.labels, "", ""), formatFloat(s.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", f.name, formatLabels(s.labels, "", ""), s.count)
+		}
+	}
+}
+
+// formatLabels renders `{k="v",...}`, optionally with one extra label appended
+func formatLabels(tags Tags, extraKey, extraValue string) string {
+	pairs := make([]string, 0, len(tags)+1)
+	for _, k := range tags.keys() {
+		pairs = append(pairs, sanitizePrometheus(k)+`="`+escapeLabelValue(tags[k])+`"`)
+	}
+
+	if extraKey != "" {
+		pairs = append(pairs, extraKey+`="`+extraValue+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// sanitizePrometheus converts a name into a valid Prometheus metric/label name
+func sanitizePrometheus(s string) string {
+	b := []byte(s)
+
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// Recorder keeps every metric in memory; meant to be used in tests in place
+// of a real backend.
+type Recorder struct {
+	mu         sync.Mutex
+	counters   map[string]int64
+	gauges     map[string]float64
+	histograms map[string][]float64
+	timings    map[string][]time.Duration
+}
+
+func NewRecorder() *Recorder {
+	r := &Recorder{}
+	r.Reset()
+
+	return r
+}
+
+func (r *Recorder) Inc(name string, value int64, tags Tags) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counters[recorderKey(name, tags)] += value
+}
+
+func (r *Recorder) Gauge(name string, value float64, tags Tags) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.gauges[recorderKey(name, tags)] = value
+}
+
+func (r *Recorder) Histogram(name string, value float64, tags Tags) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := recorderKey(name, tags)
+	r.histograms[key] = append(r.histograms[key], value)
+}
+
+func (r *Recorder) Timing(name string, d time.Duration, tags Tags) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := recorderKey(name, tags)
+	r.timings[key] = append(r.timings[key], d)
+}
+
+// Counter returns the current value of a counter (0 if never incremented)
+func (r *Recorder) Counter(name string, tags Tags) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.counters[recorderKey(name, tags)]
+}
+
+// GaugeValue returns the last value set on a gauge and whether it was ever set
+func (r *Recorder) GaugeValue(name string, tags Tags) (float64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.gauges[recorderKey(name, tags)]
+
+	return v, ok
+}
+
+// Observations returns every value recorded for a histogram
+func (r *Recorder) Observations(name string, tags Tags) []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]float64{}, r.histograms[recorderKey(name, tags)]...)
+}
+
+// Timings returns every duration recorded for a timing
+func (r *Recorder) Timings(name string, tags Tags) []time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]time.Duration{}, r.timings[recorderKey(name, tags)]...)
+}
+
+// Reset discards everything recorded so far
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counters = map[string]int64{}
+	r.gauges = map[string]float64{}
+	r.histograms = map[string][]float64{}
+	r.timings = map[string][]time.Duration{}
+}
+
+func recorderKey(name string, tags Tags) string {
+	return name + "{" + tags.String() + "}"
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+const (
+	// Tags are folded into the metric name (ie. "<prefix>.<name>.<tag value>...")
+	TAG_FORMAT_NAME = "name"
+
+	// Tags are sent using the DogStatsD "|#key:value" extension
+	TAG_FORMAT_DOGSTATSD = "dogstatsd"
+)
+
+// StatsD sends metrics through a statsd.Statter. Since plain StatsD has no
+// notion of tags, they are either folded into the metric name or sent in the
+// DogStatsD format - depending on the configured tag format.
+type StatsD struct {
+	statter   statsd.Statter
+	rate      float32
+	tagFormat string
+}
+
+func NewStatsD(statter statsd.Statter, rate float32, tagFormat string) *StatsD {
+	return &StatsD{
+		statter:   statter,
+		rate:      rate,
+		tagFormat: tagFormat,
+	}
+}
+
+func (s *StatsD) Inc(name string, value int64, tags Tags) {
+	s.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+func (s *StatsD) Gauge(name string, value float64, tags Tags) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+func (s *StatsD) Histogram(name string, value float64, tags Tags) {
+	// "h" is a DogStatsD extension; plain StatsD gets the same percentiles from a timer
+	kind := "ms"
+	if s.tagFormat == TAG_FORMAT_DOGSTATSD {
+		kind = "h"
+	}
+
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), kind, tags)
+}
+
+func (s *StatsD) Timing(name string, d time.Duration, tags Tags) {
+	ms := float64(d) / float64(time.Millisecond)
+	s.send(name, strconv.FormatFloat(ms, 'f', -1, 64), "ms", tags)
+}
+
+func (s *StatsD) send(name, value, kind string, tags Tags) {
+	stat := name
+	value = value + "|" + kind
+
+	if len(tags) > 0 {
+		if s.tagFormat == TAG_FORMAT_DOGSTATSD {
+			value = value + "|#" + dogStatsDTags(tags)
+		} else {
+			stat = nameWithTags(name, tags)
+		}
+	}
+
+	if err := s.statter.Raw(stat, value, s.rate); err != nil {
+		log.WithField("stat", stat).Debugf("Unable to send stat: %v", err)
+	}
+}
+
+func dogStatsDTags(tags Tags) string {
+	pairs := make([]string, 0, len(tags))
+	for _, k := range tags.keys() {
+		pairs = append(pairs, sanitizeStatsD(k)+":"+sanitizeStatsD(tags[k]))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// nameWithTags appends the tag values (ordered by tag key) to the metric name
+func nameWithTags(name string, tags Tags) string {
+	parts := []string{name}
+	for _, k := range tags.keys() {
+		if v := sanitizeStatsD(tags[k]); v != "" {
+			parts = append(parts, v)
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// sanitizeStatsD replaces anything that is not safe to use as a single
+// metric name component (or tag value) with an underscore
+func sanitizeStatsD(s string) string {
+	b := make([]byte, 0, len(s))
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+			b = append(b, c)
+		default:
+			if len(b) > 0 && b[len(b)-1] != '_' {
+				b = append(b, '_')
+			}
+		}
+	}
+
+	return strings.TrimRight(string(b), "_")
+}
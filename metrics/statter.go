@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+// Statter adapts IMetrics to the statsd.Statter interface so that libraries
+// which only know how to talk to StatsD (ie. rye) end up in the same place as
+// the rest of our metrics.
+//
+// Sample rates passed in by callers are ignored; rates are a concern of the
+// StatsD backend itself. Decrements, gauge deltas, sets and raw stats have no
+// equivalent (counters only ever go up, ie. in Prometheus) and are dropped;
+// the first drop of every stat is logged.
+type Statter struct {
+	m       IMetrics
+	prefix  string
+	dropped *droppedStats // shared with sub statters
+}
+
+type droppedStats struct {
+	mu    sync.Mutex
+	stats map[string]bool
+}
+
+func NewStatter(m IMetrics) *Statter {
+	return &Statter{
+		m:       m,
+		dropped: &droppedStats{stats: map[string]bool{}},
+	}
+}
+
+func (s *Statter) Inc(stat string, value int64, rate float32) error {
+	if value < 0 {
+		s.drop("Inc", stat)
+		return nil
+	}
+
+	s.m.Inc(s.name(stat), value, nil)
+	return nil
+}
+
+func (s *Statter) Dec(stat string, value int64, rate float32) error {
+	s.drop("Dec", stat)
+	return nil
+}
+
+func (s *Statter) Gauge(stat string, value int64, rate float32) error {
+	s.m.Gauge(s.name(stat), float64(value), nil)
+	return nil
+}
+
+func (s *Statter) GaugeDelta(stat string, value int64, rate float32) error {
+	s.drop("GaugeDelta", stat)
+	return nil
+}
+
+func (s *Statter) Timing(stat string, delta int64, rate float32) error {
+	s.m.Timing(s.name(stat), time.Duration(delta)*time.Millisecond, nil)
+	return nil
+}
+
+func (s *Statter) TimingDuration(stat string, delta time.Duration, rate float32) error {
+	s.m.Timing(s.name(stat), delta, nil)
+	return nil
+}
+
+func (s *Statter) Set(stat string, value string, rate float32) error {
+	s.drop("Set", stat)
+	return nil
+}
+
+func (s *Statter) SetInt(stat string, value int64, rate float32) error {
+	s.drop("SetInt", stat)
+	return nil
+}
+
+func (s *Statter) Raw(stat string, value string, rate float32) error {
+	s.drop("Raw", stat)
+	return nil
+}
+
+func (s *Statter) NewSubStatter(prefix string) statsd.SubStatter {
+	return &Statter{
+		m:       s.m,
+		prefix:  s.name(prefix),
+		dropped: s.dropped,
+	}
+}
+
+func (s *Statter) SetPrefix(prefix string) {
+	s.prefix = prefix
+}
+
+func (s *Statter) SetSamplerFunc(sampler statsd.SamplerFunc) {}
+
+func (s *Statter) Close() error {
+	return nil
+}
+
+// drop logs the first call of kind for stat that cannot be recorded
+func (s *Statter) drop(kind, stat string) {
+	name := s.name(stat)
+
+	s.dropped.mu.Lock()
+	seen := s.dropped.stats[kind+" "+name]
+	s.dropped.stats[kind+" "+name] = true
+	s.dropped.mu.Unlock()
+
+	if !seen {
+		log.WithField("stat", name).Warnf("Unsupported statsd %s; dropping it", kind)
+	}
+}
+
+func (s *Statter) name(stat string) string {
+	if s.prefix == "" {
+		return stat
+	}
+
+	return s.prefix + "." + stat
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/deps"
+	"github.com/dfraglabs/go-microservice-1/deps/backends"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+// runMigrate handles the `migrate up|down|status` subcommands. Only Mongo is
+// connected; none of the other dependencies are set up.
+func runMigrate(cfg *config.Config, cmd string) error {
+	pool, err := backends.ConnectMongo(cfg, metrics.NewNoop())
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.MigrationsTimeoutSec)*time.Second)
+	defer cancel()
+
+	m := deps.NewMigrator(pool, nil)
+
+	switch cmd {
+	case migrateUpCmd.FullCommand():
+		applied, err := m.Up(ctx)
+		for _, id := range applied {
+			fmt.Printf("applied  %s\n", id)
+		}
+
+		return err
+	case migrateDownCmd.FullCommand():
+		reverted, err := m.Down(ctx, *migrateDownSteps)
+		for _, id := range reverted {
+			fmt.Printf("reverted %s\n", id)
+		}
+
+		return err
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tAPPLIED AT\tDESCRIPTION")
+
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.Applied != nil {
+			appliedAt = s.Applied.AppliedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.ID, appliedAt, s.Description)
+	}
+
+	return w.Flush()
+}
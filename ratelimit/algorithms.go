@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// state of a rule for a key, as kept by the stores; the fields in use
+// depend on the algorithm
+type state struct {
+	// Token bucket
+	Tokens     float64   `bson:"tokens,omitempty"`
+	RefilledAt time.Time `bson:"refilled_at,omitempty"`
+
+	// Sliding window: requests counted in the current fixed window and in
+	// the one before it
+	WindowStart time.Time `bson:"window_start,omitempty"`
+	Count       int       `bson:"count,omitempty"`
+	PrevCount   int       `bson:"prev_count,omitempty"`
+}
+
+// take counts a request made at now, updating st; a zero st is that of a
+// key not seen before
+func (r *Rule) take(st *state, now time.Time) *Result {
+	if r.Algorithm == SLIDING_WINDOW {
+		return r.takeWindow(st, now)
+	}
+
+	return r.takeToken(st, now)
+}
+
+// ttl is how long the state of an idle key is worth keeping; after that it
+// is no different from a fresh one
+func (r *Rule) ttl() time.Duration {
+	refill := time.Duration(float64(r.capacity()) / r.rate() * float64(time.Second))
+
+	if window := 2 * r.Period; window > refill {
+		return window
+	}
+
+	return refill
+}
+
+func (r *Rule) capacity() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+
+	return r.Limit
+}
+
+// rate is the token bucket refill rate, per second
+func (r *Rule) rate() float64 {
+	return float64(r.Limit) / r.Period.Seconds()
+}
+
+func (r *Rule) takeToken(st *state, now time.Time) *Result {
+	capacity := float64(r.capacity())
+	rate := r.rate()
+
+	if st.RefilledAt.IsZero() {
+		st.Tokens = capacity
+	} else if elapsed := now.Sub(st.RefilledAt).Seconds(); elapsed > 0 {
+		st.Tokens = math.Min(capacity, st.Tokens+elapsed*rate)
+	}
+
+	st.RefilledAt = now
+
+	res := &Result{Limit: r.capacity()}
+
+	if st.Tokens >= 1 {
+		st.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - st.Tokens) / rate)
+	}
+
+	res.Remaining = int(math.Floor(st.Tokens))
+	res.Reset = seconds((capacity - st.Tokens) / rate)
+
+	return res
+}
+
+// takeWindow approximates a sliding window by weighting the count of the
+// previous fixed window by how much of it the sliding one still covers
+func (r *Rule) takeWindow(st *state, now time.Time) *Result {
+	start := now.Truncate(r.Period)
+
+	if !st.WindowStart.Equal(start) {
+		if st.WindowStart.Equal(start.Add(-r.Period)) {
+			st.PrevCount = st.Count
+		} else {
+			st.PrevCount = 0
+		}
+
+		st.WindowStart = start
+		st.Count = 0
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(r.Period)
+	estimate := float64(st.PrevCount)*weight + float64(st.Count)
+
+	res := &Result{Limit: r.Limit, Reset: start.Add(r.Period).Sub(now)}
+
+	if estimate+1 <= float64(r.Limit) {
+		st.Count++
+		estimate++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = r.windowRetryAfter(st, elapsed)
+	}
+
+	res.Remaining = int(math.Max(0, math.Floor(float64(r.Limit)-estimate)))
+
+	return res
+}
+
+// windowRetryAfter is how long until the previous window's weight drops
+// enough for one more request
+func (r *Rule) windowRetryAfter(st *state, elapsed time.Duration) time.Duration {
+	room := float64(r.Limit - st.Count - 1)
+	if room < 0 || st.PrevCount == 0 {
+		// Not before the next window
+		return r.Period - elapsed
+	}
+
+	weight := room / float64(st.PrevCount)
+	at := time.Duration((1 - weight) * float64(r.Period))
+
+	if at <= elapsed {
+		return time.Millisecond
+	}
+
+	return at - elapsed
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// How often idle keys are dropped
+	memorySweepInterval = time.Minute
+)
+
+type memoryEntry struct {
+	state     state
+	expiresAt time.Time
+}
+
+// MemoryStore keeps the state of the rules in process; every replica then
+// has its own budget
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	nextSweep time.Time
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]*memoryEntry{},
+		now:     time.Now,
+	}
+}
+
+// Take meets IStore
+func (s *MemoryStore) Take(ctx context.Context, key string, rule *Rule) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	if now.After(s.nextSweep) {
+		s.sweep(now)
+		s.nextSweep = now.Add(memorySweepInterval)
+	}
+
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+
+	res := rule.take(&e.state, now)
+	e.expiresAt = now.Add(rule.ttl())
+
+	return res, nil
+}
+
+// Len returns how many keys are tracked
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+// sweep drops idle keys; s.mu must be held
+func (s *MemoryStore) sweep(now time.Time) {
+	for k, e := range s.entries {
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+)
+
+const (
+	COLLECTION_NAME = "rate_limits"
+
+	// Take retries this many times when another replica updated the key
+	// in between
+	mongoTakeAttempts = 5
+)
+
+var (
+	ErrContended = errors.New("rate limit state kept changing concurrently")
+)
+
+// mongoRecord is stored in the rate_limits collection
+type mongoRecord struct {
+	Key       string    `bson:"_id"`
+	State     state     `bson:"state"`
+	Version   int64     `bson:"version"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// MongoStore keeps the state of the rules in Mongo, for a budget shared by
+// every replica. Updates are compare-and-set on a version, so a busy key
+// costs a read and a write per request (and retries under contention).
+// Replica clocks are assumed to be roughly in sync.
+type MongoStore struct {
+	coll *dalutil.SmartCollection
+
+	// Overridable in tests
+	now func() time.Time
+}
+
+func NewMongoStore(pool *dalutil.SessionPool, inst *dalutil.Instrumentation) *MongoStore {
+	return &MongoStore{
+		coll: dalutil.NewSmartCollection(pool, COLLECTION_NAME, inst),
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Indexes returns the indexes the collection should have; idle keys expire
+func Indexes() []*mgo.Index {
+	return []*mgo.Index{
+		{
+			Name:        "expiring",
+			Key:         []string{"expires_at"},
+			ExpireAfter: time.Second, // mgo takes 0 for no TTL
+		},
+	}
+}
+
+func (s *MongoStore) EnsureIndexes(allowDestructive bool) error {
+	return s.coll.EnsureIndexes(Indexes(), allowDestructive)
+}
+
+// Take meets IStore
+func (s *MongoStore) Take(ctx context.Context, key string, rule *Rule) (*Result, error) {
+	for i := 0; i < mongoTakeAttempts; i++ {
+		now := s.now()
+		rec := &mongoRecord{}
+
+		err := s.coll.FindOne(ctx, bson.M{"_id": key}, nil, rec)
+
+		switch {
+		case err == mgo.ErrNotFound:
+			rec = &mongoRecord{Key: key}
+		case err != nil:
+			return nil, err
+		case !now.Before(rec.ExpiresAt):
+			// Not removed by the TTL monitor yet
+			rec.State = state{}
+		}
+
+		res := rule.take(&rec.State, now)
+
+		if rec.Version == 0 {
+			err = s.coll.Insert(ctx, &mongoRecord{Key: key, State: rec.State, Version: 1, ExpiresAt: now.Add(rule.ttl())})
+			if mgo.IsDup(err) {
+				continue
+			}
+		} else {
+			err = s.coll.Update(ctx,
+				bson.M{"_id": key, "version": rec.Version},
+				bson.M{
+					"$set": bson.M{"state": rec.State, "expires_at": now.Add(rule.ttl())},
+					"$inc": bson.M{"version": 1},
+				},
+			)
+			if err == mgo.ErrNotFound {
+				continue
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return res, nil
+	}
+
+	return nil, ErrContended
+}
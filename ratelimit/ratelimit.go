@@ -0,0 +1,231 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+const (
+	TOKEN_BUCKET   = "token_bucket"   // bursts of up to Burst, refilled at Limit per Period
+	SLIDING_WINDOW = "sliding_window" // at most Limit over any Period (approximately)
+
+	// What requests are counted by
+	KEY_TOKEN = "token"
+	KEY_IP    = "ip"
+	KEY_ROUTE = "route"
+
+	// Applies to every route group
+	ANY_GROUP = "*"
+
+	STORE_MEMORY = "memory"
+	STORE_MONGO  = "mongo"
+
+	REJECTED_METRIC = "ratelimit.rejected"
+	ERRORS_METRIC   = "ratelimit.errors"
+)
+
+// Rule limits the requests to a group of routes, counting them separately
+// for every value of Key (ie. per token)
+type Rule struct {
+	Group     string
+	Key       string
+	Algorithm string
+	Limit     int
+	Period    time.Duration
+	Burst     int // token bucket capacity; Limit if 0
+
+	spec string
+}
+
+// ParseRule parses "<group>:<key>:<algorithm>:<limit>/<period>[:<burst>]",
+// ie. "v1:token:token_bucket:100/1s:200" or "*:ip:sliding_window:600/m"
+func ParseRule(spec string) (*Rule, error) {
+	parts := strings.Split(strings.TrimSpace(spec), ":")
+	if len(parts) != 4 && len(parts) != 5 {
+		return nil, fmt.Errorf("Invalid rate limit '%s': expected <group>:<key>:<algorithm>:<limit>/<period>[:<burst>]", spec)
+	}
+
+	r := &Rule{Group: parts[0], Key: parts[1], Algorithm: parts[2], spec: strings.TrimSpace(spec)}
+
+	if r.Group == "" {
+		return nil, fmt.Errorf("Invalid rate limit '%s': missing group", spec)
+	}
+
+	switch r.Key {
+	case KEY_TOKEN, KEY_IP, KEY_ROUTE:
+	default:
+		return nil, fmt.Errorf("Invalid rate limit '%s': unknown key '%s'", spec, r.Key)
+	}
+
+	switch r.Algorithm {
+	case TOKEN_BUCKET, SLIDING_WINDOW:
+	default:
+		return nil, fmt.Errorf("Invalid rate limit '%s': unknown algorithm '%s'", spec, r.Algorithm)
+	}
+
+	rate := strings.SplitN(parts[3], "/", 2)
+	if len(rate) != 2 {
+		return nil, fmt.Errorf("Invalid rate limit '%s': expected <limit>/<period>", spec)
+	}
+
+	limit, err := strconv.Atoi(rate[0])
+	if err != nil || limit <= 0 {
+		return nil, fmt.Errorf("Invalid rate limit '%s': limit must be a positive integer", spec)
+	}
+
+	r.Limit = limit
+
+	// "s", "m" and "h" stand for one of them
+	period := rate[1]
+	if period != "" && strings.IndexAny(period[:1], "0123456789") < 0 {
+		period = "1" + period
+	}
+
+	r.Period, err = time.ParseDuration(period)
+	if err != nil || r.Period <= 0 {
+		return nil, fmt.Errorf("Invalid rate limit '%s': invalid period '%s'", spec, rate[1])
+	}
+
+	if len(parts) == 5 {
+		if r.Algorithm != TOKEN_BUCKET {
+			return nil, fmt.Errorf("Invalid rate limit '%s': only token buckets have a burst", spec)
+		}
+
+		r.Burst, err = strconv.Atoi(parts[4])
+		if err != nil || r.Burst <= 0 {
+			return nil, fmt.Errorf("Invalid rate limit '%s': burst must be a positive integer", spec)
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Rule) String() string {
+	return r.spec
+}
+
+// Result of counting a request against a rule (or, from Limiter.Allow, of
+// the most restrictive rule)
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration // until the limit is fully available again
+
+	// Until the request would be allowed; 0 if allowed
+	RetryAfter time.Duration
+}
+
+//go:generate counterfeiter -o ../fakes/ratelimitstore/store.go . IStore
+
+// IStore keeps the state of the rules; see MemoryStore and MongoStore
+type IStore interface {
+	// Take counts a request against rule for key
+	Take(ctx context.Context, key string, rule *Rule) (*Result, error)
+}
+
+// Limiter applies the rules of a route group to requests
+type Limiter struct {
+	rules   []*Rule
+	store   IStore
+	metrics metrics.IMetrics
+}
+
+// NewLimiter parses specs (see ParseRule)
+func NewLimiter(specs []string, store IStore, m metrics.IMetrics) (*Limiter, error) {
+	if m == nil {
+		m = metrics.NewNoop()
+	}
+
+	l := &Limiter{store: store, metrics: m}
+
+	for _, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+
+		r, err := ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		l.rules = append(l.rules, r)
+	}
+
+	return l, nil
+}
+
+// Rules returns the rules applying to group
+func (l *Limiter) Rules(group string) []*Rule {
+	rules := []*Rule{}
+
+	for _, r := range l.rules {
+		if r.Group == group || r.Group == ANY_GROUP {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules
+}
+
+// Allow counts a request to group against every rule of the group; keys
+// holds what the request is counted by (KEY_TOKEN etc.), rules whose key is
+// missing are skipped. Returns nil if no rule applies, the result of the
+// rejecting rule the request would wait the longest for, or else that of the
+// rule with the fewest requests remaining.
+//
+// Every rule is counted even if another rejects the request. Store errors
+// are returned (along with the result of the other rules) for the caller to
+// fail open or closed.
+func (l *Limiter) Allow(ctx context.Context, group string, keys map[string]string) (*Result, error) {
+	var (
+		result   *Result
+		firstErr error
+	)
+
+	for _, r := range l.Rules(group) {
+		key := keys[r.Key]
+		if key == "" {
+			continue
+		}
+
+		// Rules of ANY_GROUP share their budget across groups
+		res, err := l.store.Take(ctx, r.spec+"|"+key, r)
+		if err != nil {
+			l.metrics.Inc(ERRORS_METRIC, 1, metrics.Tags{"group": group})
+
+			if firstErr == nil {
+				firstErr = fmt.Errorf("Unable to apply rate limit '%s': %v", r.spec, err)
+			}
+
+			continue
+		}
+
+		if !res.Allowed {
+			l.metrics.Inc(REJECTED_METRIC, 1, metrics.Tags{"group": group, "key": r.Key, "algorithm": r.Algorithm})
+		}
+
+		if result == nil || moreRestrictive(res, result) {
+			result = res
+		}
+	}
+
+	return result, firstErr
+}
+
+func moreRestrictive(a, b *Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+
+	return a.Remaining < b.Remaining
+}
@@ -0,0 +1,268 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/dal/dalutil"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+// fakeStore records the keys taken and fails with err, if set, or else
+// defers to a memory store
+type fakeStore struct {
+	*MemoryStore
+	err  error
+	keys []string
+}
+
+func (f *fakeStore) Take(ctx context.Context, key string, rule *Rule) (*Result, error) {
+	f.keys = append(f.keys, key)
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return f.MemoryStore.Take(ctx, key, rule)
+}
+
+var _ = Describe("Ratelimit", func() {
+	var (
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	mustParse := func(spec string) *Rule {
+		r, err := ParseRule(spec)
+		Expect(err).ToNot(HaveOccurred())
+		return r
+	}
+
+	Describe("ParseRule", func() {
+		It("should parse every field", func() {
+			r := mustParse("v1:token:token_bucket:100/2s:150")
+
+			Expect(r.Group).To(Equal("v1"))
+			Expect(r.Key).To(Equal(KEY_TOKEN))
+			Expect(r.Algorithm).To(Equal(TOKEN_BUCKET))
+			Expect(r.Limit).To(Equal(100))
+			Expect(r.Period).To(Equal(2 * time.Second))
+			Expect(r.Burst).To(Equal(150))
+			Expect(r.String()).To(Equal("v1:token:token_bucket:100/2s:150"))
+		})
+
+		It("should take a bare unit for one of it", func() {
+			Expect(mustParse("*:ip:sliding_window:600/m").Period).To(Equal(time.Minute))
+		})
+
+		It("should reject malformed rules", func() {
+			for _, spec := range []string{
+				"",
+				"v1:token:token_bucket",
+				":token:token_bucket:1/s",
+				"v1:user:token_bucket:1/s",
+				"v1:token:leaky_bucket:1/s",
+				"v1:token:token_bucket:1",
+				"v1:token:token_bucket:0/s",
+				"v1:token:token_bucket:1/fortnight",
+				"v1:token:token_bucket:1/s:0",
+				"v1:token:sliding_window:1/s:10",
+			} {
+				_, err := ParseRule(spec)
+				Expect(err).To(HaveOccurred(), spec)
+			}
+		})
+	})
+
+	Describe("token bucket", func() {
+		It("should allow bursts and refill over time", func() {
+			r := mustParse("v1:token:token_bucket:1/s:3")
+			st := &state{}
+
+			for i := 2; i >= 0; i-- {
+				res := r.take(st, now)
+				Expect(res.Allowed).To(BeTrue())
+				Expect(res.Remaining).To(Equal(i))
+				Expect(res.Limit).To(Equal(3))
+			}
+
+			res := r.take(st, now)
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.RetryAfter).To(Equal(time.Second))
+			Expect(res.Reset).To(Equal(3 * time.Second))
+
+			res = r.take(st, now.Add(1500*time.Millisecond))
+			Expect(res.Allowed).To(BeTrue())
+			Expect(res.Remaining).To(Equal(0))
+
+			res = r.take(st, now.Add(10*time.Second))
+			Expect(res.Allowed).To(BeTrue())
+			Expect(res.Remaining).To(Equal(2))
+		})
+	})
+
+	Describe("sliding window", func() {
+		It("should cap the requests of a window", func() {
+			r := mustParse("v1:ip:sliding_window:2/m")
+			st := &state{}
+
+			Expect(r.take(st, now).Allowed).To(BeTrue())
+			Expect(r.take(st, now.Add(10*time.Second)).Allowed).To(BeTrue())
+
+			res := r.take(st, now.Add(20*time.Second))
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Remaining).To(Equal(0))
+			Expect(res.RetryAfter).To(Equal(40 * time.Second))
+			Expect(res.Reset).To(Equal(40 * time.Second))
+		})
+
+		It("should weight the previous window by how much of it is still covered", func() {
+			r := mustParse("v1:ip:sliding_window:4/m")
+			st := &state{}
+
+			for i := 0; i < 4; i++ {
+				Expect(r.take(st, now.Add(50*time.Second)).Allowed).To(BeTrue())
+			}
+
+			// A quarter into the next window, 3 of the previous 4 still count
+			res := r.take(st, now.Add(75*time.Second))
+			Expect(res.Allowed).To(BeTrue())
+			Expect(res.Remaining).To(Equal(0))
+
+			res = r.take(st, now.Add(76*time.Second))
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.RetryAfter).To(Equal(14 * time.Second))
+
+			// A window later, only this window's request counts
+			res = r.take(st, now.Add(125*time.Second))
+			Expect(res.Allowed).To(BeTrue())
+		})
+
+		It("should forget windows older than the previous one", func() {
+			r := mustParse("v1:ip:sliding_window:1/m")
+			st := &state{}
+
+			Expect(r.take(st, now).Allowed).To(BeTrue())
+			Expect(r.take(st, now.Add(2*time.Minute+time.Second)).Allowed).To(BeTrue())
+		})
+	})
+
+	Describe("MemoryStore", func() {
+		It("should keep keys apart and drop idle ones", func() {
+			s := NewMemoryStore()
+			s.now = func() time.Time { return now }
+
+			r := mustParse("v1:token:token_bucket:1/s")
+
+			res, err := s.Take(context.Background(), "a", r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Allowed).To(BeTrue())
+
+			res, _ = s.Take(context.Background(), "a", r)
+			Expect(res.Allowed).To(BeFalse())
+
+			res, _ = s.Take(context.Background(), "b", r)
+			Expect(res.Allowed).To(BeTrue())
+			Expect(s.Len()).To(Equal(2))
+
+			now = now.Add(2 * memorySweepInterval)
+
+			s.Take(context.Background(), "c", r)
+			Expect(s.Len()).To(Equal(1))
+		})
+	})
+
+	Describe("MongoStore", func() {
+		It("should fail while Mongo is not connected", func() {
+			s := NewMongoStore(dalutil.NewSessionPool(nil, "db", 1, time.Second, nil), nil)
+
+			_, err := s.Take(context.Background(), "a", mustParse("v1:token:token_bucket:1/s"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Limiter", func() {
+		var (
+			store    *fakeStore
+			recorder *metrics.Recorder
+			limiter  *Limiter
+		)
+
+		BeforeEach(func() {
+			store = &fakeStore{MemoryStore: NewMemoryStore()}
+			recorder = metrics.NewRecorder()
+
+			var err error
+			limiter, err = NewLimiter([]string{
+				"v1:token:token_bucket:2/m",
+				"*:ip:sliding_window:3/m",
+				"admin:route:sliding_window:1/m",
+			}, store, recorder)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should reject invalid rules", func() {
+			_, err := NewLimiter([]string{"v1:token"}, store, nil)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should apply the rules of the group and those of every group", func() {
+			Expect(limiter.Rules("v1")).To(HaveLen(2))
+			Expect(limiter.Rules("admin")).To(HaveLen(2))
+			Expect(limiter.Rules("other")).To(HaveLen(1))
+		})
+
+		It("should report the most restrictive rule", func() {
+			keys := map[string]string{KEY_TOKEN: "t", KEY_IP: "1.2.3.4"}
+
+			res, err := limiter.Allow(context.Background(), "v1", keys)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Allowed).To(BeTrue())
+			Expect(res.Limit).To(Equal(2))
+			Expect(res.Remaining).To(Equal(1))
+
+			limiter.Allow(context.Background(), "v1", keys)
+
+			res, _ = limiter.Allow(context.Background(), "v1", keys)
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Limit).To(Equal(2))
+
+			Expect(recorder.Counter(REJECTED_METRIC, metrics.Tags{"group": "v1", "key": KEY_TOKEN, "algorithm": TOKEN_BUCKET})).To(Equal(int64(1)))
+		})
+
+		It("should skip rules whose key is missing", func() {
+			res, err := limiter.Allow(context.Background(), "v1", map[string]string{KEY_IP: "1.2.3.4"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Limit).To(Equal(3))
+
+			res, err = limiter.Allow(context.Background(), "v1", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(BeNil())
+		})
+
+		It("should share the budget of rules for every group", func() {
+			keys := map[string]string{KEY_IP: "1.2.3.4"}
+
+			limiter.Allow(context.Background(), "v1", keys)
+			limiter.Allow(context.Background(), "admin", keys)
+
+			Expect(store.keys[0]).To(Equal(store.keys[1]))
+		})
+
+		It("should return store errors", func() {
+			store.err = errors.New("boom")
+
+			res, err := limiter.Allow(context.Background(), "v1", map[string]string{KEY_TOKEN: "t"})
+			Expect(err).To(HaveOccurred())
+			Expect(res).To(BeNil())
+			Expect(recorder.Counter(ERRORS_METRIC, metrics.Tags{"group": "v1"})).To(Equal(int64(1)))
+		})
+	})
+})
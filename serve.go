@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dfraglabs/go-microservice-1/api"
+	"github.com/dfraglabs/go-microservice-1/config"
+	"github.com/dfraglabs/go-microservice-1/deps"
+)
+
+// runAPI serves the API until ctx is done; with
+// GO_MICROSERVICE_1_WORKER_IN_PROCESS, jobs are run alongside it (and both
+// shut down together)
+func runAPI(ctx context.Context, cfg *config.Config, d *deps.Dependencies) error {
+	if !cfg.WorkerInProcess {
+		return api.New(cfg, d, version).Run(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workerDone := make(chan error, 1)
+	go func() {
+		workerDone <- d.NewWorker(cfg).Run(ctx)
+	}()
+
+	err := api.New(cfg, d, version).Run(ctx)
+
+	// The API may have failed on its own
+	cancel()
+
+	if werr := <-workerDone; err == nil {
+		err = werr
+	}
+
+	return err
+}
+
+// runScheduler runs the scheduled tasks in the background unless
+// GO_MICROSERVICE_1_SCHEDULER_ENABLED is false; the returned chan is closed
+// once they stopped (after ctx is done)
+func runScheduler(ctx context.Context, cfg *config.Config, d *deps.Dependencies) <-chan struct{} {
+	done := make(chan struct{})
+
+	if !cfg.SchedulerEnabled {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+
+		if err := d.Scheduler.Run(ctx); err != nil {
+			logrus.WithError(err).Error("Scheduler stopped")
+		}
+	}()
+
+	return done
+}
+
+// runPubSub receives cache invalidations in the background; the returned
+// chan is closed once it stopped (after ctx is done)
+func runPubSub(ctx context.Context, d *deps.Dependencies) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if err := d.RunPubSub(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Error("Pubsub stopped")
+		}
+	}()
+
+	return done
+}
+
+// runEventRelay publishes recorded domain events in the background (on the
+// elected replica); the returned chan is closed once it stopped (after ctx
+// is done)
+func runEventRelay(ctx context.Context, d *deps.Dependencies) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if err := d.RunEventRelay(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Error("Event relay stopped")
+		}
+	}()
+
+	return done
+}
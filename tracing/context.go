@@ -0,0 +1,170 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	TRACEPARENT_HEADER = "traceparent"
+	TRACESTATE_HEADER  = "tracestate"
+
+	traceparentVersion = "00"
+	flagSampled        = 0x01
+)
+
+var (
+	zeroTraceID = TraceID{}
+	zeroSpanID  = SpanID{}
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsValid() bool { return t != zeroTraceID }
+func (s SpanID) IsValid() bool  { return s != zeroSpanID }
+
+// SpanContext is the part of a span that is propagated across process
+// boundaries via the W3C `traceparent` and `tracestate` headers.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+func (s SpanContext) IsValid() bool {
+	return s.TraceID.IsValid() && s.SpanID.IsValid()
+}
+
+// Traceparent formats the span context as a W3C traceparent header value
+func (s SpanContext) Traceparent() string {
+	var flags byte
+	if s.Sampled {
+		flags |= flagSampled
+	}
+
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, s.TraceID, s.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value
+func ParseTraceparent(value string) (SpanContext, error) {
+	sc := SpanContext{}
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return sc, errors.New("traceparent must have 4 fields")
+	}
+
+	version := parts[0]
+	if len(version) != 2 || version == "ff" {
+		return sc, fmt.Errorf("invalid traceparent version '%s'", version)
+	}
+
+	// Version 00 must have exactly 4 fields; future versions may append more
+	if version == traceparentVersion && len(parts) != 4 {
+		return sc, errors.New("traceparent version 00 must have exactly 4 fields")
+	}
+
+	if err := decodeHex(parts[1], sc.TraceID[:]); err != nil || !sc.TraceID.IsValid() {
+		return sc, fmt.Errorf("invalid trace id '%s'", parts[1])
+	}
+
+	if err := decodeHex(parts[2], sc.SpanID[:]); err != nil || !sc.SpanID.IsValid() {
+		return sc, fmt.Errorf("invalid parent id '%s'", parts[2])
+	}
+
+	flags := make([]byte, 1)
+	if err := decodeHex(parts[3], flags); err != nil {
+		return sc, fmt.Errorf("invalid trace flags '%s'", parts[3])
+	}
+
+	sc.Sampled = flags[0]&flagSampled == flagSampled
+
+	return sc, nil
+}
+
+// decodeHex only accepts lowercase hex of exactly the right length
+func decodeHex(s string, dst []byte) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return errors.New("bad length or case")
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+
+	return err
+}
+
+// Extract reads the span context from the W3C headers; the second return
+// value is false when there is no (valid) traceparent.
+func Extract(h http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceparent(h.Get(TRACEPARENT_HEADER))
+	if err != nil {
+		return SpanContext{}, false
+	}
+
+	sc.TraceState = h.Get(TRACESTATE_HEADER)
+
+	return sc, true
+}
+
+// Inject writes the span context into the W3C headers
+func Inject(sc SpanContext, h http.Header) {
+	if !sc.IsValid() {
+		return
+	}
+
+	h.Set(TRACEPARENT_HEADER, sc.Traceparent())
+
+	if sc.TraceState != "" {
+		h.Set(TRACESTATE_HEADER, sc.TraceState)
+	}
+}
+
+/*****************
+ Context
+*****************/
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the active span carried by ctx (if any)
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+
+	span, _ := ctx.Value(spanKey{}).(*Span)
+
+	return span
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	for !t.IsValid() {
+		rand.Read(t[:])
+	}
+
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	for !s.IsValid() {
+		rand.Read(s[:])
+	}
+
+	return s
+}
@@ -0,0 +1,386 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EXPORTER_NONE   = "none"
+	EXPORTER_STDOUT = "stdout"
+	EXPORTER_FILE   = "file"
+	EXPORTER_OTLP   = "otlp"
+
+	OTLP_TRACES_PATH = "/v1/traces"
+)
+
+// IExporter ships finished (sampled) spans somewhere
+type IExporter interface {
+	Export(span *Span)
+	Shutdown(timeout time.Duration) error
+}
+
+/*****************
+ Noop
+*****************/
+
+type NoopExporter struct{}
+
+func NewNoopExporter() *NoopExporter {
+	return &NoopExporter{}
+}
+
+func (n *NoopExporter) Export(span *Span)                    {}
+func (n *NoopExporter) Shutdown(timeout time.Duration) error { return nil }
+
+/*****************
+ JSON lines
+*****************/
+
+// JSONExporter writes every span as a single JSON document per line
+type JSONExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{
+		enc: json.NewEncoder(w),
+	}
+}
+
+type jsonSpan struct {
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         string                 `json:"kind"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	DurationMs   float64                `json:"duration_ms"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Status       string                 `json:"status"`
+	StatusMsg    string                 `json:"status_message,omitempty"`
+}
+
+func (j *JSONExporter) Export(span *Span) {
+	js := jsonSpan{
+		TraceID:    span.Context.TraceID.String(),
+		SpanID:     span.Context.SpanID.String(),
+		Name:       span.Name,
+		Kind:       span.Kind,
+		Start:      span.Start,
+		End:        span.End,
+		DurationMs: float64(span.Duration()) / float64(time.Millisecond),
+		Attributes: span.Attributes,
+		Status:     span.Status,
+		StatusMsg:  span.StatusMsg,
+	}
+
+	if span.ParentSpanID.IsValid() {
+		js.ParentSpanID = span.ParentSpanID.String()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.enc.Encode(js); err != nil {
+		log.Debugf("Unable to export span: %v", err)
+	}
+}
+
+// Shutdown is a noop; every span is written out as soon as it is exported
+func (j *JSONExporter) Shutdown(timeout time.Duration) error {
+	return nil
+}
+
+/*****************
+ OTLP/HTTP (JSON)
+*****************/
+
+type OTLPConfig struct {
+	// Endpoint is the collector base URL (ie. http://localhost:4318)
+	Endpoint    string
+	ServiceName string
+
+	// Spans are sent once BatchSize is reached or every FlushInterval
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// QueueSize bounds the number of spans waiting to be sent; spans are
+	// dropped (rather than blocking requests) once it is full
+	QueueSize int
+}
+
+// OTLPExporter batches spans and POSTs them to an OpenTelemetry collector
+// using the OTLP/HTTP JSON encoding.
+type OTLPExporter struct {
+	cfg        *OTLPConfig
+	url        string
+	httpClient *http.Client
+
+	queue chan *Span
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+func NewOTLPExporter(cfg *OTLPConfig) *OTLPExporter {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 2048
+	}
+
+	o := &OTLPExporter{
+		cfg:        cfg,
+		url:        strings.TrimRight(cfg.Endpoint, "/") + OTLP_TRACES_PATH,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		queue:      make(chan *Span, cfg.QueueSize),
+		done:       make(chan struct{}),
+	}
+
+	o.wg.Add(1)
+	go o.run()
+
+	return o
+}
+
+func (o *OTLPExporter) Export(span *Span) {
+	select {
+	case o.queue <- span:
+	default:
+		log.Debug("OTLP export queue is full; dropping span")
+	}
+}
+
+// Shutdown flushes whatever is queued and stops the background sender
+func (o *OTLPExporter) Shutdown(timeout time.Duration) error {
+	o.once.Do(func() { close(o.done) })
+
+	finished := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %v waiting for spans to be sent", timeout)
+	}
+}
+
+func (o *OTLPExporter) run() {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(o.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, o.cfg.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := o.send(batch); err != nil {
+			log.Warnf("Unable to send %d spans to OTLP collector: %v", len(batch), err)
+		}
+
+		batch = make([]*Span, 0, o.cfg.BatchSize)
+	}
+
+	for {
+		select {
+		case span := <-o.queue:
+			batch = append(batch, span)
+			if len(batch) >= o.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-o.done:
+			// drain anything left in the queue
+			for {
+				select {
+				case span := <-o.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (o *OTLPExporter) send(spans []*Span) error {
+	body, err := json.Marshal(o.payload(spans))
+	if err != nil {
+		return fmt.Errorf("unable to marshal spans: %v", err)
+	}
+
+	resp, err := o.httpClient.Post(o.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// The subset of the OTLP trace JSON encoding that we need
+type otlpPayload struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (o *OTLPExporter) payload(spans []*Span) *otlpPayload {
+	out := make([]otlpSpan, 0, len(spans))
+
+	for _, s := range spans {
+		ospan := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			TraceState:        s.Context.TraceState,
+			Name:              s.Name,
+			Kind:              otlpKind(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: otlpStatusCode(s.Status), Message: s.StatusMsg},
+		}
+
+		if s.ParentSpanID.IsValid() {
+			ospan.ParentSpanID = s.ParentSpanID.String()
+		}
+
+		out = append(out, ospan)
+	}
+
+	return &otlpPayload{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: otlpAttributes(map[string]interface{}{"service.name": o.cfg.ServiceName}),
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: o.cfg.ServiceName},
+						Spans: out,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+
+	for k, v := range attrs {
+		var value map[string]interface{}
+
+		switch tv := v.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": tv}
+		case bool:
+			value = map[string]interface{}{"boolValue": tv}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(tv)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(tv, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": tv}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprintf("%v", tv)}
+		}
+
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: value})
+	}
+
+	return kvs
+}
+
+func otlpKind(kind string) int {
+	switch kind {
+	case SPAN_KIND_INTERNAL:
+		return 1
+	case SPAN_KIND_SERVER:
+		return 2
+	case SPAN_KIND_CLIENT:
+		return 3
+	}
+
+	return 0
+}
+
+func otlpStatusCode(status string) int {
+	switch status {
+	case STATUS_OK:
+		return 1
+	case STATUS_ERROR:
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	SPAN_KIND_INTERNAL = "internal"
+	SPAN_KIND_SERVER   = "server"
+	SPAN_KIND_CLIENT   = "client"
+
+	STATUS_UNSET = "unset"
+	STATUS_OK    = "ok"
+	STATUS_ERROR = "error"
+)
+
+// Span is a single timed operation within a trace
+type Span struct {
+	Context      SpanContext
+	ParentSpanID SpanID
+	Name         string
+	Kind         string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Status       string
+	StatusMsg    string
+
+	tracer *Tracer
+	mu     sync.Mutex
+	ended  bool
+}
+
+// SetAttribute attaches a key/value pair to the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Status = STATUS_ERROR
+	s.StatusMsg = err.Error()
+}
+
+// SetStatus sets the span status (STATUS_OK or STATUS_ERROR)
+func (s *Span) SetStatus(status, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Status = status
+	s.StatusMsg = msg
+}
+
+// Finish ends the span and hands it to the exporter (if sampled). Calling it
+// more than once has no effect.
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if s.Context.Sampled && s.tracer != nil {
+		s.tracer.exporter.Export(s)
+	}
+}
+
+// Duration returns how long the span took (0 until finished)
+func (s *Span) Duration() time.Duration {
+	if s.End.IsZero() {
+		return 0
+	}
+
+	return s.End.Sub(s.Start)
+}
@@ -0,0 +1,204 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dfraglabs/go-microservice-1/apm"
+	"github.com/dfraglabs/go-microservice-1/metrics"
+)
+
+var log = logrus.WithField("pkg", "tracing")
+
+type Config struct {
+	// ServiceName is reported as the `service.name` resource attribute
+	ServiceName string
+
+	// SampleRate is the fraction [0, 1] of new (root) traces that are sampled
+	SampleRate float64
+
+	// IgnoreParentSampling makes the tracer apply SampleRate to every trace
+	// rather than honoring the sampled flag of an inbound traceparent
+	IgnoreParentSampling bool
+
+	Exporter IExporter
+}
+
+// Tracer creates spans, propagates them via the W3C trace context headers
+// and hands finished spans to an exporter. It implements apm.ITracer so it
+// can be plugged in next to (or instead of) New Relic.
+type Tracer struct {
+	serviceName          string
+	sampleRate           float64
+	ignoreParentSampling bool
+	exporter             IExporter
+}
+
+func New(cfg *Config) *Tracer {
+	exporter := cfg.Exporter
+	if exporter == nil {
+		exporter = NewNoopExporter()
+	}
+
+	rate := math.Max(0, math.Min(1, cfg.SampleRate))
+
+	return &Tracer{
+		serviceName:          cfg.ServiceName,
+		sampleRate:           rate,
+		ignoreParentSampling: cfg.IgnoreParentSampling,
+		exporter:             exporter,
+	}
+}
+
+// StartSpan starts a new span as a child of the span carried in ctx (or as a
+// new trace root) and returns a context carrying the new span.
+func (t *Tracer) StartSpan(ctx context.Context, name, kind string) (context.Context, *Span) {
+	var parent SpanContext
+	if p := SpanFromContext(ctx); p != nil {
+		parent = p.Context
+	}
+
+	span := t.newSpan(parent, name, kind)
+
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) newSpan(parent SpanContext, name, kind string) *Span {
+	sc := SpanContext{
+		SpanID: newSpanID(),
+	}
+
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.TraceState = parent.TraceState
+		sc.Sampled = parent.Sampled
+
+		if t.ignoreParentSampling {
+			sc.Sampled = t.sample(sc.TraceID)
+		}
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Sampled = t.sample(sc.TraceID)
+	}
+
+	return &Span{
+		Context:      sc,
+		ParentSpanID: parent.SpanID,
+		Name:         name,
+		Kind:         kind,
+		Start:        time.Now(),
+		Attributes:   map[string]interface{}{},
+		Status:       STATUS_UNSET,
+		tracer:       t,
+	}
+}
+
+// sample decides based on the trace id so that every service using the same
+// rate makes the same decision for a given trace
+func (t *Tracer) sample(id TraceID) bool {
+	switch {
+	case t.sampleRate >= 1:
+		return true
+	case t.sampleRate <= 0:
+		return false
+	}
+
+	bound := uint64(t.sampleRate * float64(math.MaxUint64))
+
+	return binary.BigEndian.Uint64(id[8:]) < bound
+}
+
+// WrapHandle starts a server span per request, continuing the trace from an
+// inbound traceparent header when present.
+func (t *Tracer) WrapHandle(pattern string, handler http.Handler) (string, http.Handler) {
+	return pattern, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		parent, _ := Extract(r.Header)
+
+		span := t.newSpan(parent, r.Method+" "+pattern, SPAN_KIND_SERVER)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", pattern)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		defer span.Finish()
+
+		sr := metrics.NewStatusRecorder(rw)
+		handler.ServeHTTP(sr, r.WithContext(ContextWithSpan(r.Context(), span)))
+
+		span.SetAttribute("http.status_code", sr.Status())
+
+		if sr.Status() >= http.StatusInternalServerError {
+			span.SetStatus(STATUS_ERROR, http.StatusText(sr.Status()))
+		}
+	})
+}
+
+// StartExternalSegment starts a client span and injects its context into
+// the outbound request headers
+func (t *Tracer) StartExternalSegment(ctx context.Context, req *http.Request) apm.IExternalSegment {
+	_, span := t.StartSpan(ctx, "HTTP "+req.Method, SPAN_KIND_CLIENT)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.String())
+
+	Inject(span.Context, req.Header)
+
+	return &externalSegment{span}
+}
+
+func (t *Tracer) StartDatastoreSegment(ctx context.Context, ds apm.Datastore) apm.ISegment {
+	_, span := t.StartSpan(ctx, fmt.Sprintf("%s %s.%s", ds.Product, ds.Collection, ds.Operation), SPAN_KIND_CLIENT)
+	span.SetAttribute("db.system", ds.Product)
+	span.SetAttribute("db.name", ds.Database)
+	span.SetAttribute("db.collection", ds.Collection)
+	span.SetAttribute("db.operation", ds.Operation)
+
+	if ds.Statement != "" {
+		span.SetAttribute("db.statement", ds.Statement)
+	}
+
+	return &datastoreSegment{span}
+}
+
+func (t *Tracer) Enabled() bool {
+	return true
+}
+
+func (t *Tracer) Shutdown(timeout time.Duration) {
+	if err := t.exporter.Shutdown(timeout); err != nil {
+		log.Warnf("Unable to flush spans on shutdown: %v", err)
+	}
+}
+
+type externalSegment struct {
+	span *Span
+}
+
+func (e *externalSegment) End(resp *http.Response) {
+	switch {
+	case resp == nil:
+		e.span.SetStatus(STATUS_ERROR, "no response")
+	case resp.StatusCode >= http.StatusInternalServerError:
+		e.span.SetAttribute("http.status_code", resp.StatusCode)
+		e.span.SetStatus(STATUS_ERROR, http.StatusText(resp.StatusCode))
+	default:
+		e.span.SetAttribute("http.status_code", resp.StatusCode)
+	}
+
+	e.span.Finish()
+}
+
+type datastoreSegment struct {
+	span *Span
+}
+
+func (d *datastoreSegment) SetError(err error) {
+	d.span.SetError(err)
+}
+
+func (d *datastoreSegment) End() {
+	d.span.Finish()
+}
@@ -0,0 +1,195 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dfraglabs/go-microservice-1/apm"
+)
+
+type memExporter struct {
+	spans []*Span
+}
+
+func (m *memExporter) Export(span *Span)                    { m.spans = append(m.spans, span) }
+func (m *memExporter) Shutdown(timeout time.Duration) error { return nil }
+
+var _ = Describe("tracing", func() {
+	const (
+		inboundTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	)
+
+	Describe("ParseTraceparent", func() {
+		It("should parse a valid header", func() {
+			sc, err := ParseTraceparent(inboundTraceparent)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sc.TraceID.String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			Expect(sc.SpanID.String()).To(Equal("00f067aa0ba902b7"))
+			Expect(sc.Sampled).To(BeTrue())
+			Expect(sc.Traceparent()).To(Equal(inboundTraceparent))
+		})
+
+		It("should reject invalid headers", func() {
+			for _, v := range []string{
+				"",
+				"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+				"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+				"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+				"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+				"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			} {
+				_, err := ParseTraceparent(v)
+				Expect(err).To(HaveOccurred(), v)
+			}
+		})
+
+		It("should accept future versions with extra fields", func() {
+			_, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Describe("Tracer", func() {
+		var (
+			exporter *memExporter
+			tracer   *Tracer
+		)
+
+		BeforeEach(func() {
+			exporter = &memExporter{}
+			tracer = New(&Config{ServiceName: "test", SampleRate: 1, Exporter: exporter})
+		})
+
+		Context("when a request carries a traceparent", func() {
+			It("should continue the trace and propagate it to outbound calls", func() {
+				var outbound *http.Request
+
+				_, h := tracer.WrapHandle("/v1/bars/{id}", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					tracer.StartDatastoreSegment(r.Context(), apm.Datastore{Product: "MongoDB", Collection: "foo", Operation: "find"}).End()
+
+					outbound = httptest.NewRequest("GET", "http://foo-api/bars/1", nil)
+					tracer.StartExternalSegment(r.Context(), outbound).End(&http.Response{StatusCode: 200})
+				}))
+
+				req := httptest.NewRequest("GET", "/v1/bars/1", nil)
+				req.Header.Set(TRACEPARENT_HEADER, inboundTraceparent)
+				req.Header.Set(TRACESTATE_HEADER, "vendor=value")
+				h.ServeHTTP(httptest.NewRecorder(), req)
+
+				Expect(exporter.spans).To(HaveLen(3))
+
+				server := exporter.spans[2]
+				Expect(server.Kind).To(Equal(SPAN_KIND_SERVER))
+				Expect(server.Name).To(Equal("GET /v1/bars/{id}"))
+				Expect(server.Context.TraceID.String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+				Expect(server.ParentSpanID.String()).To(Equal("00f067aa0ba902b7"))
+				Expect(server.Attributes["http.status_code"]).To(Equal(200))
+
+				for _, child := range exporter.spans[:2] {
+					Expect(child.Context.TraceID).To(Equal(server.Context.TraceID))
+					Expect(child.ParentSpanID).To(Equal(server.Context.SpanID))
+				}
+
+				sc, ok := Extract(outbound.Header)
+				Expect(ok).To(BeTrue())
+				Expect(sc.TraceID).To(Equal(server.Context.TraceID))
+				Expect(sc.SpanID).To(Equal(exporter.spans[1].Context.SpanID))
+				Expect(sc.TraceState).To(Equal("vendor=value"))
+			})
+		})
+
+		Context("when the inbound trace is not sampled", func() {
+			It("should not export spans but still propagate", func() {
+				ctx := ContextWithSpan(context.Background(), &Span{Context: SpanContext{TraceID: newTraceID(), SpanID: newSpanID()}})
+
+				out := httptest.NewRequest("GET", "http://foo-api/bars/1", nil)
+				tracer.StartExternalSegment(ctx, out).End(nil)
+
+				Expect(exporter.spans).To(BeEmpty())
+				Expect(out.Header.Get(TRACEPARENT_HEADER)).To(HaveSuffix("-00"))
+			})
+		})
+
+		Context("with a sample rate of 0", func() {
+			It("should not sample new traces", func() {
+				tracer = New(&Config{SampleRate: 0, Exporter: exporter})
+
+				_, span := tracer.StartSpan(context.Background(), "op", SPAN_KIND_INTERNAL)
+				span.Finish()
+
+				Expect(span.Context.Sampled).To(BeFalse())
+				Expect(exporter.spans).To(BeEmpty())
+			})
+		})
+
+		Context("when a span is finished more than once", func() {
+			It("should only be exported once", func() {
+				_, span := tracer.StartSpan(context.Background(), "op", SPAN_KIND_INTERNAL)
+				span.Finish()
+				span.Finish()
+
+				Expect(exporter.spans).To(HaveLen(1))
+			})
+		})
+	})
+
+	Describe("JSONExporter", func() {
+		It("should write one JSON document per span", func() {
+			buf := &bytes.Buffer{}
+			tracer := New(&Config{SampleRate: 1, Exporter: NewJSONExporter(buf)})
+
+			_, span := tracer.StartSpan(context.Background(), "one", SPAN_KIND_INTERNAL)
+			span.Finish()
+			_, span = tracer.StartSpan(context.Background(), "two", SPAN_KIND_INTERNAL)
+			span.Finish()
+
+			lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+			Expect(lines).To(HaveLen(2))
+
+			doc := map[string]interface{}{}
+			Expect(json.Unmarshal(lines[1], &doc)).To(Succeed())
+			Expect(doc["name"]).To(Equal("two"))
+			Expect(doc["trace_id"]).To(HaveLen(32))
+		})
+	})
+
+	Describe("OTLPExporter", func() {
+		It("should POST batched spans to the collector on shutdown", func() {
+			bodies := make(chan []byte, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal(OTLP_TRACES_PATH))
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies <- b
+			}))
+			defer srv.Close()
+
+			exporter := NewOTLPExporter(&OTLPConfig{Endpoint: srv.URL, ServiceName: "svc", FlushInterval: time.Hour})
+			tracer := New(&Config{SampleRate: 1, Exporter: exporter})
+
+			_, span := tracer.StartSpan(context.Background(), "op", SPAN_KIND_SERVER)
+			span.SetAttribute("count", 2)
+			span.Finish()
+
+			Expect(exporter.Shutdown(time.Second)).To(Succeed())
+
+			payload := &otlpPayload{}
+			Expect(json.Unmarshal(<-bodies, payload)).To(Succeed())
+			Expect(payload.ResourceSpans).To(HaveLen(1))
+
+			spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Name).To(Equal("op"))
+			Expect(spans[0].Kind).To(Equal(2))
+			Expect(spans[0].TraceID).To(Equal(span.Context.TraceID.String()))
+		})
+	})
+})
@@ -16,6 +16,7 @@ type TokenSigningErr TypedErr
 //DB
 type DuplicateKeyErr TypedErr
 type KeyNotFoundErr TypedErr
+type VersionConflictErr TypedErr
 
 //Auth
 type InvalidPasswordErr TypedErr
@@ -40,6 +41,7 @@ func (e SNSPublishErr) Error() string         { return e.E.Error() }
 func (e TokenSigningErr) Error() string       { return e.E.Error() }
 func (e DuplicateKeyErr) Error() string       { return e.E.Error() }
 func (e KeyNotFoundErr) Error() string        { return e.E.Error() }
+func (e VersionConflictErr) Error() string    { return e.E.Error() }
 func (e InvalidPasswordErr) Error() string    { return e.E.Error() }
 func (e MissingCredentialsErr) Error() string { return e.E.Error() }
 func (e UserNotFoundErr) Error() string       { return e.E.Error() }